@@ -12,7 +12,8 @@ import (
 type contextualResponse[T any] struct {
 	ctx *gin.Context
 
-	options []HResponseOption
+	options       []HResponseOption
+	continueToken string
 }
 
 func Manifest(ctx *gin.Context) *contextualResponse[manifest.ResourceManifest] {
@@ -29,8 +30,18 @@ func WithContext[T any](ctx *gin.Context) *contextualResponse[T] {
 
 func (c *contextualResponse[T]) WithOptions(options ...HResponseOption) *contextualResponse[T] {
 	return &contextualResponse[T]{
-		ctx:     c.ctx,
-		options: append(c.options, options...),
+		ctx:           c.ctx,
+		options:       append(c.options, options...),
+		continueToken: c.continueToken,
+	}
+}
+
+// WithContinue sets continue token for the next page of results returned by [contextualResponse.List].
+func (c *contextualResponse[T]) WithContinue(continueToken string) *contextualResponse[T] {
+	return &contextualResponse[T]{
+		ctx:           c.ctx,
+		options:       c.options,
+		continueToken: continueToken,
 	}
 }
 
@@ -99,7 +110,7 @@ func (c *contextualResponse[T]) listPage(results []T, total int64) {
 
 	searchParams := RequireSearchQueryParams(c.ctx)
 	// If not the first page: give link to previous
-	if selfURL != nil && searchParams.Page > 0 {
+	if selfURL != nil && searchParams.Page > 0 && searchParams.Continue == "" {
 		relURL := *selfURL
 
 		query := relURL.Query()
@@ -110,7 +121,9 @@ func (c *contextualResponse[T]) listPage(results []T, total int64) {
 	}
 
 	// If not the last page:
-	if selfURL != nil && len(results) > 0 && uint(len(results)) == searchParams.PageSize {
+	if selfURL != nil && c.continueToken != "" {
+		c.options = append(c.options, WithLink("next", continueLink(selfURL, c.continueToken)))
+	} else if selfURL != nil && searchParams.Continue == "" && len(results) > 0 && uint(len(results)) == searchParams.PageSize {
 		relURL := *selfURL
 
 		query := relURL.Query()
@@ -120,5 +133,7 @@ func (c *contextualResponse[T]) listPage(results []T, total int64) {
 		c.options = append(c.options, WithLink("next", manifest.HLink{Reference: relURL.String()}))
 	}
 
-	MarshalResponse(c.ctx, http.StatusOK, NewPaginatedResponse(results, total, searchParams.Pagination, c.options...))
+	response := NewPaginatedResponse(results, total, searchParams.Pagination, c.options...)
+	response.Continue = c.continueToken
+	MarshalResponse(c.ctx, http.StatusOK, response)
 }
@@ -0,0 +1,120 @@
+package bark
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+)
+
+const facetQueryKey = "facetQuery"
+
+type (
+	// FacetParams represents query parameters of requests for numbers of resources per label value or per time bucket,
+	// such as dashboard filters that show `env=prod (412)`. Resources are selected by [SearchParams] of the same request.
+	FacetParams struct {
+		// Facet is a comma-separated list of label keys to count resources by combinations of their values, for example `env,team`.
+		Facet string `uri:"facet" form:"facet" json:"facet,omitempty" yaml:"facet,omitempty" xml:"facet"`
+
+		// Interval is the width of time buckets of a histogram of resources, for example `1h`. See [time.ParseDuration].
+		Interval string `uri:"interval" form:"interval" json:"interval,omitempty" yaml:"interval,omitempty" xml:"interval"`
+	}
+
+	// FacetQuery is a parsed [FacetParams].
+	FacetQuery struct {
+		// Keys are label keys to count resources by. Empty if no facet was requested.
+		Keys []string
+		// Interval is the width of time buckets of a histogram. Zero if no histogram was requested.
+		Interval time.Duration
+	}
+
+	// FacetResponse represents numbers of resources per label value and per time bucket.
+	FacetResponse struct {
+		Facets    []manifest.FacetCount `form:"facets" json:"facets,omitempty" yaml:"facets,omitempty" xml:"facets"`
+		Histogram []manifest.TimeBucket `form:"histogram" json:"histogram,omitempty" yaml:"histogram,omitempty" xml:"histogram"`
+
+		manifest.HResponse `form:",inline" json:",inline" yaml:",inline"`
+	}
+)
+
+// BuildQuery returns a [FacetQuery] if the [FacetParams] are valid: label keys are valid and the interval is at least a second.
+func (p FacetParams) BuildQuery() (FacetQuery, error) {
+	var result FacetQuery
+	for _, key := range strings.Split(p.Facet, ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		if err := manifest.ValidateLabelKey(key); err != nil {
+			return result, fmt.Errorf("invalid facet %q: %w", key, err)
+		}
+
+		result.Keys = append(result.Keys, key)
+	}
+
+	if p.Interval != "" {
+		interval, err := time.ParseDuration(p.Interval)
+		if err != nil {
+			return result, fmt.Errorf("failed to parse 'interval': %w", err)
+		}
+		if interval < time.Second {
+			return result, fmt.Errorf("'interval' %v is shorter than a second", interval)
+		}
+
+		result.Interval = interval
+	}
+
+	return result, nil
+}
+
+// FacetAPI returns middleware to support [FacetParams] query parameters.
+// It is expected to follow [SearchableAPI] middleware, which selects resources to count.
+// See [RequireFacetQuery] on how to obtain [FacetQuery] value in the request handler.
+func FacetAPI() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var facetParams FacetParams
+		if err := ctx.ShouldBindQuery(&facetParams); err != nil {
+			AbortWithError(ctx, http.StatusBadRequest, fmt.Errorf("bad facet query: %w", err))
+			return
+		}
+
+		facetQuery, err := facetParams.BuildQuery()
+		if err != nil {
+			AbortWithError(ctx, http.StatusBadRequest, fmt.Errorf("bad facet query: %w", err))
+			return
+		}
+
+		ctx.Set(facetQueryKey, facetQuery)
+		ctx.Next()
+	}
+}
+
+// RequireFacetQuery returns [FacetQuery] from the call context previously set by [FacetAPI] middleware in the call chain.
+// Note, the function should only be called from a handler that follows after [FacetAPI] middleware in the filter chain.
+func RequireFacetQuery(ctx *gin.Context) FacetQuery {
+	return ctx.MustGet(facetQueryKey).(FacetQuery)
+}
+
+// FoundFacets checks error value and responds with error or with [FacetResponse] of the facets and the histogram.
+func FoundFacets(ctx *gin.Context, err error, facets []manifest.FacetCount, histogram []manifest.TimeBucket, options ...HResponseOption) {
+	if err != nil {
+		AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if ctx.Request.URL != nil {
+		options = append(options, WithLink("self", manifest.HLink{Reference: ctx.Request.URL.String()}))
+	}
+
+	response := FacetResponse{
+		Facets:    facets,
+		Histogram: histogram,
+	}
+	for _, o := range options {
+		o(&response.HResponse)
+	}
+
+	MarshalResponse(ctx, http.StatusOK, response)
+}
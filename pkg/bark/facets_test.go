@@ -0,0 +1,79 @@
+package bark_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/bark"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFacetParams_BuildQuery(t *testing.T) {
+	testCases := map[string]struct {
+		given     bark.FacetParams
+		expect    bark.FacetQuery
+		expectErr bool
+	}{
+		"empty":    {},
+		"keys":     {given: bark.FacetParams{Facet: "env, team"}, expect: bark.FacetQuery{Keys: []string{"env", "team"}}},
+		"interval": {given: bark.FacetParams{Interval: "1h"}, expect: bark.FacetQuery{Interval: time.Hour}},
+		"both": {
+			given:  bark.FacetParams{Facet: "env", Interval: "24h"},
+			expect: bark.FacetQuery{Keys: []string{"env"}, Interval: 24 * time.Hour},
+		},
+		"invalid-key":      {given: bark.FacetParams{Facet: "env,not a key"}, expectErr: true},
+		"invalid-interval": {given: bark.FacetParams{Interval: "hourly"}, expectErr: true},
+		"short-interval":   {given: bark.FacetParams{Interval: "10ms"}, expectErr: true},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := test.given.BuildQuery()
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expect, got)
+		})
+	}
+}
+
+func TestFacetAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	router := gin.New()
+	router.GET("/pets/facets", bark.ContentTypeAPI(), bark.SearchableAPI(10), bark.FacetAPI(), func(ctx *gin.Context) {
+		query := bark.RequireFacetQuery(ctx)
+		require.Equal(t, "kind=cat", bark.RequireSearchQuery(ctx).Selector.String())
+
+		facets := make([]manifest.FacetCount, 0, len(query.Keys))
+		for _, key := range query.Keys {
+			facets = append(facets, manifest.FacetCount{Labels: manifest.Labels{key: "prod"}, Count: 412})
+		}
+		bark.FoundFacets(ctx, nil, facets, []manifest.TimeBucket{{Start: start, Count: 3}})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pets/facets?labels=kind%3Dcat&facet=env&interval=1h", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got bark.FacetResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, []manifest.FacetCount{{Labels: manifest.Labels{"env": "prod"}, Count: 412}}, got.Facets)
+	require.Equal(t, "env=prod (412)", got.Facets[0].String())
+	require.Equal(t, []manifest.TimeBucket{{Start: start, Count: 3}}, got.Histogram)
+	require.Contains(t, got.Links, "self")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pets/facets?labels=kind%3Dcat&interval=soon", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
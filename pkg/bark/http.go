@@ -1,8 +1,10 @@
 package bark
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -38,8 +40,17 @@ const (
 	// HTTPHeaderCacheControl is a standard [header](https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cache-Control) inform client about caching options for the response received
 	HTTPHeaderCacheControl = "Cache-Control"
 
+	// HTTPHeaderIdempotencyKey is a [header](https://datatracker.ietf.org/doc/draft-ietf-httpapi-idempotency-key-header/) identifying a request, so that the receiver can discard repeated deliveries of the same request.
+	HTTPHeaderIdempotencyKey = "Idempotency-Key"
+
 	// MimeTypeJSON is the mime data type for JSON payload.
 	MimeTypeJSON = gin.MIMEJSON
+
+	// MimeTypeTable is the mime data type for JSON encoded tabular representation of resources, see [manifest.Table].
+	MimeTypeTable = "application/vnd.wyrd.table+json"
+
+	// MimeTypeText is the mime data type for plain text payload. Resources are rendered as aligned text table.
+	MimeTypeText = gin.MIMEPlain
 )
 
 var (
@@ -102,6 +113,15 @@ func replyWithAcceptedType(c *gin.Context) (responseHandler, error) {
 			return c.YAML, nil
 		case gin.MIMEXML, gin.MIMEXML2:
 			return c.XML, nil
+		case MimeTypeTable:
+			return replyWithTable(c, func(code int, table manifest.Table) {
+				c.Header(HTTPHeaderContentType, MimeTypeTable)
+				c.JSON(code, table)
+			}), nil
+		case MimeTypeText:
+			return replyWithTable(c, func(code int, table manifest.Table) {
+				c.String(code, table.String())
+			}), nil
 		}
 	}
 
@@ -109,9 +129,10 @@ func replyWithAcceptedType(c *gin.Context) (responseHandler, error) {
 }
 
 // MarshalResponse selects appropriate resource marshaler based on [HTTPHeaderAccept] request header value and marshals response object.
+// Fields of the response object marked as `wyrd:"sensitive"` are redacted, see [manifest.Redact].
 func MarshalResponse(ctx *gin.Context, code int, responseValue any) {
 	marshalResponse := ctx.MustGet(responseMarshalKey).(responseHandler)
-	marshalResponse(code, responseValue)
+	marshalResponse(code, manifest.Redact(responseValue))
 }
 
 // Ok writes HTTP/OK 200 response and marshals response object with [MarshalResponse] function
@@ -136,14 +157,21 @@ func MaybeGotOne(ctx *gin.Context, resource any, exists bool, err error) {
 
 // Found is a shortcut to produce 200/Ok response for paginated data using [NewPaginatedResponse] to wrap items into Pagination frame.
 func Found[T any](ctx *gin.Context, results []T, total int64, options ...HResponseOption) {
+	FoundWithContinue(ctx, results, total, "", options...)
+}
+
+// FoundWithContinue is a shortcut to produce 200/Ok response for paginated data, same as [Found],
+// with continue token for the next page of results, as returned by stores that support keyset pagination.
+// If continue token is not empty, `next` link continues from the token rather than the page number.
+func FoundWithContinue[T any](ctx *gin.Context, results []T, total int64, continueToken string, options ...HResponseOption) {
 	searchParams := RequireSearchQueryParams(ctx)
 
 	if ctx.Request.URL != nil {
 		options = append(options, WithLink("self", manifest.HLink{Reference: ctx.Request.URL.String()}))
 	}
 
-	// If not the first page: give link to previous
-	if searchParams.Page != 0 {
+	// If not the first page: give link to previous. Pages continued from a token can not be navigated back.
+	if searchParams.Page != 0 && searchParams.Continue == "" {
 		relURL := *ctx.Request.URL
 
 		query := relURL.Query()
@@ -154,7 +182,9 @@ func Found[T any](ctx *gin.Context, results []T, total int64, options ...HRespon
 	}
 
 	// If not the last page:
-	if len(results) > 0 && uint(len(results)) == searchParams.PageSize {
+	if continueToken != "" {
+		options = append(options, WithLink("next", continueLink(ctx.Request.URL, continueToken)))
+	} else if searchParams.Continue == "" && len(results) > 0 && uint(len(results)) == searchParams.PageSize {
 		relURL := *ctx.Request.URL
 
 		query := relURL.Query()
@@ -164,7 +194,21 @@ func Found[T any](ctx *gin.Context, results []T, total int64, options ...HRespon
 		options = append(options, WithLink("next", manifest.HLink{Reference: relURL.String()}))
 	}
 
-	MarshalResponse(ctx, http.StatusOK, NewPaginatedResponse(results, total, searchParams.Pagination, options...))
+	response := NewPaginatedResponse(results, total, searchParams.Pagination, options...)
+	response.Continue = continueToken
+	MarshalResponse(ctx, http.StatusOK, response)
+}
+
+// continueLink returns a link to the next page of results continued from the token.
+func continueLink(u *url.URL, continueToken string) manifest.HLink {
+	relURL := *u
+
+	query := relURL.Query()
+	query.Del("page")
+	query.Set("continue", continueToken)
+	relURL.RawQuery = query.Encode()
+
+	return manifest.HLink{Reference: relURL.String()}
 }
 
 // FoundOrNot checks error value and response with error or using [Found] function if no error.
@@ -185,12 +229,18 @@ func ReplyResourceCreated(ctx *gin.Context, id any, resource any) {
 	MarshalResponse(ctx, http.StatusCreated, resource)
 }
 
-// AbortWithError terminates response-handling chain with an error, and returns provided HTTP error response to the client
+// AbortWithError terminates response-handling chain with an error, and returns provided HTTP error response to the client.
+// Errors that carry [manifest.FieldErrors] are reported with [http.StatusUnprocessableEntity] code and per-field details, regardless of the code given.
+// Errors that wrap [manifest.ErrVersionConflict] are reported as [ErrResourceVersionConflict].
 func AbortWithError(ctx *gin.Context, code int, errValue error) {
 	if errValue == nil {
 		ctx.AbortWithStatus(code)
 	} else if apiError, ok := errValue.(*ErrorResponse); ok {
 		ctx.AbortWithStatusJSON(apiError.Code, apiError)
+	} else if errors.Is(errValue, manifest.ErrVersionConflict) {
+		ctx.AbortWithStatusJSON(ErrResourceVersionConflict.Code, ErrResourceVersionConflict)
+	} else if _, ok := manifest.AsFieldErrors(errValue); ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, NewErrorResponse(http.StatusUnprocessableEntity, errValue))
 	} else {
 		ctx.AbortWithStatusJSON(code, NewErrorResponse(code, errValue))
 	}
@@ -226,15 +276,16 @@ func AcceptContentTypeAPI(accept ...string) gin.HandlerFunc {
 }
 
 // SearchableAPI return middleware to support for [SearchQuery] parameter.
-// See [RequireSearchQuery] usage on how to obtain [SearchQuery] value in the request handler
-func SearchableAPI(defaultPaginationLimit uint) gin.HandlerFunc {
+// See [RequireSearchQuery] usage on how to obtain [SearchQuery] value in the request handler.
+// Time range of the query can refer to timeFields, such as custom time fields of a store, or to [manifest.DefaultTimeFields] if none are given.
+func SearchableAPI(defaultPaginationLimit uint, timeFields ...manifest.TimeField) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var searchParams SearchParams
 		if err := ctx.ShouldBindQuery(&searchParams); err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, fmt.Errorf("bad search query: %w", err)))
 		}
 
-		if searchQuery, err := searchParams.BuildQuery(defaultPaginationLimit); err != nil {
+		if searchQuery, err := searchParams.BuildQuery(defaultPaginationLimit, timeFields...); err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, fmt.Errorf("bad search query: %w", err)))
 			return
 		} else {
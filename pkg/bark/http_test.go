@@ -1,8 +1,14 @@
 package bark
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/manifest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,3 +42,92 @@ func TestFilterFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestAbortWithError_FieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := map[string]struct {
+		given        error
+		expectCode   int
+		expectFields int
+	}{
+		"plain-error": {
+			given:      fmt.Errorf("bad request"),
+			expectCode: http.StatusBadRequest,
+		},
+		"field-errors": {
+			given: manifest.FieldErrors{
+				manifest.Required(manifest.NewPath("spec", "host"), ""),
+				manifest.Invalid(manifest.NewPath("metadata", "name"), "Name", "not a DNS name"),
+			},
+			expectCode:   http.StatusUnprocessableEntity,
+			expectFields: 2,
+		},
+		"wrapped-field-errors": {
+			given:        fmt.Errorf("failed to parse manifest body: %w", manifest.ObjectMeta{Name: "Name"}.Validate()),
+			expectCode:   http.StatusUnprocessableEntity,
+			expectFields: 1,
+		},
+		"version-conflict": {
+			given:      fmt.Errorf("%w: pet-1 expected at version 2", manifest.ErrVersionConflict),
+			expectCode: http.StatusConflict,
+		},
+		"syntax-error": {
+			given:      fmt.Errorf("failed to parse manifest body: %w", (&manifest.ResourceManifest{}).UnmarshalJSON([]byte(`{"kind":`))),
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+
+			AbortWithError(ctx, http.StatusBadRequest, test.given)
+			require.Equal(t, test.expectCode, w.Code)
+
+			var got ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			require.Equal(t, test.expectCode, got.Code)
+			require.Len(t, got.Fields, test.expectFields)
+		})
+	}
+}
+
+func TestRevisionAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := map[string]struct {
+		givenPath  string
+		expectCode int
+		expect     manifest.VersionedResourceID
+	}{
+		"revision": {
+			givenPath:  "/pets/fluffy/revisions/3",
+			expectCode: http.StatusOK,
+			expect:     manifest.NewVersionedID("fluffy", 3),
+		},
+		"not-a-version": {
+			givenPath:  "/pets/fluffy/revisions/latest",
+			expectCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			var got manifest.VersionedResourceID
+			router := gin.New()
+			router.GET("/pets/:id/revisions/:version", ResourceAPI(), RevisionAPI(), func(ctx *gin.Context) {
+				got = RequireVersionedResource(ctx)
+				ctx.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.givenPath, nil))
+			require.Equal(t, test.expectCode, w.Code)
+			require.Equal(t, test.expect, got)
+		})
+	}
+}
@@ -116,6 +116,27 @@ func VersionedResourceAPI() gin.HandlerFunc {
 	}
 }
 
+// RevisionAPI returns middleware that reads resource version from the request path, as in `/artifacts/:id/revisions/:version`,
+// to serve revisions of a resource recorded by a store that keeps revision history, such as dbstore.DBStore.
+// Same as [VersionedResourceAPI], it makes [VersionedResourceID] available with [RequireVersionedResource]
+// if it follows [ResourceAPI] middleware in the call chain.
+func RevisionAPI() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var versionInfo VersionQuery
+		if err := ctx.ShouldBindUri(&versionInfo); err != nil {
+			AbortWithError(ctx, http.StatusNotFound, err)
+			return
+		}
+
+		if resourceID, ok := ctx.Get(resourceIDKey); ok {
+			ctx.Set(versionedIDKey, manifest.NewVersionedID(manifest.ResourceID(resourceID.(ResourceRequest).ID), versionInfo.Version))
+		}
+
+		ctx.Set(versionInfoKey, versionInfo)
+		ctx.Next()
+	}
+}
+
 // RequireVersionedResource is a helper function to extract [manifest.VersionedResourceID] from the call context.
 // Note, it must be called only from a handler that follows after [VersionedResourceAPI] middleware in the call-chain.
 func RequireVersionedResource(ctx *gin.Context) manifest.VersionedResourceID {
@@ -0,0 +1,74 @@
+package bark_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/bark"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoundWithContinue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/items", bark.ContentTypeAPI(), bark.SearchableAPI(2), func(ctx *gin.Context) {
+		query := bark.RequireSearchQuery(ctx)
+		next := ""
+		if query.Continue == "" {
+			next = "token-1"
+		}
+		bark.FoundWithContinue(ctx, []string{"a", "b"}, 3, next)
+	})
+
+	testCases := map[string]struct {
+		path string
+
+		expectContinue string
+		expectNext     url.Values
+		expectPrev     bool
+	}{
+		"first-page": {
+			path:           "/items?labels=env%3Dprod",
+			expectContinue: "token-1",
+			expectNext:     url.Values{"labels": {"env=prod"}, "continue": {"token-1"}},
+		},
+		"continued-from-page": {
+			path:           "/items?page=1",
+			expectContinue: "token-1",
+			expectNext:     url.Values{"continue": {"token-1"}},
+			expectPrev:     true,
+		},
+		"last-page": {
+			path: "/items?continue=token-1&page=1",
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var got bark.PaginatedResponse[string]
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			require.Equal(t, test.expectContinue, got.Continue)
+
+			_, hasPrev := got.Links["prev"]
+			require.Equal(t, test.expectPrev, hasPrev)
+
+			next, hasNext := got.Links["next"]
+			require.Equal(t, test.expectNext != nil, hasNext)
+			if hasNext {
+				nextURL, err := url.Parse(next.Reference)
+				require.NoError(t, err)
+				require.Equal(t, test.expectNext, nextURL.Query())
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package bark
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+)
+
+// ErrUnrepresentableQuery error is returned when a search query can not be represented as [SearchParams].
+var ErrUnrepresentableQuery = errors.New("search query can not be represented as search params")
+
+// SearchParamsOf returns [SearchParams] that [SearchParams.BuildQuery] converts back into the given query.
+// Times are represented in RFC3339 format with fractional seconds, preserving them exactly.
+// Search params paginate by page number, thus offset of the query must be a multiple of its limit.
+// Note server clamps the limit to its default pagination limit.
+func SearchParamsOf(q manifest.SearchQuery) (SearchParams, error) {
+	result := SearchParams{
+		Name:     q.Name,
+		Query:    q.Text,
+		Continue: q.Continue,
+		Sort:     q.Sort.String(),
+		Timerange: Timerange{
+			TimeField: string(q.TimeField),
+		},
+		Pagination: Pagination{
+			PageSize: q.Limit,
+		},
+	}
+
+	if q.Selector != nil {
+		result.Filter = q.Selector.String()
+	}
+	if !q.FromTime.IsZero() {
+		result.FromTime = q.FromTime.Format(time.RFC3339Nano)
+	}
+	if !q.TillTime.IsZero() {
+		result.TillTime = q.TillTime.Format(time.RFC3339Nano)
+	}
+
+	if q.Offset > 0 {
+		if q.Limit == 0 || q.Offset%q.Limit != 0 {
+			return result, fmt.Errorf("%w: offset %d is not a multiple of limit %d", ErrUnrepresentableQuery, q.Offset, q.Limit)
+		}
+		result.Page = q.Offset / q.Limit
+	}
+
+	return result, nil
+}
+
+// Values returns URL query parameters representing the search params, as they are bound by [SearchableAPI].
+// Parameters with zero values are omitted.
+func (s SearchParams) Values() url.Values {
+	result := url.Values{}
+	encodeFormValues(result, reflect.ValueOf(s))
+	return result
+}
+
+func encodeFormValues(values url.Values, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if field.Anonymous && (name == "" || name == "-") {
+			encodeFormValues(values, v.Field(i))
+			continue
+		}
+		if !field.IsExported() || name == "" || name == "-" || v.Field(i).IsZero() {
+			continue
+		}
+
+		values.Set(name, fmt.Sprint(v.Field(i).Interface()))
+	}
+}
+
+// ParseSearchParams returns [SearchParams] bound from URL query parameters, same as [SearchableAPI] does.
+func ParseSearchParams(values url.Values) (SearchParams, error) {
+	var result SearchParams
+	err := binding.MapFormWithTag(&result, values, "form")
+	return result, err
+}
+
+// EncodeSearchQuery returns URL query parameters representing the search query, that can be decoded by [DecodeSearchQuery] or [SearchableAPI] middleware.
+// See [SearchParamsOf] for restrictions.
+func EncodeSearchQuery(q manifest.SearchQuery) (url.Values, error) {
+	params, err := SearchParamsOf(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return params.Values(), nil
+}
+
+// DecodeSearchQuery returns a [manifest.SearchQuery] represented by URL query parameters, same as [SearchableAPI] middleware does.
+func DecodeSearchQuery(values url.Values, defaultLimit uint, timeFields ...manifest.TimeField) (manifest.SearchQuery, error) {
+	params, err := ParseSearchParams(values)
+	if err != nil {
+		return manifest.SearchQuery{}, err
+	}
+
+	return params.BuildQuery(defaultLimit, timeFields...)
+}
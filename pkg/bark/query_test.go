@@ -0,0 +1,119 @@
+package bark_test
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/bark"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+const testDefaultLimit = 50
+
+func randomSearchQuery(t *testing.T, rnd *rand.Rand) manifest.SearchQuery {
+	pick := func(values ...string) string {
+		return values[rnd.Intn(len(values))]
+	}
+	randomTime := func() time.Time {
+		if rnd.Intn(4) == 0 {
+			return time.Time{}
+		}
+		return time.Unix(rnd.Int63n(4_000_000_000), rnd.Int63n(int64(time.Second))).UTC()
+	}
+
+	selector, err := manifest.ParseSelector(pick("", "env=prod", "env!=prod,tier", "!legacy", "env in (dev,qa)", "app.k8s.io/name=web,version>2"))
+	require.NoError(t, err)
+
+	sortSpec, err := manifest.ParseSortSpec(pick("", "name", "-metadata.updateTimestamp,name,labels.priority", "-version"))
+	require.NoError(t, err)
+
+	q := manifest.SearchQuery{
+		Selector:  selector,
+		Name:      pick("", "pet", "name with spaces & symbols=?"),
+		Text:      pick("", "fluffy cat", "q=\"quoted\" +words"),
+		FromTime:  randomTime(),
+		TillTime:  randomTime(),
+		TimeField: manifest.TimeField(pick("", "created", "updated", "deleted")),
+		Sort:      sortSpec,
+		Continue:  pick("", "eyJ1IjoiMSJ9", "eyJ1IjoiMSJ9.c2ln"),
+		Limit:     uint(1 + rnd.Intn(testDefaultLimit)),
+	}
+	q.Offset = q.Limit * uint(rnd.Intn(5))
+	if !q.FromTime.IsZero() && !q.TillTime.IsZero() && q.FromTime.After(q.TillTime) {
+		q.FromTime, q.TillTime = q.TillTime, q.FromTime
+	}
+
+	return q
+}
+
+func TestSearchQuery_RoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+
+	// Every field of the query must be covered by generated queries, so that new fields are not forgotten by the encoder
+	covered := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		given := randomSearchQuery(t, rnd)
+
+		v := reflect.ValueOf(given)
+		for f := 0; f < v.NumField(); f++ {
+			if !v.Field(f).IsZero() {
+				covered[v.Type().Field(f).Name] = true
+			}
+		}
+
+		values, err := bark.EncodeSearchQuery(given)
+		require.NoError(t, err)
+
+		got, err := bark.DecodeSearchQuery(values, testDefaultLimit)
+		require.NoError(t, err, "query: %v", values.Encode())
+		require.Equal(t, given, got, "query: %v", values.Encode())
+	}
+
+	queryType := reflect.TypeOf(manifest.SearchQuery{})
+	for f := 0; f < queryType.NumField(); f++ {
+		require.True(t, covered[queryType.Field(f).Name], "field %v is not covered by round trip test", queryType.Field(f).Name)
+	}
+}
+
+func TestSearchQuery_RoundTripServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var got manifest.SearchQuery
+	router := gin.New()
+	router.GET("/items", bark.SearchableAPI(testDefaultLimit), func(ctx *gin.Context) {
+		got = bark.RequireSearchQuery(ctx)
+	})
+
+	rnd := rand.New(rand.NewSource(7))
+	for i := 0; i < 100; i++ {
+		given := randomSearchQuery(t, rnd)
+		values, err := bark.EncodeSearchQuery(given)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?"+values.Encode(), nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, given, got)
+	}
+}
+
+func TestEncodeSearchQuery_Unrepresentable(t *testing.T) {
+	testCases := map[string]manifest.SearchQuery{
+		"offset-without-limit": {Offset: 10},
+		"unaligned-offset":     {Offset: 10, Limit: 3},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			_, err := bark.EncodeSearchQuery(test)
+			require.ErrorIs(t, err, bark.ErrUnrepresentableQuery)
+		})
+	}
+}
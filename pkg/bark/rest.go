@@ -2,6 +2,7 @@ package bark
 
 import (
 	"fmt"
+	"net/http"
 	"runtime/debug"
 	"time"
 
@@ -22,8 +23,10 @@ type (
 	Timerange struct {
 		// FromTime represents start of a time-range when searching for resources with time aspect.
 		FromTime string `uri:"from" form:"from" json:"from,omitempty" yaml:"from,omitempty" xml:"from"`
-		// TillTime represents end of a time-range when searching for resources with time aspect.
+		// TillTime represents end of a time-range when searching for resources with time aspect. The end is not included in the range.
 		TillTime string `uri:"till" form:"till" json:"till,omitempty" yaml:"till,omitempty" xml:"till"`
+		// TimeField selects which timestamp of a resource the range applies to, such as `created` or `updated`. See [manifest.TimeField].
+		TimeField string `uri:"timeField" form:"timeField" json:"timeField,omitempty" yaml:"timeField,omitempty" xml:"timeField"`
 	}
 
 	// SearchParams represents grouping of query parameters commonly used by REST endpoint supporting search
@@ -34,8 +37,17 @@ type (
 		// Name is a fuzzy matched name of the resource to search for.
 		Name string `uri:"name" form:"name" json:"name,omitempty" yaml:"name,omitempty" xml:"name"`
 
+		// Query is a full-text search query, see [manifest.SearchQuery.Text].
+		Query string `uri:"q" form:"q" json:"q,omitempty" yaml:"q,omitempty" xml:"q"`
+
 		// Filter label-based filter to narrow down results.
 		Filter string `uri:"labels" form:"labels" json:"labels,omitempty" yaml:"labels,omitempty" xml:"labels"`
+
+		// Continue is an opaque continue token returned with a previous page of results, see [manifest.SearchQuery.Continue].
+		Continue string `uri:"continue" form:"continue" json:"continue,omitempty" yaml:"continue,omitempty" xml:"continue"`
+
+		// Sort is a comma-separated list of fields to order results by, for example `-metadata.updateTimestamp,name`. See [manifest.ParseSortSpec].
+		Sort string `uri:"sort" form:"sort" json:"sort,omitempty" yaml:"sort,omitempty" xml:"sort"`
 	}
 )
 
@@ -48,6 +60,9 @@ type (
 		Count int   `form:"count" json:"count,omitempty" yaml:"count,omitempty" xml:"count"`
 		Data  []T   `form:"data" json:"data,omitempty" yaml:"data,omitempty" xml:"data"`
 
+		// Continue is an opaque token to request the next page of results with, if the results were paginated by a cursor.
+		Continue string `form:"continue" json:"continue,omitempty" yaml:"continue,omitempty" xml:"continue"`
+
 		manifest.HResponse `form:",inline" json:",inline" yaml:",inline"`
 		Pagination         `form:",inline" json:",inline" yaml:",inline"`
 	}
@@ -60,6 +75,9 @@ type (
 		// Human readable representation of the error, suitable for display
 		Message string
 
+		// Fields lists validation errors of individual fields of a request, if any.
+		Fields manifest.FieldErrors `form:"fields" json:"fields,omitempty" yaml:"fields,omitempty" xml:"fields,omitempty"`
+
 		manifest.HResponse `form:",inline" json:",inline" yaml:",inline"`
 	}
 
@@ -109,6 +127,9 @@ func NewErrorResponse(statusCode int, err error, options ...HResponseOption) (re
 		Code:    statusCode,
 		Message: message,
 	}
+	if fieldErrors, ok := manifest.AsFieldErrors(err); ok {
+		result.Fields = fieldErrors
+	}
 
 	for _, o := range options {
 		o(&result.HResponse)
@@ -117,6 +138,11 @@ func NewErrorResponse(statusCode int, err error, options ...HResponseOption) (re
 	return
 }
 
+// NewValidationErrorResponse returns new [ErrorResponse] object with [http.StatusUnprocessableEntity] code, listing all field errors.
+func NewValidationErrorResponse(errs manifest.FieldErrors, options ...HResponseOption) *ErrorResponse {
+	return NewErrorResponse(http.StatusUnprocessableEntity, errs, options...)
+}
+
 // Error returns string representation of the error to implement error interface for [ErrorResponse] type.
 func (e *ErrorResponse) Error() string {
 	return fmt.Sprintf("%v %s", e.Code, e.Message)
@@ -149,18 +175,33 @@ func (p Pagination) ClampLimit(maxLimit uint) Pagination {
 	return result
 }
 
+// parseTime parses absolute RFC3339 time, with fractional seconds, or any other date and time format supported by anytime, relative to refTime.
+func parseTime(value string, refTime time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	return anytime.Parse(value, refTime)
+}
+
 // BuildQuery returns a [manifest.SearchQuery] query object if the [SearchParams] can be converted to it.
-func (s SearchParams) BuildQuery(defaultLimit uint) (manifest.SearchQuery, error) {
+// Time field must be one of timeFields, or of [manifest.DefaultTimeFields] if none are given, see [manifest.TimeField.Validate].
+func (s SearchParams) BuildQuery(defaultLimit uint, timeFields ...manifest.TimeField) (manifest.SearchQuery, error) {
 	selector, err := manifest.ParseSelector(s.Filter)
 	if err != nil {
 		return manifest.SearchQuery{}, err
 	}
 
+	timeField := manifest.TimeField(s.TimeField)
+	if err := timeField.Validate(timeFields...); err != nil {
+		return manifest.SearchQuery{}, err
+	}
+
 	refTime := time.Now()
 
 	var from time.Time
 	if s.FromTime != "" {
-		t, err := anytime.Parse(s.FromTime, refTime)
+		t, err := parseTime(s.FromTime, refTime)
 		if err != nil {
 			return manifest.SearchQuery{}, fmt.Errorf("failed to parse 'from' date: %w", err)
 		}
@@ -168,7 +209,7 @@ func (s SearchParams) BuildQuery(defaultLimit uint) (manifest.SearchQuery, error
 	}
 	var till time.Time
 	if s.TillTime != "" {
-		t, err := anytime.Parse(s.TillTime, refTime)
+		t, err := parseTime(s.TillTime, refTime)
 		if err != nil {
 			return manifest.SearchQuery{}, fmt.Errorf("failed to parse 'till' date: %w", err)
 		}
@@ -181,13 +222,23 @@ func (s SearchParams) BuildQuery(defaultLimit uint) (manifest.SearchQuery, error
 		}
 	}
 
+	sortSpec, err := manifest.ParseSortSpec(s.Sort)
+	if err != nil {
+		return manifest.SearchQuery{}, err
+	}
+
 	pagination := s.Pagination.ClampLimit(defaultLimit)
 	return manifest.SearchQuery{
 		Selector: selector,
 		Name:     s.Name,
+		Text:     s.Query,
+
+		FromTime:  from,
+		TillTime:  till,
+		TimeField: timeField,
 
-		FromTime: from,
-		TillTime: till,
+		Sort:     sortSpec,
+		Continue: s.Continue,
 
 		Offset: pagination.Offset(),
 		Limit:  pagination.Limit(),
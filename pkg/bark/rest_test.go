@@ -248,6 +248,7 @@ func TestSearchTimeRange(t *testing.T) {
 	testCases := map[string]struct {
 		given                bark.SearchParams
 		givenDefaultPageSize uint
+		givenTimeFields      []manifest.TimeField
 
 		expect      manifest.SearchQuery
 		expectError bool
@@ -293,6 +294,70 @@ func TestSearchTimeRange(t *testing.T) {
 			},
 		},
 
+		"time-range-open-ended-updated": {
+			givenDefaultPageSize: 25,
+			given: bark.SearchParams{
+				Timerange: bark.Timerange{
+					FromTime:  "2024-02-27",
+					TimeField: "updated",
+				},
+			},
+			expect: manifest.SearchQuery{
+				Selector:  emptySelector,
+				FromTime:  time.Date(2024, 02, 27, 0, 0, 0, 0, time.Local),
+				TimeField: manifest.TimeFieldUpdated,
+				Limit:     25,
+			},
+		},
+
+		"unknown-time-field": {
+			given: bark.SearchParams{
+				Timerange: bark.Timerange{
+					FromTime:  "2024-02-27",
+					TimeField: "started",
+				},
+			},
+			expectError: true,
+		},
+		"custom-time-field": {
+			givenDefaultPageSize: 25,
+			givenTimeFields:      []manifest.TimeField{manifest.TimeFieldCreated, "started"},
+			given: bark.SearchParams{
+				Timerange: bark.Timerange{
+					FromTime:  "2024-02-27",
+					TimeField: "started",
+				},
+			},
+			expect: manifest.SearchQuery{
+				Selector:  emptySelector,
+				FromTime:  time.Date(2024, 02, 27, 0, 0, 0, 0, time.Local),
+				TimeField: "started",
+				Limit:     25,
+			},
+		},
+
+		"sort": {
+			givenDefaultPageSize: 25,
+			given: bark.SearchParams{
+				Sort: "-metadata.updateTimestamp,name,labels.priority",
+			},
+			expect: manifest.SearchQuery{
+				Selector: emptySelector,
+				Sort: manifest.SortSpec{
+					{Field: manifest.SortFieldUpdatedAt, Descending: true},
+					{Field: manifest.SortFieldName},
+					{Field: "metadata.labels.priority"},
+				},
+				Limit: 25,
+			},
+		},
+		"invalid-sort": {
+			given: bark.SearchParams{
+				Sort: "name,,-",
+			},
+			expectError: true,
+		},
+
 		"invalid-range-absolute": {
 			givenDefaultPageSize: 25,
 			given: bark.SearchParams{
@@ -308,7 +373,7 @@ func TestSearchTimeRange(t *testing.T) {
 	for name, tc := range testCases {
 		test := tc
 		t.Run(name, func(t *testing.T) {
-			got, err := test.given.BuildQuery(test.givenDefaultPageSize)
+			got, err := test.given.BuildQuery(test.givenDefaultPageSize, test.givenTimeFields...)
 
 			if test.expectError {
 				require.Error(t, err)
@@ -0,0 +1,55 @@
+package bark
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+)
+
+// Functions of a store that keeps revision history of resources, such as methods of dbstore.DBStore with revision history enabled.
+type (
+	// RevisionLister lists revisions of the resource of the type of the model that match the search query.
+	RevisionLister func(ctx context.Context, model any, id manifest.ResourceID, searchQuery manifest.SearchQuery) ([]manifest.Revision, int64, error)
+
+	// RevisionGetter reads the resource as it was at the version into dest.
+	RevisionGetter func(ctx context.Context, dest any, id manifest.ResourceID, version manifest.Version) (bool, error)
+
+	// RevisionRollback saves the resource as it was at the version as a new version, reading the result into model.
+	RevisionRollback func(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version) (bool, error)
+)
+
+// ListRevisions returns a handler of `GET /<resources>/:id/revisions` that responds with a page of revisions of a resource of type T.
+// Note: the handler must follow [ResourceAPI] and [SearchableAPI] middleware in the call chain.
+func ListRevisions[T any](list RevisionLister) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var model T
+		revisions, total, err := list(ctx.Request.Context(), &model, RequireResourceID(ctx), RequireSearchQuery(ctx))
+		FoundOrNot(ctx, err, revisions, total)
+	}
+}
+
+// GetRevision returns a handler of `GET /<resources>/:id/revisions/:version` that responds with a resource of type T as it was at the version.
+// Note: the handler must follow [ResourceAPI] and [RevisionAPI] middleware in the call chain.
+func GetRevision[T any](get RevisionGetter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := RequireVersionedResource(ctx)
+
+		var resource T
+		exists, err := get(ctx.Request.Context(), &resource, id.ID, id.Version)
+		MaybeGotOne(ctx, resource, exists, err)
+	}
+}
+
+// RollbackRevision returns a handler of `POST /<resources>/:id/revisions/:version/rollback` that restores a resource of type T
+// to the version, and responds with the resource as saved.
+// Note: the handler must follow [ResourceAPI] and [RevisionAPI] middleware in the call chain.
+func RollbackRevision[T any](rollback RevisionRollback) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := RequireVersionedResource(ctx)
+
+		var resource T
+		exists, err := rollback(ctx.Request.Context(), &resource, id.ID, id.Version)
+		MaybeGotOne(ctx, resource, exists, err)
+	}
+}
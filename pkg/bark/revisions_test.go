@@ -0,0 +1,111 @@
+package bark_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/bark"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+type revisionSpec struct {
+	Name string `json:"name"`
+}
+
+type revisionModel manifest.ResourceModel[revisionSpec]
+
+// givenRevisions is a fake revision history of resource "fluffy" with versions 1 to 3.
+func givenRevisions() *gin.Engine {
+	history := map[manifest.Version]string{1: "Fluffy", 2: "Mr. Fluffy", 3: "Sir Fluffy"}
+	current := manifest.Version(3)
+
+	get := func(_ context.Context, dest any, id manifest.ResourceID, version manifest.Version) (bool, error) {
+		name, ok := history[version]
+		if id != "fluffy" || !ok {
+			return false, nil
+		}
+
+		*dest.(*revisionModel) = revisionModel{
+			ObjectMeta: manifest.ObjectMeta{UID: id, Version: version},
+			Spec:       revisionSpec{Name: name},
+		}
+		return true, nil
+	}
+	list := func(_ context.Context, model any, id manifest.ResourceID, query manifest.SearchQuery) ([]manifest.Revision, int64, error) {
+		if _, ok := model.(*revisionModel); !ok {
+			return nil, 0, errors.New("unexpected model")
+		}
+
+		var result []manifest.Revision
+		for v := current; v > 0 && uint(len(result)) < query.Limit; v-- {
+			result = append(result, manifest.Revision{VersionedResourceID: manifest.NewVersionedID(id, v)})
+		}
+		return result, int64(current), nil
+	}
+	rollback := func(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version) (bool, error) {
+		if _, ok := history[version]; !ok {
+			return false, errors.New("no such revision")
+		}
+
+		current++
+		history[current] = history[version]
+		return get(ctx, model, id, current)
+	}
+
+	router := gin.New()
+	router.Use(bark.ContentTypeAPI())
+	router.GET("/pets/:id/revisions", bark.ResourceAPI(), bark.SearchableAPI(2), bark.ListRevisions[revisionModel](list))
+	router.GET("/pets/:id/revisions/:version", bark.ResourceAPI(), bark.RevisionAPI(), bark.GetRevision[revisionModel](get))
+	router.POST("/pets/:id/revisions/:version/rollback", bark.ResourceAPI(), bark.RevisionAPI(), bark.RollbackRevision[revisionModel](rollback))
+	return router
+}
+
+func TestRevisionHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(t *testing.T, router *gin.Engine, method, path string, code int, dest any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		require.Equal(t, code, w.Code, w.Body.String())
+		if dest != nil {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), dest))
+		}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		var got bark.PaginatedResponse[manifest.Revision]
+		serve(t, givenRevisions(), http.MethodGet, "/pets/fluffy/revisions", http.StatusOK, &got)
+		require.Equal(t, int64(3), got.Total)
+		require.Equal(t, []manifest.Revision{
+			{VersionedResourceID: manifest.NewVersionedID("fluffy", 3)},
+			{VersionedResourceID: manifest.NewVersionedID("fluffy", 2)},
+		}, got.Data)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		router := givenRevisions()
+
+		var got revisionModel
+		serve(t, router, http.MethodGet, "/pets/fluffy/revisions/2", http.StatusOK, &got)
+		require.Equal(t, "Mr. Fluffy", got.Spec.Name)
+
+		serve(t, router, http.MethodGet, "/pets/fluffy/revisions/7", http.StatusNotFound, nil)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		router := givenRevisions()
+
+		var got revisionModel
+		serve(t, router, http.MethodPost, "/pets/fluffy/revisions/1/rollback", http.StatusOK, &got)
+		require.Equal(t, manifest.Version(4), got.Version)
+		require.Equal(t, "Fluffy", got.Spec.Name)
+
+		serve(t, router, http.MethodPost, "/pets/fluffy/revisions/7/rollback", http.StatusBadRequest, nil)
+	})
+}
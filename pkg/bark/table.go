@@ -0,0 +1,92 @@
+package bark
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+)
+
+// ErrNotTabular error indicates that a response value can not be represented as a [manifest.Table].
+var ErrNotTabular = errors.New("value can not be represented as a table")
+
+// Tabular interface is implemented by response objects that can be represented as a [manifest.Table].
+type Tabular interface {
+	Table() (manifest.Table, error)
+}
+
+func asManifest(value any) (manifest.ResourceManifest, bool) {
+	switch v := value.(type) {
+	case manifest.ResourceManifest:
+		return v, true
+	case *manifest.ResourceManifest:
+		if v != nil {
+			return *v, true
+		}
+	case manifest.Model:
+		return manifest.ResourceManifest{
+			TypeMeta: v.GetTypeMetadata(),
+			Metadata: v.GetMetadata(),
+			Spec:     v.GetSpec(),
+			Status:   v.GetStatus(),
+		}, true
+	}
+
+	return manifest.ResourceManifest{}, false
+}
+
+// TableOf returns a table representation of a response value.
+// Supported values are [manifest.Table], [manifest.ResourceManifest], [manifest.Model], slices of those and values implementing [Tabular].
+// An error wrapping [ErrNotTabular] is returned for any other value.
+func TableOf(value any) (manifest.Table, error) {
+	switch v := value.(type) {
+	case manifest.Table:
+		return v, nil
+	case *manifest.Table:
+		return *v, nil
+	case Tabular:
+		return v.Table()
+	case []manifest.ResourceManifest:
+		return manifest.NewTable(v...)
+	}
+
+	if m, ok := asManifest(value); ok {
+		return manifest.NewTable(m)
+	}
+
+	return manifest.Table{}, fmt.Errorf("%w: %T", ErrNotTabular, value)
+}
+
+// Table returns a table representation of the items in the page.
+// It implements [Tabular] interface for pages of [manifest.ResourceManifest] and [manifest.Model] items.
+func (r PaginatedResponse[T]) Table() (manifest.Table, error) {
+	manifests := make([]manifest.ResourceManifest, 0, len(r.Data))
+	for _, item := range r.Data {
+		m, ok := asManifest(item)
+		if !ok {
+			return manifest.Table{}, fmt.Errorf("%w: %T", ErrNotTabular, item)
+		}
+		manifests = append(manifests, m)
+	}
+
+	return manifest.NewTable(manifests...)
+}
+
+// replyWithTable returns a [responseHandler] that writes a table representation of a response value using given table handler.
+// Responses that can not be represented as a table are written as JSON.
+func replyWithTable(c *gin.Context, writeTable func(code int, table manifest.Table)) responseHandler {
+	return func(code int, obj any) {
+		table, err := TableOf(obj)
+		if errors.Is(err, ErrNotTabular) {
+			c.JSON(code, obj)
+			return
+		} else if err != nil {
+			AbortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeTable(code, table)
+	}
+}
@@ -0,0 +1,81 @@
+package bark_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sre-norns/wyrd/pkg/bark"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentTypeAPI_Table(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	items := []manifest.ResourceManifest{
+		{Metadata: manifest.ObjectMeta{Name: "first"}},
+		{Metadata: manifest.ObjectMeta{Name: "second"}},
+	}
+
+	router := gin.New()
+	router.GET("/items", bark.ContentTypeAPI(), func(ctx *gin.Context) {
+		bark.Ok(ctx, bark.NewPaginatedResponse(items, int64(len(items)), bark.Pagination{}))
+	})
+	router.GET("/status", bark.ContentTypeAPI(), func(ctx *gin.Context) {
+		bark.Ok(ctx, bark.StatusResponse{Ready: true})
+	})
+
+	testCases := map[string]struct {
+		path   string
+		accept string
+
+		expectContentType string
+		expectBody        string
+	}{
+		"json": {
+			path:              "/status",
+			accept:            bark.MimeTypeJSON,
+			expectContentType: "application/json; charset=utf-8",
+			expectBody:        `{"ready":true}`,
+		},
+		"table": {
+			path:              "/items",
+			accept:            bark.MimeTypeTable,
+			expectContentType: bark.MimeTypeTable,
+			expectBody:        `{"kind":"Table","columnDefinitions":[{"name":"Name","type":"string","description":"Name of the resource"},{"name":"Age","type":"date","description":"Time since the resource was created"}],"rows":[{"cells":["first",null]},{"cells":["second",null]}]}`,
+		},
+		"text": {
+			path:              "/items",
+			accept:            bark.MimeTypeText,
+			expectContentType: "text/plain; charset=utf-8",
+			expectBody:        "NAME     AGE\nfirst    <none>\nsecond   <none>\n",
+		},
+		"non-tabular-fallback": {
+			path:              "/status",
+			accept:            bark.MimeTypeTable,
+			expectContentType: "application/json; charset=utf-8",
+			expectBody:        `{"ready":true}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Header.Set(bark.HTTPHeaderAccept, test.accept)
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, test.expectContentType, w.Header().Get(bark.HTTPHeaderContentType))
+			if json.Valid([]byte(test.expectBody)) {
+				require.JSONEq(t, test.expectBody, w.Body.String())
+			} else {
+				require.Equal(t, test.expectBody, w.Body.String())
+			}
+		})
+	}
+}
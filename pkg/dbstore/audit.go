@@ -0,0 +1,742 @@
+package dbstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrAuditNotSupported error is returned by [AuditedStore] when transactions of the underlying store can not record an audit log.
+	ErrAuditNotSupported = errors.New("transaction does not support audit log")
+	// ErrAuditAppendOnly error is returned when modifying or deleting records of the audit log.
+	ErrAuditAppendOnly = errors.New("audit log is append-only")
+)
+
+// AuditOperation is a kind of store mutation recorded in the audit log.
+type AuditOperation string
+
+const (
+	AuditCreate  AuditOperation = "create"
+	AuditUpdate  AuditOperation = "update"
+	AuditDelete  AuditOperation = "delete"
+	AuditRestore AuditOperation = "restore"
+)
+
+// auditSelectableColumns are columns of the audit log that [manifest.SearchQuery.Selector] can select records by.
+var auditSelectableColumns = map[string]string{
+	"principal": "principal",
+	"operation": "operation",
+	"kind":      "kind",
+	"uid":       "uid",
+}
+
+// AuditRecord is a record of the audit log: who changed a resource, how and when.
+type AuditRecord struct {
+	ID uint64 `json:"id" yaml:"id" gorm:"primaryKey;autoIncrement"`
+
+	// Principal is who made the change, see [WithPrincipal].
+	Principal string `json:"principal,omitempty" yaml:"principal,omitempty" gorm:"size:256;index"`
+	// Operation is the kind of the change.
+	Operation AuditOperation `json:"operation" yaml:"operation" gorm:"size:16;not null"`
+
+	// Kind of the changed resource, or the name of its type if the kind is not registered.
+	Kind manifest.Kind `json:"kind" yaml:"kind" gorm:"size:128;index"`
+	// UID of the changed resource.
+	UID manifest.ResourceID `json:"uid" yaml:"uid" gorm:"size:64;index"`
+	// Name of the changed resource.
+	Name manifest.ResourceName `json:"name" yaml:"name"`
+	// Version of the resource after the change, or the deleted version.
+	Version manifest.Version `json:"version" yaml:"version"`
+
+	// Timestamp is when the change was made.
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp" gorm:"index"`
+
+	// Before is JSON encoding of the resource before the change, if it existed.
+	Before json.RawMessage `json:"before,omitempty" yaml:"before,omitempty"`
+	// After is JSON encoding of the resource after the change, unless it was deleted.
+	After json.RawMessage `json:"after,omitempty" yaml:"after,omitempty"`
+	// Diff is a JSON merge patch (RFC 7396) that turns Before into After, if the resource existed before and after the change.
+	Diff json.RawMessage `json:"diff,omitempty" yaml:"diff,omitempty"`
+}
+
+func (AuditRecord) TableName() string {
+	return "wyrd_audit_log"
+}
+
+// BeforeUpdate prevents records of the audit log from being modified.
+func (AuditRecord) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+// BeforeDelete prevents records of the audit log from being deleted.
+func (AuditRecord) BeforeDelete(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+// AuditLog interface is implemented by transactions that can record an audit log, persisted together with the changes it records.
+type AuditLog interface {
+	// AppendAudit adds records to the audit log.
+	AppendAudit(records ...AuditRecord) error
+}
+
+// AuditStore interface defines a store that keeps an audit log of changes to its resources.
+type AuditStore interface {
+	// FindAuditRecords returns records of the audit log that match search query, latest first.
+	FindAuditRecords(ctx context.Context, searchQuery manifest.SearchQuery) (records []AuditRecord, total int64, err error)
+}
+
+// EnableAudit creates the audit log table, so that [AuditedStore] can record changes made through a [DBStore].
+func EnableAudit(db *gorm.DB) error {
+	if err := db.AutoMigrate(&AuditRecord{}); err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+
+	return nil
+}
+
+type principalCtxKey struct{}
+
+// WithPrincipal returns a context with the principal, recorded by [AuditedStore] as the author of changes made with the context.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, principal)
+}
+
+// PrincipalFrom returns the principal set by [WithPrincipal], or an empty string if it is not set.
+func PrincipalFrom(ctx context.Context) string {
+	principal, _ := ctx.Value(principalCtxKey{}).(string)
+	return principal
+}
+
+func (tx *gormStoreTransaction) AppendAudit(records ...AuditRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return tx.db.Create(&records).Error
+}
+
+// FindAuditRecords returns records of the audit log that match search query, latest first.
+// This is an implementation of [AuditStore] interface, see [EnableAudit].
+//
+// Name of the query is fuzzy matched against names of changed resources, and time range applies to when the change was made.
+// Selector can select records by `principal`, `operation`, `kind` and `uid`, for example: `principal=alice,operation in (update,delete)`.
+func (s *DBStore) FindAuditRecords(ctx context.Context, searchQuery manifest.SearchQuery) (records []AuditRecord, total int64, err error) {
+	tx := s.db.WithContext(ctx).Model(&AuditRecord{})
+	tx = matchName(tx, "name", searchQuery)
+	tx = limitTimeRange(tx, "timestamp", searchQuery.FromTime, searchQuery.TillTime)
+	if tx, err = selectAuditRecords(tx, searchQuery.Selector); err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, total, err
+	}
+
+	err = limitedQuery(tx.Order("id DESC"), searchQuery).Find(&records).Error
+	return records, total, err
+}
+
+// selectAuditRecords translates requirements of the selector into conditions on columns of the audit log.
+func selectAuditRecords(tx *gorm.DB, selector manifest.Selector) (*gorm.DB, error) {
+	if selector == nil || selector.Empty() {
+		return tx, nil
+	}
+
+	requirements, selectable := selector.Requirements()
+	if !selectable {
+		return nil, manifest.ErrNonSelectableRequirements
+	}
+
+	for _, r := range requirements {
+		column, ok := auditSelectableColumns[r.Key()]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not a field of the audit log", ErrUnknownColumn, r.Key())
+		}
+
+		col := clause.Column{Name: column}
+		values := make([]any, 0, len(r.Values()))
+		for _, v := range r.Values().Slice() {
+			values = append(values, v)
+		}
+
+		switch r.Operator() {
+		case manifest.Equals, manifest.DoubleEquals, manifest.In:
+			tx = tx.Where(clause.IN{Column: col, Values: values})
+		case manifest.NotEquals, manifest.NotIn:
+			tx = tx.Not(clause.IN{Column: col, Values: values})
+		case manifest.Exists:
+			tx = tx.Not(clause.Eq{Column: col, Value: ""})
+		case manifest.DoesNotExist:
+			tx = tx.Where(clause.Eq{Column: col, Value: ""})
+		default:
+			return nil, fmt.Errorf("%w: %q", manifest.ErrInvalidOperator, r.Operator())
+		}
+	}
+
+	return tx, nil
+}
+
+// AuditedStore is a decorator of [TransactionalStore] that records every create, update, delete and restore of resources into an audit log,
+// within the same transaction as the change. Bulk operations of [BulkStore] record a change of every affected resource. The principal of the change is taken from the context, see [WithPrincipal],
+// and also given as [Author] of the change, unless the author is set explicitly.
+//
+// Transactions of the underlying store must implement [AuditLog] interface, [DBStore] does once [EnableAudit] is called.
+// Models are expected to embed [manifest.ObjectMeta]. Only JSON encoded fields of models are recorded.
+type AuditedStore struct {
+	store TransactionalStore
+}
+
+// NewAuditedStore returns a store recording changes made through it into the audit log of the given store.
+func NewAuditedStore(store TransactionalStore) (*AuditedStore, error) {
+	if store == nil {
+		return nil, ErrNoDBObject
+	}
+
+	return &AuditedStore{store: store}, nil
+}
+
+// Begin opens a transaction of the underlying store, recording changes made within it into the audit log.
+// Returns [ErrAuditNotSupported] if the transaction can not record the audit log.
+func (s *AuditedStore) Begin(ctx context.Context) (StoreTransaction, error) {
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log, ok := tx.(AuditLog)
+	if !ok {
+		tx.Rollback()
+		return nil, ErrAuditNotSupported
+	}
+
+	return &auditedTransaction{
+		StoreTransaction: tx,
+		log:              log,
+		principal:        PrincipalFrom(ctx),
+	}, nil
+}
+
+// inTransaction runs the action in a new audited transaction, committing it if the action succeeds.
+func (s *AuditedStore) inTransaction(ctx context.Context, action func(tx *auditedTransaction) error) error {
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := action(tx.(*auditedTransaction)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindAuditRecords returns records of the audit log, if the underlying store implements [AuditStore] interface.
+func (s *AuditedStore) FindAuditRecords(ctx context.Context, searchQuery manifest.SearchQuery) (records []AuditRecord, total int64, err error) {
+	store, ok := s.store.(AuditStore)
+	if !ok {
+		return nil, 0, ErrAuditNotSupported
+	}
+
+	return store.FindAuditRecords(ctx, searchQuery)
+}
+
+func (s *AuditedStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
+	return s.store.Find(ctx, dest, searchQuery, options...)
+}
+
+func (s *AuditedStore) GetByUID(ctx context.Context, value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	return s.store.GetByUID(ctx, value, id, options...)
+}
+
+func (s *AuditedStore) GetByName(ctx context.Context, value any, id manifest.ResourceName, options ...Option) (exists bool, err error) {
+	return s.store.GetByName(ctx, value, id, options...)
+}
+
+func (s *AuditedStore) Create(ctx context.Context, value any, options ...Option) error {
+	return s.inTransaction(ctx, func(tx *auditedTransaction) error {
+		return tx.Create(value, options...)
+	})
+}
+
+func (s *AuditedStore) CreateOrUpdate(ctx context.Context, newValue any, options ...Option) (exists bool, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		exists, err = tx.CreateOrUpdate(newValue, options...)
+		return err
+	})
+	return
+}
+
+func (s *AuditedStore) Update(ctx context.Context, newValue any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		exists, err = tx.Update(newValue, id, options...)
+		return err
+	})
+	return
+}
+
+func (s *AuditedStore) Delete(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		existed, err = tx.Delete(model, id, version, options...)
+		return err
+	})
+	return
+}
+
+func (s *AuditedStore) Restore(ctx context.Context, model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		existed, err = tx.Restore(model, id, options...)
+		return err
+	})
+	return
+}
+
+// CreateMany inserts values of a slice in a transaction, recording each created value.
+// This is an implementation of [BulkStore] interface.
+func (s *AuditedStore) CreateMany(ctx context.Context, values any, options ...Option) (created int64, results []error, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		created, results, err = tx.CreateMany(values, options...)
+		return err
+	})
+	return
+}
+
+// DeleteMany deletes entries that match search query, recording each deleted entry.
+// This is an implementation of [BulkStore] interface.
+func (s *AuditedStore) DeleteMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		affected, err = tx.DeleteMany(model, searchQuery, options...)
+		return err
+	})
+	return
+}
+
+// RestoreMany restores soft-deleted entries that match search query, recording each restored entry.
+// This is an implementation of [BulkStore] interface.
+func (s *AuditedStore) RestoreMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		affected, err = tx.RestoreMany(model, searchQuery, options...)
+		return err
+	})
+	return
+}
+
+// PatchLabels changes labels of entries that match search query, recording each changed entry.
+// This is an implementation of [BulkStore] interface.
+func (s *AuditedStore) PatchLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error) {
+	err = s.inTransaction(ctx, func(tx *auditedTransaction) (err error) {
+		affected, err = tx.PatchLabels(model, searchQuery, patch, options...)
+		return err
+	})
+	return
+}
+
+// auditedTransaction is a [StoreTransaction] recording changes made within it into the audit log.
+type auditedTransaction struct {
+	StoreTransaction
+
+	log       AuditLog
+	principal string
+}
+
+// upsertTransaction is implemented by transactions that can create or update a value in one call.
+type upsertTransaction interface {
+	CreateOrUpdate(newValue any, options ...Option) (exists bool, err error)
+}
+
+// restoreTransaction is implemented by transactions that can restore soft-deleted values.
+type restoreTransaction interface {
+	Restore(model any, id manifest.ResourceID, options ...Option) (existed bool, err error)
+}
+
+// bulkAuditTransaction is implemented by transactions that support bulk operations and can read entries selected by them,
+// so that every affected entry is recorded.
+type bulkAuditTransaction interface {
+	BulkTransaction
+	findMatching(dest any, searchQuery manifest.SearchQuery, options ...Option) error
+}
+
+// options prepends the principal as the author of the change, so that an explicit [Author] option overrides it.
+func (tx *auditedTransaction) options(options []Option) []Option {
+	if tx.principal == "" {
+		return options
+	}
+
+	return append([]Option{Author(tx.principal)}, options...)
+}
+
+// current reads the stored state of the resource, including soft-deleted one, into a new value of the model type.
+func (tx *auditedTransaction) current(model any, id manifest.ResourceID) (any, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	value := reflect.New(reflect.Indirect(reflect.ValueOf(model)).Type()).Interface()
+	exists, err := tx.StoreTransaction.GetByUID(value, id, IncludeDeleted())
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (tx *auditedTransaction) Create(newValue any, options ...Option) error {
+	if err := tx.StoreTransaction.Create(newValue, tx.options(options)...); err != nil {
+		return err
+	}
+
+	return tx.record(AuditCreate, nil, newValue)
+}
+
+func (tx *auditedTransaction) CreateOrUpdate(newValue any, options ...Option) (exists bool, err error) {
+	upsert, ok := tx.StoreTransaction.(upsertTransaction)
+	if !ok {
+		return false, fmt.Errorf("%w: CreateOrUpdate is not supported", ErrAuditNotSupported)
+	}
+
+	before, err := tx.current(newValue, objectMetaOf(newValue).UID)
+	if err != nil {
+		return false, err
+	}
+
+	if exists, err = upsert.CreateOrUpdate(newValue, tx.options(options)...); err != nil {
+		return exists, err
+	}
+
+	after, err := tx.current(newValue, objectMetaOf(newValue).UID)
+	if err != nil || after == nil {
+		return exists, err
+	}
+
+	operation := AuditUpdate
+	if before == nil {
+		operation = AuditCreate
+	}
+	return exists, tx.record(operation, before, after)
+}
+
+func (tx *auditedTransaction) Update(newValue any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	before, err := tx.current(newValue, id)
+	if err != nil {
+		return false, err
+	}
+
+	if exists, err = tx.StoreTransaction.Update(newValue, id, tx.options(options)...); err != nil || !exists {
+		return exists, err
+	}
+
+	after, err := tx.current(newValue, id)
+	if err != nil {
+		return exists, err
+	}
+
+	return exists, tx.record(AuditUpdate, before, after)
+}
+
+func (tx *auditedTransaction) Delete(model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	before, err := tx.current(model, id)
+	if err != nil {
+		return false, err
+	}
+
+	if existed, err = tx.StoreTransaction.Delete(model, id, version, tx.options(options)...); err != nil || !existed {
+		return existed, err
+	}
+
+	return existed, tx.record(AuditDelete, before, nil)
+}
+
+func (tx *auditedTransaction) Restore(model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	restore, ok := tx.StoreTransaction.(restoreTransaction)
+	if !ok {
+		return false, fmt.Errorf("%w: Restore is not supported", ErrAuditNotSupported)
+	}
+
+	before, err := tx.current(model, id)
+	if err != nil {
+		return false, err
+	}
+
+	if existed, err = restore.Restore(model, id, tx.options(options)...); err != nil || !existed {
+		return existed, err
+	}
+
+	after, err := tx.current(model, id)
+	if err != nil {
+		return existed, err
+	}
+
+	return existed, tx.record(AuditRestore, before, after)
+}
+
+// bulk returns the underlying transaction if it supports bulk operations, or [ErrAuditNotSupported] error naming the operation.
+func (tx *auditedTransaction) bulk(operation string) (bulkAuditTransaction, error) {
+	bulk, ok := tx.StoreTransaction.(bulkAuditTransaction)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not supported", ErrAuditNotSupported, operation)
+	}
+
+	return bulk, nil
+}
+
+// matching reads entries of the model type that a bulk operation selects by search query, as pointers to new values.
+func (tx *auditedTransaction) matching(bulk bulkAuditTransaction, model any, searchQuery manifest.SearchQuery, options ...Option) ([]any, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.Indirect(reflect.ValueOf(model)).Type()))
+	if err := bulk.findMatching(rows.Interface(), searchQuery, options...); err != nil {
+		return nil, err
+	}
+
+	result := make([]any, rows.Elem().Len())
+	for i := range result {
+		result[i] = rows.Elem().Index(i).Addr().Interface()
+	}
+
+	return result, nil
+}
+
+func (tx *auditedTransaction) CreateMany(values any, options ...Option) (created int64, results []error, err error) {
+	bulk, err := tx.bulk("CreateMany")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if created, results, err = bulk.CreateMany(values, tx.options(options)...); err != nil {
+		return created, results, err
+	}
+
+	items := reflect.Indirect(reflect.ValueOf(values))
+	for i, result := range results {
+		if result != nil {
+			continue
+		}
+
+		item := items.Index(i)
+		if item.Kind() != reflect.Pointer {
+			item = item.Addr()
+		}
+		if err := tx.record(AuditCreate, nil, item.Interface()); err != nil {
+			return created, results, err
+		}
+	}
+
+	return created, results, nil
+}
+
+func (tx *auditedTransaction) DeleteMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	bulk, err := tx.bulk("DeleteMany")
+	if err != nil {
+		return 0, err
+	}
+
+	before, err := tx.matching(bulk, model, searchQuery, options...)
+	if err != nil || len(before) == 0 {
+		return 0, err
+	}
+
+	if affected, err = bulk.DeleteMany(model, searchQuery, tx.options(options)...); err != nil {
+		return affected, err
+	}
+
+	for _, value := range before {
+		if err := tx.record(AuditDelete, value, nil); err != nil {
+			return affected, err
+		}
+	}
+
+	return affected, nil
+}
+
+func (tx *auditedTransaction) RestoreMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	bulk, err := tx.bulk("RestoreMany")
+	if err != nil {
+		return 0, err
+	}
+
+	before, err := tx.matching(bulk, model, searchQuery, append(options, IncludeDeleted())...)
+	if err != nil || len(before) == 0 {
+		return 0, err
+	}
+
+	if affected, err = bulk.RestoreMany(model, searchQuery, tx.options(options)...); err != nil {
+		return affected, err
+	}
+
+	for _, value := range before {
+		// Entries that are not deleted are selected too, but not restored
+		if objectMetaOf(value).DeletedAt == nil {
+			continue
+		}
+
+		after, err := tx.current(model, objectMetaOf(value).UID)
+		if err != nil {
+			return affected, err
+		}
+		if err := tx.record(AuditRestore, value, after); err != nil {
+			return affected, err
+		}
+	}
+
+	return affected, nil
+}
+
+func (tx *auditedTransaction) PatchLabels(model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error) {
+	bulk, err := tx.bulk("PatchLabels")
+	if err != nil {
+		return 0, err
+	}
+
+	before, err := tx.matching(bulk, model, searchQuery, options...)
+	if err != nil || len(before) == 0 || patch.Empty() {
+		return 0, err
+	}
+
+	if affected, err = bulk.PatchLabels(model, searchQuery, patch, tx.options(options)...); err != nil {
+		return affected, err
+	}
+
+	for _, value := range before {
+		after, err := tx.current(model, objectMetaOf(value).UID)
+		if err != nil {
+			return affected, err
+		}
+		if err := tx.record(AuditUpdate, value, after); err != nil {
+			return affected, err
+		}
+	}
+
+	return affected, nil
+}
+
+// Enqueue adds messages to the outbox of the underlying transaction, see [Outbox].
+func (tx *auditedTransaction) Enqueue(messages ...OutboxMessage) error {
+	return Enqueue(tx.StoreTransaction, messages...)
+}
+
+// record appends a record of the change to the audit log. Either of the states can be nil if the resource did not exist.
+func (tx *auditedTransaction) record(operation AuditOperation, before, after any) error {
+	record := AuditRecord{
+		Principal: tx.principal,
+		Operation: operation,
+		Timestamp: time.Now(),
+	}
+
+	subject := after
+	if subject == nil {
+		subject = before
+	}
+	if subject == nil {
+		return nil
+	}
+
+	meta := objectMetaOf(subject)
+	record.Kind = kindOf(subject)
+	record.UID = meta.UID
+	record.Name = meta.Name
+	record.Version = meta.Version
+
+	var err error
+	if record.Before, err = encodeAuditState(before); err != nil {
+		return err
+	}
+	if record.After, err = encodeAuditState(after); err != nil {
+		return err
+	}
+	if before != nil && after != nil {
+		if record.Diff, err = mergePatch(record.Before, record.After); err != nil {
+			return err
+		}
+	}
+
+	return tx.log.AppendAudit(record)
+}
+
+// encodeAuditState returns JSON encoding of the model with sensitive fields redacted, see [manifest.Redact].
+func encodeAuditState(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(manifest.Redact(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	return data, nil
+}
+
+// objectMetaOf returns [manifest.ObjectMeta] embedded into the model, or zero value if the model does not embed it.
+func objectMetaOf(model any) manifest.ObjectMeta {
+	value := reflect.Indirect(reflect.ValueOf(model))
+	if value.Kind() != reflect.Struct {
+		return manifest.ObjectMeta{}
+	}
+
+	if field := value.FieldByName("ObjectMeta"); field.IsValid() {
+		if meta, ok := field.Interface().(manifest.ObjectMeta); ok {
+			return meta
+		}
+	}
+
+	return manifest.ObjectMeta{}
+}
+
+// kindOf returns registered [manifest.Kind] of the model spec, or the name of the model type if the kind is not registered.
+func kindOf(model any) manifest.Kind {
+	value := reflect.Indirect(reflect.ValueOf(model))
+	if value.Kind() != reflect.Struct {
+		return manifest.Kind(value.Type().Name())
+	}
+	if spec := value.FieldByName("Spec"); spec.IsValid() {
+		if kind, ok := manifest.KindOf(spec.Interface()); ok {
+			return kind
+		}
+	}
+
+	return manifest.Kind(value.Type().Name())
+}
+
+// mergePatch returns a JSON merge patch (RFC 7396) that turns one JSON document into another.
+func mergePatch(from, to json.RawMessage) (json.RawMessage, error) {
+	var source, target any
+	if err := json.Unmarshal(from, &source); err != nil {
+		return nil, fmt.Errorf("failed to decode audit record: %w", err)
+	}
+	if err := json.Unmarshal(to, &target); err != nil {
+		return nil, fmt.Errorf("failed to decode audit record: %w", err)
+	}
+
+	patch, _ := diffJSON(source, target)
+	return json.Marshal(patch)
+}
+
+// diffJSON returns a merge patch from source to target decoded JSON values, and false if they are equal.
+func diffJSON(source, target any) (any, bool) {
+	sourceObject, sourceOk := source.(map[string]any)
+	targetObject, targetOk := target.(map[string]any)
+	if !sourceOk || !targetOk {
+		// Merge patch replaces anything but objects as a whole
+		return target, !reflect.DeepEqual(source, target)
+	}
+
+	patch := map[string]any{}
+	for key, value := range targetObject {
+		if p, changed := diffJSON(sourceObject[key], value); changed {
+			patch[key] = p
+		}
+	}
+	for key := range sourceObject {
+		if _, ok := targetObject[key]; !ok {
+			patch[key] = nil
+		}
+	}
+
+	return patch, len(patch) > 0
+}
@@ -0,0 +1,270 @@
+package dbstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func makeAuditedStore(t *testing.T) (*dbstore.AuditedStore, *gorm.DB) {
+	db, store := openTestDB(t)
+	require.NoError(t, dbstore.EnableAudit(db))
+
+	audited, err := dbstore.NewAuditedStore(store)
+	require.NoError(t, err)
+
+	return audited, db
+}
+
+type auditedChange struct {
+	Principal string
+	Operation dbstore.AuditOperation
+	Name      manifest.ResourceName
+	Version   manifest.Version
+}
+
+func auditedChanges(records []dbstore.AuditRecord) []auditedChange {
+	result := make([]auditedChange, 0, len(records))
+	for _, r := range records {
+		result = append(result, auditedChange{Principal: r.Principal, Operation: r.Operation, Name: r.Name, Version: r.Version})
+	}
+	return result
+}
+
+func TestAuditedStore(t *testing.T) {
+	store, _ := makeAuditedStore(t)
+	alice := dbstore.WithPrincipal(context.TODO(), "alice")
+	bob := dbstore.WithPrincipal(context.TODO(), "bob")
+
+	pet := makePet("fluffy", "Fluffy")
+	require.NoError(t, store.Create(alice, &pet))
+	pet.Spec.CustomName = "Mr. Fluffy"
+	exists, err := store.Update(bob, &pet, pet.UID)
+	require.NoError(t, err)
+	require.True(t, exists)
+	existed, err := store.Delete(bob, &Pet{}, pet.UID, 0)
+	require.NoError(t, err)
+	require.True(t, existed)
+	existed, err = store.Restore(alice, &Pet{}, pet.UID)
+	require.NoError(t, err)
+	require.True(t, existed)
+
+	// Deleting a missing resource is not recorded
+	_, err = store.Delete(bob, &Pet{}, "unknown", 0)
+	require.NoError(t, err)
+
+	records, total, err := store.FindAuditRecords(context.TODO(), manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), total)
+	require.Equal(t, []auditedChange{
+		{Principal: "alice", Operation: dbstore.AuditRestore, Name: "fluffy", Version: 2},
+		{Principal: "bob", Operation: dbstore.AuditDelete, Name: "fluffy", Version: 2},
+		{Principal: "bob", Operation: dbstore.AuditUpdate, Name: "fluffy", Version: 2},
+		{Principal: "alice", Operation: dbstore.AuditCreate, Name: "fluffy", Version: 1},
+	}, auditedChanges(records))
+
+	update := records[2]
+	require.Equal(t, manifest.Kind("Pet"), update.Kind)
+	require.Equal(t, pet.UID, update.UID)
+	require.NotEmpty(t, update.Before)
+	require.NotEmpty(t, update.After)
+
+	var diff map[string]any
+	require.NoError(t, json.Unmarshal(update.Diff, &diff))
+	require.Equal(t, map[string]any{"CustomName": "Mr. Fluffy"}, diff["spec"])
+	require.Equal(t, float64(2), diff["version"])
+
+	require.Empty(t, records[1].After)
+	require.Empty(t, records[3].Before)
+}
+
+// Credential is a model with a sensitive field. It does not embed [manifest.ObjectMeta], as pets in the same test DB do.
+type Credential struct {
+	UID   manifest.ResourceID `gorm:"primaryKey"`
+	Host  string
+	Token string `wyrd:"sensitive"`
+}
+
+func TestAuditedStore_Redacted(t *testing.T) {
+	store, db := makeAuditedStore(t)
+	require.NoError(t, db.AutoMigrate(&Credential{}))
+	ctx := dbstore.WithPrincipal(context.TODO(), "alice")
+
+	credential := Credential{UID: "registry", Host: "registry.local", Token: "secret-1"}
+	require.NoError(t, store.Create(ctx, &credential))
+	credential.Token = "secret-2"
+	_, err := store.Update(ctx, &credential, credential.UID)
+	require.NoError(t, err)
+
+	// Sensitive fields are kept in the store, but not in the audit log
+	var stored Credential
+	_, err = store.GetByUID(ctx, &stored, credential.UID)
+	require.NoError(t, err)
+	require.Equal(t, "secret-2", stored.Token)
+
+	records, _, err := store.FindAuditRecords(ctx, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		for _, state := range []json.RawMessage{record.Before, record.After, record.Diff} {
+			require.NotContains(t, string(state), "secret")
+		}
+	}
+	require.Contains(t, string(records[0].After), manifest.RedactedPlaceholder)
+
+	var diff map[string]any
+	require.NoError(t, json.Unmarshal(records[0].Diff, &diff))
+	require.Equal(t, map[string]any{}, diff)
+}
+
+func TestAuditedStore_Bulk(t *testing.T) {
+	store, _ := makeAuditedStore(t)
+	ctx := dbstore.WithPrincipal(context.TODO(), "alice")
+
+	pets := givenLabeledPets()
+	created, _, err := store.CreateMany(ctx, pets)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), created)
+
+	affected, err := store.PatchLabels(ctx, &Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")}, dbstore.LabelPatch{Set: manifest.Labels{"owner": "bob"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), affected)
+	affected, err = store.DeleteMany(ctx, &Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=dog")})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), affected)
+	affected, err = store.RestoreMany(ctx, &Pet{}, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), affected)
+
+	// Every affected resource is recorded
+	records, total, err := store.FindAuditRecords(ctx, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(8), total)
+	require.ElementsMatch(t, []auditedChange{
+		{Principal: "alice", Operation: dbstore.AuditCreate, Name: "fluffy", Version: 1},
+		{Principal: "alice", Operation: dbstore.AuditCreate, Name: "tom", Version: 1},
+		{Principal: "alice", Operation: dbstore.AuditCreate, Name: "rex", Version: 1},
+		{Principal: "alice", Operation: dbstore.AuditCreate, Name: "nemo", Version: 1},
+		{Principal: "alice", Operation: dbstore.AuditUpdate, Name: "fluffy", Version: 2},
+		{Principal: "alice", Operation: dbstore.AuditUpdate, Name: "tom", Version: 2},
+		{Principal: "alice", Operation: dbstore.AuditDelete, Name: "rex", Version: 1},
+		{Principal: "alice", Operation: dbstore.AuditRestore, Name: "rex", Version: 1},
+	}, auditedChanges(records))
+
+	for _, record := range records {
+		if record.Operation != dbstore.AuditUpdate {
+			continue
+		}
+
+		var diff map[string]any
+		require.NoError(t, json.Unmarshal(record.Diff, &diff))
+		require.Equal(t, map[string]any{"owner": "bob"}, diff["labels"])
+	}
+}
+
+func TestAuditedStore_Rollback(t *testing.T) {
+	store, _ := makeAuditedStore(t)
+	ctx := dbstore.WithPrincipal(context.TODO(), "alice")
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	pet := makePet("fluffy", "Fluffy")
+	require.NoError(t, tx.Create(&pet))
+	tx.Rollback()
+
+	_, total, err := store.FindAuditRecords(ctx, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), total)
+}
+
+func TestAuditedStore_FindAuditRecords(t *testing.T) {
+	testCases := map[string]struct {
+		givenSelector string
+		givenName     string
+
+		expect      []dbstore.AuditOperation
+		expectError error
+	}{
+		"all": {
+			expect: []dbstore.AuditOperation{dbstore.AuditDelete, dbstore.AuditCreate, dbstore.AuditUpdate, dbstore.AuditCreate},
+		},
+		"by principal": {
+			givenSelector: "principal=bob",
+			expect:        []dbstore.AuditOperation{dbstore.AuditDelete, dbstore.AuditCreate},
+		},
+		"by operation": {
+			givenSelector: "operation in (update,delete)",
+			expect:        []dbstore.AuditOperation{dbstore.AuditDelete, dbstore.AuditUpdate},
+		},
+		"by name": {
+			givenName: "rex",
+			expect:    []dbstore.AuditOperation{dbstore.AuditDelete, dbstore.AuditCreate},
+		},
+		"unknown field": {
+			givenSelector: "color=red",
+			expectError:   dbstore.ErrUnknownColumn,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			store, _ := makeAuditedStore(t)
+			alice := dbstore.WithPrincipal(context.TODO(), "alice")
+			bob := dbstore.WithPrincipal(context.TODO(), "bob")
+
+			fluffy := makePet("fluffy", "Fluffy")
+			require.NoError(t, store.Create(alice, &fluffy))
+			fluffy.Spec.CustomName = "Mr. Fluffy"
+			_, err := store.Update(alice, &fluffy, fluffy.UID)
+			require.NoError(t, err)
+			rex := makePet("rex", "Rex")
+			require.NoError(t, store.Create(bob, &rex))
+			_, err = store.Delete(bob, &Pet{}, rex.UID, 0)
+			require.NoError(t, err)
+
+			selector, err := manifest.ParseSelector(test.givenSelector)
+			require.NoError(t, err)
+			records, _, err := store.FindAuditRecords(context.TODO(), manifest.SearchQuery{Selector: selector, Name: test.givenName})
+			if test.expectError != nil {
+				require.ErrorIs(t, err, test.expectError)
+				return
+			}
+			require.NoError(t, err)
+
+			got := make([]dbstore.AuditOperation, 0, len(records))
+			for _, r := range records {
+				got = append(got, r.Operation)
+			}
+			require.Equal(t, test.expect, got)
+		})
+	}
+}
+
+func TestAuditedStore_AppendOnly(t *testing.T) {
+	store, db := makeAuditedStore(t)
+	ctx := context.TODO()
+
+	pet := makePet("fluffy", "Fluffy")
+	require.NoError(t, store.Create(ctx, &pet))
+
+	records, _, err := store.FindAuditRecords(ctx, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	require.ErrorIs(t, db.Delete(&records[0]).Error, dbstore.ErrAuditAppendOnly)
+	require.ErrorIs(t, db.Model(&records[0]).Update("principal", "mallory").Error, dbstore.ErrAuditAppendOnly)
+}
+
+func TestAuditedStore_NotSupported(t *testing.T) {
+	store, err := dbstore.NewAuditedStore(dbstore.NewMemStore(dbstore.ManifestModel))
+	require.NoError(t, err)
+
+	pet := makePet("fluffy", "Fluffy")
+	require.ErrorIs(t, store.Create(context.TODO(), &pet), dbstore.ErrAuditNotSupported)
+}
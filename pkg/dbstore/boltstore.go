@@ -0,0 +1,711 @@
+package dbstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"go.etcd.io/bbolt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrAssociationsNotSupported error is returned by methods of a [BoltStore] transaction that manage associations of models.
+var ErrAssociationsNotSupported = errors.New("associations are not supported by the store")
+
+const (
+	// boltMetaBucket holds the sequence that orders models by insertion, as [memRow] seq does.
+	boltMetaBucket = "wyrd:meta"
+
+	// Buckets nested in the bucket of a table.
+	boltRowsBucket   = "rows"
+	boltNamesBucket  = "names"
+	boltLabelsBucket = "labels"
+)
+
+// BoltStore is an implementation of [TransactionalStore] and [LabelStore] on top of an embedded bbolt key-value store.
+// It is pure Go, thus suits single-binary tools and edge agents that can not ship SQLite driver, which requires CGO.
+//
+// Models are mapped to tables and columns using the same GORM schema as DBStore, and are stored as JSON
+// in a bucket per table, keyed by primary key. Thus fields that are not JSON encoded are not stored.
+// Names and labels of models are indexed in buckets nested in the table bucket.
+//
+// Store operations are evaluated as [MemStore] evaluates them, over models loaded from the bolt DB:
+// models are looked up by primary key or name, and search queries load models that match `=`, `==`, `in` and `exists`
+// requirements of the label selector from the label index. Queries without such requirements read all models of the table.
+//
+// Each method runs in a bolt transaction of its own. [BoltStore.Begin] opens a writable bolt transaction,
+// which blocks writes of others until it is committed or rolled back.
+//
+// Note: associations are not supported, associated values of models are neither stored nor linked.
+// Note: model hooks BeforeSave, BeforeCreate, BeforeUpdate and BeforeDelete are called with nil *gorm.DB.
+type BoltStore struct {
+	db *bbolt.DB
+
+	// engine evaluates store operations over the models loaded for them. Its own state is not used.
+	engine *MemStore
+}
+
+// NewBoltStore creates a new instance of BoltStore, storing models in the bolt DB.
+func NewBoltStore(db *bbolt.DB, cfg SchemaConfig) (*BoltStore, error) {
+	if db == nil {
+		return nil, ErrNoDBObject
+	}
+
+	return &BoltStore{
+		db:     db,
+		engine: NewMemStore(cfg),
+	}, nil
+}
+
+// boltRow is the stored form of a [memRow].
+type boltRow struct {
+	Seq   uint64          `json:"seq"`
+	Value json.RawMessage `json:"value"`
+}
+
+// boltSession executes store operations within a bolt transaction.
+type boltSession struct {
+	ctx   context.Context
+	store *BoltStore
+	tx    *bbolt.Tx
+}
+
+func (s *BoltStore) view(ctx context.Context, fn func(*boltSession) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(&boltSession{ctx: ctx, store: s, tx: tx})
+	})
+}
+
+func (s *BoltStore) update(ctx context.Context, fn func(*boltSession) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(&boltSession{ctx: ctx, store: s, tx: tx})
+	})
+}
+
+// Ping implements [Pinger] interface, checking that the bolt DB is open.
+func (s *BoltStore) Ping(ctx context.Context) error {
+	return s.view(ctx, func(*boltSession) error { return nil })
+}
+
+// Begin opens a writable bolt transaction.
+// It is an implementation of Transactional interface.
+// Note: It's a caller responsibility to call Transaction.Commit() or Transaction.Rollback() to complete the transaction.
+func (s *BoltStore) Begin(ctx context.Context) (StoreTransaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltStoreTransaction{
+		session: &boltSession{ctx: ctx, store: s, tx: tx},
+	}, nil
+}
+
+// Create inserts a new value into the store, updating inserted models ID.
+func (s *BoltStore) Create(ctx context.Context, value any, options ...Option) error {
+	return s.update(ctx, func(bs *boltSession) error {
+		return bs.create(value, options...)
+	})
+}
+
+// CreateOrUpdate inserts a new value into the store if the models.ID is nil, otherwise it replaces it.
+func (s *BoltStore) CreateOrUpdate(ctx context.Context, value any, options ...Option) (exists bool, err error) {
+	err = s.update(ctx, func(bs *boltSession) (err error) {
+		exists, err = bs.save(value, options...)
+		return
+	})
+	return
+}
+
+// GetByUID finds at most one entry in the store identified by the UUID if there is one.
+// See [DBStore.GetByUID].
+func (s *BoltStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.view(ctx, func(bs *boltSession) (err error) {
+		exists, err = bs.getByUID(dest, id, options...)
+		return
+	})
+	return
+}
+
+// GetByName finds at most one entry in the store identified by the name if there is one.
+// See [DBStore.GetByName].
+func (s *BoltStore) GetByName(ctx context.Context, dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	err = s.view(ctx, func(bs *boltSession) (err error) {
+		exists, err = bs.getByName(dest, name, options...)
+		return
+	})
+	return
+}
+
+// Update updates non-zero fields of an entry identified by the ID of the value.
+// See [DBStore.Update].
+func (s *BoltStore) Update(ctx context.Context, value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.update(ctx, func(bs *boltSession) (err error) {
+		exists, err = bs.updateByUID(value, id, options...)
+		return
+	})
+	return
+}
+
+// Delete deletes an entry identified by the ID from the store.
+// See [DBStore.Delete].
+func (s *BoltStore) Delete(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = s.update(ctx, func(bs *boltSession) (err error) {
+		existed, err = bs.delete(model, id, version, options...)
+		return
+	})
+	return
+}
+
+// Restore restores a previously deleted entry identified by the ID.
+// See [DBStore.Restore].
+func (s *BoltStore) Restore(ctx context.Context, model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	err = s.update(ctx, func(bs *boltSession) (err error) {
+		existed, err = bs.restore(model, id, options...)
+		return
+	})
+	return
+}
+
+// Find returns models from the store that matched search query parameters.
+// See [DBStore.Find].
+func (s *BoltStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
+	err = s.view(ctx, func(bs *boltSession) error {
+		return bs.run(dest, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+			if err := bs.loadSelected(ms, sch, searchQuery.Selector); err != nil {
+				return err
+			}
+
+			total, err = ms.find(dest, searchQuery, tContext)
+			return
+		})
+	})
+	return
+}
+
+// FindNames returns a set of names for a model type.
+// See [DBStore.FindNames].
+func (s *BoltStore) FindNames(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (result manifest.StringSet, err error) {
+	err = s.view(ctx, func(bs *boltSession) error {
+		return bs.run(model, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+			if err := bs.loadSelected(ms, sch, searchQuery.Selector); err != nil {
+				return err
+			}
+
+			result, err = ms.findNames(model, searchQuery, tContext)
+			return
+		})
+	})
+	return
+}
+
+// FindLabels returns a set of label keys for a given model type.
+// See [DBStore.FindLabels].
+func (s *BoltStore) FindLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (result manifest.StringSet, err error) {
+	err = s.view(ctx, func(bs *boltSession) error {
+		return bs.run(model, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+			if err := bs.loadAll(ms, sch); err != nil {
+				return err
+			}
+
+			result, err = ms.findLabels(model, "", false, searchQuery, tContext)
+			return
+		})
+	})
+	return
+}
+
+// FindLabelValues returns a set of label values for a given model type and label key.
+// Only models that have the label are read, using the label index.
+// See [DBStore.FindLabelValues].
+func (s *BoltStore) FindLabelValues(ctx context.Context, model any, key string, searchQuery manifest.SearchQuery, options ...Option) (result manifest.StringSet, err error) {
+	err = s.view(ctx, func(bs *boltSession) error {
+		return bs.run(model, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+			keys := bs.indexed(sch.Table, boltLabelsBucket, boltIndexKey([]byte(key), nil))
+			if err := bs.loadKeys(ms, sch, keys); err != nil {
+				return err
+			}
+
+			result, err = ms.findLabels(model, key, true, searchQuery, tContext)
+			return
+		})
+	})
+	return
+}
+
+func (bs *boltSession) create(value any, options ...Option) error {
+	return bs.run(value, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) error {
+		if err := bs.loadValues(ms, sch, value); err != nil {
+			return err
+		}
+
+		return ms.create(value, tContext)
+	})
+}
+
+func (bs *boltSession) save(value any, options ...Option) (exists bool, err error) {
+	err = bs.run(value, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+		if err := bs.loadValues(ms, sch, value); err != nil {
+			return err
+		}
+
+		exists, err = ms.save(value, tContext)
+		return
+	})
+	return
+}
+
+func (bs *boltSession) getByUID(dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = bs.run(dest, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+		if err := bs.loadKeys(ms, sch, [][]byte{boltKey(ms.idValue(sch, id))}); err != nil {
+			return err
+		}
+
+		exists, err = ms.get(dest, ms.config().IDColumnName, id, tContext)
+		return
+	})
+	return
+}
+
+func (bs *boltSession) getByName(dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	err = bs.run(dest, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+		keys := bs.indexed(sch.Table, boltNamesBucket, boltIndexKey([]byte(name), nil))
+		if err := bs.loadKeys(ms, sch, keys); err != nil {
+			return err
+		}
+
+		exists, err = ms.get(dest, ms.config().NameColumnName, name, tContext)
+		return
+	})
+	return
+}
+
+func (bs *boltSession) updateByUID(value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = bs.run(value, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+		key := ms.idValue(sch, id)
+		if ptr := reflect.ValueOf(value); ptr.Kind() == reflect.Pointer && !ptr.IsNil() && ptr.Elem().Kind() == reflect.Struct {
+			if pk := ms.primaryKey(sch, ptr.Elem()); pk != nil {
+				key = pk
+			}
+		}
+		if err := bs.loadKeys(ms, sch, [][]byte{boltKey(key)}); err != nil {
+			return err
+		}
+
+		exists, err = ms.update(value, id, tContext)
+		return
+	})
+	return
+}
+
+func (bs *boltSession) delete(model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = bs.run(model, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+		if err := bs.loadKeys(ms, sch, [][]byte{boltKey(ms.idValue(sch, id))}); err != nil {
+			return err
+		}
+
+		existed, err = ms.delete(model, id, version, tContext)
+		return
+	})
+	return
+}
+
+func (bs *boltSession) restore(model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	err = bs.run(model, options, func(ms *memSession, sch *schema.Schema, tContext transactionContext) (err error) {
+		if err := bs.loadKeys(ms, sch, [][]byte{boltKey(ms.idValue(sch, id))}); err != nil {
+			return err
+		}
+
+		existed, err = ms.restore(model, id, tContext)
+		return
+	})
+	return
+}
+
+// run evaluates an operation on the value with a [memSession] over an empty state, that the operation loads models it reads into,
+// then writes models modified by the operation back to the bolt DB. Associations are omitted, as they are not supported.
+func (bs *boltSession) run(value any, options []Option, fn func(*memSession, *schema.Schema, transactionContext) error) error {
+	if err := bs.ctx.Err(); err != nil {
+		return err
+	}
+
+	engine := bs.store.engine
+	sch, err := engine.schema(value)
+	if err != nil {
+		return err
+	}
+
+	tContext := resolveOptions(engine.config, value, options...)
+	for name := range sch.Relationships.Relations {
+		tContext.Omit[name] = struct{}{}
+	}
+
+	ms := &memSession{
+		ctx:          bs.ctx,
+		store:        engine,
+		state:        newMemState(),
+		written:      map[memKey]*memRow{},
+		writtenLinks: map[memLinkKey]*memLinks{},
+	}
+	// New models follow the stored ones. Writable bolt transactions are exclusive, thus the sequence is not shared.
+	if bs.tx.Writable() {
+		var seq uint64
+		if meta := bs.tx.Bucket([]byte(boltMetaBucket)); meta != nil {
+			seq = meta.Sequence()
+		}
+		engine.seq.Store(seq)
+	}
+
+	if err := fn(ms, sch, tContext); err != nil {
+		return err
+	}
+
+	return bs.flush(ms, sch)
+}
+
+// flush writes models modified by the session, replacing their index entries.
+func (bs *boltSession) flush(ms *memSession, sch *schema.Schema) error {
+	if len(ms.written) == 0 {
+		return nil
+	}
+
+	table, err := bs.tx.CreateBucketIfNotExists([]byte(sch.Table))
+	if err != nil {
+		return err
+	}
+	buckets := map[string]*bbolt.Bucket{}
+	for _, name := range []string{boltRowsBucket, boltNamesBucket, boltLabelsBucket} {
+		if buckets[name], err = table.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	for key, original := range ms.written {
+		pk := boltKey(key.id)
+		if original != nil {
+			for index, entries := range bs.indexEntries(ms, sch, original, pk) {
+				for _, entry := range entries {
+					if err := buckets[index].Delete(entry); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		row := ms.state.row(key)
+		if row == nil {
+			if err := buckets[boltRowsBucket].Delete(pk); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := json.Marshal(row.value.Interface())
+		if err != nil {
+			return fmt.Errorf("failed to encode %v: %w", sch.Name, err)
+		}
+		data, err := json.Marshal(boltRow{Seq: row.seq, Value: value})
+		if err != nil {
+			return err
+		}
+		if err := buckets[boltRowsBucket].Put(pk, data); err != nil {
+			return err
+		}
+
+		for index, entries := range bs.indexEntries(ms, sch, row, pk) {
+			for _, entry := range entries {
+				if err := buckets[index].Put(entry, pk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	meta, err := bs.tx.CreateBucketIfNotExists([]byte(boltMetaBucket))
+	if err != nil {
+		return err
+	}
+
+	return meta.SetSequence(bs.store.engine.seq.Load())
+}
+
+// indexEntries returns keys of entries of the name and label indexes pointing to the row, by index bucket.
+func (bs *boltSession) indexEntries(ms *memSession, sch *schema.Schema, row *memRow, pk []byte) map[string][][]byte {
+	result := map[string][][]byte{}
+	if name, ok := columnOf(sch, row.value, ms.config().NameColumnName); ok && name != nil {
+		result[boltNamesBucket] = append(result[boltNamesBucket], boltIndexKey([]byte(fmt.Sprint(name)), pk))
+	}
+	for key, value := range labelsOf(sch, ms.config(), row.value) {
+		result[boltLabelsBucket] = append(result[boltLabelsBucket], boltIndexKey([]byte(key), []byte(value), pk))
+	}
+
+	return result
+}
+
+// bucket returns a bucket nested in the bucket of the table, or nil if there is none.
+func (bs *boltSession) bucket(table, name string) *bbolt.Bucket {
+	if b := bs.tx.Bucket([]byte(table)); b != nil {
+		return b.Bucket([]byte(name))
+	}
+	return nil
+}
+
+// indexed returns primary keys of models pointed to by entries of the index that have the prefix.
+func (bs *boltSession) indexed(table, index string, prefix []byte) [][]byte {
+	b := bs.bucket(table, index)
+	if b == nil {
+		return nil
+	}
+
+	var result [][]byte
+	c := b.Cursor()
+	for k, pk := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, pk = c.Next() {
+		result = append(result, bytes.Clone(pk))
+	}
+
+	return result
+}
+
+// loadKeys loads models with the primary keys into the session state.
+func (bs *boltSession) loadKeys(ms *memSession, sch *schema.Schema, keys [][]byte) error {
+	rows := bs.bucket(sch.Table, boltRowsBucket)
+	if rows == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		if data := rows.Get(key); data != nil {
+			if err := bs.load(ms, sch, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadAll loads all models of the table into the session state.
+func (bs *boltSession) loadAll(ms *memSession, sch *schema.Schema) error {
+	rows := bs.bucket(sch.Table, boltRowsBucket)
+	if rows == nil {
+		return nil
+	}
+
+	return rows.ForEach(func(_, data []byte) error {
+		return bs.load(ms, sch, data)
+	})
+}
+
+// loadValues loads stored models with primary keys of the values, which can be a pointer to a struct or a slice.
+// If models have integer primary keys, the model with the largest one is loaded for new keys to follow it.
+func (bs *boltSession) loadValues(ms *memSession, sch *schema.Schema, values any) error {
+	var keys [][]byte
+	err := eachModel(values, func(v reflect.Value) error {
+		if pk := ms.primaryKey(sch, v.Elem()); pk != nil {
+			keys = append(keys, boltKey(pk))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if dataType := sch.PrioritizedPrimaryField.DataType; dataType == schema.Int || dataType == schema.Uint {
+		if rows := bs.bucket(sch.Table, boltRowsBucket); rows != nil {
+			if last, _ := rows.Cursor().Last(); last != nil {
+				keys = append(keys, bytes.Clone(last))
+			}
+		}
+	}
+
+	return bs.loadKeys(ms, sch, keys)
+}
+
+// loadSelected loads models that may match the selector, using the label index for requirements it can serve.
+func (bs *boltSession) loadSelected(ms *memSession, sch *schema.Schema, selector manifest.Selector) error {
+	var selected map[string][]byte
+	if selector != nil {
+		reqs, _ := selector.Requirements()
+		for _, req := range reqs {
+			var prefixes [][]byte
+			switch req.Operator() {
+			case manifest.Equals, manifest.DoubleEquals, manifest.In:
+				for value := range req.Values() {
+					prefixes = append(prefixes, boltIndexKey([]byte(req.Key()), []byte(value), nil))
+				}
+			case manifest.Exists:
+				prefixes = append(prefixes, boltIndexKey([]byte(req.Key()), nil))
+			default:
+				continue
+			}
+
+			matched := map[string][]byte{}
+			for _, prefix := range prefixes {
+				for _, pk := range bs.indexed(sch.Table, boltLabelsBucket, prefix) {
+					if _, ok := selected[string(pk)]; selected == nil || ok {
+						matched[string(pk)] = pk
+					}
+				}
+			}
+			selected = matched
+		}
+	}
+
+	if selected == nil {
+		return bs.loadAll(ms, sch)
+	}
+
+	keys := make([][]byte, 0, len(selected))
+	for _, pk := range selected {
+		keys = append(keys, pk)
+	}
+	return bs.loadKeys(ms, sch, keys)
+}
+
+// load decodes a stored model into the session state.
+func (bs *boltSession) load(ms *memSession, sch *schema.Schema, data []byte) error {
+	var stored boltRow
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to decode %v: %w", sch.Name, err)
+	}
+
+	value := reflect.New(sch.ModelType)
+	if err := json.Unmarshal(stored.Value, value.Interface()); err != nil {
+		return fmt.Errorf("failed to decode %v: %w", sch.Name, err)
+	}
+
+	row := &memRow{seq: stored.Seq, value: value.Elem()}
+	ms.state.setRow(memKey{table: sch.Table, id: ms.primaryKey(sch, row.value)}, row)
+	return nil
+}
+
+// boltKey encodes a primary key. Integers are encoded big-endian, so that keys are ordered as numbers.
+func boltKey(id any) []byte {
+	v := reflect.ValueOf(id)
+	switch {
+	case v.Kind() == reflect.String:
+		return []byte(v.String())
+	case v.CanInt():
+		return binary.BigEndian.AppendUint64(nil, uint64(v.Int()))
+	case v.CanUint():
+		return binary.BigEndian.AppendUint64(nil, v.Uint())
+	}
+
+	return []byte(fmt.Sprint(id))
+}
+
+// boltIndexKey joins parts of a key of an index entry. Keys of entries end with the primary key of the model,
+// thus a nil last part produces a prefix of the keys.
+func boltIndexKey(parts ...[]byte) []byte {
+	return bytes.Join(parts, []byte{0})
+}
+
+type boltStoreTransaction struct {
+	session *boltSession
+
+	done bool
+}
+
+func (tx *boltStoreTransaction) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	_ = tx.session.tx.Rollback()
+}
+
+// Commit commits the bolt transaction, writing changes to the bolt DB.
+func (tx *boltStoreTransaction) Commit() error {
+	if tx.done {
+		return gorm.ErrInvalidTransaction
+	}
+	tx.done = true
+
+	return tx.session.tx.Commit()
+}
+
+func (tx *boltStoreTransaction) check() error {
+	if tx.done {
+		return gorm.ErrInvalidTransaction
+	}
+	return tx.session.ctx.Err()
+}
+
+func (tx *boltStoreTransaction) Create(value any, options ...Option) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	return tx.session.create(value, options...)
+}
+
+func (tx *boltStoreTransaction) Update(newValue any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.updateByUID(newValue, id, options...)
+}
+
+func (tx *boltStoreTransaction) CreateOrUpdate(newValue any, options ...Option) (exists bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.save(newValue, options...)
+}
+
+func (tx *boltStoreTransaction) GetByUID(dest any, id manifest.ResourceID, options ...Option) (bool, error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.getByUID(dest, id, options...)
+}
+
+func (tx *boltStoreTransaction) GetByName(dest any, name manifest.ResourceName, options ...Option) (bool, error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.getByName(dest, name, options...)
+}
+
+func (tx *boltStoreTransaction) Delete(value any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.delete(value, id, version, options...)
+}
+
+func (tx *boltStoreTransaction) Restore(model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.restore(model, id, options...)
+}
+
+func (tx *boltStoreTransaction) AddLinked(value any, link string, owner any, options ...Option) error {
+	return ErrAssociationsNotSupported
+}
+
+func (tx *boltStoreTransaction) RemoveLinked(value any, link string, owner any) error {
+	return ErrAssociationsNotSupported
+}
+
+func (tx *boltStoreTransaction) ClearLinked(link string, owner any) error {
+	return ErrAssociationsNotSupported
+}
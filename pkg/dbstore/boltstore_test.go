@@ -0,0 +1,256 @@
+package dbstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"gorm.io/gorm"
+)
+
+func openBoltStore(t *testing.T, path string) (*dbstore.BoltStore, func()) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+
+	store, err := dbstore.NewBoltStore(db, dbstore.ManifestModel)
+	require.NoError(t, err)
+
+	return store, func() { require.NoError(t, db.Close()) }
+}
+
+func makeTestBoltStore(t *testing.T, given []Pet) *dbstore.BoltStore {
+	store, cleanup := openBoltStore(t, filepath.Join(t.TempDir(), "wyrd.db"))
+	t.Cleanup(cleanup)
+
+	for _, g := range given {
+		require.NoError(t, store.Create(context.TODO(), &g))
+	}
+
+	return store
+}
+
+func givenBoltPets() []Pet {
+	return []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat", "env": "prod"})),
+		makePet("tom", "Tom", withLabels(manifest.Labels{"kind": "cat", "env": "dev", "age": "3"})),
+		makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog", "env": "prod", "age": "7"})),
+		makePet("spot", "Spot", withLabels(manifest.Labels{"kind": "dog"})),
+		makePet("nemo", "Nemo"),
+	}
+}
+
+func TestNewBoltStore_NoDB(t *testing.T) {
+	_, err := dbstore.NewBoltStore(nil, dbstore.ManifestModel)
+	require.ErrorIs(t, err, dbstore.ErrNoDBObject)
+}
+
+// TestBoltStore_Find checks that search queries served by the label index return the same results as the in-memory store.
+func TestBoltStore_Find(t *testing.T) {
+	testCases := map[string]manifest.SearchQuery{
+		"all":           {},
+		"equals":        {Selector: mustSelector(t, "kind=cat")},
+		"double-equals": {Selector: mustSelector(t, "kind==dog")},
+		"in":            {Selector: mustSelector(t, "env in (prod,dev)")},
+		"exists":        {Selector: mustSelector(t, "age")},
+		"combined":      {Selector: mustSelector(t, "kind=cat,env=prod")},
+		"not-indexed":   {Selector: mustSelector(t, "kind!=cat")},
+		"not-exists":    {Selector: mustSelector(t, "!env")},
+		"greater-than":  {Selector: mustSelector(t, "age>5")},
+		"indexed-and-not": {
+			Selector: mustSelector(t, "env=prod,kind notin (dog)"),
+		},
+		"no match": {Selector: mustSelector(t, "kind=fish")},
+		"name":     {Name: "o"},
+		"limited":  {Selector: mustSelector(t, "kind"), Offset: 1, Limit: 2},
+		"sorted":   {Sort: manifest.SortSpec{{Field: manifest.SortFieldName, Descending: true}}},
+	}
+
+	given := givenBoltPets()
+	bolt := makeTestBoltStore(t, given)
+	mem := makeTestMemStore(t, given)
+
+	for name, tc := range testCases {
+		query := tc
+		t.Run(name, func(t *testing.T) {
+			expect := findNames(t, mem, query)
+			require.Equal(t, expect, findNames(t, bolt, query))
+
+			var pets []Pet
+			total, err := bolt.Find(context.TODO(), &pets, query)
+			require.NoError(t, err)
+			expectTotal, err := mem.Find(context.TODO(), &[]Pet{}, query)
+			require.NoError(t, err)
+			require.Equal(t, expectTotal, total)
+		})
+	}
+
+	_, err := bolt.Find(context.TODO(), &[]Pet{}, manifest.SearchQuery{Selector: manifest.NewSelector(mockRequirement(t, "kind", manifest.Equals))})
+	require.ErrorIs(t, err, dbstore.ErrNoRequirementsValueProvided)
+}
+
+func TestBoltStore_Lifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wyrd.db")
+	store, cleanup := openBoltStore(t, path)
+	ctx := context.TODO()
+
+	require.NoError(t, store.Ping(ctx))
+
+	pet := makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"}))
+	require.NoError(t, store.Create(ctx, &pet))
+	require.NotEmpty(t, pet.UID)
+	require.Equal(t, manifest.Version(1), pet.Version)
+
+	var got Pet
+	found, err := store.GetByName(ctx, &got, "fluffy")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, pet.UID, got.UID)
+	require.Equal(t, "Fluffy", got.Spec.CustomName)
+	require.NotNil(t, got.CreatedAt)
+
+	// Labels and name are re-indexed on update
+	update := Pet{ObjectMeta: manifest.ObjectMeta{Name: "felix", Labels: manifest.Labels{"kind": "lion"}}}
+	updated, err := store.Update(ctx, &update, pet.UID, dbstore.Precondition(pet.Version))
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	_, err = store.Update(ctx, &Pet{}, pet.UID, dbstore.Precondition(pet.Version))
+	require.ErrorIs(t, err, dbstore.ErrVersionConflict)
+
+	require.Empty(t, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")}))
+	require.Equal(t, []manifest.ResourceName{"felix"}, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind=lion")}))
+	found, err = store.GetByName(ctx, &Pet{}, "fluffy")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// Stored models survive reopening the DB
+	cleanup()
+	store, cleanup = openBoltStore(t, path)
+	defer cleanup()
+
+	found, err = store.GetByUID(ctx, &got, pet.UID)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, manifest.ResourceName("felix"), got.Name)
+	require.Equal(t, manifest.Version(2), got.Version)
+
+	// New models follow stored ones
+	second := makePet("tom", "Tom")
+	require.NoError(t, store.Create(ctx, &second))
+	require.Equal(t, []manifest.ResourceName{"felix", "tom"}, findNames(t, store, manifest.SearchQuery{}))
+
+	existed, err := store.Delete(ctx, &Pet{}, pet.UID, 0)
+	require.NoError(t, err)
+	require.True(t, existed)
+	found, err = store.GetByUID(ctx, &Pet{}, pet.UID)
+	require.NoError(t, err)
+	require.False(t, found)
+	found, err = store.GetByUID(ctx, &Pet{}, pet.UID, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+	require.True(t, found)
+
+	restored, err := store.Restore(ctx, &Pet{}, pet.UID)
+	require.NoError(t, err)
+	require.True(t, restored)
+	require.Equal(t, []manifest.ResourceName{"felix", "tom"}, findNames(t, store, manifest.SearchQuery{}))
+
+	// Deleting permanently removes index entries
+	existed, err = store.Delete(ctx, &Pet{}, pet.UID, 0, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.Empty(t, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind")}))
+}
+
+func TestBoltStore_IntegerKeys(t *testing.T) {
+	store := makeTestBoltStore(t, nil)
+	ctx := context.TODO()
+
+	for _, name := range []string{"ball", "bone", "rope"} {
+		toy := Toy{Spec: ToySpec{Name: name}}
+		require.NoError(t, store.Create(ctx, &toy))
+	}
+
+	var toys []Toy
+	_, err := store.Find(ctx, &toys, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Len(t, toys, 3)
+	for i, toy := range toys {
+		require.Equal(t, i+1, toy.ID)
+	}
+
+	require.ErrorIs(t, store.Create(ctx, &Toy{ID: 2}), gorm.ErrDuplicatedKey)
+}
+
+func TestBoltStore_Transaction(t *testing.T) {
+	store := makeTestBoltStore(t, givenBoltPets())
+	ctx := context.TODO()
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	pet := makePet("felix", "Felix")
+	require.NoError(t, tx.Create(&pet))
+	found, err := tx.GetByName(&Pet{}, "felix")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.ErrorIs(t, tx.ClearLinked("Toys", &pet), dbstore.ErrAssociationsNotSupported)
+	tx.Rollback()
+	require.ErrorIs(t, tx.Commit(), gorm.ErrInvalidTransaction)
+
+	found, err = store.GetByName(ctx, &Pet{}, "felix")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	tx, err = store.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, tx.Create(&pet))
+	updated, err := tx.Update(&Pet{ObjectMeta: manifest.ObjectMeta{Labels: manifest.Labels{"kind": "cat"}}}, pet.UID)
+	require.NoError(t, err)
+	require.True(t, updated)
+	existed, err := tx.Delete(&Pet{}, findUID(t, store, "nemo"), 0)
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.NoError(t, tx.Commit())
+
+	require.Equal(t, []manifest.ResourceName{"fluffy", "tom", "felix"}, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")}))
+	found, err = store.GetByName(ctx, &Pet{}, "nemo")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestBoltStore_Labels(t *testing.T) {
+	store := makeTestBoltStore(t, givenBoltPets())
+	ctx := context.TODO()
+
+	_, err := store.Delete(ctx, &Pet{}, findUID(t, store, "tom"), 0)
+	require.NoError(t, err)
+
+	keys, err := store.FindLabels(ctx, &Pet{}, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, manifest.NewStringSet("kind", "env", "age"), keys)
+
+	values, err := store.FindLabelValues(ctx, &Pet{}, "env", manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, manifest.NewStringSet("prod"), values)
+
+	values, err = store.FindLabelValues(ctx, &Pet{}, "env", manifest.SearchQuery{}, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+	require.Equal(t, manifest.NewStringSet("prod", "dev"), values)
+
+	names, err := store.FindNames(ctx, &Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")})
+	require.NoError(t, err)
+	require.Equal(t, manifest.NewStringSet("fluffy"), names)
+}
+
+func findUID(t *testing.T, store dbstore.Store, name manifest.ResourceName) manifest.ResourceID {
+	var pet Pet
+	found, err := store.GetByName(context.TODO(), &pet, name)
+	require.NoError(t, err)
+	require.True(t, found)
+	return pet.UID
+}
@@ -0,0 +1,336 @@
+package dbstore
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// createManySavePoint is a name of the savepoint that CreateMany rolls back to when inserting a value fails.
+	createManySavePoint = "wyrd_create_many"
+
+	// patchLabelsBatchSize is the maximum number of entries PatchLabels changes by a statement, when it changes entries by their IDs.
+	patchLabelsBatchSize = 500
+)
+
+// CreateMany inserts values of a slice into the store, in one statement if possible.
+// This is an implementation of [BulkStore] interface. Values are inserted within a transaction,
+// and values that fail to be inserted are rolled back to a savepoint and skipped.
+func (s *DBStore) CreateMany(ctx context.Context, values any, options ...Option) (created int64, results []error, err error) {
+	err = s.db.WithContext(ctx).Transaction(func(db *gorm.DB) (err error) {
+		created, results, err = (&gormStoreTransaction{db: db, config: s.config}).CreateMany(values, options...)
+		return err
+	})
+	return
+}
+
+// DeleteMany deletes entries that match search query. Entries are soft-deleted if the model supports it, unless [IncludeDeleted] option is given.
+// This is an implementation of [BulkStore] interface.
+func (s *DBStore) DeleteMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	return s.singleTransaction(ctx).DeleteMany(model, searchQuery, options...)
+}
+
+// RestoreMany restores soft-deleted entries that match search query.
+// This is an implementation of [BulkStore] interface.
+func (s *DBStore) RestoreMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	return s.singleTransaction(ctx).RestoreMany(model, searchQuery, options...)
+}
+
+// PatchLabels changes labels of entries that match search query in one statement, using JSON functions of the DB,
+// and increments their version. This is an implementation of [BulkStore] interface.
+// Revisions of changed entries are recorded if revision history is enabled for the model, see [EnableRevisionHistory].
+func (s *DBStore) PatchLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error) {
+	return s.singleTransaction(ctx).PatchLabels(model, searchQuery, patch, options...)
+}
+
+func (tx *gormStoreTransaction) CreateMany(values any, options ...Option) (created int64, results []error, err error) {
+	items := reflect.Indirect(reflect.ValueOf(values))
+	if items.Kind() != reflect.Slice {
+		return 0, nil, gorm.ErrInvalidValue
+	}
+
+	results = make([]error, items.Len())
+	if items.Len() == 0 {
+		return 0, results, nil
+	}
+
+	// Hooks modify values on failed inserts too, thus they are restored before inserting values one by one
+	originals := make([]reflect.Value, items.Len())
+	for i := range originals {
+		originals[i] = reflect.New(reflect.Indirect(items.Index(i)).Type()).Elem()
+		originals[i].Set(reflect.Indirect(items.Index(i)))
+	}
+
+	if err := tx.db.SavePoint(createManySavePoint).Error; err != nil {
+		return 0, results, err
+	}
+	rtx, _ := applyOptions(tx.db, tx.config, values, options...)
+	if rx := rtx.Create(values); rx.Error == nil {
+		return rx.RowsAffected, results, nil
+	}
+	if err := tx.db.RollbackTo(createManySavePoint).Error; err != nil {
+		return 0, results, err
+	}
+
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i)
+		reflect.Indirect(item).Set(originals[i])
+		if item.Kind() != reflect.Pointer {
+			item = item.Addr()
+		}
+
+		if err := tx.db.SavePoint(createManySavePoint).Error; err != nil {
+			return created, results, err
+		}
+		rtx, _ := applyOptions(tx.db, tx.config, item.Interface(), options...)
+		if results[i] = rtx.Create(item.Interface()).Error; results[i] != nil {
+			if err := tx.db.RollbackTo(createManySavePoint).Error; err != nil {
+				return created, results, err
+			}
+			continue
+		}
+		created++
+	}
+
+	return created, results, nil
+}
+
+func (tx *gormStoreTransaction) DeleteMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	tContext := resolveOptions(tx.config, model, options...)
+	matched, err := matchQuery(tx.db, model, tContext, searchQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	rtx := tx.db.Model(model)
+	if tContext.unScoped {
+		rtx = rtx.Unscoped()
+	}
+
+	rx := rtx.Where(matched).Delete(model)
+	return rx.RowsAffected, rx.Error
+}
+
+func (tx *gormStoreTransaction) RestoreMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	tContext := resolveOptions(tx.config, model, options...)
+	tContext.unScoped = true
+	matched, err := matchQuery(tx.db, model, tContext, searchQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	rx := tx.db.Model(model).Unscoped().
+		Where(matched).
+		Where(clause.Neq{Column: clause.Column{Name: tx.config.DeletedAtColumnName}, Value: nil}).
+		Update(tx.config.DeletedAtColumnName, nil)
+	return rx.RowsAffected, rx.Error
+}
+
+func (tx *gormStoreTransaction) PatchLabels(model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error) {
+	if patch.Empty() {
+		return 0, nil
+	}
+
+	tContext := resolveOptions(tx.config, model, options...)
+	matched, err := matchQuery(tx.db, model, tContext, searchQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	rtx := tx.db.Model(model)
+	if tContext.unScoped {
+		rtx = rtx.Unscoped()
+	}
+	update := func(matched clause.Expression) (int64, error) {
+		rx := rtx.Session(&gorm.Session{}).Where(matched).Updates(map[string]any{
+			tx.config.LabelsColumnName:  labelsPatchExpression{column: tx.config.LabelsColumnName, patch: patch},
+			tx.config.VersionColumnName: gorm.Expr("? + 1", clause.Column{Name: tx.config.VersionColumnName}),
+		})
+		return rx.RowsAffected, rx.Error
+	}
+
+	// Full-text and label indexes include label values, thus entries changed must be re-indexed.
+	// Statement callbacks can not tell which entries are changed either, thus their revisions are recorded here
+	fts, s, ftsIndexed := fullTextIndexed(tx.db, model)
+	labelIndex, ls, labelsIndexed := labelIndexed(tx.db, model)
+	revisions, rs, revisioned := revisionsRecorded(tx.db, model)
+	if !ftsIndexed && !labelsIndexed && !revisioned {
+		return update(matched)
+	}
+
+	var ids []any
+	if err := tx.db.Model(model).Unscoped().Where(matched).Pluck(tx.config.IDColumnName, &ids).Error; err != nil {
+		return 0, err
+	}
+
+	// Entries are changed in batches of IDs, as DBs limit the number of parameters of a statement
+	for batch := range slices.Chunk(ids, patchLabelsBatchSize) {
+		rows, err := update(clause.IN{Column: clause.Column{Name: tx.config.IDColumnName}, Values: batch})
+		affected += rows
+		if err != nil {
+			return affected, err
+		}
+
+		if ftsIndexed {
+			if err := fts.reindex(tx.db, s, batch); err != nil {
+				return affected, err
+			}
+		}
+		if labelsIndexed {
+			if err := labelIndex.reindex(tx.db, ls, batch); err != nil {
+				return affected, err
+			}
+		}
+		if revisioned {
+			if err := revisions.recordIDs(tx.db, rs, batch, tContext.author); err != nil {
+				return affected, err
+			}
+		}
+	}
+
+	return affected, nil
+}
+
+// findMatching reads entries that bulk operations select by search query into dest, a pointer to a slice of models.
+func (tx *gormStoreTransaction) findMatching(dest any, searchQuery manifest.SearchQuery, options ...Option) error {
+	tContext := resolveOptions(tx.config, dest, options...)
+	matched, err := matchQuery(tx.db, dest, tContext, searchQuery)
+	if err != nil {
+		return err
+	}
+
+	return tx.db.Unscoped().Where(matched).Find(dest).Error
+}
+
+// matchQuery returns a condition selecting entries of the model that match search query, as Find would select them, by their IDs.
+// Matching entries are selected by a sub-query, so that sorting, limits and full-text search of the query apply.
+func matchQuery(db *gorm.DB, model any, tContext transactionContext, query manifest.SearchQuery) (clause.Expression, error) {
+	id := tContext.Config.IDColumnName
+	sub := db.Session(&gorm.Session{NewDB: true}).Model(model)
+	if tContext.unScoped {
+		sub = sub.Unscoped()
+	}
+
+	sub, _, err := withQuery(sub, nil, tContext, query)
+	if err != nil {
+		return nil, err
+	}
+	sub = sub.Select("?", clause.Column{Table: clause.CurrentTable, Name: id})
+
+	// Sub-query is wrapped into a derived table, as MySQL does not allow to select from the table being modified
+	return clause.Expr{
+		SQL:  "? IN (SELECT ? FROM (?) AS wyrd_matched)",
+		Vars: []any{clause.Column{Name: id}, clause.Column{Name: id}, sub},
+	}, nil
+}
+
+// labelsPatchExpression is an expression evaluating to labels in the JSON column patched with [LabelPatch].
+// Labels that are not a JSON object, such as NULL, are patched as if they were empty.
+type labelsPatchExpression struct {
+	column string
+	patch  LabelPatch
+}
+
+// Build implements clause.Expression
+func (e labelsPatchExpression) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		return
+	}
+
+	switch stmt.Dialector.Name() {
+	case "mysql", "sqlite":
+		// Functions are nested so that the innermost is applied first: JSON_INSERT keeps existing keys, JSON_SET overwrites them
+		if len(e.patch.Remove) > 0 {
+			builder.WriteString("JSON_REMOVE(")
+		}
+		if len(e.patch.Set) > 0 {
+			builder.WriteString("JSON_SET(")
+		}
+		if len(e.patch.Add) > 0 {
+			builder.WriteString("JSON_INSERT(")
+		}
+
+		builder.WriteString("CASE WHEN UPPER(JSON_TYPE(")
+		builder.WriteQuoted(e.column)
+		builder.WriteString(")) = 'OBJECT' THEN ")
+		builder.WriteQuoted(e.column)
+		builder.WriteString(" ELSE '{}' END")
+
+		for _, labels := range []manifest.Labels{e.patch.Add, e.patch.Set} {
+			if len(labels) == 0 {
+				continue
+			}
+			for _, key := range labels.Slice() {
+				builder.WriteByte(',')
+				builder.AddVar(stmt, jsonQueryJoin([]string{key}))
+				builder.WriteByte(',')
+				builder.AddVar(stmt, labels[key])
+			}
+			builder.WriteByte(')')
+		}
+		if len(e.patch.Remove) > 0 {
+			for _, key := range e.patch.Remove {
+				builder.WriteByte(',')
+				builder.AddVar(stmt, jsonQueryJoin([]string{key}))
+			}
+			builder.WriteByte(')')
+		}
+	case "postgres":
+		// Right operand of || wins, thus added labels go to the left of existing ones, and set labels to the right
+		builder.WriteString("((")
+		if len(e.patch.Add) > 0 {
+			builder.AddVar(stmt, labelsJSON(e.patch.Add))
+			builder.WriteString("::jsonb || ")
+		}
+
+		builder.WriteString("(CASE WHEN json_typeof(")
+		builder.WriteQuoted(e.column)
+		builder.WriteString("::json) = 'object' THEN ")
+		builder.WriteQuoted(e.column)
+		builder.WriteString("::jsonb ELSE '{}'::jsonb END)")
+
+		if len(e.patch.Set) > 0 {
+			builder.WriteString(" || ")
+			builder.AddVar(stmt, labelsJSON(e.patch.Set))
+			builder.WriteString("::jsonb")
+		}
+		builder.WriteString(")")
+		for _, key := range e.patch.Remove {
+			builder.WriteString(" - ")
+			builder.AddVar(stmt, key)
+			builder.WriteString("::text")
+		}
+		builder.WriteString(")::json")
+	}
+}
+
+func labelsJSON(labels manifest.Labels) string {
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// fullTextIndexed returns full-text search plugin and schema of the model, if the model is indexed.
+func fullTextIndexed(db *gorm.DB, model any) (*FullTextSearch, *schema.Schema, bool) {
+	p, ok := fullTextPlugin(db)
+	if !ok {
+		return nil, nil, false
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, nil, false
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return nil, nil, false
+	}
+
+	return p, stmt.Schema, true
+}
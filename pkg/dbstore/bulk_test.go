@@ -0,0 +1,208 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func givenLabeledPets() []Pet {
+	return []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat", "env": "dev"})),
+		makePet("tom", "Tom", withLabels(manifest.Labels{"kind": "cat", "env": "prod"})),
+		makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog"})),
+		makePet("nemo", "Nemo"),
+	}
+}
+
+func mustSelector(t testing.TB, selector string) manifest.Selector {
+	result, err := manifest.ParseSelector(selector)
+	require.NoError(t, err)
+	return result
+}
+
+func findNames(t *testing.T, store dbstore.Store, query manifest.SearchQuery, options ...dbstore.Option) []manifest.ResourceName {
+	var pets []Pet
+	_, err := store.Find(context.TODO(), &pets, query, options...)
+	require.NoError(t, err)
+
+	result := make([]manifest.ResourceName, 0, len(pets))
+	for _, p := range pets {
+		result = append(result, p.Name)
+	}
+	return result
+}
+
+func TestStore_DeleteMany(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, givenLabeledPets())
+			defer cleanup()
+			ctx := context.TODO()
+
+			affected, err := store.DeleteMany(ctx, &Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")})
+			require.NoError(t, err)
+			require.Equal(t, int64(2), affected)
+			require.ElementsMatch(t, []manifest.ResourceName{"rex", "nemo"}, findNames(t, store, manifest.SearchQuery{}))
+
+			// Already deleted entries are not deleted again
+			affected, err = store.DeleteMany(ctx, &Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")})
+			require.NoError(t, err)
+			require.Equal(t, int64(0), affected)
+
+			affected, err = store.RestoreMany(ctx, &Pet{}, manifest.SearchQuery{Name: "tom"})
+			require.NoError(t, err)
+			require.Equal(t, int64(1), affected)
+			require.ElementsMatch(t, []manifest.ResourceName{"tom", "rex", "nemo"}, findNames(t, store, manifest.SearchQuery{}))
+
+			// Limit of the query applies
+			affected, err = store.DeleteMany(ctx, &Pet{}, manifest.SearchQuery{Limit: 1})
+			require.NoError(t, err)
+			require.Equal(t, int64(1), affected)
+			require.Len(t, findNames(t, store, manifest.SearchQuery{}), 2)
+		})
+	}
+}
+
+func TestStore_PatchLabels(t *testing.T) {
+	testCases := map[string]struct {
+		givenQuery manifest.SearchQuery
+		givenPatch dbstore.LabelPatch
+
+		expectAffected int64
+		expect         map[manifest.ResourceName]manifest.Labels
+	}{
+		"add keeps existing": {
+			givenQuery:     manifest.SearchQuery{Name: "e"},
+			givenPatch:     dbstore.LabelPatch{Add: manifest.Labels{"env": "test", "owner": "alice"}},
+			expectAffected: 2,
+			expect: map[manifest.ResourceName]manifest.Labels{
+				"rex":  {"kind": "dog", "env": "test", "owner": "alice"},
+				"nemo": {"env": "test", "owner": "alice"},
+			},
+		},
+		"set overwrites": {
+			givenQuery:     manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")},
+			givenPatch:     dbstore.LabelPatch{Set: manifest.Labels{"env": "staging"}},
+			expectAffected: 2,
+			expect: map[manifest.ResourceName]manifest.Labels{
+				"fluffy": {"kind": "cat", "env": "staging"},
+				"tom":    {"kind": "cat", "env": "staging"},
+			},
+		},
+		"remove": {
+			givenQuery:     manifest.SearchQuery{Selector: mustSelector(t, "env")},
+			givenPatch:     dbstore.LabelPatch{Remove: []string{"env", "missing"}},
+			expectAffected: 2,
+			expect: map[manifest.ResourceName]manifest.Labels{
+				"fluffy": {"kind": "cat"},
+				"tom":    {"kind": "cat"},
+			},
+		},
+		"all at once": {
+			givenQuery: manifest.SearchQuery{Name: "fluffy"},
+			givenPatch: dbstore.LabelPatch{
+				Add:    manifest.Labels{"kind": "dog", "owner": "bob"},
+				Set:    manifest.Labels{"env": "prod"},
+				Remove: []string{"kind"},
+			},
+			expectAffected: 1,
+			expect: map[manifest.ResourceName]manifest.Labels{
+				"fluffy": {"env": "prod", "owner": "bob"},
+			},
+		},
+		"no matches": {
+			givenQuery: manifest.SearchQuery{Selector: mustSelector(t, "kind=fish")},
+			givenPatch: dbstore.LabelPatch{Set: manifest.Labels{"env": "prod"}},
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			for storeName, makeStore := range testStores {
+				t.Run(storeName, func(t *testing.T) {
+					store, cleanup := makeStore(t, givenLabeledPets())
+					defer cleanup()
+					ctx := context.TODO()
+
+					affected, err := store.PatchLabels(ctx, &Pet{}, test.givenQuery, test.givenPatch)
+					require.NoError(t, err)
+					require.Equal(t, test.expectAffected, affected)
+
+					for name, labels := range test.expect {
+						var got Pet
+						exists, err := store.GetByName(ctx, &got, name)
+						require.NoError(t, err)
+						require.True(t, exists)
+						require.Equal(t, labels, got.Labels)
+						require.Equal(t, manifest.Version(2), got.Version)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestStore_CreateMany(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, nil)
+			defer cleanup()
+			ctx := context.TODO()
+
+			fluffy := makePet("fluffy", "Fluffy")
+			require.NoError(t, store.Create(ctx, &fluffy))
+
+			duplicate := makePet("fluffy-copy", "Fluffy")
+			duplicate.UID = fluffy.UID
+			pets := []Pet{makePet("tom", "Tom"), duplicate, makePet("rex", "Rex")}
+
+			created, results, err := store.CreateMany(ctx, &pets)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), created)
+			require.Len(t, results, 3)
+			require.NoError(t, results[0])
+			require.Error(t, results[1])
+			require.NoError(t, results[2])
+			require.ElementsMatch(t, []manifest.ResourceName{"fluffy", "tom", "rex"}, findNames(t, store, manifest.SearchQuery{}))
+			require.Equal(t, manifest.Version(1), pets[0].Version)
+
+			// All values are created at once
+			more := []Pet{makePet("nemo", "Nemo"), makePet("kitty", "Kitty")}
+			created, results, err = store.CreateMany(ctx, &more)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), created)
+			require.Equal(t, []error{nil, nil}, results)
+		})
+	}
+}
+
+func TestStore_BulkInTransaction(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, givenLabeledPets())
+			defer cleanup()
+			ctx := context.TODO()
+
+			tx, err := store.Begin(ctx)
+			require.NoError(t, err)
+			bulk, ok := tx.(dbstore.BulkTransaction)
+			require.True(t, ok)
+
+			affected, err := bulk.PatchLabels(&Pet{}, manifest.SearchQuery{}, dbstore.LabelPatch{Set: manifest.Labels{"owner": "alice"}})
+			require.NoError(t, err)
+			require.Equal(t, int64(4), affected)
+			affected, err = bulk.DeleteMany(&Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=dog")})
+			require.NoError(t, err)
+			require.Equal(t, int64(1), affected)
+			tx.Rollback()
+
+			require.Len(t, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "owner")}), 0)
+			require.Len(t, findNames(t, store, manifest.SearchQuery{}), 4)
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package dbstore
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotTransactional error is returned by [CachedStore.Begin] when the wrapped store does not implement [Transactional] interface.
+var ErrNotTransactional = errors.New("store does not support transactions")
+
+const (
+	// defaultCacheSize is the maximum number of cached entries, unless set by [CachedStore.Size].
+	defaultCacheSize = 1024
+	// defaultCacheTTL is how long entries are cached for, unless set by [CachedStore.TTL].
+	defaultCacheTTL = time.Minute
+
+	// Kinds of lookups of cached entries.
+	cacheByUID  = "uid"
+	cacheByName = "name"
+	cacheByFind = "find"
+)
+
+// CacheStats are metrics of a [CachedStore] so far.
+type CacheStats struct {
+	// Hits is the number of reads served from the cache.
+	Hits int64
+	// Misses is the number of cacheable reads passed to the wrapped store, because their results were not cached.
+	Misses int64
+	// Evictions is the number of entries dropped to keep the cache within its size.
+	Evictions int64
+	// Expirations is the number of entries dropped because they were cached for longer than TTL.
+	Expirations int64
+	// Invalidations is the number of entries dropped because models they hold were written.
+	Invalidations int64
+	// Entries is the number of entries in the cache.
+	Entries int
+}
+
+// CachedStore is a read-through cache of a [Store] that keeps recently read models in memory,
+// to serve hot resources fetched by GetByUID and GetByName without a round trip to the DB.
+//
+// Models are cached by their Go type and UID or name, and the least recently used ones are evicted once there are more than Size of them.
+// Results of Find are cached by normalized search query if CacheFind is set. Entries expire after TTL, which bounds staleness
+// of models changed by other processes. Writes through the cache, and commits of its transactions, drop cached entries of models they change,
+// as well as all cached search results of the model type.
+//
+// Only reads with no options other than [Count] are cached. Thus reads with [IncludeDeleted] never see cached entries,
+// and as soft-deleted models are not found by other reads, they are never cached. Reads that find nothing are not cached either.
+// Use [ReadFromPrimary] to bypass the cache, for example to read a value that must be up to date.
+//
+// Note: writes that bypass the cache, including ones through the store returned by [CachedStore.Unwrap], are only observed after TTL,
+// unless [CachedStore.Invalidate] is called.
+type CachedStore struct {
+	store   Store
+	config  SchemaConfig
+	schemas sync.Map
+
+	// Size is the maximum number of cached entries. Defaults to 1024.
+	Size int
+	// TTL is how long entries are cached for. Defaults to 1 minute.
+	TTL time.Duration
+	// CacheFind enables caching of results of Find.
+	CacheFind bool
+	// Meter records metrics of the cache, in addition to [CachedStore.Stats]. No metrics are recorded if it is nil.
+	Meter Meter
+
+	lock    sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	tags    map[cacheTag]map[*list.Element]struct{}
+	// generations of model types, advanced by writes so that reads started before a write do not cache their results.
+	generations map[reflect.Type]uint64
+	stats       CacheStats
+}
+
+type cacheKey struct {
+	model reflect.Type
+	by    string
+	key   string
+}
+
+// cacheTag identifies cached entries dropped when a model is written. Search results are tagged with an empty ID.
+type cacheTag struct {
+	model reflect.Type
+	id    string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	tag     cacheTag
+	value   reflect.Value
+	total   int64
+	expires time.Time
+}
+
+// NewCachedStore creates a cache of the store.
+func NewCachedStore(store Store, config SchemaConfig) *CachedStore {
+	return &CachedStore{
+		store:       store,
+		config:      config,
+		entries:     map[cacheKey]*list.Element{},
+		lru:         list.New(),
+		tags:        map[cacheTag]map[*list.Element]struct{}{},
+		generations: map[reflect.Type]uint64{},
+	}
+}
+
+// Unwrap returns the cached store, for example to use interfaces it implements other than [Store].
+func (c *CachedStore) Unwrap() Store {
+	return c.store
+}
+
+// Stats returns metrics of the cache so far.
+func (c *CachedStore) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := c.stats
+	result.Entries = c.lru.Len()
+	return result
+}
+
+// Invalidate drops cached entries of models of the type with the IDs, and cached search results of the type.
+// Use it when models are changed bypassing the cache, for example on [WatchEvent] of a change by another process.
+func (c *CachedStore) Invalidate(model any, ids ...manifest.ResourceID) {
+	t := cacheModelType(model)
+	if t == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, string(id))
+	}
+	c.invalidate(t, keys)
+}
+
+// Ping implements [Pinger] interface, checking connectivity of the cached store if it is a Pinger.
+func (c *CachedStore) Ping(ctx context.Context) error {
+	if pinger, ok := c.store.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return ctx.Err()
+}
+
+// Begin opens a transaction of the cached store. Entries of models written by the transaction are dropped once it is committed.
+// Reads of the transaction are not cached.
+// Note: It's a caller responsibility to call Transaction.Commit() or Transaction.Rollback() to complete the transaction.
+func (c *CachedStore) Begin(ctx context.Context) (StoreTransaction, error) {
+	transactional, ok := c.store.(Transactional)
+	if !ok {
+		return nil, ErrNotTransactional
+	}
+
+	tx, err := transactional.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedStoreTransaction{
+		StoreTransaction: tx,
+		cache:            c,
+		written:          map[reflect.Type][]string{},
+	}, nil
+}
+
+// GetByUID finds at most one entry in the store identified by the UUID if there is one, from the cache if it holds it.
+// See [DBStore.GetByUID].
+func (c *CachedStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	return c.get(dest, cacheByUID, string(id), options, func() (bool, error) {
+		return c.store.GetByUID(ctx, dest, id, options...)
+	})
+}
+
+// GetByName finds at most one entry in the store identified by the name if there is one, from the cache if it holds it.
+// See [DBStore.GetByName].
+func (c *CachedStore) GetByName(ctx context.Context, dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	return c.get(dest, cacheByName, string(name), options, func() (bool, error) {
+		return c.store.GetByName(ctx, dest, name, options...)
+	})
+}
+
+// Find returns models from the store that matched search query parameters, from the cache if [CachedStore.CacheFind] is set and it holds them.
+// See [DBStore.Find].
+func (c *CachedStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
+	ptr := reflect.ValueOf(dest)
+	model := cacheModelType(dest)
+	tContext, cacheable := c.cacheable(dest, options)
+	if !c.CacheFind || !cacheable || model == nil || ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return c.store.Find(ctx, dest, searchQuery, options...)
+	}
+
+	key := cacheKey{model: model, by: cacheByFind, key: cacheQueryKey(searchQuery, tContext)}
+	if entry, ok := c.lookup(key); ok {
+		ptr.Elem().Set(deepCopy(entry.value))
+		return entry.total, nil
+	}
+
+	generation := c.generation(model)
+	total, err = c.store.Find(ctx, dest, searchQuery, options...)
+	if err != nil {
+		return total, err
+	}
+
+	c.put(key, cacheTag{model: model}, generation, deepCopy(ptr.Elem()), total)
+	return total, nil
+}
+
+// Create inserts a new value into the store, updating inserted models ID.
+func (c *CachedStore) Create(ctx context.Context, value any, options ...Option) error {
+	err := c.store.Create(ctx, value, options...)
+	c.invalidate(cacheModelType(value), c.idsOf(value))
+	return err
+}
+
+// CreateOrUpdate inserts a new value into the store if the models.ID is nil, otherwise it replaces it.
+func (c *CachedStore) CreateOrUpdate(ctx context.Context, value any, options ...Option) (exists bool, err error) {
+	exists, err = c.store.CreateOrUpdate(ctx, value, options...)
+	c.invalidate(cacheModelType(value), c.idsOf(value))
+	return
+}
+
+// Update updates non-zero fields of an entry identified by the ID of the value.
+// See [DBStore.Update].
+func (c *CachedStore) Update(ctx context.Context, value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	exists, err = c.store.Update(ctx, value, id, options...)
+	c.invalidate(cacheModelType(value), append(c.idsOf(value), string(id)))
+	return
+}
+
+// Delete deletes an entry identified by the ID from the store.
+// See [DBStore.Delete].
+func (c *CachedStore) Delete(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	existed, err = c.store.Delete(ctx, model, id, version, options...)
+	c.invalidate(cacheModelType(model), []string{string(id)})
+	return
+}
+
+// Restore restores a previously deleted entry identified by the ID.
+// See [DBStore.Restore].
+func (c *CachedStore) Restore(ctx context.Context, model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	existed, err = c.store.Restore(ctx, model, id, options...)
+	c.invalidate(cacheModelType(model), []string{string(id)})
+	return
+}
+
+// get serves a read of one model from the cache, or caches the model found by fetch.
+func (c *CachedStore) get(dest any, by, key string, options []Option, fetch func() (bool, error)) (bool, error) {
+	ptr := reflect.ValueOf(dest)
+	model := cacheModelType(dest)
+	if _, cacheable := c.cacheable(dest, options); !cacheable || model == nil || ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return fetch()
+	}
+
+	cKey := cacheKey{model: model, by: by, key: key}
+	if entry, ok := c.lookup(cKey); ok {
+		ptr.Elem().Set(deepCopy(entry.value))
+		return true, nil
+	}
+
+	generation := c.generation(model)
+	exists, err := fetch()
+	if err != nil || !exists {
+		return exists, err
+	}
+
+	if ids := c.idsOf(dest); len(ids) == 1 {
+		c.put(cKey, cacheTag{model: model, id: ids[0]}, generation, deepCopy(ptr.Elem()), 0)
+	}
+	return true, nil
+}
+
+// cacheable returns true if results of a read with the options can be cached.
+func (c *CachedStore) cacheable(value any, options []Option) (transactionContext, bool) {
+	tContext := resolveOptions(c.config, value, options...)
+	return tContext, !tContext.unScoped && !tContext.readPrimary &&
+		len(tContext.Omit) == 0 && len(tContext.Expand) == 0 && len(tContext.Order.OrderColumns) == 0 && len(tContext.Sortable) == 0 &&
+		tContext.withVersion == nil && tContext.precondition == nil && tContext.nextToken == nil
+}
+
+// idsOf returns IDs of models of the value, which can be a pointer to a struct or a slice.
+func (c *CachedStore) idsOf(value any) []string {
+	sch, err := schema.Parse(value, &c.schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil
+	}
+	field := sch.LookUpField(c.config.IDColumnName)
+	if field == nil {
+		return nil
+	}
+
+	var result []string
+	_ = eachModel(value, func(v reflect.Value) error {
+		if id, ok := fieldByIndex(v.Elem(), field.StructField.Index); ok && !id.IsZero() {
+			result = append(result, fmt.Sprint(id.Interface()))
+		}
+		return nil
+	})
+	return result
+}
+
+// lookup returns a cached entry, marking it as recently used.
+func (c *CachedStore) lookup(key cacheKey) (*cacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.count(&c.stats.Misses, MetricCacheMisses, key.model, 1)
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expires) {
+		c.remove(element)
+		c.count(&c.stats.Expirations, MetricCacheExpirations, key.model, 1)
+		c.count(&c.stats.Misses, MetricCacheMisses, key.model, 1)
+		c.reportEntries()
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	c.count(&c.stats.Hits, MetricCacheHits, key.model, 1)
+	return entry, true
+}
+
+func (c *CachedStore) generation(model reflect.Type) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.generations[model]
+}
+
+// put caches the value, unless a model of the type has been written since the generation was observed,
+// as the value may have been read before the write. Least recently used entries are evicted to keep the cache within its size.
+func (c *CachedStore) put(key cacheKey, tag cacheTag, generation uint64, value reflect.Value, total int64) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	size := c.Size
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.generations[key.model] != generation {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	element := c.lru.PushFront(&cacheEntry{key: key, tag: tag, value: value, total: total, expires: time.Now().Add(ttl)})
+	c.entries[key] = element
+	if c.tags[tag] == nil {
+		c.tags[tag] = map[*list.Element]struct{}{}
+	}
+	c.tags[tag][element] = struct{}{}
+
+	for c.lru.Len() > size {
+		evicted := c.lru.Back()
+		c.remove(evicted)
+		c.count(&c.stats.Evictions, MetricCacheEvictions, evicted.Value.(*cacheEntry).key.model, 1)
+	}
+	c.reportEntries()
+}
+
+// invalidate drops entries of models of the type with the IDs and search results of the type.
+func (c *CachedStore) invalidate(model reflect.Type, ids []string) {
+	if model == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generations[model]++
+	var invalidated int64
+	for _, id := range append([]string{""}, ids...) {
+		for element := range c.tags[cacheTag{model: model, id: id}] {
+			c.remove(element)
+			invalidated++
+		}
+	}
+	if invalidated > 0 {
+		c.count(&c.stats.Invalidations, MetricCacheInvalidations, model, invalidated)
+		c.reportEntries()
+	}
+}
+
+// count adds the increment to the counter of stats, and to the metric of models of the type, if there is a meter.
+// It must be called with the lock held.
+func (c *CachedStore) count(counter *int64, metric string, model reflect.Type, increment int64) {
+	*counter += increment
+	if c.Meter != nil {
+		c.Meter.Add(metric, increment, manifest.Labels{MetricLabelModel: model.Name()})
+	}
+}
+
+// reportEntries records the number of cached entries, if there is a meter. It must be called with the lock held.
+func (c *CachedStore) reportEntries() {
+	if c.Meter != nil {
+		c.Meter.Set(MetricCacheEntries, float64(c.lru.Len()), nil)
+	}
+}
+
+func (c *CachedStore) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	if elements := c.tags[entry.tag]; elements != nil {
+		delete(elements, element)
+		if len(elements) == 0 {
+			delete(c.tags, entry.tag)
+		}
+	}
+}
+
+// cacheModelType returns the type of models of the value, which can be a struct, a slice or a pointer to either.
+func cacheModelType(value any) reflect.Type {
+	if value == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return t
+}
+
+// cacheQueryKey returns a key of results of the search query, that is the same for queries that select the same results:
+// requirements of the selector are sorted, and times are in UTC.
+func cacheQueryKey(query manifest.SearchQuery, tContext transactionContext) string {
+	var requirements []string
+	if query.Selector != nil {
+		reqs, _ := query.Selector.Requirements()
+		for _, req := range reqs {
+			requirements = append(requirements, req.String())
+		}
+		slices.Sort(requirements)
+	}
+
+	key, _ := json.Marshal(struct {
+		Selector  []string           `json:"s,omitempty"`
+		Name      string             `json:"n,omitempty"`
+		Text      string             `json:"q,omitempty"`
+		FromTime  time.Time          `json:"f"`
+		TillTime  time.Time          `json:"t"`
+		TimeField manifest.TimeField `json:"tf,omitempty"`
+		Sort      string             `json:"o,omitempty"`
+		Continue  string             `json:"c,omitempty"`
+		Offset    uint               `json:"off,omitempty"`
+		Limit     uint               `json:"l,omitempty"`
+		NoCount   bool               `json:"nc,omitempty"`
+	}{
+		Selector:  requirements,
+		Name:      query.Name,
+		Text:      query.Text,
+		FromTime:  query.FromTime.UTC(),
+		TillTime:  query.TillTime.UTC(),
+		TimeField: query.TimeField,
+		Sort:      query.Sort.String(),
+		Continue:  query.Continue,
+		Offset:    query.Offset,
+		Limit:     query.Limit,
+		NoCount:   tContext.disableCounting,
+	})
+	return string(key)
+}
+
+// cachedStoreTransaction records models written by the transaction, to drop their cached entries once it is committed.
+type cachedStoreTransaction struct {
+	StoreTransaction
+
+	cache   *CachedStore
+	written map[reflect.Type][]string
+}
+
+func (tx *cachedStoreTransaction) record(value any, ids ...string) {
+	if t := cacheModelType(value); t != nil {
+		tx.written[t] = append(tx.written[t], append(tx.cache.idsOf(value), ids...)...)
+	}
+}
+
+// Commit commits the transaction, then drops cached entries of models it wrote.
+// Entries are dropped even if the commit fails, as the outcome of a failed commit may not be known.
+func (tx *cachedStoreTransaction) Commit() error {
+	err := tx.StoreTransaction.Commit()
+	for t, ids := range tx.written {
+		tx.cache.invalidate(t, ids)
+	}
+	clear(tx.written)
+	return err
+}
+
+func (tx *cachedStoreTransaction) Create(value any, options ...Option) error {
+	err := tx.StoreTransaction.Create(value, options...)
+	tx.record(value)
+	return err
+}
+
+func (tx *cachedStoreTransaction) Update(value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	exists, err = tx.StoreTransaction.Update(value, id, options...)
+	tx.record(value, string(id))
+	return
+}
+
+func (tx *cachedStoreTransaction) Delete(model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	existed, err = tx.StoreTransaction.Delete(model, id, version, options...)
+	tx.record(model, string(id))
+	return
+}
+
+func (tx *cachedStoreTransaction) AddLinked(model any, link string, owner any, options ...Option) error {
+	err := tx.StoreTransaction.AddLinked(model, link, owner, options...)
+	tx.record(model)
+	tx.record(owner)
+	return err
+}
+
+func (tx *cachedStoreTransaction) RemoveLinked(model any, link string, owner any) error {
+	err := tx.StoreTransaction.RemoveLinked(model, link, owner)
+	tx.record(model)
+	tx.record(owner)
+	return err
+}
+
+func (tx *cachedStoreTransaction) ClearLinked(link string, owner any) error {
+	err := tx.StoreTransaction.ClearLinked(link, owner)
+	tx.record(owner)
+	return err
+}
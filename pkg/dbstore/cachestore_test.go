@@ -0,0 +1,234 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts reads that reach the store.
+type countingStore struct {
+	*dbstore.MemStore
+
+	gets  int
+	finds int
+}
+
+func (s *countingStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...dbstore.Option) (bool, error) {
+	s.gets++
+	return s.MemStore.GetByUID(ctx, dest, id, options...)
+}
+
+func (s *countingStore) GetByName(ctx context.Context, dest any, name manifest.ResourceName, options ...dbstore.Option) (bool, error) {
+	s.gets++
+	return s.MemStore.GetByName(ctx, dest, name, options...)
+}
+
+func (s *countingStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...dbstore.Option) (int64, error) {
+	s.finds++
+	return s.MemStore.Find(ctx, dest, searchQuery, options...)
+}
+
+func makeTestCachedStore(t *testing.T, given []Pet) (*dbstore.CachedStore, *countingStore) {
+	inner := &countingStore{MemStore: makeTestMemStore(t, given)}
+	return dbstore.NewCachedStore(inner, dbstore.ManifestModel), inner
+}
+
+func getPet(t *testing.T, store dbstore.Store, name manifest.ResourceName, options ...dbstore.Option) (Pet, bool) {
+	var pet Pet
+	found, err := store.GetByName(context.TODO(), &pet, name, options...)
+	require.NoError(t, err)
+	return pet, found
+}
+
+func TestCachedStore_Get(t *testing.T) {
+	store, inner := makeTestCachedStore(t, givenBoltPets())
+	ctx := context.TODO()
+
+	fluffy, found := getPet(t, store, "fluffy")
+	require.True(t, found)
+	cached, found := getPet(t, store, "fluffy")
+	require.True(t, found)
+	require.Equal(t, fluffy, cached)
+	require.Equal(t, 1, inner.gets)
+
+	var byUID Pet
+	for i := 0; i < 2; i++ {
+		found, err := store.GetByUID(ctx, &byUID, fluffy.UID)
+		require.NoError(t, err)
+		require.True(t, found)
+	}
+	require.Equal(t, fluffy, byUID)
+	require.Equal(t, 2, inner.gets)
+
+	// Cached models are copies
+	byUID.Labels["kind"] = "dog"
+	cached, _ = getPet(t, store, "fluffy")
+	require.Equal(t, "cat", cached.Labels["kind"])
+
+	// Misses are not cached
+	_, found = getPet(t, store, "felix")
+	require.False(t, found)
+	_, found = getPet(t, store, "felix")
+	require.False(t, found)
+	require.Equal(t, 4, inner.gets)
+
+	// Reads with options other than Count bypass the cache
+	_, found = getPet(t, store, "fluffy", dbstore.ReadFromPrimary())
+	require.True(t, found)
+	require.Equal(t, 5, inner.gets)
+
+	require.Equal(t, dbstore.CacheStats{Hits: 3, Misses: 4, Entries: 2}, store.Stats())
+}
+
+func TestCachedStore_Invalidation(t *testing.T) {
+	store, inner := makeTestCachedStore(t, givenBoltPets())
+	meter := newRecordingMeter()
+	store.Meter = meter
+	ctx := context.TODO()
+
+	fluffy, _ := getPet(t, store, "fluffy")
+	_, err := store.GetByUID(ctx, &Pet{}, fluffy.UID)
+	require.NoError(t, err)
+
+	// Renamed model is neither found by its UID as it was, nor by its old name
+	updated, err := store.Update(ctx, &Pet{ObjectMeta: manifest.ObjectMeta{Name: "felix"}}, fluffy.UID)
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	_, found := getPet(t, store, "fluffy")
+	require.False(t, found)
+	felix, found := getPet(t, store, "felix")
+	require.True(t, found)
+	require.Equal(t, fluffy.UID, felix.UID)
+	require.Equal(t, int64(2), store.Stats().Invalidations)
+	require.Equal(t, int64(2), meter.counters["dbstore.cache.invalidations{wyrd.model=Pet}"])
+
+	// Soft-deleted models are not served from the cache, but can be read with IncludeDeleted
+	existed, err := store.Delete(ctx, &Pet{}, felix.UID, 0)
+	require.NoError(t, err)
+	require.True(t, existed)
+	_, found = getPet(t, store, "felix")
+	require.False(t, found)
+	for i := 0; i < 2; i++ {
+		_, found = getPet(t, store, "felix", dbstore.IncludeDeleted())
+		require.True(t, found)
+	}
+
+	restored, err := store.Restore(ctx, &Pet{}, felix.UID)
+	require.NoError(t, err)
+	require.True(t, restored)
+	_, found = getPet(t, store, "felix")
+	require.True(t, found)
+
+	// Writes bypassing the cache are seen once invalidated
+	gets := inner.gets
+	tom, _ := getPet(t, store, "tom")
+	_, err = inner.Update(ctx, &Pet{Spec: PetSpec{CustomName: "Thomas"}}, tom.UID)
+	require.NoError(t, err)
+	cached, _ := getPet(t, store, "tom")
+	require.Equal(t, "Tom", cached.Spec.CustomName)
+
+	store.Invalidate(&Pet{}, tom.UID)
+	cached, _ = getPet(t, store, "tom")
+	require.Equal(t, "Thomas", cached.Spec.CustomName)
+	require.Equal(t, gets+2, inner.gets)
+}
+
+func TestCachedStore_Transaction(t *testing.T) {
+	store, _ := makeTestCachedStore(t, givenBoltPets())
+	ctx := context.TODO()
+
+	tom, _ := getPet(t, store, "tom")
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.Update(&Pet{Spec: PetSpec{CustomName: "Thomas"}}, tom.UID)
+	require.NoError(t, err)
+
+	cached, _ := getPet(t, store, "tom")
+	require.Equal(t, "Tom", cached.Spec.CustomName)
+
+	require.NoError(t, tx.Commit())
+	cached, _ = getPet(t, store, "tom")
+	require.Equal(t, "Thomas", cached.Spec.CustomName)
+
+	_, err = dbstore.NewCachedStore(struct{ dbstore.Store }{store}, dbstore.ManifestModel).Begin(ctx)
+	require.ErrorIs(t, err, dbstore.ErrNotTransactional)
+}
+
+func TestCachedStore_Expiry(t *testing.T) {
+	store, inner := makeTestCachedStore(t, givenBoltPets())
+	store.TTL = 10 * time.Millisecond
+	store.Size = 2
+	meter := newRecordingMeter()
+	store.Meter = meter
+
+	for _, name := range []manifest.ResourceName{"fluffy", "tom", "rex"} {
+		_, found := getPet(t, store, name)
+		require.True(t, found)
+	}
+	require.Equal(t, dbstore.CacheStats{Misses: 3, Evictions: 1, Entries: 2}, store.Stats())
+
+	// Least recently used model has been evicted
+	getPet(t, store, "rex")
+	getPet(t, store, "fluffy")
+	require.Equal(t, 4, inner.gets)
+
+	time.Sleep(2 * store.TTL)
+	getPet(t, store, "rex")
+	require.Equal(t, 5, inner.gets)
+	require.Equal(t, int64(1), store.Stats().Expirations)
+
+	// The same metrics are recorded with the meter
+	stats := store.Stats()
+	require.Equal(t, map[string]int64{
+		"dbstore.cache.hits{wyrd.model=Pet}":        stats.Hits,
+		"dbstore.cache.misses{wyrd.model=Pet}":      stats.Misses,
+		"dbstore.cache.evictions{wyrd.model=Pet}":   stats.Evictions,
+		"dbstore.cache.expirations{wyrd.model=Pet}": stats.Expirations,
+	}, meter.counters)
+	require.Equal(t, map[string]float64{"dbstore.cache.entries{}": float64(stats.Entries)}, meter.gauges)
+}
+
+func TestCachedStore_Find(t *testing.T) {
+	store, inner := makeTestCachedStore(t, givenBoltPets())
+	ctx := context.TODO()
+
+	// Find is not cached by default
+	findNames(t, store, manifest.SearchQuery{})
+	findNames(t, store, manifest.SearchQuery{})
+	require.Equal(t, 2, inner.finds)
+
+	store.CacheFind = true
+	expect := findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat,env=prod")})
+	require.Equal(t, expect, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "env=prod,kind=cat")}))
+	require.Equal(t, 3, inner.finds)
+
+	var pets []Pet
+	total, err := store.Find(ctx, &pets, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat"), Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	total, err = store.Find(ctx, &pets, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat"), Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	require.Len(t, pets, 1)
+	require.Equal(t, 4, inner.finds)
+
+	// Any write of the model type drops cached results
+	felix := makePet("felix", "Felix", withLabels(manifest.Labels{"kind": "cat", "env": "prod"}))
+	require.NoError(t, store.Create(ctx, &felix))
+	require.Equal(t, append(expect, "felix"), findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat,env=prod")}))
+	require.Equal(t, 5, inner.finds)
+
+	findNames(t, store, manifest.SearchQuery{}, dbstore.Count(false))
+	findNames(t, store, manifest.SearchQuery{}, dbstore.Count(false))
+	findNames(t, store, manifest.SearchQuery{}, dbstore.OrderByCreatedAt(dbstore.OrderDescending))
+	require.Equal(t, 7, inner.finds)
+}
@@ -0,0 +1,99 @@
+package dbstore
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// affectedIDs returns IDs of models given to the statement of a callback, skipping models without an ID.
+func affectedIDs(db *gorm.DB, s *schema.Schema, idColumn string) []any {
+	idField := s.LookUpField(idColumn)
+	if idField == nil {
+		return nil
+	}
+
+	var ids []any
+	collect := func(v reflect.Value) {
+		if id, zero := idField.ValueOf(db.Statement.Context, reflect.Indirect(v)); !zero {
+			ids = append(ids, id)
+		}
+	}
+
+	switch value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			collect(value.Index(i))
+		}
+	case reflect.Struct:
+		collect(value)
+	}
+
+	return ids
+}
+
+// reloadAffected loads models written by the statement of a callback from the DB into a new slice, see [loadByIDs].
+// Models are re-loaded as a statement may update only some of the fields, and the DB may set others.
+func reloadAffected(db *gorm.DB, idColumn string) (reflect.Value, error) {
+	s := db.Statement.Schema
+	return loadByIDs(db, s, idColumn, affectedIDs(db, s, idColumn))
+}
+
+// loadByIDs loads models with given IDs from the DB into a new slice, including soft-deleted ones, without running hooks.
+func loadByIDs(db *gorm.DB, s *schema.Schema, idColumn string, ids []any) (reflect.Value, error) {
+	rows := reflect.New(reflect.SliceOf(s.ModelType))
+	if len(ids) == 0 {
+		return rows.Elem(), nil
+	}
+
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Unscoped().Table(s.Table).
+		Where(clause.IN{Column: clause.Column{Name: idColumn}, Values: ids}).
+		Find(rows.Interface()).Error
+	return rows.Elem(), err
+}
+
+// matchConditions returns conditions of an update or delete statement that is about to execute,
+// including the primary key of the value, which GORM adds to conditions as the statement executes.
+// Returns nil if the statement has no conditions, as GORM rejects such statements.
+func matchConditions(db *gorm.DB, s *schema.Schema) []clause.Expression {
+	var exprs []clause.Expression
+	if where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where); ok {
+		exprs = append(exprs, where.Exprs...)
+	}
+
+	if value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() == reflect.Struct && value.Type() == s.ModelType {
+		for _, field := range s.PrimaryFields {
+			if v, zero := field.ValueOf(db.Statement.Context, value); !zero {
+				exprs = append(exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: v})
+			}
+		}
+	}
+
+	return exprs
+}
+
+// matchIDs returns IDs of models that an update or delete statement is about to change, see [matchConditions].
+func matchIDs(db *gorm.DB, s *schema.Schema, idColumn string) ([]any, error) {
+	exprs := matchConditions(db, s)
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	if db.Statement.Unscoped {
+		tx = tx.Unscoped()
+	}
+
+	var ids []string
+	if err := tx.Model(reflect.New(s.ModelType).Interface()).Clauses(clause.Where{Exprs: exprs}).Pluck(idColumn, &ids).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]any, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, id)
+	}
+	return result, nil
+}
@@ -0,0 +1,296 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidCompactionPolicy error is returned by [NewCompactor] when a policy refers to a model or a column that does not exist.
+var ErrInvalidCompactionPolicy = errors.New("invalid compaction policy")
+
+const (
+	// defaultCompactionInterval is how often compaction runs, unless set by [Compactor.Interval].
+	defaultCompactionInterval = time.Minute
+	// defaultCompactionBatchSize is the maximum number of entries deleted by a statement, unless set by [Compactor.BatchSize].
+	defaultCompactionBatchSize = 500
+)
+
+// CompactionPolicy determines the lifetime of entries of a model.
+type CompactionPolicy struct {
+	// Model which entries the policy applies to.
+	Model any
+
+	// Retention is how long soft-deleted entries are kept before they are permanently deleted. Zero keeps them forever.
+	Retention time.Duration
+
+	// ExpiryColumn is the name of the column holding the time an entry expires at. Entries are soft-deleted once expired,
+	// thus the model must support soft-delete. Entries with NULL expiry time never expire. Empty means entries of the model do not expire.
+	ExpiryColumn string
+}
+
+// CompactionCounts are numbers of entries changed by compaction.
+type CompactionCounts struct {
+	// Expired is the number of entries soft-deleted as expired.
+	Expired int64
+	// Compacted is the number of soft-deleted entries permanently deleted after their retention.
+	Compacted int64
+}
+
+func (c *CompactionCounts) add(other CompactionCounts) {
+	c.Expired += other.Expired
+	c.Compacted += other.Compacted
+}
+
+// CompactionStats are metrics of a [Compactor] so far.
+type CompactionStats struct {
+	// CompactionCounts are total numbers of entries changed by compaction.
+	CompactionCounts
+	// Tables are numbers of entries changed by compaction per model table.
+	Tables map[string]CompactionCounts
+
+	// Passes is the number of completed compaction passes.
+	Passes int64
+	// Failures is the number of compaction passes that failed.
+	Failures int64
+	// LastPass is the time the last compaction pass started at.
+	LastPass time.Time
+	// LastDuration is how long the last compaction pass took.
+	LastDuration time.Duration
+	// LastError is the error of the last compaction pass, nil if it succeeded.
+	LastError error
+}
+
+// Compactor permanently deletes soft-deleted entries (tombstones) after their retention, and soft-deletes entries past their expiry time,
+// as determined by a [CompactionPolicy] per model.
+//
+// Entries are deleted in batches with GORM, thus callbacks such as the change log, full-text and label indexes see the changes.
+// A pass stops between batches when its context is cancelled, and the next pass continues where it stopped.
+type Compactor struct {
+	db       *gorm.DB
+	config   SchemaConfig
+	policies []compactionPolicy
+
+	// Interval is how often compaction runs. Defaults to 1 minute.
+	Interval time.Duration
+	// BatchSize is the maximum number of entries deleted by a statement. Defaults to 500.
+	BatchSize int
+	// Meter records metrics of compaction passes, in addition to [Compactor.Stats]. No metrics are recorded if it is nil.
+	Meter Meter
+
+	// now returns current time, overridden in tests.
+	now func() time.Time
+
+	lock  sync.Mutex
+	stats CompactionStats
+}
+
+// compactionPolicy is a [CompactionPolicy] with the parsed schema of the model.
+type compactionPolicy struct {
+	CompactionPolicy
+	schema *schema.Schema
+}
+
+// NewCompactor creates a compactor of given models' entries.
+func NewCompactor(db *gorm.DB, config SchemaConfig, policies ...CompactionPolicy) (*Compactor, error) {
+	if db == nil {
+		return nil, ErrNoDBObject
+	}
+
+	result := &Compactor{
+		db:     db,
+		config: config,
+		now:    time.Now,
+		stats:  CompactionStats{Tables: map[string]CompactionCounts{}},
+	}
+	for _, policy := range policies {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(policy.Model); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse model %T: %w", ErrInvalidCompactionPolicy, policy.Model, err)
+		}
+		if stmt.Schema.LookUpField(config.IDColumnName) == nil {
+			return nil, fmt.Errorf("%w: model %T has no %q column", ErrInvalidCompactionPolicy, policy.Model, config.IDColumnName)
+		}
+		if policy.Retention > 0 && stmt.Schema.LookUpField(config.DeletedAtColumnName) == nil {
+			return nil, fmt.Errorf("%w: model %T has no %q column", ErrInvalidCompactionPolicy, policy.Model, config.DeletedAtColumnName)
+		}
+		if policy.ExpiryColumn != "" && stmt.Schema.LookUpField(policy.ExpiryColumn) == nil {
+			return nil, fmt.Errorf("%w: model %T has no %q column", ErrInvalidCompactionPolicy, policy.Model, policy.ExpiryColumn)
+		}
+		// Expired entries are soft-deleted, as deleting entries of a model without soft-delete would delete them permanently
+		if policy.ExpiryColumn != "" && (stmt.Schema.LookUpField(config.DeletedAtColumnName) == nil || len(stmt.Schema.DeleteClauses) == 0) {
+			return nil, fmt.Errorf("%w: model %T has no soft-delete %q column to expire entries", ErrInvalidCompactionPolicy, policy.Model, config.DeletedAtColumnName)
+		}
+
+		result.policies = append(result.policies, compactionPolicy{CompactionPolicy: policy, schema: stmt.Schema})
+	}
+
+	return result, nil
+}
+
+// Run compacts entries every [Compactor.Interval] until the context is cancelled, and returns nil once it is.
+// Failed passes are retried on the next interval, and their errors are reported by [Compactor.Stats] and the [Compactor.Meter].
+func (c *Compactor) Run(ctx context.Context) error {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultCompactionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Errors are recorded by the pass itself
+		_, _ = c.Compact(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Compact makes one compaction pass over all models, returning the numbers of entries expired and compacted by it.
+// Entries that expire are soft-deleted before compaction, thus they are permanently deleted once their retention passes.
+func (c *Compactor) Compact(ctx context.Context) (counts CompactionCounts, err error) {
+	started := c.now()
+	tables := make(map[string]CompactionCounts, len(c.policies))
+	defer func() {
+		c.record(started, tables, err)
+	}()
+
+	db := c.db.WithContext(ctx)
+	for _, policy := range c.policies {
+		var tableCounts CompactionCounts
+		if policy.ExpiryColumn != "" {
+			tableCounts.Expired, err = c.deleteInBatches(ctx, db, policy, false, clause.Lt{
+				Column: clause.Column{Name: policy.ExpiryColumn},
+				Value:  started,
+			})
+		}
+		if err == nil && policy.Retention > 0 {
+			tableCounts.Compacted, err = c.deleteInBatches(ctx, db, policy, true, clause.Lt{
+				Column: clause.Column{Name: c.config.DeletedAtColumnName},
+				Value:  started.Add(-policy.Retention),
+			})
+		}
+
+		tables[policy.schema.Table] = tableCounts
+		counts.add(tableCounts)
+		if err != nil {
+			return counts, fmt.Errorf("failed to compact %q: %w", policy.schema.Table, err)
+		}
+	}
+
+	return counts, nil
+}
+
+// Stats returns metrics of compaction passes so far.
+func (c *Compactor) Stats() CompactionStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := c.stats
+	result.Tables = make(map[string]CompactionCounts, len(c.stats.Tables))
+	for table, counts := range c.stats.Tables {
+		result.Tables[table] = counts
+	}
+
+	return result
+}
+
+func (c *Compactor) record(started time.Time, tables map[string]CompactionCounts, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for table, counts := range tables {
+		total := c.stats.Tables[table]
+		total.add(counts)
+		c.stats.Tables[table] = total
+		c.stats.CompactionCounts.add(counts)
+	}
+
+	c.stats.Passes++
+	if err != nil {
+		c.stats.Failures++
+	}
+	c.stats.LastPass = started
+	c.stats.LastDuration = c.now().Sub(started)
+	c.stats.LastError = err
+
+	if c.Meter != nil {
+		c.meter(tables, c.stats.LastDuration, err)
+	}
+}
+
+// meter records metrics of a compaction pass with the meter.
+func (c *Compactor) meter(tables map[string]CompactionCounts, elapsed time.Duration, err error) {
+	for table, counts := range tables {
+		labels := manifest.Labels{MetricLabelTable: table}
+		if counts.Expired > 0 {
+			c.Meter.Add(MetricCompactionExpired, counts.Expired, labels)
+		}
+		if counts.Compacted > 0 {
+			c.Meter.Add(MetricCompactionCompacted, counts.Compacted, labels)
+		}
+	}
+
+	var labels manifest.Labels
+	if err != nil {
+		labels = manifest.Labels{MetricLabelErrorType: ErrorType(err)}
+	}
+	c.Meter.Record(MetricCompactionDuration, elapsed, labels)
+}
+
+// deleteInBatches deletes entries of the model matching the condition, soft-deleted ones if unscoped, a batch at a time.
+// Soft-deleted entries are deleted permanently, others are soft-deleted. Returns the number of entries deleted.
+func (c *Compactor) deleteInBatches(ctx context.Context, db *gorm.DB, policy compactionPolicy, unscoped bool, condition clause.Expression) (deleted int64, err error) {
+	batchSize := c.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCompactionBatchSize
+	}
+
+	idColumn := clause.Column{Name: c.config.IDColumnName}
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		tx := db.Table(policy.schema.Table)
+		if unscoped {
+			tx = tx.Unscoped().Where(clause.Neq{Column: clause.Column{Name: c.config.DeletedAtColumnName}, Value: nil})
+		} else if policy.schema.LookUpField(c.config.DeletedAtColumnName) != nil {
+			tx = tx.Where(clause.Eq{Column: clause.Column{Name: c.config.DeletedAtColumnName}, Value: nil})
+		}
+
+		var ids []any
+		if err := tx.Where(condition).Limit(batchSize).Pluck(c.config.IDColumnName, &ids).Error; err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+
+		rtx := db.Model(policy.Model)
+		if unscoped {
+			rtx = rtx.Unscoped()
+		}
+		rtx = rtx.Where(clause.IN{Column: idColumn, Values: ids}).Delete(policy.Model)
+		if rtx.Error != nil {
+			return deleted, rtx.Error
+		}
+		deleted += rtx.RowsAffected
+
+		if len(ids) < batchSize {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package dbstore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type Lease struct {
+	UID       string `gorm:"primaryKey"`
+	Holder    string
+	ExpiresAt *time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+// Ticket is a model that expires, but can not be soft-deleted.
+type Ticket struct {
+	UID       string `gorm:"primaryKey"`
+	ExpiresAt *time.Time
+}
+
+func makeCompactionDB(t *testing.T) (*gorm.DB, *dbstore.DBStore) {
+	db, store := openTestDB(t)
+	require.NoError(t, db.AutoMigrate(&Lease{}))
+
+	return db, store
+}
+
+func givenLeases(t *testing.T, db *gorm.DB, now time.Time) {
+	expiry := func(d time.Duration) *time.Time {
+		at := now.Add(d)
+		return &at
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&Lease{UID: fmt.Sprintf("expired-%d", i), ExpiresAt: expiry(-time.Minute)}).Error)
+	}
+	require.NoError(t, db.Create(&Lease{UID: "valid", ExpiresAt: expiry(time.Hour)}).Error)
+	require.NoError(t, db.Create(&Lease{UID: "forever"}).Error)
+}
+
+func TestCompactor_Expiry(t *testing.T) {
+	db, _ := makeCompactionDB(t)
+	givenLeases(t, db, time.Now())
+
+	compactor, err := dbstore.NewCompactor(db, dbstore.ManifestModel, dbstore.CompactionPolicy{Model: &Lease{}, ExpiryColumn: "expires_at"})
+	require.NoError(t, err)
+	compactor.BatchSize = 2
+
+	counts, err := compactor.Compact(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, dbstore.CompactionCounts{Expired: 5}, counts)
+
+	var leases []Lease
+	require.NoError(t, db.Order("uid").Find(&leases).Error)
+	require.Len(t, leases, 2)
+	require.Equal(t, "forever", leases[0].UID)
+	require.Equal(t, "valid", leases[1].UID)
+
+	// Expired entries are soft-deleted, not removed
+	var total int64
+	require.NoError(t, db.Unscoped().Model(&Lease{}).Count(&total).Error)
+	require.Equal(t, int64(7), total)
+
+	counts, err = compactor.Compact(context.TODO())
+	require.NoError(t, err)
+	require.Zero(t, counts)
+}
+
+func TestCompactor_Retention(t *testing.T) {
+	db, store := makeCompactionDB(t)
+	ctx := context.TODO()
+
+	for _, name := range []string{"fluffy", "tom", "rex", "nemo"} {
+		pet := makePet(name, name)
+		require.NoError(t, store.Create(ctx, &pet))
+		if name != "nemo" {
+			_, err := store.Delete(ctx, &Pet{}, pet.UID, 0)
+			require.NoError(t, err)
+		}
+	}
+	// Tombstones of fluffy and tom are past the retention
+	require.NoError(t, db.Unscoped().Model(&Pet{}).Where("name IN ?", []string{"fluffy", "tom"}).Update("deleted_at", time.Now().Add(-48*time.Hour)).Error)
+
+	compactor, err := dbstore.NewCompactor(db, dbstore.ManifestModel, dbstore.CompactionPolicy{Model: &Pet{}, Retention: 24 * time.Hour})
+	require.NoError(t, err)
+	compactor.BatchSize = 1
+	meter := newRecordingMeter()
+	compactor.Meter = meter
+
+	counts, err := compactor.Compact(ctx)
+	require.NoError(t, err)
+	require.Equal(t, dbstore.CompactionCounts{Compacted: 2}, counts)
+
+	var names []string
+	require.NoError(t, db.Unscoped().Model(&Pet{}).Order("name").Pluck("name", &names).Error)
+	require.Equal(t, []string{"nemo", "rex"}, names)
+
+	stats := compactor.Stats()
+	require.Equal(t, int64(1), stats.Passes)
+	require.Equal(t, dbstore.CompactionCounts{Compacted: 2}, stats.CompactionCounts)
+	require.Equal(t, dbstore.CompactionCounts{Compacted: 2}, stats.Tables["pets"])
+	require.NoError(t, stats.LastError)
+
+	// The same metrics are recorded with the meter
+	require.Equal(t, map[string]int64{"dbstore.compaction.compacted{db.collection.name=pets}": 2}, meter.counters)
+	require.Equal(t, map[string][]time.Duration{"dbstore.compaction.duration{}": {stats.LastDuration}}, meter.histograms)
+}
+
+func TestCompactor_Cancelled(t *testing.T) {
+	db, _ := makeCompactionDB(t)
+	givenLeases(t, db, time.Now())
+
+	compactor, err := dbstore.NewCompactor(db, dbstore.ManifestModel, dbstore.CompactionPolicy{Model: &Lease{}, ExpiryColumn: "expires_at"})
+	require.NoError(t, err)
+	meter := newRecordingMeter()
+	compactor.Meter = meter
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err = compactor.Compact(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	stats := compactor.Stats()
+	require.Equal(t, int64(1), stats.Failures)
+	require.ErrorIs(t, stats.LastError, context.Canceled)
+	require.Len(t, meter.histograms["dbstore.compaction.duration{error.type=canceled}"], 1)
+
+	// Run returns once cancelled, without reporting cancellation as an error
+	require.NoError(t, compactor.Run(ctx))
+
+	var total int64
+	require.NoError(t, db.Model(&Lease{}).Count(&total).Error)
+	require.Equal(t, int64(7), total)
+}
+
+func TestCompactor_RunAfterFailedPass(t *testing.T) {
+	db, _ := makeCompactionDB(t)
+	givenLeases(t, db, time.Now())
+
+	compactor, err := dbstore.NewCompactor(db, dbstore.ManifestModel, dbstore.CompactionPolicy{Model: &Lease{}, ExpiryColumn: "expires_at"})
+	require.NoError(t, err)
+	compactor.Interval = 10 * time.Millisecond
+	require.NoError(t, db.Migrator().DropTable(&Lease{}))
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	// A failed pass is not returned once the context is done, as that is a clean shutdown
+	require.NoError(t, compactor.Run(ctx))
+
+	stats := compactor.Stats()
+	require.Positive(t, stats.Failures)
+	require.Error(t, stats.LastError)
+}
+
+func TestNewCompactor_InvalidPolicy(t *testing.T) {
+	db, _ := makeCompactionDB(t)
+
+	testCases := map[string]dbstore.CompactionPolicy{
+		"missing expiry column":      {Model: &Pet{}, ExpiryColumn: "expires_at"},
+		"no id column":               {Model: &Toy{}, ExpiryColumn: "id"},
+		"expiry without soft-delete": {Model: &Ticket{}, ExpiryColumn: "expires_at"},
+	}
+
+	for name, tc := range testCases {
+		policy := tc
+		t.Run(name, func(t *testing.T) {
+			_, err := dbstore.NewCompactor(db, dbstore.ManifestModel, policy)
+			require.ErrorIs(t, err, dbstore.ErrInvalidCompactionPolicy)
+		})
+	}
+}
@@ -1,10 +1,19 @@
 package dbstore
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/xo/dburl"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -16,10 +25,30 @@ var (
 	ErrNoDSNorURL         = errors.New("no Data Source connection details provided")
 	ErrInvalidDBUrl       = errors.New("invalid DB URL")
 	ErrUnsupportedDialect = errors.New("unsupported data source type")
+
+	// ErrInvalidConfig error is returned when options of [Config] can not be applied to the selected Data Source.
+	ErrInvalidConfig = errors.New("invalid DB config")
+)
+
+// TLS modes of [Config.TLS], named after PostgreSQL `sslmode` values.
+const (
+	// TLSDisable connects without TLS.
+	TLSDisable = "disable"
+	// TLSRequire connects with TLS, without verifying server certificate.
+	TLSRequire = "require"
+	// TLSVerifyCA connects with TLS, verifying that server certificate is signed by a trusted CA.
+	TLSVerifyCA = "verify-ca"
+	// TLSVerifyFull connects with TLS, verifying server certificate and that it matches the server host name.
+	TLSVerifyFull = "verify-full"
 )
 
 // Config struct defines common command line options to select and connect to the DB implementing store.
+//
+// User, Password, DBName, Port and TLS options override the respective parts of the URL, for every supported Data Source.
+// SQLite databases are files: user and password are passed to the driver as `_auth_user` and `_auth_pass` parameters,
+// which are only enforced if the driver is built with `sqlite_userauth` tag, while other options are ignored.
 type Config struct {
+	// DSN holds extra `key=value` parameters of the connection, separated by spaces.
 	DSN string `help:"Data Source Name" group:"DB_STORE_DNS"`
 
 	URL      string `help:"Connection string" default:"sqlite:test.sqlite" group:"DB_STORE_URL" env:"DB_URL"`
@@ -28,6 +57,19 @@ type Config struct {
 
 	DBName string `help:"Name of the DB to connect to if Data Source supports multiple DBs" group:"DB_STORE_URL" env:"DB_NAME"`
 	Port   *int   `help:"A port to connect to a Data Source" group:"DB_STORE_URL"`
+
+	// Replicas are connection strings of read replicas. User, Password, DBName and TLS options apply to them too.
+	Replicas []string `help:"Connection strings of read replicas" group:"DB_STORE_URL" env:"DB_REPLICAS"`
+
+	TLS     string `help:"TLS mode: disable, require, verify-ca or verify-full" enum:",disable,require,verify-ca,verify-full" default:"" group:"DB_STORE_TLS" env:"DB_TLS"`
+	TLSCA   string `help:"Path to a PEM file of CA certificates to verify server certificate with" group:"DB_STORE_TLS" env:"DB_TLS_CA"`
+	TLSCert string `help:"Path to a PEM file of client certificate" group:"DB_STORE_TLS" env:"DB_TLS_CERT"`
+	TLSKey  string `help:"Path to a PEM file of client certificate key" group:"DB_STORE_TLS" env:"DB_TLS_KEY"`
+
+	MaxOpenConns    int           `help:"Maximum number of open connections to a Data Source, 0 is unlimited" group:"DB_STORE_POOL" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `help:"Maximum number of idle connections to a Data Source, 0 keeps the driver default" group:"DB_STORE_POOL" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `help:"Maximum time a connection may be reused for, 0 is forever" group:"DB_STORE_POOL" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `help:"Maximum time a connection may be idle for, 0 is forever" group:"DB_STORE_POOL" env:"DB_CONN_MAX_IDLE_TIME"`
 }
 
 // Dialector produces [gorm.Dialector] based on the config options selected.
@@ -37,39 +79,288 @@ func (c Config) Dialector() (gorm.Dialector, error) {
 		return nil, ErrNoDSNorURL
 	}
 
-	u, err := dburl.Parse(c.URL)
+	return c.dialector(c.URL, true)
+}
+
+// ReplicaDialectors produces [gorm.Dialector] for each of the read replicas of the config.
+func (c Config) ReplicaDialectors() ([]gorm.Dialector, error) {
+	result := make([]gorm.Dialector, 0, len(c.Replicas))
+	for _, replica := range c.Replicas {
+		dialector, err := c.dialector(replica, false)
+		if err != nil {
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+
+		result = append(result, dialector)
+	}
+
+	return result, nil
+}
+
+// Open connects to the Data Source selected by the config, and applies connection pool options.
+// If the config has read replicas, they are connected to and enabled with [EnableReadReplicas].
+// Use [Close] to close connections of the DB and its replicas.
+func (c Config) Open(options ...gorm.Option) (*gorm.DB, error) {
+	dialector, err := c.Dialector()
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidDBUrl, err)
+		return nil, err
+	}
+	replicaDialectors, err := c.ReplicaDialectors()
+	if err != nil {
+		return nil, err
 	}
 
-	// convert custom params to DSN:
-	extraParams := []string{u.DSN}
-	if c.DSN != "" {
-		extraParams = append(extraParams, c.DSN)
+	db, err := gorm.Open(dialector, options...)
+	if err != nil {
+		return nil, err
 	}
-	if c.User != "" {
-		extraParams = append(extraParams, fmt.Sprintf("user=%v", c.User))
+	if err := c.configurePool(db); err != nil {
+		return nil, errors.Join(err, Close(db))
 	}
-	if c.Password != "" {
-		extraParams = append(extraParams, fmt.Sprintf("password=%v", c.Password))
+
+	replicas := make([]gorm.ConnPool, 0, len(replicaDialectors))
+	for _, replicaDialector := range replicaDialectors {
+		replica, err := gorm.Open(replicaDialector, &gorm.Config{Logger: db.Logger})
+		if err == nil {
+			err = c.configurePool(replica)
+		}
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to connect to replica: %w", err), closePools(replicas), Close(db))
+		}
+
+		replicas = append(replicas, replica.ConnPool)
 	}
-	if c.DBName != "" {
-		extraParams = append(extraParams, fmt.Sprintf("dbname=%v", c.DBName))
+
+	if len(replicas) > 0 {
+		if err := EnableReadReplicas(db, replicas...); err != nil {
+			return nil, errors.Join(err, closePools(replicas), Close(db))
+		}
 	}
-	if c.Port != nil {
-		extraParams = append(extraParams, fmt.Sprintf("port=%v", c.Port))
+
+	return db, nil
+}
+
+func (c Config) configurePool(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if c.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+
+	return nil
+}
+
+// dialector produces [gorm.Dialector] for the connection string, with options of the config applied.
+// The port option only applies to the primary Data Source.
+func (c Config) dialector(connection string, primary bool) (gorm.Dialector, error) {
+	u, err := dburl.Parse(connection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDBUrl, err)
+	}
+
+	extraParams, err := c.extraParams()
+	if err != nil {
+		return nil, err
+	}
+
+	target := u.URL
+	query := target.Query()
+	switch u.Driver {
+	case "sqlite3", "sqlite":
+		if c.TLS != "" && c.TLS != TLSDisable {
+			return nil, fmt.Errorf("%w: TLS is not supported by %v", ErrInvalidConfig, u.Driver)
+		}
+		if c.User != "" || c.Password != "" {
+			query.Set("_auth", "")
+			query.Set("_auth_user", c.User)
+			query.Set("_auth_pass", c.Password)
+		}
+	case "mysql", "postgres":
+		c.applyURL(&target, primary)
+		if err := c.applyTLS(u.Driver, query); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedDialect, u.Driver)
+	}
+
+	for key, value := range extraParams {
+		query.Set(key, value)
+	}
+	target.RawQuery = query.Encode()
+
+	// DSN is generated by dburl from the URL with the options applied
+	if u, err = dburl.Parse(target.String()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDBUrl, err)
 	}
 
-	dsn := strings.Join(extraParams, " ")
 	switch u.Driver {
 	case "sqlite3", "sqlite":
 		return sqlite.Open(u.DSN), nil
 	case "mysql":
 		return mysql.Open(u.DSN), nil
-	case "postgres":
-		return postgres.Open(dsn), nil
 	default:
-		// return sql.Open(dsn)
-		return nil, fmt.Errorf("%w: %v", ErrUnsupportedDialect, u.Driver)
+		return postgres.Open(u.DSN), nil
+	}
+}
+
+// applyURL overrides user, password, DB name and port of the URL with the options of the config.
+func (c Config) applyURL(target *url.URL, primary bool) {
+	if c.User != "" || c.Password != "" {
+		user := c.User
+		if user == "" && target.User != nil {
+			user = target.User.Username()
+		}
+
+		password, hasPassword := "", false
+		if target.User != nil {
+			password, hasPassword = target.User.Password()
+		}
+		if c.Password != "" {
+			password, hasPassword = c.Password, true
+		}
+
+		if hasPassword {
+			target.User = url.UserPassword(user, password)
+		} else {
+			target.User = url.User(user)
+		}
+	}
+
+	if c.DBName != "" {
+		target.Path = "/" + c.DBName
+	}
+	if primary && c.Port != nil {
+		target.Host = net.JoinHostPort(target.Hostname(), strconv.Itoa(*c.Port))
+	}
+}
+
+// applyTLS sets connection parameters of the driver to the TLS mode of the config.
+func (c Config) applyTLS(driver string, query url.Values) error {
+	switch c.TLS {
+	case "", TLSDisable, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+	default:
+		return fmt.Errorf("%w: unknown TLS mode %q", ErrInvalidConfig, c.TLS)
+	}
+	if c.TLS == "" {
+		return nil
+	}
+
+	if driver == "postgres" {
+		query.Set("sslmode", c.TLS)
+		for key, value := range map[string]string{"sslrootcert": c.TLSCA, "sslcert": c.TLSCert, "sslkey": c.TLSKey} {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+		return nil
+	}
+
+	// MySQL driver only knows named TLS configs, thus custom ones are registered with it
+	switch {
+	case c.TLS == TLSDisable:
+		query.Set("tls", "false")
+	case c.TLS == TLSRequire && c.TLSCert == "":
+		query.Set("tls", "skip-verify")
+	case c.TLS == TLSVerifyFull && c.TLSCA == "" && c.TLSCert == "":
+		query.Set("tls", "true")
+	default:
+		name, err := c.registerMySQLTLS()
+		if err != nil {
+			return err
+		}
+		query.Set("tls", name)
 	}
+
+	return nil
+}
+
+// registerMySQLTLS registers TLS config with MySQL driver, returning its name. The name is derived from the options, so that the same config is registered once.
+func (c Config) registerMySQLTLS() (string, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLSCA != "" {
+		pem, err := os.ReadFile(c.TLSCA)
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to read CA certificates: %w", ErrInvalidConfig, err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("%w: no CA certificates in %q", ErrInvalidConfig, c.TLSCA)
+		}
+	}
+	if c.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to load client certificate: %w", ErrInvalidConfig, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch c.TLS {
+	case TLSRequire:
+		config.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// Certificate chain is verified, but not the host name
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(config.RootCAs, rawCerts)
+		}
+	}
+
+	name := fmt.Sprintf("wyrd-%x", sha256.Sum256([]byte(strings.Join([]string{c.TLS, c.TLSCA, c.TLSCert, c.TLSKey}, "\x00"))))
+	if err := mysqldriver.RegisterTLSConfig(name, config); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	return name, nil
+}
+
+func verifyCertificateChain(roots *x509.CertPool, rawCerts [][]byte) error {
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// extraParams parses `key=value` parameters of the DSN option.
+func (c Config) extraParams() (map[string]string, error) {
+	result := map[string]string{}
+	for _, param := range strings.Fields(c.DSN) {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: DSN parameter %q is not in key=value form", ErrInvalidConfig, param)
+		}
+
+		result[key] = value
+	}
+
+	return result, nil
 }
@@ -2,9 +2,14 @@ package dbstore_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/sre-norns/wyrd/pkg/dbstore"
 	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func launderInt(v int) *int {
@@ -82,3 +87,133 @@ func TestConfig_Dialector(t *testing.T) {
 		})
 	}
 }
+
+func dialectorDSN(d gorm.Dialector) string {
+	switch d := d.(type) {
+	case *mysql.Dialector:
+		return d.Config.DSN
+	case *postgres.Dialector:
+		return d.Config.DSN
+	case *sqlite.Dialector:
+		return d.DSN
+	}
+
+	return ""
+}
+
+func TestConfig_DialectorDSN(t *testing.T) {
+	testCases := map[string]struct {
+		given       dbstore.Config
+		expectError error
+		expect      string
+	}{
+		"pg port": {
+			given:  dbstore.Config{URL: "postgres://localhost:5432/app", Port: launderInt(7777)},
+			expect: "dbname=app host=localhost port=7777",
+		},
+		"pg credentials and db name": {
+			given:  dbstore.Config{URL: "postgres://localhost/app", User: "pg", Password: "secret", DBName: "wyrd"},
+			expect: "dbname=wyrd host=localhost password=secret user=pg",
+		},
+		"pg password keeps URL user": {
+			given:  dbstore.Config{URL: "postgres://pg@localhost/app", Password: "secret"},
+			expect: "dbname=app host=localhost password=secret user=pg",
+		},
+		"pg DSN params": {
+			given:  dbstore.Config{URL: "postgres://localhost/app", DSN: "application_name=wyrd connect_timeout=5"},
+			expect: "application_name=wyrd connect_timeout=5 dbname=app host=localhost",
+		},
+		"pg TLS": {
+			given:  dbstore.Config{URL: "postgres://localhost/app", TLS: dbstore.TLSVerifyFull, TLSCA: "/etc/ca.pem"},
+			expect: "dbname=app host=localhost sslmode=verify-full sslrootcert=/etc/ca.pem",
+		},
+		"mysql port and credentials": {
+			given:  dbstore.Config{URL: "mysql://localhost:3306/app", User: "my", Password: "secret", Port: launderInt(7777)},
+			expect: "my:secret@tcp(localhost:7777)/app",
+		},
+		"mysql DSN params": {
+			given:  dbstore.Config{URL: "mysql://root:pw@localhost/app", User: "my", DSN: "parseTime=true"},
+			expect: "my:pw@tcp(localhost:3306)/app?parseTime=true",
+		},
+		"mysql TLS require": {
+			given:  dbstore.Config{URL: "mysql://localhost/app", TLS: dbstore.TLSRequire},
+			expect: "tcp(localhost:3306)/app?tls=skip-verify",
+		},
+		"mysql TLS disable": {
+			given:  dbstore.Config{URL: "mysql://localhost/app", TLS: dbstore.TLSDisable},
+			expect: "tcp(localhost:3306)/app?tls=false",
+		},
+		"mysql missing CA": {
+			given:       dbstore.Config{URL: "mysql://localhost/app", TLS: dbstore.TLSVerifyCA, TLSCA: "/does/not/exist.pem"},
+			expectError: dbstore.ErrInvalidConfig,
+		},
+		"sqlite credentials": {
+			given:  dbstore.Config{URL: "sqlite:test.sqlite", User: "admin", Password: "secret"},
+			expect: "test.sqlite?_auth=&_auth_pass=secret&_auth_user=admin",
+		},
+		"sqlite TLS": {
+			given:       dbstore.Config{URL: "sqlite:test.sqlite", TLS: dbstore.TLSRequire},
+			expectError: dbstore.ErrInvalidConfig,
+		},
+		"unknown TLS mode": {
+			given:       dbstore.Config{URL: "postgres://localhost/app", TLS: "maybe"},
+			expectError: dbstore.ErrInvalidConfig,
+		},
+		"malformed DSN params": {
+			given:       dbstore.Config{URL: "postgres://localhost/app", DSN: "sslmode"},
+			expectError: dbstore.ErrInvalidConfig,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := test.given.Dialector()
+			if test.expectError != nil {
+				require.ErrorIs(t, err, test.expectError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expect, dialectorDSN(got))
+		})
+	}
+}
+
+func TestConfig_ReplicaDialectors(t *testing.T) {
+	config := dbstore.Config{
+		URL:      "postgres://primary:5432/app",
+		Port:     launderInt(7777),
+		User:     "pg",
+		Replicas: []string{"postgres://replica-1:5432/app", "postgres://replica-2/app"},
+	}
+
+	got, err := config.ReplicaDialectors()
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	// Port only applies to the primary
+	require.Equal(t, "dbname=app host=replica-1 port=5432 user=pg", dialectorDSN(got[0]))
+	require.Equal(t, "dbname=app host=replica-2 user=pg", dialectorDSN(got[1]))
+
+	_, err = dbstore.Config{URL: "postgres://primary/app", Replicas: []string{"oracle://replica"}}.ReplicaDialectors()
+	require.ErrorIs(t, err, dbstore.ErrUnsupportedDialect)
+}
+
+func TestConfig_Open(t *testing.T) {
+	config := dbstore.Config{
+		URL:             "sqlite:file::memory:?cache=shared",
+		MaxOpenConns:    3,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	db, err := config.Open(&gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+
+	require.NoError(t, dbstore.Close(db))
+	require.Error(t, sqlDB.Ping())
+}
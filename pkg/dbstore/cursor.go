@@ -0,0 +1,181 @@
+package dbstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (c SchemaConfig) continueTokenCodec() manifest.ContinueTokenCodec {
+	return manifest.ContinueTokenCodec{Key: c.ContinueTokenKey}
+}
+
+// decodeCursor decodes continue token of the query and converts values of the cursor to types comparable with columns of the sort spec.
+func decodeCursor(cfg SchemaConfig, query manifest.SearchQuery) (manifest.Cursor, error) {
+	cursor, err := cfg.continueTokenCodec().Decode(query.Continue)
+	if err != nil {
+		return cursor, err
+	}
+
+	if cursor.Sort != query.Sort.String() || len(cursor.Values) != len(query.Sort) {
+		return cursor, fmt.Errorf("%w: token was issued for a different sort order", manifest.ErrInvalidContinueToken)
+	}
+
+	for i, field := range query.Sort {
+		value, err := cursorValue(field, cursor.Values[i])
+		if err != nil {
+			return cursor, fmt.Errorf("%w: %w", manifest.ErrInvalidContinueToken, err)
+		}
+		cursor.Values[i] = value
+	}
+
+	return cursor, nil
+}
+
+func cursorValue(field manifest.SortField, value any) (any, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case string:
+		switch field.Field {
+		case manifest.SortFieldCreatedAt, manifest.SortFieldUpdatedAt, manifest.SortFieldDeletedAt:
+			return time.Parse(time.RFC3339Nano, v)
+		}
+	}
+
+	return value, nil
+}
+
+// keysetCondition returns condition selecting rows that follow the given values in the order of columns:
+// (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ... with comparisons reversed for descending columns.
+// NULL values go first in ascending order, as [withSort] orders them, thus NULL follows values of descending columns only,
+// and is matched with IS NULL rather than compared.
+func keysetCondition(columns []clause.OrderByColumn, values []any) clause.Expression {
+	alternatives := make([]clause.Expression, 0, len(columns))
+	for i, column := range columns {
+		conditions := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			// Eq with nil value is built as IS NULL
+			conditions = append(conditions, clause.Eq{Column: columns[j].Column, Value: values[j]})
+		}
+
+		switch {
+		case values[i] == nil && column.Desc:
+			// Nothing follows NULL in descending order
+			continue
+		case values[i] == nil:
+			conditions = append(conditions, clause.Neq{Column: column.Column, Value: nil})
+		case column.Desc:
+			conditions = append(conditions, clause.Or(
+				clause.Lt{Column: column.Column, Value: values[i]},
+				clause.Eq{Column: column.Column, Value: nil},
+			))
+		default:
+			conditions = append(conditions, clause.Gt{Column: column.Column, Value: values[i]})
+		}
+
+		alternatives = append(alternatives, clause.And(conditions...))
+	}
+
+	return clause.Or(alternatives...)
+}
+
+// nullsFirst returns a column ordering NULL values of the column before others in ascending order, and after them in descending order,
+// for DBs that do not order NULL values that way, or nil if the DB does. SQLite and MySQL order NULL values as the smallest ones, while Postgres as the largest.
+func nullsFirst(stmt *gorm.Statement, column clause.OrderByColumn) *clause.OrderByColumn {
+	if stmt.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	name := column.Column.Name
+	if !column.Column.Raw {
+		name = stmt.Quote(column.Column.Name)
+	}
+
+	return &clause.OrderByColumn{
+		Column: clause.Column{Name: fmt.Sprintf("(%s IS NULL)", name), Raw: true},
+		Desc:   !column.Desc,
+	}
+}
+
+// nextContinueToken returns continue token pointing after the last of the results, or empty string if results are the last page.
+func nextContinueToken(tx *gorm.DB, cfg SchemaConfig, dest any, query manifest.SearchQuery) (string, error) {
+	results := reflect.Indirect(reflect.ValueOf(dest))
+	if query.Limit == 0 || results.Kind() != reflect.Slice || results.Len() < int(query.Limit) {
+		return "", nil
+	}
+
+	last := reflect.Indirect(results.Index(results.Len() - 1))
+	schema := tx.Statement.Schema
+	if schema == nil {
+		return "", fmt.Errorf("no schema to build a continue token from results of type %T", dest)
+	}
+
+	fieldValue := func(column string) (any, error) {
+		field := schema.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("column %q is not a field of %v", column, schema.Name)
+		}
+
+		// Note: raw value of the field is used, as ValueOf wraps fields with serializers, such as JSON labels.
+		value := field.ReflectValueOf(tx.Statement.Context, last)
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return nil, nil
+			}
+			value = value.Elem()
+		}
+
+		if deletedAt, ok := value.Interface().(gorm.DeletedAt); ok {
+			if !deletedAt.Valid {
+				return nil, nil
+			}
+			return deletedAt.Time, nil
+		}
+
+		return value.Interface(), nil
+	}
+
+	cursor := manifest.Cursor{
+		Sort:   query.Sort.String(),
+		Values: make([]any, 0, len(query.Sort)),
+	}
+	for _, field := range query.Sort {
+		var value any
+		var err error
+		if key, ok := field.LabelKey(); ok && cfg.SortColumns[field.Field] == "" {
+			var labels any
+			if labels, err = fieldValue(cfg.LabelsColumnName); err == nil {
+				if l, ok := labels.(manifest.Labels); ok && l.Has(key) {
+					value = l.Get(key)
+				}
+			}
+		} else {
+			var column clause.OrderByColumn
+			if column, err = cfg.sortColumn(tx.Statement, field); err == nil {
+				value, err = fieldValue(column.Column.Name)
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to build continue token: %w", err)
+		}
+
+		cursor.Values = append(cursor.Values, value)
+	}
+
+	uid, err := fieldValue(cfg.IDColumnName)
+	if err != nil {
+		return "", fmt.Errorf("failed to build continue token: %w", err)
+	}
+	cursor.UID = manifest.ResourceID(fmt.Sprint(uid))
+
+	return cfg.continueTokenCodec().Encode(cursor)
+}
@@ -0,0 +1,248 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func petNames(pets []Pet) []string {
+	result := make([]string, 0, len(pets))
+	for _, p := range pets {
+		result = append(result, string(p.Name))
+	}
+	return result
+}
+
+func TestDBStore_FindContinue(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2001, time.January, d, 0, 0, 0, 0, time.UTC) }
+
+	testCases := map[string]struct {
+		given      []Pet
+		givenQuery manifest.SearchQuery
+
+		expectPages [][]string
+	}{
+		"no-sort-orders-by-uid": {
+			given: []Pet{
+				makePet("pet-1", "a", withUID("00000000-0000-0000-0000-000000000003")),
+				makePet("pet-2", "b", withUID("00000000-0000-0000-0000-000000000001")),
+				makePet("pet-3", "c", withUID("00000000-0000-0000-0000-000000000002")),
+			},
+			givenQuery: manifest.SearchQuery{Limit: 2},
+			expectPages: [][]string{
+				{"pet-2", "pet-3"},
+				{"pet-1"},
+			},
+		},
+		"sort-by-created-desc": {
+			given: []Pet{
+				makePet("pet-1", "a", withCreatedAt(day(1))),
+				makePet("pet-2", "b", withCreatedAt(day(2))),
+				makePet("pet-3", "c", withCreatedAt(day(3))),
+				makePet("pet-4", "d", withCreatedAt(day(4))),
+			},
+			givenQuery: manifest.SearchQuery{
+				Limit: 2,
+				Sort:  manifest.SortSpec{{Field: manifest.SortFieldCreatedAt, Descending: true}},
+			},
+			expectPages: [][]string{
+				{"pet-4", "pet-3"},
+				{"pet-2", "pet-1"},
+				{},
+			},
+		},
+		"ties-broken-by-uid": {
+			given: []Pet{
+				makePet("pet-1", "a", withUID("00000000-0000-0000-0000-000000000002"), withLabels(manifest.Labels{"priority": "1"})),
+				makePet("pet-2", "b", withUID("00000000-0000-0000-0000-000000000001"), withLabels(manifest.Labels{"priority": "1"})),
+				makePet("pet-3", "c", withUID("00000000-0000-0000-0000-000000000003"), withLabels(manifest.Labels{"priority": "0"})),
+			},
+			givenQuery: manifest.SearchQuery{
+				Limit: 1,
+				Sort:  manifest.SortSpec{{Field: "metadata.labels.priority", Descending: true}},
+			},
+			expectPages: [][]string{
+				{"pet-2"},
+				{"pet-1"},
+				{"pet-3"},
+				{},
+			},
+		},
+		"missing-labels-first-ascending": {
+			given: []Pet{
+				makePet("pet-1", "a", withUID("00000000-0000-0000-0000-000000000001"), withLabels(manifest.Labels{"priority": "2"})),
+				makePet("pet-2", "b", withUID("00000000-0000-0000-0000-000000000002")),
+				makePet("pet-3", "c", withUID("00000000-0000-0000-0000-000000000003"), withLabels(manifest.Labels{"priority": "1"})),
+				makePet("pet-4", "d", withUID("00000000-0000-0000-0000-000000000004")),
+			},
+			givenQuery: manifest.SearchQuery{
+				Limit: 1,
+				Sort:  manifest.SortSpec{{Field: "metadata.labels.priority"}},
+			},
+			expectPages: [][]string{
+				{"pet-2"},
+				{"pet-4"},
+				{"pet-3"},
+				{"pet-1"},
+				{},
+			},
+		},
+		"missing-labels-last-descending": {
+			given: []Pet{
+				makePet("pet-1", "a", withUID("00000000-0000-0000-0000-000000000001"), withLabels(manifest.Labels{"priority": "2"})),
+				makePet("pet-2", "b", withUID("00000000-0000-0000-0000-000000000002")),
+				makePet("pet-3", "c", withUID("00000000-0000-0000-0000-000000000003"), withLabels(manifest.Labels{"priority": "1"})),
+				makePet("pet-4", "d", withUID("00000000-0000-0000-0000-000000000004")),
+			},
+			givenQuery: manifest.SearchQuery{
+				Limit: 1,
+				Sort:  manifest.SortSpec{{Field: "metadata.labels.priority", Descending: true}},
+			},
+			expectPages: [][]string{
+				{"pet-1"},
+				{"pet-3"},
+				{"pet-2"},
+				{"pet-4"},
+				{},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		for storeName, makeStore := range testStores {
+			t.Run(name+"/"+storeName, func(t *testing.T) {
+				store, cleanup := makeStore(t, test.given)
+				defer cleanup()
+
+				query := test.givenQuery
+				for i, expect := range test.expectPages {
+					var got []Pet
+					var next string
+					total, err := store.Find(context.TODO(), &got, query, dbstore.NextContinueToken(&next))
+					require.NoError(t, err)
+					require.Equal(t, int64(len(test.given)), total)
+					require.Equal(t, expect, petNames(got), "page %d", i)
+
+					if i == len(test.expectPages)-1 {
+						require.Empty(t, next)
+					}
+					query.Continue = next
+				}
+			})
+		}
+	}
+}
+
+func TestDBStore_FindContinue_ConcurrentInsert(t *testing.T) {
+	store, cleanup := makeTestStore(t, []Pet{
+		makePet("pet-1", "a", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-2", "b", withCreatedAt(time.Date(2001, time.January, 2, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-3", "c", withCreatedAt(time.Date(2001, time.January, 3, 0, 0, 0, 0, time.UTC))),
+	})
+	defer cleanup()
+
+	query := manifest.SearchQuery{
+		Limit: 2,
+		Sort:  manifest.SortSpec{{Field: manifest.SortFieldCreatedAt, Descending: true}},
+	}
+
+	var first []Pet
+	var next string
+	_, err := store.Find(context.TODO(), &first, query, dbstore.NextContinueToken(&next))
+	require.NoError(t, err)
+	require.Equal(t, []string{"pet-3", "pet-2"}, petNames(first))
+
+	// Insert a newer entry that would shift offset-based pages
+	newPet := makePet("pet-4", "d", withCreatedAt(time.Date(2001, time.January, 4, 0, 0, 0, 0, time.UTC)))
+	require.NoError(t, store.Create(context.TODO(), &newPet))
+
+	var second []Pet
+	query.Continue = next
+	_, err = store.Find(context.TODO(), &second, query)
+	require.NoError(t, err)
+	require.Equal(t, []string{"pet-1"}, petNames(second))
+}
+
+func TestDBStore_FindContinue_InvalidToken(t *testing.T) {
+	store, cleanup := makeTestStore(t, []Pet{
+		makePet("pet-1", "a"),
+		makePet("pet-2", "b"),
+	})
+	defer cleanup()
+
+	query := manifest.SearchQuery{Limit: 1, Sort: manifest.SortSpec{{Field: manifest.SortFieldName}}}
+	var got []Pet
+	var next string
+	_, err := store.Find(context.TODO(), &got, query, dbstore.NextContinueToken(&next))
+	require.NoError(t, err)
+	require.NotEmpty(t, next)
+
+	testCases := map[string]manifest.SearchQuery{
+		"garbage":         {Limit: 1, Sort: query.Sort, Continue: "!not-a-token!"},
+		"different-sort":  {Limit: 1, Sort: manifest.SortSpec{{Field: manifest.SortFieldVersion}}, Continue: next},
+		"unexpected-sign": {Limit: 1, Sort: query.Sort, Continue: next + ".c2lnbmF0dXJl"},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			var got []Pet
+			_, err := store.Find(context.TODO(), &got, test)
+			require.ErrorIs(t, err, manifest.ErrInvalidContinueToken)
+		})
+	}
+}
+
+func Test_ForEach_Keyset(t *testing.T) {
+	given := []Pet{
+		makePet("pet-1", "a", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-2", "b", withCreatedAt(time.Date(2001, time.January, 2, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-3", "c", withCreatedAt(time.Date(2001, time.January, 3, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-4", "d", withCreatedAt(time.Date(2001, time.January, 4, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-5", "e", withCreatedAt(time.Date(2001, time.January, 5, 0, 0, 0, 0, time.UTC))),
+	}
+	store, cleanup := makeTestStore(t, given)
+	defer cleanup()
+
+	query := manifest.SearchQuery{
+		Limit: 2,
+		Sort:  manifest.SortSpec{{Field: manifest.SortFieldCreatedAt}},
+	}
+
+	var got []string
+	processed, err := dbstore.ForEach(context.TODO(), store, query, func(p Pet) error {
+		got = append(got, string(p.Name))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), processed)
+	require.Equal(t, []string{"pet-1", "pet-2", "pet-3", "pet-4", "pet-5"}, got)
+}
+
+func Test_ForEach_OrderBy(t *testing.T) {
+	given := []Pet{
+		makePet("pet-1", "a", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-2", "b", withCreatedAt(time.Date(2001, time.January, 2, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-3", "c", withCreatedAt(time.Date(2001, time.January, 3, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-4", "d", withCreatedAt(time.Date(2001, time.January, 4, 0, 0, 0, 0, time.UTC))),
+		makePet("pet-5", "e", withCreatedAt(time.Date(2001, time.January, 5, 0, 0, 0, 0, time.UTC))),
+	}
+	store, cleanup := makeTestStore(t, given)
+	defer cleanup()
+
+	// Order of options is kept, as entries are iterated by offset
+	var got []string
+	processed, err := dbstore.ForEach(context.TODO(), store, manifest.SearchQuery{Limit: 2}, func(p Pet) error {
+		got = append(got, string(p.Name))
+		return nil
+	}, dbstore.OrderByCreatedAt(dbstore.OrderDescending))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), processed)
+	require.Equal(t, []string{"pet-5", "pet-4", "pet-3", "pet-2", "pet-1"}, got)
+}
@@ -2,6 +2,7 @@ package dbstore
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
@@ -23,6 +24,13 @@ var (
 	// ErrNoRequirementsValueProvided error is returned when some of the query selector's requirements can not be converted into SQL query.
 	// For example, selector `key=` has no value and thus will not be converted into a valid SQL expression.
 	ErrNoRequirementsValueProvided = errors.New("no value for a requirement is provided")
+
+	// ErrUnknownTimeField error is returned when search query time range refers to a time field that is not mapped to a column of the model.
+	ErrUnknownTimeField = errors.New("unknown time field")
+
+	// ErrVersionConflict error is returned by Update and CreateOrUpdate when the stored entry has a version other than expected.
+	// See [Precondition] option.
+	ErrVersionConflict = manifest.ErrVersionConflict
 )
 
 // SchemaConfig determines how a model is mapped into DB columns.
@@ -35,6 +43,97 @@ type SchemaConfig struct {
 	CreatedAtColumnName string
 	UpdatedAtColumnName string
 	DeletedAtColumnName string
+
+	// TimeColumns maps custom time fields, such as timestamps in a resource status, to columns that search query time range can apply to.
+	// Well-known [manifest.TimeField] values are mapped to CreatedAt, UpdatedAt and DeletedAt columns.
+	TimeColumns map[manifest.TimeField]string
+
+	// SortColumns maps custom sort fields, such as `spec.priority`, to columns that search results can be sorted by.
+	// Well-known metadata fields are mapped to columns of this config, and label fields are extracted from LabelsColumnName.
+	SortColumns map[string]string
+
+	// ContinueTokenKey is an optional key to sign continue tokens with, see [manifest.ContinueTokenCodec].
+	ContinueTokenKey []byte
+}
+
+// TimeColumn returns the name of the column holding given time field.
+func (c SchemaConfig) TimeColumn(field manifest.TimeField) (string, error) {
+	switch field {
+	case "", manifest.TimeFieldCreated:
+		return c.CreatedAtColumnName, nil
+	case manifest.TimeFieldUpdated:
+		return c.UpdatedAtColumnName, nil
+	case manifest.TimeFieldDeleted:
+		return c.DeletedAtColumnName, nil
+	}
+
+	if column, ok := c.TimeColumns[field]; ok {
+		return column, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownTimeField, field)
+}
+
+// SortableFields returns fields that search results can be sorted by unless restricted by [SortableFields] option.
+func (c SchemaConfig) SortableFields() []string {
+	result := make([]string, 0, len(manifest.DefaultSortableFields)+len(c.SortColumns))
+	result = append(result, manifest.DefaultSortableFields...)
+	for field := range c.SortColumns {
+		result = append(result, field)
+	}
+
+	return result
+}
+
+// sortColumnName returns the name of the column holding a sort field, unless it is a label field.
+func (c SchemaConfig) sortColumnName(field manifest.SortField) (string, bool) {
+	switch field.Field {
+	case manifest.SortFieldUID:
+		return c.IDColumnName, true
+	case manifest.SortFieldName:
+		return c.NameColumnName, true
+	case manifest.SortFieldVersion:
+		return c.VersionColumnName, true
+	case manifest.SortFieldCreatedAt:
+		return c.CreatedAtColumnName, true
+	case manifest.SortFieldUpdatedAt:
+		return c.UpdatedAtColumnName, true
+	case manifest.SortFieldDeletedAt:
+		return c.DeletedAtColumnName, true
+	}
+
+	column, ok := c.SortColumns[field.Field]
+	return column, ok
+}
+
+// sortColumn returns order-by column for a field of a sort spec.
+// Label fields are extracted from the JSON labels column with a raw expression specific to the DB dialect.
+func (c SchemaConfig) sortColumn(stmt *gorm.Statement, field manifest.SortField) (clause.OrderByColumn, error) {
+	result := clause.OrderByColumn{Desc: field.Descending}
+	if column, ok := c.sortColumnName(field); ok {
+		result.Column.Name = column
+		return result, nil
+	}
+
+	key, ok := field.LabelKey()
+	if !ok {
+		return result, fmt.Errorf("%w: %q", manifest.ErrUnsortableField, field.Field)
+	}
+
+	// Note: the key is embedded into raw SQL, validation ensures it can not contain quotes.
+	if err := manifest.ValidateLabelKey(key); err != nil {
+		return result, fmt.Errorf("%w: %w", manifest.ErrInvalidSortSpec, err)
+	}
+
+	column := stmt.Quote(c.LabelsColumnName)
+	switch stmt.Dialector.Name() {
+	case "postgres":
+		result.Column = clause.Column{Name: fmt.Sprintf("%s::json ->> '%s'", column, key), Raw: true}
+	default:
+		result.Column = clause.Column{Name: fmt.Sprintf("JSON_EXTRACT(%s, '%s')", column, jsonQueryJoin([]string{key})), Raw: true}
+	}
+
+	return result, nil
 }
 
 type rawJSONSQL struct {
@@ -79,12 +178,22 @@ func (c orderByColumn) Clause() clause.OrderByColumn {
 	}
 }
 
-func applyOptions(db *gorm.DB, config SchemaConfig, value any, options ...Option) (tx, ctx *gorm.DB) {
+func resolveOptions(config SchemaConfig, value any, options ...Option) transactionContext {
 	tContext := newTransactionContext(config)
+	tContext.model = value
 	for _, o := range options {
 		tContext = o(value, tContext)
 	}
 
+	return tContext
+}
+
+func applyOptions(db *gorm.DB, config SchemaConfig, value any, options ...Option) (tx, ctx *gorm.DB) {
+	return applyTransactionContext(db, resolveOptions(config, value, options...))
+}
+
+func applyTransactionContext(db *gorm.DB, tContext transactionContext) (tx, ctx *gorm.DB) {
+	config := tContext.Config
 	tx, ctx = db, db
 	if tContext.unScoped {
 		tx = tx.Unscoped()
@@ -101,7 +210,7 @@ func applyOptions(db *gorm.DB, config SchemaConfig, value any, options ...Option
 		args := []any{}
 		if !expand.Query.Empty() {
 			args = []any{func(db *gorm.DB) *gorm.DB {
-				stx, _, _ := withQuery(db, nil, config, expand.Query)
+				stx, _, _ := withQuery(db, nil, newTransactionContext(config), expand.Query)
 				if expand.OrderBy.Column == "" {
 					return stx
 				}
@@ -113,6 +222,15 @@ func applyOptions(db *gorm.DB, config SchemaConfig, value any, options ...Option
 		tx = tx.Preload(relation, args...)
 	}
 
+	if tContext.readPrimary {
+		tx = tx.Set(readReplicaKey, false)
+		ctx = ctx.Set(readReplicaKey, false)
+	}
+
+	if tContext.author != "" {
+		tx = tx.Set(revisionAuthorKey, tContext.author)
+	}
+
 	if tContext.withVersion != nil {
 		req := clause.Eq{
 			Column: clause.Column{Name: config.VersionColumnName},
@@ -165,22 +283,19 @@ func matchName(tx *gorm.DB, jfield string, query manifest.SearchQuery) *gorm.DB
 	})
 }
 
+// limitTimeRange limits results to the half-open time range [from, till), where either end can be omitted.
 func limitTimeRange(tx *gorm.DB, column string, from time.Time, till time.Time) *gorm.DB {
 	if tx == nil {
 		return tx
 	}
 
 	if !from.IsZero() {
-		if !till.IsZero() {
-			tx = tx.Where(fmt.Sprintf("%s BETWEEN ? AND ?", column), from, till)
-		} else {
-			tx = tx.Where(clause.Gte{
-				Column: clause.Column{Name: column},
-				Value:  from,
-			})
-
-		}
-	} else if !till.IsZero() {
+		tx = tx.Where(clause.Gte{
+			Column: clause.Column{Name: column},
+			Value:  from,
+		})
+	}
+	if !till.IsZero() {
 		tx = tx.Where(clause.Lt{
 			Column: clause.Column{Name: column},
 			Value:  till,
@@ -197,18 +312,33 @@ func (s *DBStore) singleTransaction(ctx context.Context) *gormStoreTransaction {
 	}
 }
 
+// reader returns a DB session for reads that can be served by a read replica, see [ReadReplicas].
+func (s *DBStore) reader(ctx context.Context) *gorm.DB {
+	return FromReplica(s.db.WithContext(ctx))
+}
+
 // Ping implements [Pinger] interface for the DBStore, using SQL DB PingContext,
 // which send empty "SELECT" to the DB to check if it is able to process requests.
+// See [DBStore.DBStats] for statistics of connections to the DB.
 func (s *DBStore) Ping(ctx context.Context) error {
 	sqlDB, err := s.db.DB()
 	if err != nil {
 		return fmt.Errorf("failed to access DB interface: %w", err)
 	}
 
-	// TODO: Return connection stats for more info
 	return sqlDB.PingContext(ctx)
 }
 
+// DBStats implements [DBStatsReporter] interface, returning statistics of the connection pool of the primary DB.
+func (s *DBStore) DBStats() (sql.DBStats, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return sql.DBStats{}, fmt.Errorf("failed to access DB interface: %w", err)
+	}
+
+	return sqlDB.Stats(), nil
+}
+
 // Begin opens a transaction and produces [StoreTransaction] object to execute queries.
 // It is an implementation of Transactional interface.
 // Note: It's a caller responsibility to call Transaction.Commit() or Transaction.Rollback() to complete the transaction.
@@ -235,8 +365,9 @@ func (s *DBStore) Create(ctx context.Context, value any, options ...Option) erro
 // This is an implementation of AssociationStore interface.
 // Using empty query will select all linked entries. Use with caution as in that case number of results returned from DB in unbounded.
 func (s *DBStore) FindLinked(ctx context.Context, dest any, link string, owner any, searchQuery manifest.SearchQuery, options ...Option) (totalCount int64, err error) {
-	tx, xtx := applyOptions(s.db.Model(owner).WithContext(ctx), s.config, dest, options...)
-	tx, xtx, err = withQuery(tx, xtx, s.config, searchQuery)
+	tContext := resolveOptions(s.config, dest, options...)
+	tx, xtx := applyTransactionContext(FromReplica(s.db.Model(owner).WithContext(ctx)), tContext)
+	tx, xtx, err = withQuery(tx, xtx, tContext, searchQuery)
 	if err != nil {
 		return
 	}
@@ -275,7 +406,7 @@ func (s *DBStore) ClearLinked(ctx context.Context, link string, owner any) error
 // Return values indicate if entry with such id were found, and if there was an error while fetching the value.
 // In case of an error or if returned value is false, dest is not updated.
 func (s *DBStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...Option) (bool, error) {
-	return s.singleTransaction(ctx).GetByUID(dest, id, options...)
+	return (&gormStoreTransaction{db: s.reader(ctx), config: s.config}).GetByUID(dest, id, options...)
 }
 
 // GetByName finds at most one entry in the store identified by the name if there is one.
@@ -284,7 +415,7 @@ func (s *DBStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID
 // Return values indicate if entry with such id were found, and if there was an error while fetching the value.
 // In case of an error or if returned value is false, dest is not updated.
 func (s *DBStore) GetByName(ctx context.Context, dest any, id manifest.ResourceName, options ...Option) (bool, error) {
-	return s.singleTransaction(ctx).GetByName(dest, id, options...)
+	return (&gormStoreTransaction{db: s.reader(ctx), config: s.config}).GetByName(dest, id, options...)
 }
 
 // Update updates an entry identified by the ID in the DB.
@@ -315,8 +446,9 @@ func (s *DBStore) Restore(ctx context.Context, model any, id manifest.ResourceID
 // manifest.SearchQuery - defines limits and offset.
 // [options] control how results are returned and expansion of collections.
 func (s *DBStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
-	tx, xtx := applyOptions(s.db.WithContext(ctx), s.config, dest, options...)
-	tx, xtx, err = withQuery(tx, xtx, s.config, searchQuery)
+	tContext := resolveOptions(s.config, dest, options...)
+	tx, xtx := applyTransactionContext(s.reader(ctx), tContext)
+	tx, xtx, err = withQuery(tx, xtx, tContext, searchQuery)
 	if err != nil {
 		return 0, err
 	}
@@ -327,15 +459,25 @@ func (s *DBStore) Find(ctx context.Context, dest any, searchQuery manifest.Searc
 		}
 	}
 
-	return total, tx.Find(dest).Error
+	rtx := tx.Find(dest)
+	if rtx.Error != nil {
+		return total, rtx.Error
+	}
+
+	if tContext.nextToken != nil {
+		*tContext.nextToken, err = nextContinueToken(rtx, s.config, dest, searchQuery)
+	}
+
+	return total, err
 }
 
 // FindNames returns a set of names for a model type.
 // Type of the model argument determines which model to restore. No field of the value is used, thus a pointer to an default value can be safely passed.
 // searchQuery arguments selection matches and pagination.
 func (s *DBStore) FindNames(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (manifest.StringSet, error) {
-	tx, xtx := applyOptions(s.db.Model(model).WithContext(ctx), s.config, model, options...)
-	tx, _, err := withQuery(tx, xtx, s.config, searchQuery)
+	tContext := resolveOptions(s.config, model, options...)
+	tx, xtx := applyTransactionContext(FromReplica(s.db.Model(model).WithContext(ctx)), tContext)
+	tx, _, err := withQuery(tx, xtx, tContext, searchQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -357,7 +499,12 @@ func (s *DBStore) FindNames(ctx context.Context, model any, searchQuery manifest
 // Type of the model argument determines which model to restore. No field of the value is used, thus a pointer to an default value can be safely passed.
 // searchQuery arguments selection matches and pagination.
 func (s *DBStore) FindLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (manifest.StringSet, error) {
-	tx, _ := applyOptions(s.db.Model(model).WithContext(ctx), s.config, model, options...)
+	tContext := resolveOptions(s.config, model, options...)
+	tx, _ := applyTransactionContext(FromReplica(s.db.Model(model).WithContext(ctx)), tContext)
+	if index := labelIndexFor(tx, tContext); index != nil {
+		return findIndexedLabels(tx, index, "label_key", nil, searchQuery)
+	}
+
 	// SELECT key, value FROM conversations, json_each(cast(conversations.labels as json));
 	tx = limitedQuery(tx, searchQuery).Clauses(clause.From{
 		Joins: []clause.Join{
@@ -384,7 +531,12 @@ func (s *DBStore) FindLabels(ctx context.Context, model any, searchQuery manifes
 // Type of the model argument determines which model to restore. No field of the value is used, thus a pointer to an default value can be safely passed.
 // searchQuery arguments selection matches and pagination.
 func (s *DBStore) FindLabelValues(ctx context.Context, model any, key string, searchQuery manifest.SearchQuery, options ...Option) (manifest.StringSet, error) {
-	tx, _ := applyOptions(s.db.Model(model).WithContext(ctx), s.config, model, options...)
+	tContext := resolveOptions(s.config, model, options...)
+	tx, _ := applyTransactionContext(FromReplica(s.db.Model(model).WithContext(ctx)), tContext)
+	if index := labelIndexFor(tx, tContext); index != nil {
+		return findIndexedLabels(tx, index, "label_value", &key, searchQuery)
+	}
+
 	tx = limitedQuery(tx, searchQuery).Clauses(clause.From{
 		Joins: []clause.Join{
 			{
@@ -405,9 +557,11 @@ func (s *DBStore) FindLabelValues(ctx context.Context, model any, key string, se
 	return result, rtx.Error
 }
 
-func withSelector(tx *gorm.DB, jcolumn string, selector manifest.Selector) (*gorm.DB, error) {
+// withSelector limits results to models with labels matching the selector.
+// Labels are queried in the label index table if it is given, and in the JSON column otherwise.
+func withSelector(tx *gorm.DB, jcolumn string, index *labelIndexTarget, selector manifest.Selector) (*gorm.DB, error) {
 	// Convert Label-based selector to the SQL query
-	if selector == nil {
+	if tx == nil || selector == nil {
 		return tx, nil
 	}
 
@@ -479,6 +633,10 @@ func withSelector(tx *gorm.DB, jcolumn string, selector manifest.Selector) (*gor
 		}
 	}
 
+	if index != nil && len(qs) > 0 {
+		return tx.Where(index.condition(qs)), nil
+	}
+
 	for _, c := range qs {
 		tx = tx.Where(c)
 	}
@@ -486,17 +644,106 @@ func withSelector(tx *gorm.DB, jcolumn string, selector manifest.Selector) (*gor
 	return tx, nil
 }
 
-func withQuery(tx, ctx *gorm.DB, cfg SchemaConfig, query manifest.SearchQuery) (selecting, counting *gorm.DB, err error) {
+// withSort orders results by fields of the sort spec, after validating them against sortable fields.
+// Sort spec replaces any order previously set on the query, such as by [OrderBy] option.
+// For keyset pagination results are also ordered by UID, and are limited to the ones following the continue token of the query.
+// NULL values, such as timestamps that are not set or labels that are missing, go first in ascending order on every DB.
+func withSort(tx *gorm.DB, tContext transactionContext, query manifest.SearchQuery) (*gorm.DB, error) {
+	cfg := tContext.Config
+	keyset := tContext.keyset(query)
+	if len(query.Sort) == 0 && !keyset {
+		return tx, nil
+	}
+
+	sortable := tContext.Sortable
+	if len(sortable) == 0 {
+		sortable = cfg.SortableFields()
+	}
+	if err := query.Sort.Validate(sortable...); err != nil {
+		return nil, err
+	}
+
+	columns := make([]clause.OrderByColumn, 0, len(query.Sort)+1)
+	for _, field := range query.Sort {
+		column, err := cfg.sortColumn(tx.Statement, field)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+	if keyset {
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: cfg.IDColumnName}})
+	}
+
+	if query.Continue != "" {
+		cursor, err := decodeCursor(cfg, query)
+		if err != nil {
+			return nil, err
+		}
+
+		tx = tx.Where(keysetCondition(columns, append(cursor.Values, cursor.UID)))
+	}
+
+	orders := make([]clause.OrderByColumn, 0, 2*len(columns))
+	for _, column := range columns {
+		if nulls := nullsFirst(tx.Statement, column); nulls != nil && column.Column.Name != cfg.IDColumnName {
+			orders = append(orders, *nulls)
+		}
+		orders = append(orders, column)
+	}
+	for i, column := range orders {
+		column.Reorder = i == 0
+		tx = tx.Order(column)
+	}
+
+	return tx, nil
+}
+
+func withQuery(tx, ctx *gorm.DB, tContext transactionContext, query manifest.SearchQuery) (selecting, counting *gorm.DB, err error) {
+	cfg := tContext.Config
+	// Offset is ignored when continuing from a token
+	if query.Continue != "" {
+		query.Offset = 0
+	}
+
 	// Apply name matcher if any
 	tx = matchName(tx, cfg.NameColumnName, query)
 	ctx = matchName(ctx, cfg.NameColumnName, query)
 
+	// Apply full-text search if any
+	if query.Text != "" {
+		if tx, ctx, err = withFullText(tx, ctx, tContext, query); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Apply time-range limit
-	tx = limitTimeRange(tx, cfg.CreatedAtColumnName, query.FromTime, query.TillTime)
-	ctx = limitTimeRange(ctx, cfg.CreatedAtColumnName, query.FromTime, query.TillTime)
+	if !query.FromTime.IsZero() || !query.TillTime.IsZero() {
+		column, err := cfg.TimeColumn(query.TimeField)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Soft-deleted entries must be included to search by the time of deletion
+		if query.TimeField == manifest.TimeFieldDeleted {
+			tx = tx.Unscoped()
+			if ctx != nil {
+				ctx = ctx.Unscoped()
+			}
+		}
+
+		tx = limitTimeRange(tx, column, query.FromTime, query.TillTime)
+		ctx = limitTimeRange(ctx, column, query.FromTime, query.TillTime)
+	}
+
+	if tx, err = withSort(tx, tContext, query); err != nil {
+		return nil, nil, err
+	}
 
-	tx, err = withSelector(tx, cfg.LabelsColumnName, query.Selector)
-	ctx, _ = withSelector(ctx, cfg.LabelsColumnName, query.Selector)
+	index := labelIndexFor(tx, tContext)
+	tx, err = withSelector(tx, cfg.LabelsColumnName, index, query.Selector)
+	ctx, _ = withSelector(ctx, cfg.LabelsColumnName, index, query.Selector)
 
 	// Apply offset and limit to the query
 	return limitedQuery(tx, query), ctx, err
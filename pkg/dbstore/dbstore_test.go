@@ -2,6 +2,8 @@ package dbstore_test
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 type Toys []Toy
@@ -88,6 +91,28 @@ func makeTestStore(t *testing.T, given []Pet) (*dbstore.DBStore, func()) {
 	return store, cleanup
 }
 
+// openTestDB opens an in-memory DB private to the test, with pets and toys migrated and the plugins enabled, and a store of it.
+func openTestDB(tb testing.TB, plugins ...gorm.Plugin) (*gorm.DB, *dbstore.DBStore) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(tb.Name(), "/", "_"))), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		dbInstance, _ := db.DB()
+		_ = dbInstance.Close()
+	})
+
+	require.NoError(tb, db.AutoMigrate(&Pet{}, &Toy{}))
+	for _, plugin := range plugins {
+		require.NoError(tb, db.Use(plugin))
+	}
+
+	store, err := dbstore.NewDBStore(db, dbstore.ManifestModel)
+	require.NoError(tb, err)
+
+	return db, store
+}
+
 type petOption func(*Pet)
 
 func withCreatedAt(t time.Time) petOption {
@@ -96,6 +121,12 @@ func withCreatedAt(t time.Time) petOption {
 	}
 }
 
+func withUpdatedAt(t time.Time) petOption {
+	return func(p *Pet) {
+		p.UpdatedAt = &t
+	}
+}
+
 func withDeletedAt(t time.Time) petOption {
 	return func(p *Pet) {
 		if t.IsZero() {
@@ -115,6 +146,12 @@ func withVersion(v manifest.Version) petOption {
 	}
 }
 
+func withUID(uid manifest.ResourceID) petOption {
+	return func(p *Pet) {
+		p.UID = uid
+	}
+}
+
 func withLabels(labels manifest.Labels) petOption {
 	return func(p *Pet) {
 		p.Labels = labels
@@ -145,6 +182,36 @@ func mockRequirement(t *testing.T, key string, op manifest.Operator, values ...s
 	return req
 }
 
+func TestDBStore_CreateOrUpdateRace(t *testing.T) {
+	db, store := openTestDB(t)
+	ctx := context.TODO()
+
+	// The entry is created by another writer after the store checked that it does not exist
+	uid := manifest.ResourceID("6a1f7b0e-5d2c-4c1e-9f3a-1b2c3d4e5f60")
+	raced := false
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if raced {
+			return
+		}
+		raced = true
+		racing := makePet("fluffy", "Racing Fluffy", withUID(uid), withVersion(4))
+		_ = tx.AddError(tx.Session(&gorm.Session{NewDB: true}).Create(&racing).Error)
+	}))
+
+	value := makePet("fluffy", "Sir Fluffy", withUID(uid), withVersion(2))
+	_, err := store.CreateOrUpdate(ctx, &value)
+	require.ErrorIs(t, err, dbstore.ErrVersionConflict)
+	require.True(t, raced)
+	require.Equal(t, manifest.Version(2), value.Version)
+
+	var got Pet
+	found, err := store.GetByUID(ctx, &got, uid)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "Racing Fluffy", got.Spec.CustomName)
+	require.Equal(t, manifest.Version(5), got.Version)
+}
+
 func TestDBStore_Find(t *testing.T) {
 	testCases := map[string]struct {
 		givenQuery manifest.SearchQuery
@@ -369,6 +436,134 @@ func TestDBStore_Find(t *testing.T) {
 			},
 		},
 
+		"query-created-range-is-half-open": {
+			given: []Pet{
+				makePet("pet-1", "at-start", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+				makePet("pet-2", "inside", withCreatedAt(time.Date(2001, time.June, 1, 0, 0, 0, 0, time.UTC))),
+				makePet("pet-3", "at-end", withCreatedAt(time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC))),
+			},
+			options: []dbstore.Option{
+				dbstore.OrderByCreatedAt(dbstore.OrderAscending),
+			},
+			givenQuery: manifest.SearchQuery{
+				FromTime: time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC),
+				TillTime: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			expectTotal: 2,
+			expect: []Pet{
+				makePet("pet-1", "at-start"),
+				makePet("pet-2", "inside"),
+			},
+		},
+
+		"query-updated-after": {
+			given: []Pet{
+				makePet("pet-1", "old", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)), withUpdatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+				makePet("pet-2", "touched", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)), withUpdatedAt(time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC))),
+				makePet("pet-3", "new", withCreatedAt(time.Date(2009, time.January, 1, 0, 0, 0, 0, time.UTC)), withUpdatedAt(time.Date(2009, time.January, 1, 0, 0, 0, 0, time.UTC))),
+			},
+			options: []dbstore.Option{
+				dbstore.OrderByCreatedAt(dbstore.OrderAscending),
+			},
+			givenQuery: manifest.SearchQuery{
+				FromTime:  time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+				TimeField: manifest.TimeFieldUpdated,
+			},
+			expectTotal: 2,
+			expect: []Pet{
+				makePet("pet-2", "touched"),
+				makePet("pet-3", "new"),
+			},
+		},
+
+		"query-deleted-before": {
+			given: []Pet{
+				makePet("pet-1", "alive"),
+				makePet("pet-2", "deleted-long-ago", withDeletedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+				makePet("pet-3", "deleted-recently", withDeletedAt(time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC))),
+			},
+			givenQuery: manifest.SearchQuery{
+				TillTime:  time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+				TimeField: manifest.TimeFieldDeleted,
+			},
+			expectTotal: 1,
+			expect: []Pet{
+				makePet("pet-2", "deleted-long-ago"),
+			},
+		},
+
+		"query-unknown-time-field": {
+			given: []Pet{
+				makePet("pet-1", "some value"),
+			},
+			givenQuery: manifest.SearchQuery{
+				FromTime:  time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+				TimeField: "born",
+			},
+			expectError: dbstore.ErrUnknownTimeField,
+		},
+
+		"sort-by-label-desc-then-name": {
+			given: []Pet{
+				makePet("pet-1", "b", withLabels(manifest.Labels{"priority": "1"})),
+				makePet("pet-2", "a", withLabels(manifest.Labels{"priority": "1"})),
+				makePet("pet-3", "c", withLabels(manifest.Labels{"priority": "2"})),
+			},
+			givenQuery: manifest.SearchQuery{
+				Sort: manifest.SortSpec{
+					{Field: "metadata.labels.priority", Descending: true},
+					{Field: manifest.SortFieldName},
+				},
+			},
+			expectTotal: 3,
+			expect: []Pet{
+				makePet("pet-3", "c"),
+				makePet("pet-1", "b"),
+				makePet("pet-2", "a"),
+			},
+		},
+
+		"sort-overrides-order-options": {
+			given: []Pet{
+				makePet("pet-1", "old", withCreatedAt(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))),
+				makePet("pet-2", "new", withCreatedAt(time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC))),
+			},
+			options: []dbstore.Option{
+				dbstore.OrderByCreatedAt(dbstore.OrderAscending),
+			},
+			givenQuery: manifest.SearchQuery{
+				Sort: manifest.SortSpec{{Field: manifest.SortFieldCreatedAt, Descending: true}},
+			},
+			expectTotal: 2,
+			expect: []Pet{
+				makePet("pet-2", "new"),
+				makePet("pet-1", "old"),
+			},
+		},
+
+		"sort-by-unsortable-field": {
+			given: []Pet{
+				makePet("pet-1", "some value"),
+			},
+			givenQuery: manifest.SearchQuery{
+				Sort: manifest.SortSpec{{Field: "spec.value"}},
+			},
+			expectError: manifest.ErrUnsortableField,
+		},
+
+		"sort-by-field-not-in-allowlist": {
+			given: []Pet{
+				makePet("pet-1", "some value"),
+			},
+			options: []dbstore.Option{
+				dbstore.SortableFields(manifest.SortFieldName),
+			},
+			givenQuery: manifest.SearchQuery{
+				Sort: manifest.SortSpec{{Field: manifest.SortFieldCreatedAt}},
+			},
+			expectError: manifest.ErrUnsortableField,
+		},
+
 		"query-all-unscoped": {
 			given: []Pet{
 				makePet("pet-1", "some value"),
@@ -570,28 +765,30 @@ func TestDBStore_Find(t *testing.T) {
 
 	for name, tc := range testCases {
 		test := tc
-		t.Run(name, func(t *testing.T) {
-			store, cleanup := makeTestStore(t, test.given)
-			defer cleanup()
-
-			var got []Pet
-			total, err := store.Find(context.TODO(), &got, test.givenQuery, test.options...)
-			if test.expectError != nil {
-				require.ErrorIs(t, err, test.expectError)
-			} else {
-				require.NoError(t, err)
-
-				filtered := make([]Pet, 0, len(got))
-				for _, g := range got {
-					filtered = append(filtered, Pet{
-						ObjectMeta: manifest.ObjectMeta{Name: g.Name},
-						Spec:       g.Spec,
-					})
+		for storeName, makeStore := range testStores {
+			t.Run(name+"/"+storeName, func(t *testing.T) {
+				store, cleanup := makeStore(t, test.given)
+				defer cleanup()
+
+				var got []Pet
+				total, err := store.Find(context.TODO(), &got, test.givenQuery, test.options...)
+				if test.expectError != nil {
+					require.ErrorIs(t, err, test.expectError)
+				} else {
+					require.NoError(t, err)
+
+					filtered := make([]Pet, 0, len(got))
+					for _, g := range got {
+						filtered = append(filtered, Pet{
+							ObjectMeta: manifest.ObjectMeta{Name: g.Name},
+							Spec:       g.Spec,
+						})
+					}
+					require.Equal(t, test.expect, filtered)
+					require.Equal(t, test.expectTotal, total)
 				}
-				require.Equal(t, test.expect, filtered)
-				require.Equal(t, test.expectTotal, total)
-			}
-		})
+			})
+		}
 	}
 }
 
@@ -689,18 +886,20 @@ func TestDBStore_FindNames(t *testing.T) {
 
 	for name, tc := range testCases {
 		test := tc
-		t.Run(name, func(t *testing.T) {
-			store, cleanup := makeTestStore(t, test.given)
-			defer cleanup()
-
-			got, err := store.FindNames(context.TODO(), test.model, test.givenQuery, test.options...)
-			if test.expectError != nil {
-				require.ErrorIs(t, err, test.expectError)
-			} else {
-				require.NoError(t, err)
-				require.Equal(t, test.expect, got)
-			}
-		})
+		for storeName, makeStore := range testStores {
+			t.Run(name+"/"+storeName, func(t *testing.T) {
+				store, cleanup := makeStore(t, test.given)
+				defer cleanup()
+
+				got, err := store.FindNames(context.TODO(), test.model, test.givenQuery, test.options...)
+				if test.expectError != nil {
+					require.ErrorIs(t, err, test.expectError)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, test.expect, got)
+				}
+			})
+		}
 	}
 }
 
@@ -793,18 +992,20 @@ func TestDBStore_FindLabels(t *testing.T) {
 
 	for name, tc := range testCases {
 		test := tc
-		t.Run(name, func(t *testing.T) {
-			store, cleanup := makeTestStore(t, test.given)
-			defer cleanup()
-
-			got, err := store.FindLabels(context.TODO(), test.model, test.givenQuery, test.options...)
-			if test.expectError != nil {
-				require.ErrorIs(t, err, test.expectError)
-			} else {
-				require.NoError(t, err)
-				require.Equal(t, test.expect, got)
-			}
-		})
+		for storeName, makeStore := range testStores {
+			t.Run(name+"/"+storeName, func(t *testing.T) {
+				store, cleanup := makeStore(t, test.given)
+				defer cleanup()
+
+				got, err := store.FindLabels(context.TODO(), test.model, test.givenQuery, test.options...)
+				if test.expectError != nil {
+					require.ErrorIs(t, err, test.expectError)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, test.expect, got)
+				}
+			})
+		}
 	}
 }
 
@@ -897,17 +1098,19 @@ func TestDBStore_FindLabelValues(t *testing.T) {
 
 	for name, tc := range testCases {
 		test := tc
-		t.Run(name, func(t *testing.T) {
-			store, cleanup := makeTestStore(t, test.store)
-			defer cleanup()
-
-			got, err := store.FindLabelValues(context.TODO(), test.model, test.given, test.givenQuery, test.options...)
-			if test.expectError != nil {
-				require.ErrorIs(t, err, test.expectError)
-			} else {
-				require.NoError(t, err)
-				require.Equal(t, test.expect, got)
-			}
-		})
+		for storeName, makeStore := range testStores {
+			t.Run(name+"/"+storeName, func(t *testing.T) {
+				store, cleanup := makeStore(t, test.store)
+				defer cleanup()
+
+				got, err := store.FindLabelValues(context.TODO(), test.model, test.given, test.givenQuery, test.options...)
+				if test.expectError != nil {
+					require.ErrorIs(t, err, test.expectError)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, test.expect, got)
+				}
+			})
+		}
 	}
 }
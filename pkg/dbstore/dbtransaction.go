@@ -3,9 +3,12 @@ package dbstore
 import (
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/sre-norns/wyrd/pkg/manifest"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 type gormStoreTransaction struct {
@@ -29,18 +32,50 @@ func (tx *gormStoreTransaction) Create(value any, options ...Option) error {
 }
 
 func (tx *gormStoreTransaction) Update(newValue any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
-	rtx, _ := applyOptions(tx.db.Model(newValue), tx.config, newValue, options...)
-	rtx = rtx.Updates(newValue)
+	tContext := resolveOptions(tx.config, newValue, options...)
+	precondition, err := tx.precondition(newValue, tContext)
+	if err != nil {
+		return false, err
+	}
+
+	rtx, _ := applyTransactionContext(tx.db.Model(newValue), tContext)
+	rtx = precondition.apply(rtx).Updates(newValue)
 	if errors.Is(rtx.Error, gorm.ErrRecordNotFound) {
 		return false, nil
 	}
+	if rtx.Error == nil && rtx.RowsAffected == 0 {
+		return false, precondition.failed(tx.db, newValue, tContext)
+	}
 
 	return rtx.RowsAffected == 1, rtx.Error
 }
 
 func (tx *gormStoreTransaction) CreateOrUpdate(newValue any, options ...Option) (exists bool, err error) {
-	rx, _ := applyOptions(tx.db, tx.config, newValue, options...)
-	rx = rx.Save(newValue)
+	tContext := resolveOptions(tx.config, newValue, options...)
+	precondition, err := tx.precondition(newValue, tContext)
+	if err != nil {
+		return false, err
+	}
+
+	rx, _ := applyTransactionContext(tx.db, tContext)
+	if precondition == nil || precondition.newEntry {
+		rx = rx.Save(newValue)
+	} else {
+		// Same as Save does, but an entry with unexpected version must not be overwritten by an upsert
+		rx = precondition.apply(rx.Model(newValue).Select("*")).Updates(newValue)
+		if rx.Error == nil && rx.RowsAffected == 0 {
+			if err := precondition.failed(tx.db, newValue, tContext); err != nil {
+				return false, err
+			}
+
+			// The entry may be created concurrently after the check, so the upsert is also restricted to the expected version
+			rx, _ = applyTransactionContext(tx.db, tContext)
+			rx = rx.Clauses(precondition.onConflict(rx)).Create(newValue)
+			if rx.Error == nil && rx.RowsAffected == 0 {
+				return false, precondition.failed(tx.db, newValue, tContext)
+			}
+		}
+	}
 	if errors.Is(rx.Error, gorm.ErrRecordNotFound) {
 		return false, nil
 	}
@@ -48,6 +83,118 @@ func (tx *gormStoreTransaction) CreateOrUpdate(newValue any, options ...Option)
 	return rx.RowsAffected == 1, rx.Error
 }
 
+// versionPrecondition is a version that an entry must have in the store for the value to be written to it.
+type versionPrecondition struct {
+	field      *schema.Field
+	primaryKey *schema.Field
+	version    manifest.Version
+
+	// newEntry is true if the value has no primary key, and thus will be created rather than updated.
+	newEntry bool
+}
+
+// precondition returns the version that the value expects the stored entry to have, or nil if any version will do.
+// The version is set by the [Precondition] option, or is the value's own version if that is not zero.
+func (tx *gormStoreTransaction) precondition(value any, tContext transactionContext) (*versionPrecondition, error) {
+	stmt := &gorm.Statement{DB: tx.db}
+	if err := stmt.Parse(value); err != nil {
+		return nil, err
+	}
+
+	field := stmt.Schema.LookUpField(tx.config.VersionColumnName)
+	if field == nil {
+		if tContext.precondition != nil {
+			return nil, fmt.Errorf("%w: %q is not a field of %v", ErrUnknownColumn, tx.config.VersionColumnName, stmt.Schema.Name)
+		}
+		return nil, nil
+	}
+
+	ctx, rv := tx.db.Statement.Context, reflect.ValueOf(value)
+	if tContext.precondition != nil {
+		if err := field.Set(ctx, rv, uint64(*tContext.precondition)); err != nil {
+			return nil, err
+		}
+	}
+
+	v, isZero := field.ValueOf(ctx, rv)
+	if isZero {
+		return nil, nil
+	}
+	version := reflect.ValueOf(v)
+	if !version.CanConvert(reflect.TypeFor[manifest.Version]()) {
+		return nil, fmt.Errorf("%w: %q is not a version", ErrUnknownColumn, tx.config.VersionColumnName)
+	}
+
+	result := &versionPrecondition{
+		field:      field,
+		primaryKey: stmt.Schema.PrioritizedPrimaryField,
+		version:    version.Convert(reflect.TypeFor[manifest.Version]()).Interface().(manifest.Version),
+		newEntry:   true,
+	}
+	if result.primaryKey != nil {
+		_, result.newEntry = result.primaryKey.ValueOf(ctx, rv)
+	}
+
+	return result, nil
+}
+
+// apply restricts a write to the entry with the expected version.
+func (p *versionPrecondition) apply(tx *gorm.DB) *gorm.DB {
+	if p == nil || p.newEntry {
+		return tx
+	}
+
+	return tx.Where(clause.Eq{
+		Column: clause.Column{Name: p.field.DBName},
+		Value:  p.version,
+	})
+}
+
+// onConflict returns an upsert clause that only overwrites an existing entry with the expected version.
+// MySQL does not support conditional upserts, thus an existing entry is never overwritten there.
+func (p *versionPrecondition) onConflict(tx *gorm.DB) clause.OnConflict {
+	if tx.Dialector.Name() == "mysql" {
+		return clause.OnConflict{DoNothing: true}
+	}
+
+	return clause.OnConflict{
+		UpdateAll: true,
+		Where: clause.Where{Exprs: []clause.Expression{clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: p.field.DBName},
+			Value:  p.version,
+		}}},
+	}
+}
+
+// failed is called when a write has not changed any entry. It reverts the version of the value changed by model hooks,
+// and returns [ErrVersionConflict] if the entry exists, and thus must have a version other than expected.
+func (p *versionPrecondition) failed(db *gorm.DB, value any, tContext transactionContext) error {
+	if p == nil || p.newEntry || p.primaryKey == nil {
+		return nil
+	}
+
+	ctx, rv := db.Statement.Context, reflect.ValueOf(value)
+	if err := p.field.Set(ctx, rv, uint64(p.version)); err != nil {
+		return err
+	}
+
+	id, _ := p.primaryKey.ValueOf(ctx, rv)
+	tx := db.Model(value)
+	if tContext.unScoped {
+		tx = tx.Unscoped()
+	}
+
+	var count int64
+	if err := tx.Where(clause.Eq{Column: clause.Column{Name: p.primaryKey.DBName}, Value: id}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v expected at version %d", ErrVersionConflict, id, p.version)
+}
+
 func (tx *gormStoreTransaction) GetByUID(dest any, id manifest.ResourceID, options ...Option) (bool, error) {
 	rx, _ := applyOptions(tx.db, tx.config, dest, options...)
 	rx = rx.First(dest, id)
@@ -0,0 +1,245 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidFacet error is returned by facet queries without label keys, or with a time bucket shorter than a second.
+var ErrInvalidFacet = errors.New("invalid facet")
+
+// CountLabelValues returns numbers of models that match search query per combination of values of the label keys, most common first.
+// This is an implementation of [FacetStore] interface. Labels are extracted from the JSON column by the DB,
+// and the label index, if enabled for the model, only serves the label selector of the search query.
+func (s *DBStore) CountLabelValues(ctx context.Context, model any, keys []string, searchQuery manifest.SearchQuery, options ...Option) ([]manifest.FacetCount, error) {
+	if err := validateFacetKeys(keys); err != nil {
+		return nil, err
+	}
+	if err := facetDialect(s.db); err != nil {
+		return nil, err
+	}
+
+	tContext := resolveOptions(s.config, model, options...)
+	matched, err := s.facetQuery(ctx, model, tContext, searchQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	// SELECT f0, f1, COUNT(*) AS count FROM (SELECT JSON_EXTRACT(labels, '$."env"') AS f0, ... FROM models WHERE ...) GROUP BY f0, f1
+	selects := make([]string, 0, len(keys))
+	values := make([]any, 0, len(keys))
+	aliases := make([]string, 0, len(keys))
+	for i, key := range keys {
+		alias := fmt.Sprintf("f%d", i)
+		selects = append(selects, "? AS "+alias)
+		values = append(values, labelValueExpression{column: s.config.LabelsColumnName, key: key})
+		aliases = append(aliases, alias)
+	}
+
+	tx := s.reader(ctx).Table("(?) AS wyrd_facets", matched.Select(strings.Join(selects, ", "), values...)).
+		Select(strings.Join(aliases, ", ") + ", COUNT(*) AS count").
+		Where(strings.Join(aliases, " IS NOT NULL OR ") + " IS NOT NULL").
+		Group(strings.Join(aliases, ", ")).
+		Order("count DESC")
+	// Models without a label go last, as they do in PostgreSQL, while SQLite and MySQL order NULLs first
+	for _, alias := range aliases {
+		tx = tx.Order(alias + " IS NULL").Order(alias)
+	}
+
+	rows, err := limitedQuery(tx, searchQuery).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []manifest.FacetCount{}
+	for rows.Next() {
+		labelValues := make([]sql.NullString, len(keys))
+		dest := make([]any, 0, len(keys)+1)
+		for i := range labelValues {
+			dest = append(dest, &labelValues[i])
+		}
+
+		var facet manifest.FacetCount
+		if err := rows.Scan(append(dest, &facet.Count)...); err != nil {
+			return result, err
+		}
+
+		facet.Labels = make(manifest.Labels, len(keys))
+		for i, value := range labelValues {
+			if value.Valid {
+				facet.Labels[keys[i]] = value.String
+			}
+		}
+		result = append(result, facet)
+	}
+
+	return result, rows.Err()
+}
+
+// CountByTime returns numbers of models that match search query per time bucket, by the time field of the search query, in order of time.
+// This is an implementation of [FacetStore] interface. Buckets are aligned to Unix epoch, and models without the timestamp are not counted.
+func (s *DBStore) CountByTime(ctx context.Context, model any, bucket time.Duration, searchQuery manifest.SearchQuery, options ...Option) ([]manifest.TimeBucket, error) {
+	if bucket < time.Second {
+		return nil, fmt.Errorf("%w: time bucket %v is shorter than a second", ErrInvalidFacet, bucket)
+	}
+	if err := facetDialect(s.db); err != nil {
+		return nil, err
+	}
+
+	column, err := s.config.TimeColumn(searchQuery.TimeField)
+	if err != nil {
+		return nil, err
+	}
+
+	tContext := resolveOptions(s.config, model, options...)
+	// Soft-deleted entries must be included to count them by the time of deletion
+	if searchQuery.TimeField == manifest.TimeFieldDeleted {
+		tContext.unScoped = true
+	}
+	matched, err := s.facetQuery(ctx, model, tContext, searchQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	matched = matched.Select("? AS bucket", timeBucketExpression{column: column, seconds: int64(bucket / time.Second)}).
+		Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: nil})
+	tx := s.reader(ctx).Table("(?) AS wyrd_facets", matched).
+		Select("bucket, COUNT(*) AS count").
+		Group("bucket").
+		Order("bucket")
+
+	var buckets []struct {
+		Bucket int64
+		Count  int64
+	}
+	if err := limitedQuery(tx, searchQuery).Scan(&buckets).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]manifest.TimeBucket, 0, len(buckets))
+	for _, b := range buckets {
+		result = append(result, manifest.TimeBucket{Start: time.Unix(b.Bucket, 0).UTC(), Count: b.Count})
+	}
+
+	return result, nil
+}
+
+// facetQuery returns a query of models that match search query, as Find counts them: without sorting and pagination.
+func (s *DBStore) facetQuery(ctx context.Context, model any, tContext transactionContext, query manifest.SearchQuery) (*gorm.DB, error) {
+	query.Sort = nil
+	query.Continue = ""
+
+	tx, xtx := applyTransactionContext(FromReplica(s.db.Model(model).WithContext(ctx)), tContext)
+	if xtx == nil {
+		xtx = tx
+	}
+
+	_, matched, err := withQuery(tx, xtx, tContext, query)
+	return matched, err
+}
+
+func validateFacetKeys(keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: no label keys", ErrInvalidFacet)
+	}
+
+	for _, key := range keys {
+		if err := manifest.ValidateLabelKey(key); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidFacet, err)
+		}
+	}
+
+	return nil
+}
+
+func facetDialect(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "sqlite", "mysql", "postgres":
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v", ErrUnsupportedDialect, db.Dialector.Name())
+}
+
+// labelValueExpression is an expression evaluating to the value of a label as text, or NULL if a model does not have the label.
+type labelValueExpression struct {
+	column string
+	key    string
+}
+
+// Build implements clause.Expression
+func (e labelValueExpression) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		return
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: e.column}
+	switch stmt.Dialector.Name() {
+	case "sqlite":
+		builder.WriteString("JSON_EXTRACT(")
+		builder.WriteQuoted(column)
+		builder.WriteByte(',')
+		builder.AddVar(stmt, jsonQueryJoin([]string{e.key}))
+		builder.WriteByte(')')
+	case "mysql":
+		builder.WriteString("JSON_UNQUOTE(JSON_EXTRACT(")
+		builder.WriteQuoted(column)
+		builder.WriteByte(',')
+		builder.AddVar(stmt, jsonQueryJoin([]string{e.key}))
+		builder.WriteString("))")
+	case "postgres":
+		builder.WriteQuoted(column)
+		builder.WriteString("::json ->> ")
+		builder.AddVar(stmt, e.key)
+	}
+}
+
+// timeBucketExpression is an expression evaluating to Unix time of the start of a time bucket that a timestamp column falls into.
+type timeBucketExpression struct {
+	column  string
+	seconds int64
+}
+
+// Build implements clause.Expression
+func (e timeBucketExpression) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		return
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: e.column}
+	switch stmt.Dialector.Name() {
+	case "sqlite":
+		builder.WriteString("CAST(STRFTIME('%s', ")
+		builder.WriteQuoted(column)
+		builder.WriteString(") AS INTEGER) / ")
+		builder.AddVar(stmt, e.seconds)
+		builder.WriteString(" * ")
+		builder.AddVar(stmt, e.seconds)
+	case "mysql":
+		builder.WriteString("FLOOR(UNIX_TIMESTAMP(")
+		builder.WriteQuoted(column)
+		builder.WriteString(") / ")
+		builder.AddVar(stmt, e.seconds)
+		builder.WriteString(") * ")
+		builder.AddVar(stmt, e.seconds)
+	case "postgres":
+		builder.WriteString("CAST(FLOOR(EXTRACT(EPOCH FROM ")
+		builder.WriteQuoted(column)
+		builder.WriteString(") / ")
+		builder.AddVar(stmt, e.seconds)
+		builder.WriteString(") * ")
+		builder.AddVar(stmt, e.seconds)
+		builder.WriteString(" AS BIGINT)")
+	}
+}
@@ -0,0 +1,189 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func givenFacetedPets() []Pet {
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	return []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat", "env": "prod"}), withCreatedAt(day.Add(10*time.Minute))),
+		makePet("tom", "Tom", withLabels(manifest.Labels{"kind": "cat", "env": "prod"}), withCreatedAt(day.Add(50*time.Minute))),
+		makePet("felix", "Felix", withLabels(manifest.Labels{"kind": "cat", "env": "dev"}), withCreatedAt(day.Add(3*time.Hour))),
+		makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog", "env": "prod"}), withCreatedAt(day.Add(3*time.Hour+time.Minute))),
+		makePet("spot", "Spot", withLabels(manifest.Labels{"kind": "dog"}), withCreatedAt(day.Add(25*time.Hour))),
+		makePet("nemo", "Nemo", withCreatedAt(day.Add(26*time.Hour))),
+	}
+}
+
+func TestStore_CountLabelValues(t *testing.T) {
+	testCases := map[string]struct {
+		keys  []string
+		query manifest.SearchQuery
+
+		expect    []manifest.FacetCount
+		expectErr error
+	}{
+		"one key": {
+			keys: []string{"env"},
+			expect: []manifest.FacetCount{
+				{Labels: manifest.Labels{"env": "prod"}, Count: 3},
+				{Labels: manifest.Labels{"env": "dev"}, Count: 1},
+			},
+		},
+		"combination of keys": {
+			keys: []string{"kind", "env"},
+			expect: []manifest.FacetCount{
+				{Labels: manifest.Labels{"kind": "cat", "env": "prod"}, Count: 2},
+				{Labels: manifest.Labels{"kind": "cat", "env": "dev"}, Count: 1},
+				{Labels: manifest.Labels{"kind": "dog", "env": "prod"}, Count: 1},
+				{Labels: manifest.Labels{"kind": "dog"}, Count: 1},
+			},
+		},
+		"matching query": {
+			keys:  []string{"env"},
+			query: manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")},
+			expect: []manifest.FacetCount{
+				{Labels: manifest.Labels{"env": "prod"}, Count: 2},
+				{Labels: manifest.Labels{"env": "dev"}, Count: 1},
+			},
+		},
+		"limited": {
+			keys:  []string{"kind", "env"},
+			query: manifest.SearchQuery{Offset: 1, Limit: 2},
+			expect: []manifest.FacetCount{
+				{Labels: manifest.Labels{"kind": "cat", "env": "dev"}, Count: 1},
+				{Labels: manifest.Labels{"kind": "dog", "env": "prod"}, Count: 1},
+			},
+		},
+		"unknown key": {
+			keys:   []string{"owner"},
+			expect: []manifest.FacetCount{},
+		},
+		"no keys": {
+			expectErr: dbstore.ErrInvalidFacet,
+		},
+		"invalid key": {
+			keys:      []string{"'; DROP TABLE pets; --"},
+			expectErr: dbstore.ErrInvalidFacet,
+		},
+	}
+
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, givenFacetedPets())
+			defer cleanup()
+
+			for name, tc := range testCases {
+				test := tc
+				t.Run(name, func(t *testing.T) {
+					got, err := store.CountLabelValues(context.TODO(), &Pet{}, test.keys, test.query)
+					if test.expectErr != nil {
+						require.ErrorIs(t, err, test.expectErr)
+						return
+					}
+
+					require.NoError(t, err)
+					require.Equal(t, test.expect, got)
+				})
+			}
+		})
+	}
+}
+
+func TestStore_CountByTime(t *testing.T) {
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		bucket time.Duration
+		query  manifest.SearchQuery
+
+		expect    []manifest.TimeBucket
+		expectErr error
+	}{
+		"hourly": {
+			bucket: time.Hour,
+			expect: []manifest.TimeBucket{
+				{Start: day, Count: 2},
+				{Start: day.Add(3 * time.Hour), Count: 2},
+				{Start: day.Add(25 * time.Hour), Count: 1},
+				{Start: day.Add(26 * time.Hour), Count: 1},
+			},
+		},
+		"daily": {
+			bucket: 24 * time.Hour,
+			expect: []manifest.TimeBucket{
+				{Start: day, Count: 4},
+				{Start: day.Add(24 * time.Hour), Count: 2},
+			},
+		},
+		"matching query": {
+			bucket: 24 * time.Hour,
+			query:  manifest.SearchQuery{Selector: mustSelector(t, "kind=dog"), FromTime: day.Add(time.Hour)},
+			expect: []manifest.TimeBucket{
+				{Start: day, Count: 1},
+				{Start: day.Add(24 * time.Hour), Count: 1},
+			},
+		},
+		"unknown time field": {
+			bucket:    time.Hour,
+			query:     manifest.SearchQuery{TimeField: "born"},
+			expectErr: dbstore.ErrUnknownTimeField,
+		},
+		"short bucket": {
+			bucket:    time.Millisecond,
+			expectErr: dbstore.ErrInvalidFacet,
+		},
+	}
+
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, givenFacetedPets())
+			defer cleanup()
+
+			for name, tc := range testCases {
+				test := tc
+				t.Run(name, func(t *testing.T) {
+					got, err := store.CountByTime(context.TODO(), &Pet{}, test.bucket, test.query)
+					if test.expectErr != nil {
+						require.ErrorIs(t, err, test.expectErr)
+						return
+					}
+
+					require.NoError(t, err)
+					require.Equal(t, test.expect, got)
+				})
+			}
+		})
+	}
+}
+
+func TestStore_CountByTime_Deleted(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, givenFacetedPets())
+			defer cleanup()
+			ctx := context.TODO()
+
+			_, err := store.DeleteMany(ctx, &Pet{}, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")})
+			require.NoError(t, err)
+
+			got, err := store.CountByTime(ctx, &Pet{}, 24*time.Hour, manifest.SearchQuery{TimeField: manifest.TimeFieldDeleted})
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			require.Equal(t, int64(3), got[0].Count)
+
+			// Deleted models are not counted by other time fields
+			got, err = store.CountByTime(ctx, &Pet{}, 24*time.Hour, manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Len(t, got, 2)
+			require.Equal(t, int64(1), got[0].Count)
+		})
+	}
+}
@@ -0,0 +1,846 @@
+package dbstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidManifestFile error is returned when a file of [FSStore] can not be decoded, or declares a model that another file declares.
+var ErrInvalidManifestFile = errors.New("invalid manifest file")
+
+const (
+	// defaultFSReloadInterval is how often files are checked for external edits, unless set by [FSStore.Interval].
+	defaultFSReloadInterval = 2 * time.Second
+	// fsWatchDelay is how long [FSStore.Watch] waits for more changes after a file system notification before reloading files,
+	// as editors and git write many files at once.
+	fsWatchDelay = 100 * time.Millisecond
+
+	// fsFileMode is the permission of manifest files created by the store.
+	fsFileMode = 0o644
+	// fsDirMode is the permission of directories created by the store.
+	fsDirMode = 0o755
+)
+
+// FSStore is an implementation of [Store] and [LabelStore] backed by a directory tree of YAML manifest files,
+// such as a checkout of a git repository that holds the desired state of resources.
+//
+// Files with `.yaml` and `.yml` extensions are read, and each document of a file is decoded as a [manifest.ResourceManifest]
+// using the kind registry. Documents of kinds that match a model given to [NewFSStore] are indexed in memory and served
+// by a [MemStore], documents of other kinds are kept as is. Documents that have no `uid` get one derived from their kind and name,
+// and models are versioned from 1, thus manifests written by hand need only kind, name and spec. Hidden directories, such as .git, are skipped.
+//
+// Writes are applied to the files first, and become visible to reads once the files are written. A model is written back to the file
+// it was read from, in place of its document, and new models are written to `<kind>/<name>.yaml`, thus names of new models must be
+// valid DNS subdomain names, see [manifest.ValidateSubdomainName]. Documents are encoded with indent of 2,
+// in the order of fields of the manifest, thus files are formatted the same on every write. Soft-deleted models keep their document,
+// with `deletionTimestamp`, and deleting permanently removes the document, and the file once it has none.
+// Derived `uid` and version 1 are not written, as reads assign them, while `creationTimestamp` and `updateTimestamp` of models
+// a write modifies are, by design, thus a file records when the store last changed each of its models.
+//
+// Files edited outside of the store are picked up by [FSStore.Reload], which [FSStore.Watch] calls on file system notifications.
+// A write fails with [ErrTransactionConflict], and writes no files, if a file it would write was changed outside of the store
+// since it was last read, so that edits are never overwritten before they are reloaded. Retry it after [FSStore.Reload].
+//
+// Note: associations are not supported, associated values of models are neither stored nor linked.
+// Note: comments and formatting of documents of models are not preserved when the store rewrites them, other documents are kept as is.
+// Note: model hooks BeforeSave, BeforeCreate, BeforeUpdate and BeforeDelete are called with nil *gorm.DB.
+type FSStore struct {
+	dir string
+	mem *MemStore
+
+	// kinds of models by table name
+	kinds map[string]*fsKind
+
+	// Interval is how often [FSStore.Watch] checks files for external edits if file system notifications are not available.
+	// Defaults to 2 seconds.
+	Interval time.Duration
+
+	// lock serializes writes and reloads, which modify both files and the in-memory index.
+	lock sync.Mutex
+	// files are the manifest files read, by path relative to the directory.
+	files map[string]*fsFile
+	// paths are the files models are declared in.
+	paths map[memKey]string
+}
+
+// fsKind maps documents of a kind to the model of a table.
+type fsKind struct {
+	kind   manifest.Kind
+	schema *schema.Schema
+
+	// Indexes of metadata, spec and status fields of the model. Status is nil if the model has none.
+	meta, spec, status []int
+}
+
+// fsFile is a manifest file as it was last read or written.
+type fsFile struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+
+	docs []fsDoc
+}
+
+// fsDoc is a document of a manifest file, that either declares a model, or is kept as is.
+type fsDoc struct {
+	// key of the model declared by the document, if node is nil.
+	key        memKey
+	apiVersion string
+
+	// node is the content of a document the store does not manage.
+	node *yaml.Node
+}
+
+// NewFSStore creates a new instance of FSStore, reading manifests of the models from files in the directory.
+// Models must have `ObjectMeta` and `Spec` fields, and may have `Status`, as [manifest.ResourceModel] and [manifest.StatefulResource] do,
+// and types of their specs must be registered kinds.
+func NewFSStore(dir string, cfg SchemaConfig, models ...any) (*FSStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %q is not a directory", fs.ErrInvalid, dir)
+	}
+
+	result := &FSStore{
+		dir:   dir,
+		mem:   NewMemStore(cfg),
+		kinds: map[string]*fsKind{},
+		files: map[string]*fsFile{},
+		paths: map[memKey]string{},
+	}
+	for _, model := range models {
+		kind, err := result.kindOf(model)
+		if err != nil {
+			return nil, err
+		}
+		result.kinds[kind.schema.Table] = kind
+	}
+
+	if err := result.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *FSStore) kindOf(model any) (*fsKind, error) {
+	sch, err := s.mem.schema(model)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, ok := sch.ModelType.FieldByName("ObjectMeta")
+	if !ok || meta.Type != reflect.TypeOf(manifest.ObjectMeta{}) {
+		return nil, fmt.Errorf("%w: %v has no ObjectMeta field", gorm.ErrInvalidValue, sch.Name)
+	}
+	spec, ok := sch.ModelType.FieldByName("Spec")
+	if !ok {
+		return nil, fmt.Errorf("%w: %v has no Spec field", gorm.ErrInvalidValue, sch.Name)
+	}
+
+	kind, ok := manifest.KindOf(reflect.New(spec.Type).Interface())
+	if !ok {
+		return nil, fmt.Errorf("%w: spec %v of %v", manifest.ErrUnknownKind, spec.Type, sch.Name)
+	}
+
+	result := &fsKind{
+		kind:   kind,
+		schema: sch,
+		meta:   meta.Index,
+		spec:   spec.Index,
+	}
+	if status, ok := sch.ModelType.FieldByName("Status"); ok {
+		result.status = status.Index
+	}
+
+	return result, nil
+}
+
+// Ping implements [Pinger] interface, checking that the directory is accessible.
+func (s *FSStore) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := os.Stat(s.dir)
+	return err
+}
+
+// Watch reloads files edited outside of the store until the context is cancelled, and returns nil once it is.
+// Files that fail to reload are read again on the next change, as with [FSStore.Reload].
+// Directories are watched for changes with file system notifications, and files are reloaded shortly after changes stop.
+// If notifications are not available, for example on file systems that do not support them, files are reloaded every [FSStore.Interval].
+func (s *FSStore) Watch(ctx context.Context) error {
+	watcher, err := s.watcher()
+	if err != nil {
+		return s.poll(ctx)
+	}
+	defer watcher.Close()
+
+	// Files are reloaded once watched, as files written before directories are added to the watcher are not notified of
+	reload := time.NewTimer(0)
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-watcher.Events:
+			if strings.HasPrefix(filepath.Base(event.Name), ".") {
+				// Hidden files and directories, and temporary files of writes by the store
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					// Files of a directory that fails to be watched are still reloaded on the next notification
+					_ = s.watchDirs(watcher, event.Name)
+				}
+			}
+			reload.Reset(fsWatchDelay)
+		case <-watcher.Errors:
+			// Notifications may be lost, thus all files are checked
+			reload.Reset(fsWatchDelay)
+		case <-reload.C:
+			_ = s.Reload(ctx)
+		}
+	}
+}
+
+// watcher returns a file system watcher of the directory of the store and its subdirectories.
+func (s *FSStore) watcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.watchDirs(watcher, s.dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+// watchDirs adds the directory and its subdirectories, except hidden ones, to the watcher.
+func (s *FSStore) watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != s.dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(path)
+	})
+}
+
+// poll reloads files every [FSStore.Interval] until the context is cancelled, and returns nil once it is.
+func (s *FSStore) poll(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultFSReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		_ = s.Reload(ctx)
+	}
+}
+
+// Reload reads files that were created, modified or removed since they were last read or written by the store,
+// and updates models they declare. Files that fail to decode keep models they declared before, and are read again by the next reload.
+func (s *FSStore) Reload(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	found, err := s.scan()
+	if err != nil {
+		return err
+	}
+
+	s.mem.lock.Lock()
+	defer s.mem.lock.Unlock()
+	ms := s.mem.session(ctx)
+
+	for path := range s.files {
+		if _, ok := found[path]; !ok {
+			s.replace(ms, path, nil, nil)
+		}
+	}
+
+	var errs []error
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		info := found[path]
+		file := s.files[path]
+		if file != nil && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, path))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		hash := sha256.Sum256(data)
+		if file != nil && file.hash == hash {
+			file.modTime, file.size = info.ModTime(), info.Size()
+			continue
+		}
+
+		docs, rows, err := s.decode(ms, path, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w %s: %w", ErrInvalidManifestFile, path, err))
+			continue
+		}
+
+		s.replace(ms, path, &fsFile{modTime: info.ModTime(), size: info.Size(), hash: hash, docs: docs}, rows)
+	}
+
+	return errors.Join(errs...)
+}
+
+// scan returns manifest files of the directory tree by path relative to the directory.
+func (s *FSStore) scan() (map[string]fs.FileInfo, error) {
+	result := map[string]fs.FileInfo{}
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != s.dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); !entry.Type().IsRegular() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+
+		result[rel] = info
+		return nil
+	})
+
+	return result, err
+}
+
+// decode returns documents of the file, and models declared by them by key.
+func (s *FSStore) decode(ms *memSession, path string, data []byte) ([]fsDoc, map[memKey]reflect.Value, error) {
+	var docs []fsDoc
+	rows := map[memKey]reflect.Value{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		node := &yaml.Node{}
+		if err := decoder.Decode(node); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if len(node.Content) == 0 {
+			continue
+		}
+
+		var meta manifest.TypeMeta
+		if err := node.Decode(&meta); err != nil {
+			return nil, nil, err
+		}
+
+		kind := s.kindByName(meta.Kind)
+		if kind == nil {
+			docs = append(docs, fsDoc{node: node})
+			continue
+		}
+
+		var resource manifest.UnredactedManifest
+		if err := node.Decode(&resource); err != nil {
+			return nil, nil, err
+		}
+		value, err := kind.model(resource)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		row := ms.copyIn(kind.schema, value, nil)
+		key := memKey{table: kind.schema.Table, id: ms.primaryKey(kind.schema, row)}
+		if _, ok := rows[key]; ok {
+			return nil, nil, fmt.Errorf("%w: %v %q is declared twice", gorm.ErrDuplicatedKey, kind.kind, resource.Metadata.Name)
+		}
+		if other, ok := s.paths[key]; ok && other != path {
+			return nil, nil, fmt.Errorf("%w: %v %q is declared by %s", gorm.ErrDuplicatedKey, kind.kind, resource.Metadata.Name, other)
+		}
+
+		rows[key] = row
+		docs = append(docs, fsDoc{key: key, apiVersion: resource.APIVersion})
+	}
+
+	return docs, rows, nil
+}
+
+func (s *FSStore) kindByName(kind manifest.Kind) *fsKind {
+	for _, k := range s.kinds {
+		if k.kind == kind {
+			return k
+		}
+	}
+	return nil
+}
+
+// replace replaces models declared by the file with the rows, or removes the file if it is nil.
+// Rows of models that are still declared keep their order.
+func (s *FSStore) replace(ms *memSession, path string, file *fsFile, rows map[memKey]reflect.Value) {
+	if old, ok := s.files[path]; ok {
+		for _, doc := range old.docs {
+			if _, ok := rows[doc.key]; doc.node == nil && !ok {
+				ms.state.setRow(doc.key, nil)
+				delete(s.paths, doc.key)
+			}
+		}
+	}
+
+	if file == nil {
+		delete(s.files, path)
+		return
+	}
+
+	for key, value := range rows {
+		row := &memRow{value: value}
+		if existing := ms.state.row(key); existing != nil {
+			row.seq = existing.seq
+		} else {
+			row.seq = s.mem.seq.Add(1)
+		}
+
+		ms.state.setRow(key, row)
+		s.paths[key] = path
+	}
+	s.files[path] = file
+}
+
+// model returns a value of the model holding metadata, spec and status of the manifest.
+func (k *fsKind) model(resource manifest.UnredactedManifest) (reflect.Value, error) {
+	meta := resource.Metadata
+	if meta.Name == "" {
+		return reflect.Value{}, fmt.Errorf("%w: %v with no name", gorm.ErrInvalidValue, k.kind)
+	}
+	if meta.UID == "" {
+		meta.UID = k.derivedUID(meta.Name)
+	}
+	if meta.Version == 0 {
+		meta.Version = 1
+	}
+
+	result := reflect.New(k.schema.ModelType).Elem()
+	result.FieldByIndex(k.meta).Set(reflect.ValueOf(meta))
+	if err := k.assign(result, k.spec, resource.Spec, "spec"); err != nil {
+		return reflect.Value{}, err
+	}
+	if err := k.assign(result, k.status, resource.Status, "status"); err != nil {
+		return reflect.Value{}, err
+	}
+
+	return result, nil
+}
+
+// derivedUID returns the ID of a model declared by a document with no `uid`, which is the same for every read of the document.
+func (k *fsKind) derivedUID(name manifest.ResourceName) manifest.ResourceID {
+	return manifest.ResourceID(uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("wyrd:%v/%v", k.kind, name))).String())
+}
+
+// assign sets the field of the model to the decoded value, which is nil or a pointer to a value of the field type.
+func (k *fsKind) assign(model reflect.Value, index []int, value any, name string) error {
+	if value == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if index == nil || v.Kind() != reflect.Pointer || v.Type().Elem() != model.FieldByIndex(index).Type() {
+		return fmt.Errorf("%w: %v can not hold %s of type %T", gorm.ErrInvalidValue, k.schema.Name, name, value)
+	}
+
+	model.FieldByIndex(index).Set(v.Elem())
+	return nil
+}
+
+// manifest returns the manifest of a stored model.
+func (k *fsKind) manifest(row reflect.Value, apiVersion string) manifest.UnredactedManifest {
+	meta := row.FieldByIndex(k.meta).Interface().(manifest.ObjectMeta)
+	// Derived IDs and the first version are not written, as reads assign them,
+	// so that documents written by hand do not change when another document of the file does
+	if meta.UID == k.derivedUID(meta.Name) {
+		meta.UID = ""
+	}
+	if meta.Version == 1 {
+		meta.Version = 0
+	}
+
+	result := manifest.UnredactedManifest{
+		TypeMeta: manifest.TypeMeta{APIVersion: apiVersion, Kind: k.kind},
+		Metadata: meta,
+		Spec:     row.FieldByIndex(k.spec).Addr().Interface(),
+	}
+	if k.status != nil {
+		result.Status = row.FieldByIndex(k.status).Addr().Interface()
+	}
+
+	return result
+}
+
+// write runs a store operation over a snapshot of models, writes files of models it modified, then makes the changes visible to reads.
+// Associations are omitted, as they are not supported.
+func (s *FSStore) write(ctx context.Context, value any, options []Option, fn func(*memSession, transactionContext) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sch, err := s.mem.schema(value)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.kinds[sch.Table]; !ok {
+		return fmt.Errorf("%w: model %v", manifest.ErrUnknownKind, sch.Name)
+	}
+
+	tContext := resolveOptions(s.mem.config, value, options...)
+	for name := range sch.Relationships.Relations {
+		tContext.Omit[name] = struct{}{}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.mem.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	session := tx.(*memStoreTransaction).session
+	if err := fn(session, tContext); err != nil {
+		return err
+	}
+	if err := s.flush(session); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// flush writes files declaring models modified by the session.
+// If writing a file fails, files written before it are read again by the next reload.
+func (s *FSStore) flush(ms *memSession) error {
+	changed := map[string][]fsDoc{}
+	docsOf := func(path string) []fsDoc {
+		if docs, ok := changed[path]; ok {
+			return docs
+		}
+		if file, ok := s.files[path]; ok {
+			return slices.Clone(file.docs)
+		}
+		return nil
+	}
+
+	for key := range ms.written {
+		row := ms.state.row(key)
+		path, ok := s.paths[key]
+		switch {
+		case ok && row == nil:
+			changed[path] = slices.DeleteFunc(docsOf(path), func(doc fsDoc) bool {
+				return doc.node == nil && doc.key == key
+			})
+		case ok:
+			changed[path] = docsOf(path)
+		case row != nil:
+			path, err := s.pathOf(ms, key, row)
+			if err != nil {
+				return err
+			}
+			changed[path] = append(docsOf(path), fsDoc{key: key})
+		}
+	}
+
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	// All files are checked before any is written, so that a conflict leaves files as they are
+	for _, path := range paths {
+		if err := s.checkFile(path); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		file, err := s.writeFile(ms, path, changed[path])
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+
+		if old, ok := s.files[path]; ok {
+			for _, doc := range old.docs {
+				delete(s.paths, doc.key)
+			}
+		}
+		if file == nil {
+			delete(s.files, path)
+			continue
+		}
+		for _, doc := range file.docs {
+			if doc.node == nil {
+				s.paths[doc.key] = path
+			}
+		}
+		s.files[path] = file
+	}
+
+	return nil
+}
+
+// checkFile returns [ErrTransactionConflict] if the file was created, edited or removed outside of the store since it was last read or written,
+// as writing it would overwrite changes that are not reloaded yet.
+func (s *FSStore) checkFile(path string) error {
+	file := s.files[path]
+	info, err := os.Stat(filepath.Join(s.dir, path))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if file == nil {
+			return nil
+		}
+		return fmt.Errorf("%w: %s was removed outside of the store", ErrTransactionConflict, path)
+	case err != nil:
+		return err
+	case file == nil:
+		return fmt.Errorf("%w: %s was created outside of the store", ErrTransactionConflict, path)
+	case file.modTime.Equal(info.ModTime()) && file.size == info.Size():
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, path))
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(data) != file.hash {
+		return fmt.Errorf("%w: %s was edited outside of the store", ErrTransactionConflict, path)
+	}
+
+	return nil
+}
+
+// pathOf returns the path of the file a new model is written to, relative to the directory of the store.
+// Names are validated, so that a model can not be written outside of the directory.
+func (s *FSStore) pathOf(ms *memSession, key memKey, row *memRow) (string, error) {
+	kind := s.kinds[key.table]
+	name := fmt.Sprint(key.id)
+	if v, ok := columnOf(kind.schema, row.value, ms.config().NameColumnName); ok && v != nil && fmt.Sprint(v) != "" {
+		name = fmt.Sprint(v)
+	}
+	if err := manifest.ValidateSubdomainName(name); err != nil {
+		return "", fmt.Errorf("can not write %v %q to a file: %w", kind.kind, name, err)
+	}
+
+	path := filepath.Join(strings.ToLower(string(kind.kind)), name+".yaml")
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("%w: %v %q would be written outside of %s", fs.ErrInvalid, kind.kind, name, s.dir)
+	}
+
+	return path, nil
+}
+
+// writeFile replaces the file with the documents, or removes it if there are none left, returning the file as written.
+func (s *FSStore) writeFile(ms *memSession, path string, docs []fsDoc) (*fsFile, error) {
+	fullPath := filepath.Join(s.dir, path)
+	if len(docs) == 0 {
+		if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, doc := range docs {
+		var value any = doc.node
+		if doc.node == nil {
+			value = s.kinds[doc.key.table].manifest(ms.state.row(doc.key).value, doc.apiVersion)
+		}
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), fsDirMode); err != nil {
+		return nil, err
+	}
+	// Files are replaced by renaming, so that readers never observe a partially written file.
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fsFileMode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fullPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsFile{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(buf.Bytes()),
+		docs:    docs,
+	}, nil
+}
+
+// Create inserts a new value into the store, updating inserted models ID.
+func (s *FSStore) Create(ctx context.Context, value any, options ...Option) error {
+	return s.write(ctx, value, options, func(ms *memSession, tContext transactionContext) error {
+		return ms.create(value, tContext)
+	})
+}
+
+// CreateOrUpdate inserts a new value into the store if the models.ID is nil, otherwise it replaces it.
+func (s *FSStore) CreateOrUpdate(ctx context.Context, value any, options ...Option) (exists bool, err error) {
+	err = s.write(ctx, value, options, func(ms *memSession, tContext transactionContext) (err error) {
+		exists, err = ms.save(value, tContext)
+		return
+	})
+	return
+}
+
+// Update updates non-zero fields of an entry identified by the ID of the value.
+// See [DBStore.Update].
+func (s *FSStore) Update(ctx context.Context, value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.write(ctx, value, options, func(ms *memSession, tContext transactionContext) (err error) {
+		exists, err = ms.update(value, id, tContext)
+		return
+	})
+	return
+}
+
+// Delete deletes an entry identified by the ID from the store.
+// See [DBStore.Delete].
+func (s *FSStore) Delete(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = s.write(ctx, model, options, func(ms *memSession, tContext transactionContext) (err error) {
+		existed, err = ms.delete(model, id, version, tContext)
+		return
+	})
+	return
+}
+
+// Restore restores a previously deleted entry identified by the ID.
+// See [DBStore.Restore].
+func (s *FSStore) Restore(ctx context.Context, model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	err = s.write(ctx, model, options, func(ms *memSession, tContext transactionContext) (err error) {
+		existed, err = ms.restore(model, id, tContext)
+		return
+	})
+	return
+}
+
+// GetByUID finds at most one entry in the store identified by the UUID if there is one.
+// See [DBStore.GetByUID].
+func (s *FSStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	return s.mem.GetByUID(ctx, dest, id, options...)
+}
+
+// GetByName finds at most one entry in the store identified by the name if there is one.
+// See [DBStore.GetByName].
+func (s *FSStore) GetByName(ctx context.Context, dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	return s.mem.GetByName(ctx, dest, name, options...)
+}
+
+// Find returns models from the store that matched search query parameters.
+// See [DBStore.Find].
+func (s *FSStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
+	return s.mem.Find(ctx, dest, searchQuery, options...)
+}
+
+// FindNames returns a set of names for a model type.
+// See [DBStore.FindNames].
+func (s *FSStore) FindNames(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (manifest.StringSet, error) {
+	return s.mem.FindNames(ctx, model, searchQuery, options...)
+}
+
+// FindLabels returns a set of label keys for a given model type.
+// See [DBStore.FindLabels].
+func (s *FSStore) FindLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (manifest.StringSet, error) {
+	return s.mem.FindLabels(ctx, model, searchQuery, options...)
+}
+
+// FindLabelValues returns a set of label values for a given model type and label key.
+// See [DBStore.FindLabelValues].
+func (s *FSStore) FindLabelValues(ctx context.Context, model any, key string, searchQuery manifest.SearchQuery, options ...Option) (manifest.StringSet, error) {
+	return s.mem.FindLabelValues(ctx, model, key, searchQuery, options...)
+}
@@ -0,0 +1,402 @@
+package dbstore_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const serviceKind = manifest.Kind("Service")
+
+type ServiceSpec struct {
+	Image    string `json:"image" yaml:"image"`
+	Replicas int    `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+}
+
+type Service manifest.ResourceModel[ServiceSpec]
+
+func registerServiceKind(t *testing.T) {
+	require.NoError(t, manifest.RegisterKind(serviceKind, &ServiceSpec{}))
+	t.Cleanup(func() { manifest.UnregisterKind(serviceKind) })
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		fullPath := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0o755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0o644))
+	}
+}
+
+func readFile(t *testing.T, dir, path string) string {
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func findServices(t *testing.T, store dbstore.Store, query manifest.SearchQuery) map[manifest.ResourceName]ServiceSpec {
+	var services []Service
+	_, err := store.Find(context.TODO(), &services, query)
+	require.NoError(t, err)
+
+	result := make(map[manifest.ResourceName]ServiceSpec, len(services))
+	for _, s := range services {
+		result[s.Name] = s.Spec
+	}
+	return result
+}
+
+const givenServiceFiles = `# Services of the shop
+kind: Service
+metadata:
+  name: web
+  labels:
+    tier: frontend
+spec:
+  image: nginx
+  replicas: 3
+---
+# Not managed by the store
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  key: value
+`
+
+func makeTestFSStore(t *testing.T, files map[string]string) (*dbstore.FSStore, string) {
+	registerServiceKind(t)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+
+	store, err := dbstore.NewFSStore(dir, dbstore.ManifestModel, &Service{})
+	require.NoError(t, err)
+	return store, dir
+}
+
+func TestNewFSStore_Errors(t *testing.T) {
+	registerServiceKind(t)
+
+	testCases := map[string]struct {
+		files  map[string]string
+		dir    string
+		models []any
+		expect error
+	}{
+		"no-dir": {
+			dir:    "missing",
+			models: []any{&Service{}},
+			expect: os.ErrNotExist,
+		},
+		"unknown-kind": {
+			models: []any{&Pet{}},
+			expect: manifest.ErrUnknownKind,
+		},
+		"not-a-manifest": {
+			models: []any{&Toy{}},
+			expect: gorm.ErrInvalidValue,
+		},
+		"invalid-yaml": {
+			files:  map[string]string{"web.yaml": "kind: Service\nmetadata: [\n"},
+			models: []any{&Service{}},
+			expect: dbstore.ErrInvalidManifestFile,
+		},
+		"no-name": {
+			files:  map[string]string{"web.yaml": "kind: Service\nspec:\n  image: nginx\n"},
+			models: []any{&Service{}},
+			expect: dbstore.ErrInvalidManifestFile,
+		},
+		"duplicate": {
+			files: map[string]string{
+				"web.yaml":       "kind: Service\nmetadata:\n  name: web\n",
+				"other/web.yaml": "kind: Service\nmetadata:\n  name: web\n",
+			},
+			models: []any{&Service{}},
+			expect: gorm.ErrDuplicatedKey,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+
+			_, err := dbstore.NewFSStore(filepath.Join(dir, test.dir), dbstore.ManifestModel, test.models...)
+			require.ErrorIs(t, err, test.expect)
+		})
+	}
+}
+
+func TestFSStore_Load(t *testing.T) {
+	store, dir := makeTestFSStore(t, map[string]string{
+		"shop/web.yaml": givenServiceFiles,
+		"shop/api.yml": `kind: Service
+metadata:
+  uid: 0b3c6e0c-8d5a-4a0e-9d0b-2f7f0e9f5a11
+  version: 4
+  name: api
+  labels:
+    tier: backend
+spec:
+  image: api-server
+`,
+		".git/web.yaml":  "kind: Service\nmetadata:\n  name: web\n",
+		"shop/notes.txt": "kind: Service\nmetadata:\n  name: notes\n",
+	})
+	ctx := context.TODO()
+
+	require.NoError(t, store.Ping(ctx))
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{
+		"web": {Image: "nginx", Replicas: 3},
+		"api": {Image: "api-server"},
+	}, findServices(t, store, manifest.SearchQuery{}))
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{
+		"api": {Image: "api-server"},
+	}, findServices(t, store, manifest.SearchQuery{Selector: mustSelector(t, "tier=backend")}))
+
+	var api Service
+	found, err := store.GetByUID(ctx, &api, "0b3c6e0c-8d5a-4a0e-9d0b-2f7f0e9f5a11")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, manifest.Version(4), api.Version)
+
+	// Manifests without UID get one derived from the kind and name, that is the same each time the files are read
+	var web Service
+	found, err = store.GetByName(ctx, &web, "web")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NotEmpty(t, web.UID)
+	require.Equal(t, manifest.Version(1), web.Version)
+
+	reloaded, err := dbstore.NewFSStore(dir, dbstore.ManifestModel, &Service{})
+	require.NoError(t, err)
+	var again Service
+	found, err = reloaded.GetByName(ctx, &again, "web")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, web.UID, again.UID)
+
+	values, err := store.FindLabelValues(ctx, &Service{}, "tier", manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, manifest.NewStringSet("frontend", "backend"), values)
+}
+
+func TestFSStore_Write(t *testing.T) {
+	store, dir := makeTestFSStore(t, map[string]string{"shop/web.yaml": givenServiceFiles})
+	ctx := context.TODO()
+
+	// New models are written to a file of their own
+	cache := Service{
+		ObjectMeta: manifest.ObjectMeta{Name: "cache", Labels: manifest.Labels{"tier": "backend"}},
+		Spec:       ServiceSpec{Image: "redis"},
+	}
+	require.NoError(t, store.Create(ctx, &cache))
+	content := readFile(t, dir, "service/cache.yaml")
+	require.Contains(t, content, "kind: Service\nmetadata:\n  uid: "+string(cache.UID)+"\n  name: cache\n  labels:\n    tier: backend\n")
+	require.Contains(t, content, "\nspec:\n  image: redis\n")
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{
+		"web":   {Image: "nginx", Replicas: 3},
+		"cache": {Image: "redis"},
+	}, findServices(t, store, manifest.SearchQuery{}))
+
+	// Updated model replaces its document, and documents the store does not manage are kept
+	var web Service
+	_, err := store.GetByName(ctx, &web, "web")
+	require.NoError(t, err)
+	updated, err := store.Update(ctx, &Service{Spec: ServiceSpec{Image: "nginx:1.27"}}, web.UID, dbstore.Precondition(web.Version))
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	content = readFile(t, dir, "shop/web.yaml")
+	require.Contains(t, content, "  name: web\n")
+	require.Contains(t, content, "spec:\n  image: nginx:1.27\n  replicas: 3\n---\n# Not managed by the store\nkind: ConfigMap\n")
+
+	// Files are the source of truth: a new store reads the same models
+	reloaded, err := dbstore.NewFSStore(dir, dbstore.ManifestModel, &Service{})
+	require.NoError(t, err)
+	require.Equal(t, findServices(t, store, manifest.SearchQuery{}), findServices(t, reloaded, manifest.SearchQuery{}))
+
+	// Soft-deleted model keeps its document
+	existed, err := store.Delete(ctx, &Service{}, cache.UID, 0)
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.Contains(t, readFile(t, dir, "service/cache.yaml"), "deletionTimestamp:")
+	reloaded, err = dbstore.NewFSStore(dir, dbstore.ManifestModel, &Service{})
+	require.NoError(t, err)
+	found, err := reloaded.GetByUID(ctx, &Service{}, cache.UID)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	restored, err := store.Restore(ctx, &Service{}, cache.UID)
+	require.NoError(t, err)
+	require.True(t, restored)
+	require.NotContains(t, readFile(t, dir, "service/cache.yaml"), "deletionTimestamp:")
+
+	// Permanently deleted model removes its document, and the file once it is empty
+	existed, err = store.Delete(ctx, &Service{}, cache.UID, 0, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.NoFileExists(t, filepath.Join(dir, "service/cache.yaml"))
+
+	existed, err = store.Delete(ctx, &Service{}, web.UID, 0, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.Equal(t, "# Not managed by the store\nkind: ConfigMap\nmetadata:\n  name: web-config\ndata:\n  key: value\n", readFile(t, dir, "shop/web.yaml"))
+	require.Empty(t, findServices(t, store, manifest.SearchQuery{}))
+
+	require.ErrorIs(t, store.Create(ctx, &Pet{}), manifest.ErrUnknownKind)
+}
+
+func TestFSStore_WriteConflict(t *testing.T) {
+	store, dir := makeTestFSStore(t, map[string]string{
+		"services.yaml": "kind: Service\nmetadata:\n  name: a\nspec:\n  image: a1\n---\nkind: Service\nmetadata:\n  name: b\nspec:\n  image: b1\n",
+	})
+	ctx := context.TODO()
+
+	var a Service
+	_, err := store.GetByName(ctx, &a, "a")
+	require.NoError(t, err)
+
+	// Edits not reloaded yet are not overwritten by writes of other documents of the file
+	edited := "kind: Service\nmetadata:\n  name: a\nspec:\n  image: a1\n---\nkind: Service\nmetadata:\n  name: b\nspec:\n  image: b2\n"
+	writeFiles(t, dir, map[string]string{"services.yaml": edited})
+	_, err = store.Update(ctx, &Service{Spec: ServiceSpec{Image: "a2"}}, a.UID)
+	require.ErrorIs(t, err, dbstore.ErrTransactionConflict)
+	require.Equal(t, edited, readFile(t, dir, "services.yaml"))
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{"a": {Image: "a1"}, "b": {Image: "b1"}}, findServices(t, store, manifest.SearchQuery{}))
+
+	// Files created outside of the store are not overwritten by new models
+	writeFiles(t, dir, map[string]string{"service/c.yaml": "kind: Service\nmetadata:\n  name: c\nspec:\n  image: c1\n"})
+	require.ErrorIs(t, store.Create(ctx, &Service{ObjectMeta: manifest.ObjectMeta{Name: "c"}, Spec: ServiceSpec{Image: "c2"}}), dbstore.ErrTransactionConflict)
+
+	// Writes succeed once edits are reloaded, and documents written by hand get no derived uid or version
+	require.NoError(t, store.Reload(ctx))
+	_, err = store.Update(ctx, &Service{Spec: ServiceSpec{Image: "a2"}}, a.UID)
+	require.NoError(t, err)
+	content := readFile(t, dir, "services.yaml")
+	require.Contains(t, content, "---\nkind: Service\nmetadata:\n  name: b\nspec:\n  image: b2\n")
+	require.NotContains(t, content, "uid:")
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{
+		"a": {Image: "a2"},
+		"b": {Image: "b2"},
+		"c": {Image: "c1"},
+	}, findServices(t, store, manifest.SearchQuery{}))
+
+	// Models keep their identity across reads of the files
+	reloaded, err := dbstore.NewFSStore(dir, dbstore.ManifestModel, &Service{})
+	require.NoError(t, err)
+	var got Service
+	_, err = reloaded.GetByName(ctx, &got, "a")
+	require.NoError(t, err)
+	require.Equal(t, a.UID, got.UID)
+}
+
+func TestFSStore_WriteInvalidName(t *testing.T) {
+	store, dir := makeTestFSStore(t, nil)
+	ctx := context.TODO()
+
+	// Names are validated, so that models are never written outside of the directory
+	escape := Service{ObjectMeta: manifest.ObjectMeta{Name: "../../escape"}, Spec: ServiceSpec{Image: "nginx"}}
+	require.ErrorIs(t, store.Create(ctx, &escape), manifest.ErrNameNotDNSname)
+	require.NoFileExists(t, filepath.Join(dir, "..", "escape.yaml"))
+	require.Empty(t, findServices(t, store, manifest.SearchQuery{}))
+}
+
+func TestFSStore_Reload(t *testing.T) {
+	store, dir := makeTestFSStore(t, map[string]string{
+		"web.yaml": "kind: Service\nmetadata:\n  name: web\nspec:\n  image: nginx\n",
+		"api.yaml": "kind: Service\nmetadata:\n  name: api\nspec:\n  image: api-server\n",
+	})
+	ctx := context.TODO()
+
+	var web Service
+	_, err := store.GetByName(ctx, &web, "web")
+	require.NoError(t, err)
+
+	// Nothing changed
+	require.NoError(t, store.Reload(ctx))
+
+	writeFiles(t, dir, map[string]string{
+		"web.yaml":        "kind: Service\nmetadata:\n  name: web\nspec:\n  image: nginx:1.27\n  replicas: 2\n",
+		"jobs/batch.yaml": "kind: Service\nmetadata:\n  name: batch\nspec:\n  image: batch\n",
+	})
+	require.NoError(t, os.Remove(filepath.Join(dir, "api.yaml")))
+	require.NoError(t, store.Reload(ctx))
+
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{
+		"web":   {Image: "nginx:1.27", Replicas: 2},
+		"batch": {Image: "batch"},
+	}, findServices(t, store, manifest.SearchQuery{}))
+
+	// Models keep their identity across edits
+	var edited Service
+	_, err = store.GetByName(ctx, &edited, "web")
+	require.NoError(t, err)
+	require.Equal(t, web.UID, edited.UID)
+
+	// A file that fails to decode keeps models it declared
+	writeFiles(t, dir, map[string]string{"web.yaml": "kind: Service\nmetadata: [\n"})
+	require.ErrorIs(t, store.Reload(ctx), dbstore.ErrInvalidManifestFile)
+	require.Equal(t, map[manifest.ResourceName]ServiceSpec{
+		"web":   {Image: "nginx:1.27", Replicas: 2},
+		"batch": {Image: "batch"},
+	}, findServices(t, store, manifest.SearchQuery{}))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, store.Reload(ctx), context.Canceled)
+	require.NoError(t, store.Watch(ctx))
+}
+
+func TestFSStore_Watch(t *testing.T) {
+	store, dir := makeTestFSStore(t, map[string]string{
+		"web.yaml": "kind: Service\nmetadata:\n  name: web\nspec:\n  image: nginx\n",
+	})
+	ctx, cancel := context.WithCancel(context.TODO())
+	// Polling would not notice changes within the test
+	store.Interval = time.Hour
+
+	done := make(chan error)
+	go func() {
+		done <- store.Watch(ctx)
+	}()
+
+	// Changes of files, and files of new directories, are reloaded once notified
+	writeFiles(t, dir, map[string]string{
+		"web.yaml":        "kind: Service\nmetadata:\n  name: web\nspec:\n  image: nginx:1.27\n",
+		"jobs/batch.yaml": "kind: Service\nmetadata:\n  name: batch\nspec:\n  image: batch\n",
+	})
+	require.Eventually(t, func() bool {
+		return reflect.DeepEqual(map[manifest.ResourceName]ServiceSpec{
+			"web":   {Image: "nginx:1.27"},
+			"batch": {Image: "batch"},
+		}, findServices(t, store, manifest.SearchQuery{}))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	writeFiles(t, dir, map[string]string{"jobs/cron/nightly.yaml": "kind: Service\nmetadata:\n  name: nightly\nspec:\n  image: cron\n"})
+	require.Eventually(t, func() bool {
+		return len(findServices(t, store, manifest.SearchQuery{})) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Files that fail to decode are not returned once the context is cancelled, as that is a clean shutdown
+	writeFiles(t, dir, map[string]string{
+		"broken.yaml": "kind: Service\nmetadata: [\n",
+		"cache.yaml":  "kind: Service\nmetadata:\n  name: cache\nspec:\n  image: redis\n",
+	})
+	require.Eventually(t, func() bool {
+		return len(findServices(t, store, manifest.SearchQuery{})) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
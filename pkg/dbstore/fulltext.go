@@ -0,0 +1,365 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrFullTextNotEnabled error is returned when a search query has full-text search terms, but full-text search is not enabled for the model.
+var ErrFullTextNotEnabled = errors.New("full-text search is not enabled for the model")
+
+const (
+	fullTextPluginName   = "wyrd:full_text_search"
+	fullTextCallbackName = "wyrd:full_text_index"
+
+	// fullTextTableSuffix is appended to a model table name to name its full-text index table.
+	fullTextTableSuffix = "_fts"
+
+	// fullTextDeletedKey is a key of GORM statement instance setting holding IDs of models a permanent delete statement is about to delete.
+	fullTextDeletedKey = "wyrd:full_text_deleted"
+	// fullTextDeleteBatchSize is the maximum number of models removed from the index by a statement.
+	fullTextDeleteBatchSize = 500
+)
+
+// FullTextSearch is a [gorm.Plugin] that maintains full-text index of models, used by [manifest.SearchQuery.Text] queries.
+// Index of a model includes its name, label values and spec fields marked as [manifest.TagOptionSearchable].
+//
+// Index is kept in a separate table per model, named after the model table with `_fts` suffix:
+// SQLite FTS5 virtual table, Postgres table with `tsvector` column or MySQL table with FULLTEXT index.
+// The index is updated by callbacks when models are created, updated or permanently deleted.
+//
+// Note: github.com/mattn/go-sqlite3 driver includes FTS5 only when built with `sqlite_fts5` build tag.
+type FullTextSearch struct {
+	// Config is the schema config of the models.
+	Config SchemaConfig
+	// Models to index.
+	Models []any
+
+	tables map[string]struct{}
+}
+
+// EnableFullTextSearch creates full-text index tables for given models and registers callbacks keeping them in sync with model tables.
+// Models created before full-text search was enabled can be indexed with [RebuildFullTextIndex].
+func EnableFullTextSearch(db *gorm.DB, config SchemaConfig, models ...any) error {
+	return db.Use(&FullTextSearch{Config: config, Models: models})
+}
+
+// Name implements [gorm.Plugin] interface.
+func (p *FullTextSearch) Name() string {
+	return fullTextPluginName
+}
+
+// Initialize implements [gorm.Plugin] interface. It creates index tables and registers callbacks.
+func (p *FullTextSearch) Initialize(db *gorm.DB) error {
+	p.tables = make(map[string]struct{}, len(p.Models))
+	for _, model := range p.Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		if err := createFullTextTable(db, stmt.Schema.Table); err != nil {
+			return fmt.Errorf("failed to create full-text index for %q: %w", stmt.Schema.Table, err)
+		}
+		p.tables[stmt.Schema.Table] = struct{}{}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().After("gorm:create").Register(fullTextCallbackName, p.indexCallback),
+		callbacks.Update().After("gorm:update").Register(fullTextCallbackName, p.indexCallback),
+		callbacks.Delete().Before("gorm:delete").Register(fullTextCallbackName+"_match", p.matchCallback),
+		callbacks.Delete().After("gorm:delete").Register(fullTextCallbackName, p.deleteCallback),
+	)
+}
+
+func (p *FullTextSearch) indexed(db *gorm.DB) (*schema.Schema, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, false
+	}
+
+	_, ok := p.tables[db.Statement.Schema.Table]
+	return db.Statement.Schema, ok
+}
+
+// indexCallback re-indexes models written by a statement.
+func (p *FullTextSearch) indexCallback(db *gorm.DB) {
+	s, ok := p.indexed(db)
+	if !ok {
+		return
+	}
+
+	rows, err := reloadAffected(db, p.Config.IDColumnName)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to index: %w", err))
+		return
+	}
+
+	if err := p.index(db.Session(&gorm.Session{NewDB: true, SkipHooks: true}), s, rows); err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+// reindex re-loads models with given IDs from the DB and indexes them.
+func (p *FullTextSearch) reindex(db *gorm.DB, s *schema.Schema, ids []any) error {
+	rows, err := loadByIDs(db, s, p.Config.IDColumnName, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load models to index: %w", err)
+	}
+
+	return p.index(db.Session(&gorm.Session{NewDB: true, SkipHooks: true}), s, rows)
+}
+
+// matchCallback loads IDs of models that a permanent delete statement is about to delete, as they can't be loaded after.
+// Soft-deleted models stay indexed, so that they can be restored.
+func (p *FullTextSearch) matchCallback(db *gorm.DB) {
+	s, ok := p.indexed(db)
+	if !ok {
+		return
+	}
+
+	if !db.Statement.Unscoped && s.LookUpField(p.Config.DeletedAtColumnName) != nil {
+		return
+	}
+
+	ids, err := matchIDs(db, s, p.Config.IDColumnName)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to remove from full-text index: %w", err))
+		return
+	}
+
+	db.InstanceSet(fullTextDeletedKey, ids)
+}
+
+// deleteCallback removes index entries of models deleted permanently by a statement, as matched by [FullTextSearch.matchCallback].
+func (p *FullTextSearch) deleteCallback(db *gorm.DB) {
+	s, ok := p.indexed(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+
+	v, _ := db.InstanceGet(fullTextDeletedKey)
+	ids, _ := v.([]any)
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	table := clause.Table{Name: s.Table + fullTextTableSuffix}
+	for batch := range slices.Chunk(ids, fullTextDeleteBatchSize) {
+		if err := tx.Exec("DELETE FROM ? WHERE uid IN ?", table, batch).Error; err != nil {
+			_ = db.AddError(fmt.Errorf("failed to remove deleted models from full-text index: %w", err))
+			return
+		}
+	}
+}
+
+func (p *FullTextSearch) index(tx *gorm.DB, s *schema.Schema, rows reflect.Value) error {
+	table := clause.Table{Name: s.Table + fullTextTableSuffix}
+	for i := 0; i < rows.Len(); i++ {
+		row := reflect.Indirect(rows.Index(i))
+
+		id, content := p.content(tx.Statement.Context, s, row)
+		if err := tx.Exec("DELETE FROM ? WHERE uid = ?", table, id).Error; err != nil {
+			return fmt.Errorf("failed to update full-text index: %w", err)
+		}
+		if err := tx.Exec("INSERT INTO ? (uid, content) VALUES (?, ?)", table, id, content).Error; err != nil {
+			return fmt.Errorf("failed to update full-text index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// content returns ID of a model and the text to index it by.
+func (p *FullTextSearch) content(ctx context.Context, s *schema.Schema, row reflect.Value) (any, string) {
+	var id any
+	var name string
+	var labels manifest.Labels
+
+	if field := s.LookUpField(p.Config.IDColumnName); field != nil {
+		id, _ = field.ValueOf(ctx, row)
+	}
+	if field := s.LookUpField(p.Config.NameColumnName); field != nil {
+		name = fmt.Sprint(field.ReflectValueOf(ctx, row).Interface())
+	}
+	if field := s.LookUpField(p.Config.LabelsColumnName); field != nil {
+		labels, _ = field.ReflectValueOf(ctx, row).Interface().(manifest.Labels)
+	}
+
+	return id, fullTextContent(name, labels, row.Interface())
+}
+
+// fullTextContent returns the text to index a model by: its name, label values and searchable fields.
+func fullTextContent(name string, labels manifest.Labels, model any) string {
+	parts := []string{name}
+	for _, key := range labels.Slice() {
+		parts = append(parts, labels[key])
+	}
+
+	parts = append(parts, manifest.SearchableText(model)...)
+	return strings.Join(parts, " ")
+}
+
+// RebuildFullTextIndex re-indexes all stored models of the given type, including soft-deleted ones.
+// It is useful to index models created before full-text search was enabled.
+func RebuildFullTextIndex(ctx context.Context, db *gorm.DB, model any) error {
+	p, ok := fullTextPlugin(db)
+	if !ok {
+		return ErrFullTextNotEnabled
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return fmt.Errorf("%w: %q", ErrFullTextNotEnabled, stmt.Schema.Table)
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+		return tx.Unscoped().Table(stmt.Schema.Table).FindInBatches(rows.Interface(), 500, func(batch *gorm.DB, _ int) error {
+			return p.index(tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}), stmt.Schema, rows.Elem())
+		}).Error
+	})
+}
+
+func fullTextPlugin(db *gorm.DB) (*FullTextSearch, bool) {
+	p, ok := db.Config.Plugins[fullTextPluginName].(*FullTextSearch)
+	return p, ok
+}
+
+func createFullTextTable(db *gorm.DB, table string) error {
+	ftsTable := clause.Table{Name: table + fullTextTableSuffix}
+
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS ? USING fts5(uid UNINDEXED, content)", ftsTable).Error
+	case "postgres":
+		if err := db.Exec("CREATE TABLE IF NOT EXISTS ? (uid text PRIMARY KEY, content text NOT NULL DEFAULT '', document tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED)", ftsTable).Error; err != nil {
+			return err
+		}
+		return db.Exec("CREATE INDEX IF NOT EXISTS ? ON ? USING GIN (document)", clause.Column{Name: "idx_" + ftsTable.Name + "_document"}, ftsTable).Error
+	case "mysql":
+		return db.Exec("CREATE TABLE IF NOT EXISTS ? (uid varchar(64) NOT NULL PRIMARY KEY, content text NOT NULL, FULLTEXT INDEX ? (content)) ENGINE=InnoDB", ftsTable, clause.Column{Name: "idx_" + ftsTable.Name + "_content"}).Error
+	default:
+		return fmt.Errorf("%w: %v", ErrUnsupportedDialect, db.Dialector.Name())
+	}
+}
+
+// fullTextTokens splits text into lowercase words of letters and digits. Any other characters are separators.
+func fullTextTokens(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+
+	return words
+}
+
+// fullTextWords returns distinct words of the text, see [fullTextTokens]. Words are safe to embed into SQL.
+func fullTextWords(text string) []string {
+	words := fullTextTokens(text)
+
+	// Remove duplicates, keeping the order stable
+	seen := make(map[string]struct{}, len(words))
+	result := words[:0]
+	for _, w := range words {
+		if _, ok := seen[w]; !ok {
+			seen[w] = struct{}{}
+			result = append(result, w)
+		}
+	}
+
+	return result
+}
+
+// fullTextMatch returns condition matching models with full-text index entries matching all words, and an expression to rank results by.
+func fullTextMatch(stmt *gorm.Statement, cfg SchemaConfig, table string, words []string) (match clause.Expression, rank clause.OrderByColumn, err error) {
+	ftsTable := stmt.Quote(table + fullTextTableSuffix)
+	idColumn := clause.Column{Table: table, Name: cfg.IDColumnName}
+	correlated := fmt.Sprintf("%s.uid = %s", ftsTable, stmt.Quote(idColumn))
+
+	switch stmt.Dialector.Name() {
+	case "sqlite":
+		terms := make([]string, 0, len(words))
+		for _, w := range words {
+			terms = append(terms, `"`+w+`"*`)
+		}
+		query := strings.Join(terms, " ")
+
+		match = clause.Expr{SQL: fmt.Sprintf("? IN (SELECT uid FROM %s WHERE %s MATCH ?)", ftsTable, ftsTable), Vars: []any{idColumn, query}}
+		// bm25 scores better matches lower
+		rank = clause.OrderByColumn{Column: clause.Column{Raw: true, Name: fmt.Sprintf("(SELECT bm25(%s) FROM %s WHERE %s MATCH '%s' AND %s)", ftsTable, ftsTable, ftsTable, query, correlated)}}
+	case "postgres":
+		terms := make([]string, 0, len(words))
+		for _, w := range words {
+			terms = append(terms, w+":*")
+		}
+		query := strings.Join(terms, " & ")
+
+		match = clause.Expr{SQL: fmt.Sprintf("? IN (SELECT uid FROM %s WHERE document @@ to_tsquery('simple', ?))", ftsTable), Vars: []any{idColumn, query}}
+		rank = clause.OrderByColumn{Desc: true, Column: clause.Column{Raw: true, Name: fmt.Sprintf("(SELECT ts_rank(document, to_tsquery('simple', '%s')) FROM %s WHERE %s)", query, ftsTable, correlated)}}
+	case "mysql":
+		terms := make([]string, 0, len(words))
+		for _, w := range words {
+			terms = append(terms, "+"+w+"*")
+		}
+		query := strings.Join(terms, " ")
+
+		match = clause.Expr{SQL: fmt.Sprintf("? IN (SELECT uid FROM %s WHERE MATCH(content) AGAINST (? IN BOOLEAN MODE))", ftsTable), Vars: []any{idColumn, query}}
+		rank = clause.OrderByColumn{Desc: true, Column: clause.Column{Raw: true, Name: fmt.Sprintf("(SELECT MATCH(content) AGAINST ('%s' IN BOOLEAN MODE) FROM %s WHERE %s)", query, ftsTable, correlated)}}
+	default:
+		err = fmt.Errorf("%w: %v", ErrUnsupportedDialect, stmt.Dialector.Name())
+	}
+
+	return
+}
+
+// withFullText limits results to models matching full-text search query, ranking them by relevance unless sorted otherwise.
+func withFullText(tx, ctx *gorm.DB, tContext transactionContext, query manifest.SearchQuery) (*gorm.DB, *gorm.DB, error) {
+	words := fullTextWords(query.Text)
+	if len(words) == 0 {
+		return tx, ctx, nil
+	}
+
+	p, ok := fullTextPlugin(tx)
+	if !ok || tContext.model == nil {
+		return nil, nil, ErrFullTextNotEnabled
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(tContext.model); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse model %T: %w", tContext.model, err)
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrFullTextNotEnabled, stmt.Schema.Table)
+	}
+
+	match, rank, err := fullTextMatch(tx.Statement, tContext.Config, stmt.Schema.Table, words)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx = tx.Where(match)
+	if ctx != nil {
+		ctx = ctx.Where(match)
+	}
+
+	if len(query.Sort) == 0 && !tContext.keyset(query) {
+		rank.Reorder = true
+		tx = tx.Order(rank)
+	}
+
+	return tx, ctx, nil
+}
@@ -0,0 +1,19 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBStore_FindFullText_NotEnabled(t *testing.T) {
+	store, cleanup := makeTestStore(t, []Pet{makePet("pet-1", "a")})
+	defer cleanup()
+
+	var got []Pet
+	_, err := store.Find(context.TODO(), &got, manifest.SearchQuery{Text: "pet"})
+	require.ErrorIs(t, err, dbstore.ErrFullTextNotEnabled)
+}
@@ -0,0 +1,215 @@
+//go:build sqlite_fts5
+
+package dbstore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type NoteSpec struct {
+	Title    string   `wyrd:"searchable"`
+	Tags     []string `wyrd:"searchable" gorm:"serializer:json"`
+	Secret   string   `wyrd:"searchable,sensitive"`
+	Internal string
+}
+
+type Note manifest.ResourceModel[NoteSpec]
+
+func makeNote(name string, labels manifest.Labels, spec NoteSpec) Note {
+	return Note{
+		ObjectMeta: manifest.ObjectMeta{Name: manifest.ResourceName(name), Labels: labels},
+		Spec:       spec,
+	}
+}
+
+func makeFullTextStore(t *testing.T, given []Note) (*gorm.DB, *dbstore.DBStore) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		dbInstance, _ := db.DB()
+		_ = dbInstance.Close()
+	})
+
+	require.NoError(t, db.AutoMigrate(&Note{}))
+	require.NoError(t, dbstore.EnableFullTextSearch(db, dbstore.ManifestModel, &Note{}))
+
+	store, err := dbstore.NewDBStore(db, dbstore.ManifestModel)
+	require.NoError(t, err)
+	for _, g := range given {
+		require.NoError(t, store.Create(context.TODO(), &g))
+	}
+
+	return db, store
+}
+
+func noteNames(notes []Note) []string {
+	result := make([]string, 0, len(notes))
+	for _, n := range notes {
+		result = append(result, string(n.Name))
+	}
+	return result
+}
+
+func TestDBStore_FindFullText(t *testing.T) {
+	given := []Note{
+		makeNote("groceries", manifest.Labels{"owner": "alice"}, NoteSpec{Title: "Buy milk and bread", Tags: []string{"home"}}),
+		makeNote("work-plan", manifest.Labels{"owner": "bob"}, NoteSpec{Title: "Quarterly planning", Tags: []string{"work", "milk-run"}}),
+		makeNote("passwords", nil, NoteSpec{Title: "Accounts", Secret: "hunter2", Internal: "vault"}),
+		makeNote("milk-milk", nil, NoteSpec{Title: "milk milk milk"}),
+	}
+
+	testCases := map[string]struct {
+		givenQuery manifest.SearchQuery
+		expect     []string
+	}{
+		"name": {
+			givenQuery: manifest.SearchQuery{Text: "grocer"},
+			expect:     []string{"groceries"},
+		},
+		"label-value": {
+			givenQuery: manifest.SearchQuery{Text: "alice"},
+			expect:     []string{"groceries"},
+		},
+		"searchable-spec-field": {
+			givenQuery: manifest.SearchQuery{Text: "Quarterly"},
+			expect:     []string{"work-plan"},
+		},
+		"all-words-must-match": {
+			givenQuery: manifest.SearchQuery{Text: "milk bread"},
+			expect:     []string{"groceries"},
+		},
+		"ranked-by-relevance": {
+			givenQuery: manifest.SearchQuery{Text: "milk"},
+			expect:     []string{"milk-milk", "groceries", "work-plan"},
+		},
+		"sort-overrides-rank": {
+			givenQuery: manifest.SearchQuery{Text: "milk", Sort: manifest.SortSpec{{Field: manifest.SortFieldName}}},
+			expect:     []string{"groceries", "milk-milk", "work-plan"},
+		},
+		"not-searchable-field": {
+			givenQuery: manifest.SearchQuery{Text: "vault"},
+			expect:     []string{},
+		},
+		"sensitive-field": {
+			givenQuery: manifest.SearchQuery{Text: "hunter2"},
+			expect:     []string{},
+		},
+		"query-syntax-is-escaped": {
+			givenQuery: manifest.SearchQuery{Text: `"milk" OR NOT* ("bread`},
+			expect:     []string{},
+		},
+	}
+
+	_, store := makeFullTextStore(t, given)
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			var got []Note
+			total, err := store.Find(context.TODO(), &got, test.givenQuery)
+			require.NoError(t, err)
+			require.Equal(t, test.expect, noteNames(got))
+			require.Equal(t, int64(len(test.expect)), total)
+		})
+	}
+}
+
+func TestDBStore_FindFullText_Sync(t *testing.T) {
+	db, store := makeFullTextStore(t, nil)
+	ctx := context.TODO()
+
+	find := func(text string, options ...dbstore.Option) []string {
+		var got []Note
+		_, err := store.Find(ctx, &got, manifest.SearchQuery{Text: text}, options...)
+		require.NoError(t, err)
+		return noteNames(got)
+	}
+
+	note := makeNote("note", nil, NoteSpec{Title: "draft"})
+	require.NoError(t, store.Create(ctx, &note))
+	require.Equal(t, []string{"note"}, find("draft"))
+
+	// Partial update re-indexes complete model
+	_, err := store.Update(ctx, &Note{ObjectMeta: manifest.ObjectMeta{UID: note.UID}, Spec: NoteSpec{Title: "final"}}, note.UID)
+	require.NoError(t, err)
+	require.Empty(t, find("draft"))
+	require.Equal(t, []string{"note"}, find("final"))
+	require.Equal(t, []string{"note"}, find("note"))
+
+	// Soft-deleted models are excluded from results, but stay indexed
+	_, err = store.Delete(ctx, &Note{}, note.UID, 0)
+	require.NoError(t, err)
+	require.Empty(t, find("final"))
+	require.Equal(t, []string{"note"}, find("final", dbstore.IncludeDeleted()))
+
+	// Permanently deleted models are removed from the index, others are kept
+	other := makeNote("other", nil, NoteSpec{Title: "final"})
+	require.NoError(t, store.Create(ctx, &other))
+	_, err = store.Delete(ctx, &Note{}, note.UID, 0, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+
+	var indexed int64
+	require.NoError(t, db.Table("notes_fts").Count(&indexed).Error)
+	require.Equal(t, int64(1), indexed)
+	require.Equal(t, []string{"other"}, find("final"))
+
+	// Models deleted by conditions are removed from the index too
+	require.NoError(t, db.Unscoped().Where("name = ?", "other").Delete(&Note{}).Error)
+	require.NoError(t, db.Table("notes_fts").Count(&indexed).Error)
+	require.Zero(t, indexed)
+}
+
+func TestDBStore_FindFullText_PatchLabels(t *testing.T) {
+	_, store := makeFullTextStore(t, []Note{
+		makeNote("first", manifest.Labels{"team": "alpha"}, NoteSpec{Title: "one"}),
+		makeNote("second", manifest.Labels{"team": "alpha"}, NoteSpec{Title: "two"}),
+	})
+	ctx := context.TODO()
+
+	find := func(text string) []string {
+		var got []Note
+		_, err := store.Find(ctx, &got, manifest.SearchQuery{Text: text})
+		require.NoError(t, err)
+		return noteNames(got)
+	}
+
+	// Bulk label changes re-index matched models
+	affected, err := store.PatchLabels(ctx, &Note{}, manifest.SearchQuery{Name: "first"}, dbstore.LabelPatch{Set: manifest.Labels{"team": "beta"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), affected)
+	require.Equal(t, []string{"first"}, find("beta"))
+	require.Equal(t, []string{"second"}, find("alpha"))
+}
+
+func TestRebuildFullTextIndex(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Note{}))
+
+	store, err := dbstore.NewDBStore(db, dbstore.ManifestModel)
+	require.NoError(t, err)
+
+	// Created before full-text search is enabled
+	note := makeNote("legacy", nil, NoteSpec{Title: "archived"})
+	require.NoError(t, store.Create(context.TODO(), &note))
+
+	require.ErrorIs(t, dbstore.RebuildFullTextIndex(context.TODO(), db, &Note{}), dbstore.ErrFullTextNotEnabled)
+	require.NoError(t, dbstore.EnableFullTextSearch(db, dbstore.ManifestModel, &Note{}))
+
+	var got []Note
+	_, err = store.Find(context.TODO(), &got, manifest.SearchQuery{Text: "archived"})
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	require.NoError(t, dbstore.RebuildFullTextIndex(context.TODO(), db, &Note{}))
+	_, err = store.Find(context.TODO(), &got, manifest.SearchQuery{Text: "archived"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"legacy"}, noteNames(got))
+}
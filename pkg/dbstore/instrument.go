@@ -0,0 +1,638 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+)
+
+// DefaultLatencyBuckets are upper bounds of buckets of latency histograms of [InstrumentedStore], unless set by [InstrumentedStore.LatencyBuckets].
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Types of errors counted by [OperationStats.Errors].
+const (
+	ErrorTypeCanceled            = "canceled"
+	ErrorTypeTimeout             = "timeout"
+	ErrorTypeVersionConflict     = "version_conflict"
+	ErrorTypeTransactionConflict = "transaction_conflict"
+	ErrorTypeDuplicatedKey       = "duplicated_key"
+	ErrorTypeNotFound            = "not_found"
+	ErrorTypeInvalid             = "invalid"
+	ErrorTypeOther               = "other"
+)
+
+// transactionSpanName is the operation of spans that cover transactions, from Begin to Commit or Rollback.
+const transactionSpanName = "Transaction"
+
+// Tracer starts spans of store operations, for example with a distributed tracing system.
+// See package otelstore for an adapter of an OpenTelemetry tracer.
+type Tracer interface {
+	// Start starts a span of the operation on models of the named type, returning a context that carries the span.
+	Start(ctx context.Context, operation, model string) (context.Context, Span)
+}
+
+// Span is a span of a store operation started by a [Tracer].
+type Span interface {
+	// End ends the span, recording the number of models the operation returned or wrote, and its error, if any.
+	End(rows int64, err error)
+}
+
+// Meter records metrics of stores and their background jobs, for example with a monitoring system.
+// Metrics are identified by names, such as [MetricOperationDuration], and labels, such as [MetricLabelOperation].
+// See package otelstore for an adapter of an OpenTelemetry meter.
+type Meter interface {
+	// Add adds the increment to the named counter.
+	Add(name string, increment int64, labels manifest.Labels)
+	// Record records the duration in the named histogram.
+	Record(name string, d time.Duration, labels manifest.Labels)
+	// Set sets the named gauge to the value.
+	Set(name string, value float64, labels manifest.Labels)
+}
+
+// Names of metrics recorded with a [Meter].
+const (
+	// MetricOperationDuration is the histogram of durations of store operations, labeled by operation, model and error type of failed ones.
+	MetricOperationDuration = "dbstore.operation.duration"
+	// MetricOperationRows is the counter of models returned or written by store operations, labeled by operation and model.
+	MetricOperationRows = "dbstore.operation.rows"
+
+	// MetricDBConnectionsMax is the gauge of the maximum number of open connections to the DB.
+	MetricDBConnectionsMax = "dbstore.db.connections.max"
+	// MetricDBConnectionsOpen is the gauge of the number of open connections to the DB.
+	MetricDBConnectionsOpen = "dbstore.db.connections.open"
+	// MetricDBConnectionsInUse is the gauge of the number of connections to the DB in use.
+	MetricDBConnectionsInUse = "dbstore.db.connections.in_use"
+	// MetricDBConnectionsIdle is the gauge of the number of idle connections to the DB.
+	MetricDBConnectionsIdle = "dbstore.db.connections.idle"
+	// MetricDBConnectionsWaits is the gauge of the total number of waits for a connection to the DB.
+	MetricDBConnectionsWaits = "dbstore.db.connections.waits"
+	// MetricDBConnectionsWaitDuration is the gauge of the total time waited for connections to the DB, in seconds.
+	MetricDBConnectionsWaitDuration = "dbstore.db.connections.wait_duration"
+	// MetricDBConnectionsClosed is the gauge of the total number of connections to the DB closed, labeled by reason.
+	MetricDBConnectionsClosed = "dbstore.db.connections.closed"
+
+	// MetricCacheHits is the counter of reads served from a [CachedStore], labeled by model.
+	MetricCacheHits = "dbstore.cache.hits"
+	// MetricCacheMisses is the counter of cacheable reads passed to the store wrapped by a [CachedStore], labeled by model.
+	MetricCacheMisses = "dbstore.cache.misses"
+	// MetricCacheEvictions is the counter of entries dropped to keep a [CachedStore] within its size, labeled by model.
+	MetricCacheEvictions = "dbstore.cache.evictions"
+	// MetricCacheExpirations is the counter of entries of a [CachedStore] dropped after TTL, labeled by model.
+	MetricCacheExpirations = "dbstore.cache.expirations"
+	// MetricCacheInvalidations is the counter of entries of a [CachedStore] dropped as models they hold were written, labeled by model.
+	MetricCacheInvalidations = "dbstore.cache.invalidations"
+	// MetricCacheEntries is the gauge of the number of entries in a [CachedStore].
+	MetricCacheEntries = "dbstore.cache.entries"
+
+	// MetricCompactionDuration is the histogram of durations of passes of a [Compactor], labeled by error type of failed ones.
+	MetricCompactionDuration = "dbstore.compaction.duration"
+	// MetricCompactionExpired is the counter of entries soft-deleted as expired by a [Compactor], labeled by table.
+	MetricCompactionExpired = "dbstore.compaction.expired"
+	// MetricCompactionCompacted is the counter of entries permanently deleted by a [Compactor], labeled by table.
+	MetricCompactionCompacted = "dbstore.compaction.compacted"
+)
+
+// Labels of metrics recorded with a [Meter].
+const (
+	MetricLabelOperation = "db.operation.name"
+	MetricLabelModel     = "wyrd.model"
+	MetricLabelErrorType = "error.type"
+	MetricLabelTable     = "db.collection.name"
+	MetricLabelReason    = "reason"
+)
+
+// dbStatsReportInterval is the minimum interval between reports of statistics of connections to the DB by an [InstrumentedStore].
+const dbStatsReportInterval = 10 * time.Second
+
+// DBStatsReporter interface is implemented by stores backed by an SQL DB, to report statistics of its connection pool.
+type DBStatsReporter interface {
+	// DBStats returns statistics of the connection pool of the DB.
+	DBStats() (sql.DBStats, error)
+}
+
+// LatencyHistogram is a histogram of durations of operations.
+type LatencyHistogram struct {
+	// Bounds are upper bounds of buckets, in increasing order.
+	Bounds []time.Duration
+	// Counts are numbers of operations per bucket: Counts[i] is the number of operations that took at most Bounds[i], and longer than Bounds[i-1].
+	// The last count is the number of operations that took longer than the last bound.
+	Counts []int64
+	// Sum is the total duration of operations.
+	Sum time.Duration
+}
+
+func (h *LatencyHistogram) observe(d time.Duration) {
+	i, _ := slices.BinarySearch(h.Bounds, d)
+	h.Counts[i]++
+	h.Sum += d
+}
+
+// OperationStats are metrics of calls of a store operation.
+type OperationStats struct {
+	// Calls is the number of calls of the operation.
+	Calls int64
+	// Errors are numbers of calls that failed, by type of error, such as [ErrorTypeVersionConflict].
+	Errors map[string]int64
+	// Rows is the total number of models returned by calls of a read operation, or written by a write.
+	Rows int64
+	// Latency is the histogram of durations of calls.
+	Latency LatencyHistogram
+}
+
+// InstrumentationStats are metrics of an [InstrumentedStore] so far.
+type InstrumentationStats struct {
+	// Operations are metrics of store operations, by name of the operation, such as "Find".
+	Operations map[string]OperationStats
+	// DB are statistics of connections to the DB, to export as gauges. It is nil if the store does not implement [DBStatsReporter].
+	DB *sql.DBStats
+}
+
+// InstrumentedStore is a [Store] that records metrics of operations of the store it wraps, and traces them with a [Tracer].
+// Metrics are returned by [InstrumentedStore.Stats], and recorded with a [Meter], if there is one. Statistics of connections to the DB
+// are recorded as gauges after operations, at most every 10 seconds.
+//
+// Operations are recorded by their name, such as "Find" or "GetByUID". Operations of transactions are recorded under the same names
+// as operations of the store, while "Begin", "Commit" and "Rollback" are recorded under their own. Spans of operations of a transaction
+// are children of the span of the transaction, that covers it from Begin till Commit or Rollback.
+//
+// See [EnableSlowQueryLog] to log SQL statements of slow operations.
+type InstrumentedStore struct {
+	store Store
+
+	// Tracer starts spans of operations. No spans are started if it is nil.
+	Tracer Tracer
+	// Meter records metrics of operations, in addition to [InstrumentedStore.Stats]. No metrics are recorded if it is nil.
+	Meter Meter
+	// LatencyBuckets are upper bounds of buckets of latency histograms, in increasing order. Defaults to [DefaultLatencyBuckets].
+	// It must be set before the store is used.
+	LatencyBuckets []time.Duration
+
+	lock       sync.Mutex
+	operations map[string]*OperationStats
+	// dbStatsReported is the time statistics of connections to the DB were last recorded with the meter at.
+	dbStatsReported time.Time
+}
+
+// NewInstrumentedStore creates an instrumented wrapper of the store.
+func NewInstrumentedStore(store Store) *InstrumentedStore {
+	return &InstrumentedStore{
+		store:      store,
+		operations: map[string]*OperationStats{},
+	}
+}
+
+// Unwrap returns the instrumented store, for example to use interfaces it implements other than [Store].
+func (s *InstrumentedStore) Unwrap() Store {
+	return s.store
+}
+
+// Stats returns metrics of operations so far, and current statistics of connections to the DB, if the store reports them.
+func (s *InstrumentedStore) Stats() InstrumentationStats {
+	result := InstrumentationStats{Operations: map[string]OperationStats{}, DB: s.dbStats()}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name, op := range s.operations {
+		stats := *op
+		stats.Errors = make(map[string]int64, len(op.Errors))
+		for errType, count := range op.Errors {
+			stats.Errors[errType] = count
+		}
+		stats.Latency.Bounds = slices.Clone(op.Latency.Bounds)
+		stats.Latency.Counts = slices.Clone(op.Latency.Counts)
+		result.Operations[name] = stats
+	}
+
+	return result
+}
+
+// dbStats returns current statistics of connections to the DB, or nil if the store does not report them.
+func (s *InstrumentedStore) dbStats() *sql.DBStats {
+	reporter, ok := unwrapStore[DBStatsReporter](s.store)
+	if !ok {
+		return nil
+	}
+
+	stats, err := reporter.DBStats()
+	if err != nil {
+		return nil
+	}
+	return &stats
+}
+
+// reportDBStats records statistics of connections to the DB as gauges with the meter, unless they were recorded recently.
+func (s *InstrumentedStore) reportDBStats(now time.Time) {
+	s.lock.Lock()
+	if now.Sub(s.dbStatsReported) < dbStatsReportInterval {
+		s.lock.Unlock()
+		return
+	}
+	s.dbStatsReported = now
+	s.lock.Unlock()
+
+	stats := s.dbStats()
+	if stats == nil {
+		return
+	}
+
+	s.Meter.Set(MetricDBConnectionsMax, float64(stats.MaxOpenConnections), nil)
+	s.Meter.Set(MetricDBConnectionsOpen, float64(stats.OpenConnections), nil)
+	s.Meter.Set(MetricDBConnectionsInUse, float64(stats.InUse), nil)
+	s.Meter.Set(MetricDBConnectionsIdle, float64(stats.Idle), nil)
+	s.Meter.Set(MetricDBConnectionsWaits, float64(stats.WaitCount), nil)
+	s.Meter.Set(MetricDBConnectionsWaitDuration, stats.WaitDuration.Seconds(), nil)
+	s.Meter.Set(MetricDBConnectionsClosed, float64(stats.MaxIdleClosed), manifest.Labels{MetricLabelReason: "max_idle"})
+	s.Meter.Set(MetricDBConnectionsClosed, float64(stats.MaxIdleTimeClosed), manifest.Labels{MetricLabelReason: "max_idle_time"})
+	s.Meter.Set(MetricDBConnectionsClosed, float64(stats.MaxLifetimeClosed), manifest.Labels{MetricLabelReason: "max_lifetime"})
+}
+
+// unwrapStore returns the first store that implements the interface, looking through stores that wrap others, such as [CachedStore].
+func unwrapStore[T any](store Store) (T, bool) {
+	for store != nil {
+		if result, ok := store.(T); ok {
+			return result, true
+		}
+
+		wrapper, ok := store.(interface{ Unwrap() Store })
+		if !ok {
+			break
+		}
+		store = wrapper.Unwrap()
+	}
+
+	var none T
+	return none, false
+}
+
+// ErrorType returns the type of the error, as counted by [OperationStats.Errors], or empty string if the error is nil.
+func ErrorType(err error) string {
+	var fieldErrors manifest.FieldErrors
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeTimeout
+	case errors.Is(err, ErrVersionConflict):
+		return ErrorTypeVersionConflict
+	case errors.Is(err, ErrTransactionConflict):
+		return ErrorTypeTransactionConflict
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrorTypeDuplicatedKey
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrorTypeNotFound
+	case errors.As(err, &fieldErrors),
+		errors.Is(err, gorm.ErrInvalidValue),
+		errors.Is(err, ErrUnknownColumn),
+		errors.Is(err, ErrUnexpectedSelectorOperator),
+		errors.Is(err, ErrNoRequirementsValueProvided):
+		return ErrorTypeInvalid
+	}
+
+	return ErrorTypeOther
+}
+
+// start starts a span of an operation, if there is a tracer.
+func (s *InstrumentedStore) start(ctx context.Context, operation string, model any) (context.Context, Span) {
+	if s.Tracer == nil {
+		return ctx, nil
+	}
+	return s.Tracer.Start(ctx, operation, modelName(model))
+}
+
+// record records metrics of a call of the operation on models of the named type and ends its span.
+func (s *InstrumentedStore) record(span Span, operation, model string, started time.Time, rows int64, err error) {
+	elapsed := time.Since(started)
+	if span != nil {
+		span.End(rows, err)
+	}
+	if s.Meter != nil {
+		s.meter(operation, model, elapsed, rows, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	op, ok := s.operations[operation]
+	if !ok {
+		bounds := s.LatencyBuckets
+		if len(bounds) == 0 {
+			bounds = DefaultLatencyBuckets
+		}
+		op = &OperationStats{
+			Errors: map[string]int64{},
+			Latency: LatencyHistogram{
+				Bounds: slices.Clone(bounds),
+				Counts: make([]int64, len(bounds)+1),
+			},
+		}
+		s.operations[operation] = op
+	}
+
+	op.Calls++
+	op.Rows += rows
+	op.Latency.observe(elapsed)
+	if err != nil {
+		op.Errors[ErrorType(err)]++
+	}
+}
+
+// meter records metrics of a call of the operation with the meter.
+func (s *InstrumentedStore) meter(operation, model string, elapsed time.Duration, rows int64, err error) {
+	labels := manifest.Labels{MetricLabelOperation: operation}
+	if model != "" {
+		labels[MetricLabelModel] = model
+	}
+	if rows != 0 {
+		s.Meter.Add(MetricOperationRows, rows, labels)
+	}
+	if err != nil {
+		labels[MetricLabelErrorType] = ErrorType(err)
+	}
+	s.Meter.Record(MetricOperationDuration, elapsed, labels)
+
+	s.reportDBStats(time.Now())
+}
+
+// instrument runs the operation, recording its metrics and tracing it.
+func (s *InstrumentedStore) instrument(ctx context.Context, operation string, model any, fn func(context.Context) (int64, error)) error {
+	ctx, span := s.start(ctx, operation, model)
+	started := time.Now()
+	rows, err := fn(ctx)
+	s.record(span, operation, modelName(model), started, rows, err)
+	return err
+}
+
+// modelName returns the name of the type of models of the value, which can be a struct, a slice or a pointer to either.
+func modelName(value any) string {
+	if t := cacheModelType(value); t != nil {
+		return t.Name()
+	}
+	return ""
+}
+
+// countModels returns the number of models of the value, which can be a pointer to a struct or a slice.
+func countModels(value any) int64 {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return int64(v.Len())
+	case reflect.Struct:
+		return 1
+	}
+	return 0
+}
+
+func countExisting(exists bool) int64 {
+	if exists {
+		return 1
+	}
+	return 0
+}
+
+// Ping implements [Pinger] interface, checking connectivity of the instrumented store if it is a Pinger.
+func (s *InstrumentedStore) Ping(ctx context.Context) error {
+	return s.instrument(ctx, "Ping", nil, func(ctx context.Context) (int64, error) {
+		if pinger, ok := s.store.(Pinger); ok {
+			return 0, pinger.Ping(ctx)
+		}
+		return 0, ctx.Err()
+	})
+}
+
+// Begin opens a transaction of the instrumented store, starting a span that covers the transaction till Commit or Rollback.
+// It fails with [ErrNotTransactional] if the store does not implement [Transactional] interface.
+// Note: It's a caller responsibility to call Transaction.Commit() or Transaction.Rollback() to complete the transaction.
+func (s *InstrumentedStore) Begin(ctx context.Context) (StoreTransaction, error) {
+	transactional, ok := s.store.(Transactional)
+	if !ok {
+		return nil, ErrNotTransactional
+	}
+
+	ctx, span := s.start(ctx, transactionSpanName, nil)
+	var tx StoreTransaction
+	err := s.instrument(ctx, "Begin", nil, func(ctx context.Context) (_ int64, err error) {
+		tx, err = transactional.Begin(ctx)
+		return
+	})
+	if err != nil {
+		if span != nil {
+			span.End(0, err)
+		}
+		return nil, err
+	}
+
+	return &instrumentedStoreTransaction{
+		StoreTransaction: tx,
+		store:            s,
+		ctx:              ctx,
+		span:             span,
+	}, nil
+}
+
+// Find returns models from the store that matched search query parameters.
+// See [DBStore.Find].
+func (s *InstrumentedStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
+	err = s.instrument(ctx, "Find", dest, func(ctx context.Context) (_ int64, err error) {
+		total, err = s.store.Find(ctx, dest, searchQuery, options...)
+		return countModels(dest), err
+	})
+	return
+}
+
+// GetByUID finds at most one entry in the store identified by the UUID if there is one.
+// See [DBStore.GetByUID].
+func (s *InstrumentedStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.instrument(ctx, "GetByUID", dest, func(ctx context.Context) (_ int64, err error) {
+		exists, err = s.store.GetByUID(ctx, dest, id, options...)
+		return countExisting(exists), err
+	})
+	return
+}
+
+// GetByName finds at most one entry in the store identified by the name if there is one.
+// See [DBStore.GetByName].
+func (s *InstrumentedStore) GetByName(ctx context.Context, dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	err = s.instrument(ctx, "GetByName", dest, func(ctx context.Context) (_ int64, err error) {
+		exists, err = s.store.GetByName(ctx, dest, name, options...)
+		return countExisting(exists), err
+	})
+	return
+}
+
+// Create inserts a new value into the store, updating inserted models ID.
+func (s *InstrumentedStore) Create(ctx context.Context, value any, options ...Option) error {
+	return s.instrument(ctx, "Create", value, func(ctx context.Context) (int64, error) {
+		if err := s.store.Create(ctx, value, options...); err != nil {
+			return 0, err
+		}
+		return countModels(value), nil
+	})
+}
+
+// CreateOrUpdate inserts a new value into the store if the models.ID is nil, otherwise it replaces it.
+func (s *InstrumentedStore) CreateOrUpdate(ctx context.Context, value any, options ...Option) (exists bool, err error) {
+	err = s.instrument(ctx, "CreateOrUpdate", value, func(ctx context.Context) (_ int64, err error) {
+		exists, err = s.store.CreateOrUpdate(ctx, value, options...)
+		return countExisting(err == nil), err
+	})
+	return
+}
+
+// Update updates non-zero fields of an entry identified by the ID of the value.
+// See [DBStore.Update].
+func (s *InstrumentedStore) Update(ctx context.Context, value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.instrument(ctx, "Update", value, func(ctx context.Context) (_ int64, err error) {
+		exists, err = s.store.Update(ctx, value, id, options...)
+		return countExisting(exists), err
+	})
+	return
+}
+
+// Delete deletes an entry identified by the ID from the store.
+// See [DBStore.Delete].
+func (s *InstrumentedStore) Delete(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = s.instrument(ctx, "Delete", model, func(ctx context.Context) (_ int64, err error) {
+		existed, err = s.store.Delete(ctx, model, id, version, options...)
+		return countExisting(existed), err
+	})
+	return
+}
+
+// Restore restores a previously deleted entry identified by the ID.
+// See [DBStore.Restore].
+func (s *InstrumentedStore) Restore(ctx context.Context, model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	err = s.instrument(ctx, "Restore", model, func(ctx context.Context) (_ int64, err error) {
+		existed, err = s.store.Restore(ctx, model, id, options...)
+		return countExisting(existed), err
+	})
+	return
+}
+
+// instrumentedStoreTransaction records metrics of operations of a transaction, tracing them as children of the span of the transaction.
+type instrumentedStoreTransaction struct {
+	StoreTransaction
+
+	store *InstrumentedStore
+	ctx   context.Context
+	span  Span
+	done  bool
+}
+
+// end ends the span of the transaction, once.
+func (tx *instrumentedStoreTransaction) end(err error) {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	if tx.span != nil {
+		tx.span.End(0, err)
+	}
+}
+
+func (tx *instrumentedStoreTransaction) Rollback() {
+	if tx.done {
+		tx.StoreTransaction.Rollback()
+		return
+	}
+
+	_ = tx.store.instrument(tx.ctx, "Rollback", nil, func(context.Context) (int64, error) {
+		tx.StoreTransaction.Rollback()
+		return 0, nil
+	})
+	tx.end(nil)
+}
+
+func (tx *instrumentedStoreTransaction) Commit() error {
+	err := tx.store.instrument(tx.ctx, "Commit", nil, func(context.Context) (int64, error) {
+		return 0, tx.StoreTransaction.Commit()
+	})
+	tx.end(err)
+	return err
+}
+
+func (tx *instrumentedStoreTransaction) Create(value any, options ...Option) error {
+	return tx.store.instrument(tx.ctx, "Create", value, func(context.Context) (int64, error) {
+		if err := tx.StoreTransaction.Create(value, options...); err != nil {
+			return 0, err
+		}
+		return countModels(value), nil
+	})
+}
+
+func (tx *instrumentedStoreTransaction) Update(value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = tx.store.instrument(tx.ctx, "Update", value, func(context.Context) (_ int64, err error) {
+		exists, err = tx.StoreTransaction.Update(value, id, options...)
+		return countExisting(exists), err
+	})
+	return
+}
+
+func (tx *instrumentedStoreTransaction) Delete(model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = tx.store.instrument(tx.ctx, "Delete", model, func(context.Context) (_ int64, err error) {
+		existed, err = tx.StoreTransaction.Delete(model, id, version, options...)
+		return countExisting(existed), err
+	})
+	return
+}
+
+func (tx *instrumentedStoreTransaction) GetByUID(dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = tx.store.instrument(tx.ctx, "GetByUID", dest, func(context.Context) (_ int64, err error) {
+		exists, err = tx.StoreTransaction.GetByUID(dest, id, options...)
+		return countExisting(exists), err
+	})
+	return
+}
+
+func (tx *instrumentedStoreTransaction) GetByName(dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	err = tx.store.instrument(tx.ctx, "GetByName", dest, func(context.Context) (_ int64, err error) {
+		exists, err = tx.StoreTransaction.GetByName(dest, name, options...)
+		return countExisting(exists), err
+	})
+	return
+}
+
+func (tx *instrumentedStoreTransaction) AddLinked(model any, link string, owner any, options ...Option) error {
+	return tx.store.instrument(tx.ctx, "AddLinked", model, func(context.Context) (int64, error) {
+		if err := tx.StoreTransaction.AddLinked(model, link, owner, options...); err != nil {
+			return 0, err
+		}
+		return countModels(model), nil
+	})
+}
+
+func (tx *instrumentedStoreTransaction) RemoveLinked(model any, link string, owner any) error {
+	return tx.store.instrument(tx.ctx, "RemoveLinked", model, func(context.Context) (int64, error) {
+		return 0, tx.StoreTransaction.RemoveLinked(model, link, owner)
+	})
+}
+
+func (tx *instrumentedStoreTransaction) ClearLinked(link string, owner any) error {
+	return tx.store.instrument(tx.ctx, "ClearLinked", owner, func(context.Context) (int64, error) {
+		return 0, tx.StoreTransaction.ClearLinked(link, owner)
+	})
+}
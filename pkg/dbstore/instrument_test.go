@@ -0,0 +1,276 @@
+package dbstore_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type recordedSpan struct {
+	operation string
+	model     string
+	parent    *recordedSpan
+	rows      int64
+	err       error
+	ended     int
+}
+
+func (s *recordedSpan) End(rows int64, err error) {
+	s.rows = rows
+	s.err = err
+	s.ended++
+}
+
+type spanContextKey struct{}
+
+// recordingTracer records spans it starts.
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, operation, model string) (context.Context, dbstore.Span) {
+	span := &recordedSpan{operation: operation, model: model}
+	span.parent, _ = ctx.Value(spanContextKey{}).(*recordedSpan)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// recordingMeter records metrics, by name and labels, such as "dbstore.cache.hits{wyrd.model=Pet}".
+type recordingMeter struct {
+	lock       sync.Mutex
+	counters   map[string]int64
+	histograms map[string][]time.Duration
+	gauges     map[string]float64
+}
+
+func newRecordingMeter() *recordingMeter {
+	return &recordingMeter{
+		counters:   map[string]int64{},
+		histograms: map[string][]time.Duration{},
+		gauges:     map[string]float64{},
+	}
+}
+
+func metricKey(name string, labels manifest.Labels) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	slices.Sort(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *recordingMeter) Add(name string, increment int64, labels manifest.Labels) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[metricKey(name, labels)] += increment
+}
+
+func (m *recordingMeter) Record(name string, d time.Duration, labels manifest.Labels) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := metricKey(name, labels)
+	m.histograms[key] = append(m.histograms[key], d)
+}
+
+func (m *recordingMeter) Set(name string, value float64, labels manifest.Labels) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.gauges[metricKey(name, labels)] = value
+}
+
+func TestInstrumentedStore_Stats(t *testing.T) {
+	tracer := &recordingTracer{}
+	meter := newRecordingMeter()
+	store := dbstore.NewInstrumentedStore(makeTestMemStore(t, givenBoltPets()))
+	store.Tracer = tracer
+	store.Meter = meter
+	ctx := context.TODO()
+
+	require.NoError(t, store.Ping(ctx))
+	require.Len(t, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")}), 2)
+	require.Len(t, findNames(t, store, manifest.SearchQuery{}), 5)
+
+	var pet Pet
+	found, err := store.GetByName(ctx, &pet, "fluffy")
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = store.GetByName(ctx, &Pet{}, "felix")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	_, err = store.Update(ctx, &Pet{}, pet.UID, dbstore.Precondition(pet.Version+1))
+	require.ErrorIs(t, err, dbstore.ErrVersionConflict)
+
+	stats := store.Stats()
+	require.Nil(t, stats.DB)
+	require.ElementsMatch(t, []string{"Ping", "Find", "GetByName", "Update"}, keys(stats.Operations))
+
+	find := stats.Operations["Find"]
+	require.Equal(t, int64(2), find.Calls)
+	require.Equal(t, int64(7), find.Rows)
+	require.Empty(t, find.Errors)
+	require.Equal(t, dbstore.DefaultLatencyBuckets, find.Latency.Bounds)
+	require.Len(t, find.Latency.Counts, len(dbstore.DefaultLatencyBuckets)+1)
+	require.Equal(t, int64(2), sum(find.Latency.Counts))
+
+	require.Equal(t, int64(1), stats.Operations["GetByName"].Rows)
+	require.Equal(t, map[string]int64{dbstore.ErrorTypeVersionConflict: 1}, stats.Operations["Update"].Errors)
+
+	require.Len(t, tracer.spans, 6)
+	for _, span := range tracer.spans {
+		require.Equal(t, 1, span.ended)
+	}
+	require.Equal(t, "Find", tracer.spans[1].operation)
+	require.Equal(t, "Pet", tracer.spans[1].model)
+	require.Equal(t, int64(2), tracer.spans[1].rows)
+	require.ErrorIs(t, tracer.spans[5].err, dbstore.ErrVersionConflict)
+
+	// The same metrics are recorded with the meter
+	require.Equal(t, map[string]int64{
+		"dbstore.operation.rows{db.operation.name=Find,wyrd.model=Pet}":      7,
+		"dbstore.operation.rows{db.operation.name=GetByName,wyrd.model=Pet}": 1,
+	}, meter.counters)
+	require.ElementsMatch(t, []string{
+		"dbstore.operation.duration{db.operation.name=Ping}",
+		"dbstore.operation.duration{db.operation.name=Find,wyrd.model=Pet}",
+		"dbstore.operation.duration{db.operation.name=GetByName,wyrd.model=Pet}",
+		"dbstore.operation.duration{db.operation.name=Update,error.type=version_conflict,wyrd.model=Pet}",
+	}, keys(meter.histograms))
+	require.Len(t, meter.histograms["dbstore.operation.duration{db.operation.name=Find,wyrd.model=Pet}"], 2)
+	require.Empty(t, meter.gauges)
+}
+
+func TestInstrumentedStore_Transaction(t *testing.T) {
+	tracer := &recordingTracer{}
+	store := dbstore.NewInstrumentedStore(makeTestMemStore(t, nil))
+	store.Tracer = tracer
+	ctx := context.TODO()
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	pet := makePet("fluffy", "Fluffy")
+	require.NoError(t, tx.Create(&pet))
+	found, err := tx.GetByUID(&Pet{}, pet.UID)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NoError(t, tx.Commit())
+	tx.Rollback()
+
+	operations := make([]string, 0, len(tracer.spans))
+	for _, span := range tracer.spans {
+		operations = append(operations, span.operation)
+		require.Equal(t, 1, span.ended)
+		if span.operation != "Transaction" {
+			require.NotNil(t, span.parent)
+			require.Equal(t, "Transaction", span.parent.operation)
+		}
+	}
+	require.Equal(t, []string{"Transaction", "Begin", "Create", "GetByUID", "Commit"}, operations)
+
+	stats := store.Stats()
+	require.Equal(t, int64(1), stats.Operations["Create"].Rows)
+	require.NotContains(t, stats.Operations, "Rollback")
+
+	_, err = dbstore.NewInstrumentedStore(struct{ dbstore.Store }{store}).Begin(ctx)
+	require.ErrorIs(t, err, dbstore.ErrNotTransactional)
+}
+
+func TestInstrumentedStore_DBStats(t *testing.T) {
+	db, cleanup := makeTestStore(t, givenBoltPets())
+	defer cleanup()
+
+	// DB stats are reported through stores wrapping the DB store
+	meter := newRecordingMeter()
+	store := dbstore.NewInstrumentedStore(dbstore.NewCachedStore(db, dbstore.ManifestModel))
+	store.Meter = meter
+	require.NoError(t, store.Ping(context.TODO()))
+	require.Len(t, findNames(t, store, manifest.SearchQuery{}), 5)
+
+	stats := store.Stats()
+	require.NotNil(t, stats.DB)
+	require.Positive(t, stats.DB.OpenConnections)
+
+	// DB stats are recorded as gauges
+	require.Positive(t, meter.gauges["dbstore.db.connections.open{}"])
+	require.Contains(t, meter.gauges, "dbstore.db.connections.closed{reason=max_lifetime}")
+}
+
+func TestErrorType(t *testing.T) {
+	testCases := map[string]struct {
+		given  error
+		expect string
+	}{
+		"nil":      {},
+		"canceled": {given: context.Canceled, expect: dbstore.ErrorTypeCanceled},
+		"timeout":  {given: context.DeadlineExceeded, expect: dbstore.ErrorTypeTimeout},
+		"wrapped":  {given: fmt.Errorf("update: %w", dbstore.ErrVersionConflict), expect: dbstore.ErrorTypeVersionConflict},
+		"conflict": {given: dbstore.ErrTransactionConflict, expect: dbstore.ErrorTypeTransactionConflict},
+		"dup":      {given: gorm.ErrDuplicatedKey, expect: dbstore.ErrorTypeDuplicatedKey},
+		"invalid":  {given: manifest.FieldErrors{manifest.NewFieldError(manifest.FieldErrorRequired, manifest.NewPath("spec"), nil, nil)}, expect: dbstore.ErrorTypeInvalid},
+		"other":    {given: fmt.Errorf("boom"), expect: dbstore.ErrorTypeOther},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expect, dbstore.ErrorType(test.given))
+		})
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	db, store := openTestDB(t)
+
+	var logs bytes.Buffer
+	require.NoError(t, dbstore.EnableSlowQueryLog(db, time.Hour, slog.New(slog.NewTextHandler(&logs, nil))))
+
+	pet := makePet("fluffy", "Fluffy")
+	require.NoError(t, store.Create(context.TODO(), &pet))
+	require.Empty(t, logs.String())
+
+	// Zero threshold logs all statements
+	plugin := db.Config.Plugins["wyrd:slow_query_log"].(*dbstore.SlowQueryLog)
+	plugin.Threshold = 0
+	found, err := store.GetByName(context.TODO(), &Pet{}, "fluffy")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	require.Contains(t, logs.String(), "level=WARN msg=\"slow query\"")
+	require.Contains(t, logs.String(), `name = ?`)
+	require.NotContains(t, logs.String(), "fluffy")
+	require.Contains(t, logs.String(), "rows=1")
+
+	// Values of parameters are logged only if enabled
+	logs.Reset()
+	plugin.LogValues = true
+	_, err = store.GetByName(context.TODO(), &Pet{}, "fluffy")
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), `name = \"fluffy\"`)
+}
+
+func keys[K comparable, V any](m map[K]V) []K {
+	result := make([]K, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
+
+func sum(values []int64) (result int64) {
+	for _, v := range values {
+		result += v
+	}
+	return
+}
@@ -3,15 +3,25 @@ package dbstore
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/sre-norns/wyrd/pkg/manifest"
 )
 
 // ForEach provides an easy way to iterate over all entries in the store that match search query provided.
+// Entries are iterated in pages of the query limit using continue tokens, see [NextContinueToken].
+// Stores that don't return continue tokens are iterated by offset, and so are entries ordered by [OrderBy] or [OrderByCreatedAt] options,
+// as continue tokens order results by the sort spec of the query instead.
 func ForEach[Model any](ctx context.Context, store Store, q manifest.SearchQuery, handler func(Model) error, options ...Option) (processed int64, err error) {
+	keyset := len(resolveOptions(SchemaConfig{}, new(Model), options...).Order.OrderColumns) == 0
 	for {
 		var batch []Model
-		total, err := store.Find(ctx, &batch, q, options...)
+		var next string
+		batchOptions := options
+		if keyset {
+			batchOptions = append(slices.Clip(options), NextContinueToken(&next))
+		}
+		total, err := store.Find(ctx, &batch, q, batchOptions...)
 		if err != nil {
 			return total, fmt.Errorf("failed to load a batch from the store: %w", err)
 		}
@@ -23,8 +33,14 @@ func ForEach[Model any](ctx context.Context, store Store, q manifest.SearchQuery
 			processed += 1
 		}
 
-		q.Offset += uint(len(batch))
-		if len(batch) == 0 || q.Offset >= uint(total) || len(batch) < int(q.Limit) {
+		if next != "" {
+			q.Continue = next
+			q.Offset = 0
+		} else {
+			q.Offset += uint(len(batch))
+		}
+
+		if len(batch) == 0 || len(batch) < int(q.Limit) || (next == "" && q.Offset >= uint(total)) {
 			break
 		}
 
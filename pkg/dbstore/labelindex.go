@@ -0,0 +1,448 @@
+package dbstore
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrLabelIndexNotEnabled error is returned by [RebuildLabelIndex] when the label index is not enabled for the model.
+var ErrLabelIndexNotEnabled = errors.New("label index is not enabled for the model")
+
+const (
+	labelIndexPluginName   = "wyrd:label_index"
+	labelIndexCallbackName = "wyrd:label_index"
+
+	// labelIndexTableSuffix is appended to a model table name to name its label index table.
+	labelIndexTableSuffix = "_labels"
+
+	// labelIndexDeletedKey is a key of GORM statement instance setting holding IDs of models a permanent delete statement is about to delete.
+	labelIndexDeletedKey = "wyrd:label_index_deleted"
+
+	// labelIndexBatchSize is the maximum number of label rows inserted, or of models removed from the index, by a statement.
+	labelIndexBatchSize = 500
+
+	// labelKeyMaxLength is the maximum length of a label key: a DNS subdomain prefix, a slash and a name, see [manifest.ValidateLabelKey].
+	labelKeyMaxLength = 253 + 1 + 63
+)
+
+// LabelIndex is a [gorm.Plugin] that keeps labels of models in a normalized table, so that label selectors of search queries can use DB indexes.
+// Without it, selectors are evaluated by extracting values from the JSON labels column of every row.
+//
+// Index is kept in a separate table per model, named after the model table with `_labels` suffix,
+// holding a `(uid, label_key, label_value)` row per label, indexed by key and value.
+// The index is updated by callbacks when models are created, updated or permanently deleted.
+// Once enabled, selectors of search queries, [DBStore.FindLabels] and [DBStore.FindLabelValues] use the index table.
+type LabelIndex struct {
+	// Config is the schema config of the models.
+	Config SchemaConfig
+	// Models to index.
+	Models []any
+
+	tables map[string]struct{}
+}
+
+// labelIndexRow is a row of a label index table.
+type labelIndexRow struct {
+	UID        string `gorm:"column:uid"`
+	LabelKey   string `gorm:"column:label_key"`
+	LabelValue string `gorm:"column:label_value"`
+}
+
+// EnableLabelIndex creates label index tables for given models and registers callbacks keeping them in sync with model tables.
+// Models created before the label index was enabled can be indexed with [RebuildLabelIndex].
+func EnableLabelIndex(db *gorm.DB, config SchemaConfig, models ...any) error {
+	return db.Use(&LabelIndex{Config: config, Models: models})
+}
+
+// Name implements [gorm.Plugin] interface.
+func (p *LabelIndex) Name() string {
+	return labelIndexPluginName
+}
+
+// Initialize implements [gorm.Plugin] interface. It creates index tables and registers callbacks.
+func (p *LabelIndex) Initialize(db *gorm.DB) error {
+	p.tables = make(map[string]struct{}, len(p.Models))
+	for _, model := range p.Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		if err := createLabelIndexTable(db, stmt.Schema, p.Config.IDColumnName); err != nil {
+			return fmt.Errorf("failed to create label index for %q: %w", stmt.Schema.Table, err)
+		}
+		p.tables[stmt.Schema.Table] = struct{}{}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().After("gorm:create").Register(labelIndexCallbackName, p.indexCallback),
+		callbacks.Update().After("gorm:update").Register(labelIndexCallbackName, p.indexCallback),
+		callbacks.Delete().Before("gorm:delete").Register(labelIndexCallbackName+"_match", p.matchCallback),
+		callbacks.Delete().After("gorm:delete").Register(labelIndexCallbackName, p.deleteCallback),
+	)
+}
+
+func (p *LabelIndex) indexed(db *gorm.DB) (*schema.Schema, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, false
+	}
+
+	_, ok := p.tables[db.Statement.Schema.Table]
+	return db.Statement.Schema, ok
+}
+
+// indexCallback re-indexes labels of models written by a statement.
+func (p *LabelIndex) indexCallback(db *gorm.DB) {
+	s, ok := p.indexed(db)
+	if !ok {
+		return
+	}
+
+	rows, err := reloadAffected(db, p.Config.IDColumnName)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to index labels: %w", err))
+		return
+	}
+
+	if err := p.index(db.Session(&gorm.Session{NewDB: true, SkipHooks: true}), s, rows); err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+// reindex re-loads models with given IDs from the DB and indexes their labels.
+func (p *LabelIndex) reindex(db *gorm.DB, s *schema.Schema, ids []any) error {
+	rows, err := loadByIDs(db, s, p.Config.IDColumnName, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load models to index labels: %w", err)
+	}
+
+	return p.index(db.Session(&gorm.Session{NewDB: true, SkipHooks: true}), s, rows)
+}
+
+// matchCallback loads IDs of models that a permanent delete statement is about to delete, as they can't be loaded after.
+// Soft-deleted models stay indexed, so that they can be restored.
+func (p *LabelIndex) matchCallback(db *gorm.DB) {
+	s, ok := p.indexed(db)
+	if !ok {
+		return
+	}
+
+	if !db.Statement.Unscoped && s.LookUpField(p.Config.DeletedAtColumnName) != nil {
+		return
+	}
+
+	ids, err := matchIDs(db, s, p.Config.IDColumnName)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to remove from label index: %w", err))
+		return
+	}
+
+	db.InstanceSet(labelIndexDeletedKey, ids)
+}
+
+// deleteCallback removes index entries of models deleted permanently by a statement, as matched by [LabelIndex.matchCallback].
+func (p *LabelIndex) deleteCallback(db *gorm.DB) {
+	s, ok := p.indexed(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+
+	v, _ := db.InstanceGet(labelIndexDeletedKey)
+	ids, _ := v.([]any)
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	for batch := range slices.Chunk(ids, labelIndexBatchSize) {
+		if err := tx.Table(s.Table + labelIndexTableSuffix).Where(clause.IN{Column: clause.Column{Name: "uid"}, Values: batch}).Delete(&labelIndexRow{}).Error; err != nil {
+			_ = db.AddError(fmt.Errorf("failed to remove deleted models from label index: %w", err))
+			return
+		}
+	}
+}
+
+func (p *LabelIndex) index(tx *gorm.DB, s *schema.Schema, rows reflect.Value) error {
+	idField := s.LookUpField(p.Config.IDColumnName)
+	labelsField := s.LookUpField(p.Config.LabelsColumnName)
+	if idField == nil || labelsField == nil || rows.Len() == 0 {
+		return nil
+	}
+
+	table := s.Table + labelIndexTableSuffix
+	ids := make([]any, 0, rows.Len())
+	var labelRows []labelIndexRow
+	for i := 0; i < rows.Len(); i++ {
+		row := reflect.Indirect(rows.Index(i))
+
+		value, _ := idField.ValueOf(tx.Statement.Context, row)
+		id := fmt.Sprint(value)
+		ids = append(ids, id)
+		labels, _ := labelsField.ReflectValueOf(tx.Statement.Context, row).Interface().(manifest.Labels)
+		for _, key := range labels.Slice() {
+			labelRows = append(labelRows, labelIndexRow{UID: id, LabelKey: key, LabelValue: labels[key]})
+		}
+	}
+
+	if err := tx.Table(table).Where(clause.IN{Column: clause.Column{Name: "uid"}, Values: ids}).Delete(&labelIndexRow{}).Error; err != nil {
+		return fmt.Errorf("failed to update label index: %w", err)
+	}
+	if len(labelRows) == 0 {
+		return nil
+	}
+	if err := tx.Table(table).CreateInBatches(labelRows, labelIndexBatchSize).Error; err != nil {
+		return fmt.Errorf("failed to update label index: %w", err)
+	}
+
+	return nil
+}
+
+// RebuildLabelIndex re-indexes labels of all stored models of the given type, including soft-deleted ones.
+// It is useful to index models created before the label index was enabled.
+func RebuildLabelIndex(ctx context.Context, db *gorm.DB, model any) error {
+	p, ok := labelIndexPlugin(db)
+	if !ok {
+		return ErrLabelIndexNotEnabled
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return fmt.Errorf("%w: %q", ErrLabelIndexNotEnabled, stmt.Schema.Table)
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+		return tx.Unscoped().Table(stmt.Schema.Table).FindInBatches(rows.Interface(), labelIndexBatchSize, func(batch *gorm.DB, _ int) error {
+			return p.index(tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}), stmt.Schema, rows.Elem())
+		}).Error
+	})
+}
+
+func labelIndexPlugin(db *gorm.DB) (*LabelIndex, bool) {
+	p, ok := db.Config.Plugins[labelIndexPluginName].(*LabelIndex)
+	return p, ok
+}
+
+// labelIndexed returns label index plugin and schema of the model, if labels of the model are indexed.
+func labelIndexed(db *gorm.DB, model any) (*LabelIndex, *schema.Schema, bool) {
+	p, ok := labelIndexPlugin(db)
+	if !ok || model == nil {
+		return nil, nil, false
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, nil, false
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return nil, nil, false
+	}
+
+	return p, stmt.Schema, true
+}
+
+// createLabelIndexTable creates the label index table of the model table.
+// Entries are identified by a column of the same type as the model ID, so that DBs can compare them without conversion.
+func createLabelIndexTable(db *gorm.DB, s *schema.Schema, idColumn string) error {
+	indexTable := clause.Table{Name: s.Table + labelIndexTableSuffix}
+	keyValueIndex := clause.Column{Name: "idx_" + indexTable.Name + "_key_value"}
+
+	idType := clause.Expr{SQL: "text"}
+	if db.Dialector.Name() == "mysql" {
+		idType = clause.Expr{SQL: "varchar(64)"}
+	}
+	if field := s.LookUpField(idColumn); field != nil {
+		idType = clause.Expr{SQL: db.Dialector.DataTypeOf(field)}
+	}
+
+	switch db.Dialector.Name() {
+	case "sqlite", "postgres":
+		if err := db.Exec("CREATE TABLE IF NOT EXISTS ? (uid ? NOT NULL, label_key text NOT NULL, label_value text NOT NULL, PRIMARY KEY (uid, label_key))", indexTable, idType).Error; err != nil {
+			return err
+		}
+		return db.Exec("CREATE INDEX IF NOT EXISTS ? ON ? (label_key, label_value)", keyValueIndex, indexTable).Error
+	case "mysql":
+		return db.Exec("CREATE TABLE IF NOT EXISTS ? (uid ? NOT NULL, label_key varchar(?) NOT NULL, label_value varchar(255) NOT NULL, PRIMARY KEY (uid, label_key), INDEX ? (label_key, label_value)) ENGINE=InnoDB",
+			indexTable, idType, clause.Expr{SQL: strconv.Itoa(labelKeyMaxLength)}, keyValueIndex).Error
+	default:
+		return fmt.Errorf("%w: %v", ErrUnsupportedDialect, db.Dialector.Name())
+	}
+}
+
+// labelIndexTarget identifies the label index table that label selectors of a query use instead of the JSON labels column.
+type labelIndexTarget struct {
+	table    string
+	idColumn string
+}
+
+// labelIndexFor returns the label index target of the model of the transaction context, if labels of the model are indexed.
+func labelIndexFor(db *gorm.DB, tContext transactionContext) *labelIndexTarget {
+	if db == nil {
+		return nil
+	}
+
+	_, s, ok := labelIndexed(db, tContext.model)
+	if !ok {
+		return nil
+	}
+
+	return &labelIndexTarget{table: s.Table, idColumn: tContext.Config.IDColumnName}
+}
+
+// condition returns a condition matching models with labels matching all queries, see [labelIndexCondition].
+// Queries that require a label to exist are ordered by how selective their operators usually are, see [labelRequirementRank],
+// so that the most selective one selects index entries to check the others for.
+func (t *labelIndexTarget) condition(queries []*jsonQueryExpression) labelIndexCondition {
+	var present, missing []*jsonQueryExpression
+	for _, q := range queries {
+		if q.hasKeys && q.keysOp == isNull {
+			missing = append(missing, q)
+		} else {
+			present = append(present, q)
+		}
+	}
+
+	slices.SortStableFunc(present, func(a, b *jsonQueryExpression) int {
+		return cmp.Compare(labelRequirementRank(a), labelRequirementRank(b))
+	})
+
+	return labelIndexCondition{target: t, present: present, missing: missing}
+}
+
+// labelRequirementRank ranks a query by how selective its operator usually is, lower first: a value equal to one of a few,
+// a value in a range, a value other than some, and any value of the key. Ranking does not query the DB, so that it is free for every Find.
+func labelRequirementRank(q *jsonQueryExpression) int {
+	switch q.op {
+	case equals, isIn:
+		return 0
+	case greaterThan, lessThan:
+		return 1
+	case notEquals, isNotIn:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// labelIndexCondition is a condition matching models with labels in the label index table matching all queries.
+// Queries are compiled from requirements of a label selector, thus only have top-level keys.
+//
+// Requirements that a label exists, with or without a condition on its value, are matched by a single sub-query:
+// the first requirement selects index entries using the key-value index, and the others are checked per entry using the primary key.
+// Matching each requirement by a separate sub-query would make the DB build a list of all entries matching each of them.
+type labelIndexCondition struct {
+	target *labelIndexTarget
+	// present are queries that require a label to exist
+	present []*jsonQueryExpression
+	// missing are queries that require a label not to exist
+	missing []*jsonQueryExpression
+}
+
+// Build implements clause.Expression
+func (c labelIndexCondition) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		return
+	}
+
+	table := c.target.table + labelIndexTableSuffix
+	id := clause.Column{Table: c.target.table, Name: c.target.idColumn}
+
+	if len(c.present) > 0 {
+		stmt.AddVar(stmt, id)
+		stmt.WriteString(" IN (SELECT l0.uid FROM ")
+		stmt.WriteQuoted(table)
+		stmt.WriteString(" l0 WHERE ")
+		stmt.AddVar(stmt, labelIndexMatch{alias: "l0", query: c.present[0]})
+
+		for i, q := range c.present[1:] {
+			alias := fmt.Sprintf("l%d", i+1)
+			stmt.WriteString(" AND EXISTS (SELECT 1 FROM ")
+			stmt.WriteQuoted(table)
+			stmt.WriteString(fmt.Sprintf(" %s WHERE %s.uid = l0.uid AND ", alias, alias))
+			stmt.AddVar(stmt, labelIndexMatch{alias: alias, query: q})
+			stmt.WriteString(")")
+		}
+		stmt.WriteString(")")
+	}
+
+	for i, q := range c.missing {
+		if i > 0 || len(c.present) > 0 {
+			stmt.WriteString(" AND ")
+		}
+
+		stmt.WriteString("NOT EXISTS (SELECT 1 FROM ")
+		stmt.WriteQuoted(table)
+		stmt.WriteString(" m WHERE m.uid = ")
+		stmt.AddVar(stmt, id)
+		stmt.WriteString(" AND ")
+		stmt.AddVar(stmt, labelIndexMatch{alias: "m", query: q})
+		stmt.WriteString(")")
+	}
+}
+
+// labelIndexMatch is a condition matching entries of the label index table alias with the key and value of the query.
+type labelIndexMatch struct {
+	alias string
+	query *jsonQueryExpression
+}
+
+// Build implements clause.Expression
+func (m labelIndexMatch) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		return
+	}
+
+	q := m.query
+	stmt.WriteString(m.alias + ".label_key = ")
+	stmt.AddVar(stmt, q.keys[0])
+	if q.hasKeys || len(q.op) == 0 {
+		return
+	}
+
+	stmt.WriteString(" AND ")
+	if q.asType != "" {
+		stmt.WriteString(fmt.Sprintf("cast(%s.label_value as %v)", m.alias, q.asType))
+	} else {
+		stmt.WriteString(m.alias + ".label_value")
+	}
+	stmt.WriteString(string(q.op))
+
+	if q.groupOp {
+		stmt.AddVar(stmt, q.groupValueSet.Slice())
+	} else {
+		stmt.AddVar(stmt, q.equalsValue)
+	}
+}
+
+// findIndexedLabels returns distinct values of a column of the label index table, for labels of models selected by the given statement.
+// Only labels with the key are included, if it is given.
+func findIndexedLabels(models *gorm.DB, target *labelIndexTarget, column string, key *string, query manifest.SearchQuery) (manifest.StringSet, error) {
+	tx := models.Session(&gorm.Session{NewDB: true}).Table(target.table+labelIndexTableSuffix).
+		Where("uid IN (?)", models.Select(target.idColumn))
+	if key != nil {
+		tx = tx.Where("label_key = ?", *key)
+	}
+
+	var values []string
+	rtx := matchName(limitedQuery(tx, query), column, query).Distinct(column).Pluck(column, &values)
+
+	result := make(manifest.StringSet, len(values))
+	for _, v := range values {
+		result[v] = struct{}{}
+	}
+
+	return result, rtx.Error
+}
@@ -0,0 +1,287 @@
+package dbstore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func makeLabelIndexStore(tb testing.TB, indexed bool, given []Pet) (*gorm.DB, *dbstore.DBStore) {
+	db, store := openTestDB(tb)
+	if indexed {
+		require.NoError(tb, dbstore.EnableLabelIndex(db, dbstore.ManifestModel, &Pet{}))
+	}
+
+	for _, g := range given {
+		require.NoError(tb, store.Create(context.TODO(), &g))
+	}
+
+	return db, store
+}
+
+func TestLabelIndex_Find(t *testing.T) {
+	given := []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat", "env": "dev", "age": "3"})),
+		makePet("tom", "Tom", withLabels(manifest.Labels{"kind": "cat", "env": "prod", "age": "12"})),
+		makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog", "age": "7"})),
+		makePet("nemo", "Nemo"),
+	}
+
+	testCases := map[string]struct {
+		givenSelector string
+		expect        []manifest.ResourceName
+	}{
+		"equals":         {givenSelector: "kind=cat", expect: []manifest.ResourceName{"fluffy", "tom"}},
+		"not equals":     {givenSelector: "kind!=cat", expect: []manifest.ResourceName{"rex"}},
+		"in":             {givenSelector: "env in (dev,test)", expect: []manifest.ResourceName{"fluffy"}},
+		"not in":         {givenSelector: "env notin (dev,test)", expect: []manifest.ResourceName{"tom"}},
+		"exists":         {givenSelector: "env", expect: []manifest.ResourceName{"fluffy", "tom"}},
+		"does not exist": {givenSelector: "!env", expect: []manifest.ResourceName{"rex", "nemo"}},
+		"greater than":   {givenSelector: "age>5", expect: []manifest.ResourceName{"tom", "rex"}},
+		"less than":      {givenSelector: "age<5", expect: []manifest.ResourceName{"fluffy"}},
+		"all of":         {givenSelector: "kind=cat,age>5", expect: []manifest.ResourceName{"tom"}},
+		"no match":       {givenSelector: "kind=fish"},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			// Results are the same with and without the index
+			for _, indexed := range []bool{false, true} {
+				t.Run(fmt.Sprintf("indexed=%v", indexed), func(t *testing.T) {
+					_, store := makeLabelIndexStore(t, indexed, given)
+
+					var pets []Pet
+					total, err := store.Find(context.TODO(), &pets, manifest.SearchQuery{Selector: mustSelector(t, test.givenSelector)})
+					require.NoError(t, err)
+					require.Equal(t, int64(len(test.expect)), total)
+
+					got := make([]manifest.ResourceName, 0, len(pets))
+					for _, p := range pets {
+						got = append(got, p.Name)
+					}
+					require.ElementsMatch(t, test.expect, got)
+				})
+			}
+		})
+	}
+}
+
+func TestLabelIndex_RequirementsOrder(t *testing.T) {
+	db, store := makeLabelIndexStore(t, true, []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat", "env": "dev"})),
+		makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog", "env": "dev"})),
+	})
+
+	var statements []string
+	record := func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:record_sql", record))
+	require.NoError(t, db.Callback().Row().After("gorm:row").Register("test:record_sql", record))
+
+	require.Equal(t, []manifest.ResourceName{"fluffy"}, findNames(t, store, manifest.SearchQuery{Selector: mustSelector(t, "env,kind=cat")}))
+
+	// Equality selects index entries, and the existence of a key is checked for them, without estimating matches by extra queries
+	require.Len(t, statements, 2)
+	for _, statement := range statements {
+		require.Contains(t, statement, `l0.label_key = "kind" AND l0.label_value = "cat" AND EXISTS`)
+	}
+}
+
+func TestLabelIndex_Sync(t *testing.T) {
+	db, store := makeLabelIndexStore(t, true, nil)
+	ctx := context.TODO()
+
+	find := func(selector string, options ...dbstore.Option) []manifest.ResourceName {
+		var pets []Pet
+		_, err := store.Find(ctx, &pets, manifest.SearchQuery{Selector: mustSelector(t, selector)}, options...)
+		require.NoError(t, err)
+
+		result := make([]manifest.ResourceName, 0, len(pets))
+		for _, p := range pets {
+			result = append(result, p.Name)
+		}
+		return result
+	}
+
+	pet := makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"env": "dev"}))
+	require.NoError(t, store.Create(ctx, &pet))
+	require.Equal(t, []manifest.ResourceName{"fluffy"}, find("env=dev"))
+
+	pet.Labels = manifest.Labels{"env": "prod"}
+	_, err := store.Update(ctx, &pet, pet.UID)
+	require.NoError(t, err)
+	require.Empty(t, find("env=dev"))
+	require.Equal(t, []manifest.ResourceName{"fluffy"}, find("env=prod"))
+
+	_, err = store.PatchLabels(ctx, &Pet{}, manifest.SearchQuery{}, dbstore.LabelPatch{Set: manifest.Labels{"owner": "alice"}})
+	require.NoError(t, err)
+	require.Equal(t, []manifest.ResourceName{"fluffy"}, find("owner=alice"))
+
+	// Soft-deleted models stay indexed
+	_, err = store.Delete(ctx, &Pet{}, pet.UID, 0)
+	require.NoError(t, err)
+	require.Empty(t, find("env=prod"))
+	require.Equal(t, []manifest.ResourceName{"fluffy"}, find("env=prod", dbstore.IncludeDeleted()))
+
+	// Permanently deleted models are removed from the index, others are kept
+	tom := makePet("tom", "Tom", withLabels(manifest.Labels{"env": "prod"}))
+	require.NoError(t, store.Create(ctx, &tom))
+	_, err = store.Delete(ctx, &Pet{}, pet.UID, 0, dbstore.IncludeDeleted())
+	require.NoError(t, err)
+
+	var indexed int64
+	require.NoError(t, db.Table("pets_labels").Count(&indexed).Error)
+	require.Equal(t, int64(1), indexed)
+	require.Equal(t, []manifest.ResourceName{"tom"}, find("env=prod"))
+
+	// Models deleted by conditions are removed from the index too
+	require.NoError(t, db.Unscoped().Where("name = ?", "tom").Delete(&Pet{}).Error)
+	require.NoError(t, db.Table("pets_labels").Count(&indexed).Error)
+	require.Zero(t, indexed)
+}
+
+func TestLabelIndex_PatchLabelsInBatches(t *testing.T) {
+	given := make([]Pet, 0, 1200)
+	for i := range cap(given) {
+		given = append(given, makePet(fmt.Sprintf("pet-%d", i), "Pet", withLabels(manifest.Labels{"env": "dev"})))
+	}
+	db, store := makeLabelIndexStore(t, true, given)
+	ctx := context.TODO()
+
+	// Entries are changed and re-indexed in batches of IDs, as DBs limit the number of parameters of a statement
+	affected, err := store.PatchLabels(ctx, &Pet{}, manifest.SearchQuery{}, dbstore.LabelPatch{Set: manifest.Labels{"env": "prod"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(given)), affected)
+
+	var indexed int64
+	require.NoError(t, db.Table("pets_labels").Where("label_value = ?", "prod").Count(&indexed).Error)
+	require.Equal(t, int64(len(given)), indexed)
+
+	var pets []Pet
+	total, err := store.Find(ctx, &pets, manifest.SearchQuery{Selector: mustSelector(t, "env=prod"), Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(given)), total)
+}
+
+func TestLabelIndex_FindLabels(t *testing.T) {
+	given := []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat", "env": "dev"})),
+		makePet("tom", "Tom", withLabels(manifest.Labels{"kind": "cat", "owner": "alice"})),
+		makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog"})),
+	}
+
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indexed=%v", indexed), func(t *testing.T) {
+			_, store := makeLabelIndexStore(t, indexed, given)
+			ctx := context.TODO()
+
+			keys, err := store.FindLabels(ctx, &Pet{}, manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Equal(t, manifest.NewStringSet("kind", "env", "owner"), keys)
+
+			keys, err = store.FindLabels(ctx, &Pet{}, manifest.SearchQuery{Name: "n"})
+			require.NoError(t, err)
+			require.Equal(t, manifest.NewStringSet("kind", "env", "owner"), keys)
+
+			values, err := store.FindLabelValues(ctx, &Pet{}, "kind", manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Equal(t, manifest.NewStringSet("cat", "dog"), values)
+
+			// Labels of soft-deleted models are not listed
+			var tom Pet
+			_, err = store.GetByName(ctx, &tom, "tom")
+			require.NoError(t, err)
+			_, err = store.Delete(ctx, &Pet{}, tom.UID, 0)
+			require.NoError(t, err)
+			keys, err = store.FindLabels(ctx, &Pet{}, manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Equal(t, manifest.NewStringSet("kind", "env"), keys)
+		})
+	}
+}
+
+func TestRebuildLabelIndex(t *testing.T) {
+	db, store := makeLabelIndexStore(t, false, []Pet{
+		makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"})),
+	})
+	require.ErrorIs(t, dbstore.RebuildLabelIndex(context.TODO(), db, &Pet{}), dbstore.ErrLabelIndexNotEnabled)
+
+	// Models created before the index is enabled are not found until it is rebuilt
+	require.NoError(t, dbstore.EnableLabelIndex(db, dbstore.ManifestModel, &Pet{}))
+	var pets []Pet
+	_, err := store.Find(context.TODO(), &pets, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")})
+	require.NoError(t, err)
+	require.Empty(t, pets)
+
+	require.NoError(t, dbstore.RebuildLabelIndex(context.TODO(), db, &Pet{}))
+	_, err = store.Find(context.TODO(), &pets, manifest.SearchQuery{Selector: mustSelector(t, "kind=cat")})
+	require.NoError(t, err)
+	require.Len(t, pets, 1)
+}
+
+// BenchmarkLabelSelector compares label selector queries over the JSON labels column and the label index, with 1M stored models.
+// Use -short flag for a smaller data set.
+func BenchmarkLabelSelector(b *testing.B) {
+	rows := 1_000_000
+	if testing.Short() {
+		rows = 10_000
+	}
+
+	queries := map[string]string{
+		"equals":  "team=team-42",
+		"in":      "team in (team-1,team-2),env=prod",
+		"exists":  "rare",
+		"missing": "env=dev,!rare",
+	}
+
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("indexed=%v", indexed), func(b *testing.B) {
+			db, store := makeLabelIndexStore(b, indexed, nil)
+			seedLabeledPets(b, db, rows)
+
+			for name, query := range queries {
+				selector := mustSelector(b, query)
+				b.Run(name, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						var pets []Pet
+						_, err := store.Find(context.TODO(), &pets, manifest.SearchQuery{Selector: selector, Limit: 100})
+						require.NoError(b, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+// seedLabeledPets inserts pets with labels in batches, bypassing hooks for speed.
+func seedLabeledPets(b *testing.B, db *gorm.DB, rows int) {
+	const batchSize = 1000
+	envs := []string{"dev", "test", "prod"}
+
+	batch := make([]Pet, 0, batchSize)
+	for i := 0; i < rows; i++ {
+		labels := manifest.Labels{
+			"team": fmt.Sprintf("team-%d", i%1000),
+			"env":  envs[i%len(envs)],
+		}
+		if i%10_000 == 0 {
+			labels["rare"] = "true"
+		}
+
+		pet := makePet(fmt.Sprintf("pet-%d", i), "Pet", withLabels(labels))
+		pet.UID = manifest.ResourceID(uuid.NewString())
+		batch = append(batch, pet)
+		if len(batch) == batchSize || i == rows-1 {
+			require.NoError(b, db.Session(&gorm.Session{SkipHooks: true}).Omit("Spec.Toys").Create(&batch).Error)
+			batch = batch[:0]
+		}
+	}
+}
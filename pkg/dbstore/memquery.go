@@ -0,0 +1,677 @@
+package dbstore
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// memOrder compares two rows, returning negative value if the first one goes before the second.
+type memOrder func(a, b *memRow) int
+
+// query returns rows of the model that match the search query, in order and limited to the page of the query, and total number of matches.
+// If ids is not nil, only rows with these primary keys are considered.
+// Query is evaluated in the same way as [withQuery] does it for [DBStore].
+func (ms *memSession) query(sch *schema.Schema, tContext transactionContext, query manifest.SearchQuery, ids []any) ([]*memRow, int64, error) {
+	cfg := tContext.Config
+	// Offset is ignored when continuing from a token
+	if query.Continue != "" {
+		query.Offset = 0
+	}
+
+	filter, err := newQueryFilter(sch, cfg, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Soft-deleted entries must be included to search by the time of deletion
+	unscoped := tContext.unScoped || (filter.timeField != nil && query.TimeField == manifest.TimeFieldDeleted)
+
+	var candidates []*memRow
+	if ids != nil {
+		for _, id := range ids {
+			if row := ms.state.row(memKey{table: sch.Table, id: id}); row != nil {
+				candidates = append(candidates, row)
+			}
+		}
+	} else {
+		for _, row := range ms.rows(sch.Table) {
+			candidates = append(candidates, row)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *memRow) int { return compareValues(a.seq, b.seq) })
+
+	words := filter.words
+	rank := map[*memRow]int{}
+
+	rows := make([]*memRow, 0, len(candidates))
+	for _, row := range candidates {
+		if !ms.visible(sch, row, tContext, unscoped) {
+			continue
+		}
+
+		r, ok := filter.match(row.value)
+		if !ok {
+			continue
+		}
+
+		rank[row] = r
+		rows = append(rows, row)
+	}
+
+	var total int64
+	if !tContext.disableCounting {
+		total = int64(len(rows))
+	}
+
+	// Sort spec replaces order options, as does full-text rank
+	var orders []memOrder
+	keyset := tContext.keyset(query)
+	switch {
+	case len(query.Sort) > 0 || keyset:
+		sortable := tContext.Sortable
+		if len(sortable) == 0 {
+			sortable = cfg.SortableFields()
+		}
+		if err := query.Sort.Validate(sortable...); err != nil {
+			return nil, total, err
+		}
+
+		if _, err := ms.sortValues(sch, cfg, nil, query.Sort...); err != nil {
+			return nil, total, err
+		}
+
+		for _, field := range query.Sort {
+			orders = append(orders, func(a, b *memRow) int {
+				av, _ := ms.sortValues(sch, cfg, a, field)
+				bv, _ := ms.sortValues(sch, cfg, b, field)
+				return orderValues(av[0], bv[0], field.Descending)
+			})
+		}
+		if keyset {
+			orders = append(orders, func(a, b *memRow) int {
+				av, _ := columnOf(sch, a.value, cfg.IDColumnName)
+				bv, _ := columnOf(sch, b.value, cfg.IDColumnName)
+				return orderValues(av, bv, false)
+			})
+		}
+	case len(words) > 0:
+		orders = append(orders, func(a, b *memRow) int { return rank[b] - rank[a] })
+	default:
+		for _, orderBy := range tContext.Order.OrderColumns {
+			field := sch.LookUpField(orderBy.Column)
+			if field == nil {
+				return nil, total, fmt.Errorf("%w: %q", ErrUnknownColumn, orderBy.Column)
+			}
+
+			desc := orderBy.Order == OrderDescending
+			orders = append(orders, func(a, b *memRow) int {
+				av, _ := fieldByIndex(a.value, field.StructField.Index)
+				bv, _ := fieldByIndex(b.value, field.StructField.Index)
+				return orderValues(memValue(av), memValue(bv), desc)
+			})
+		}
+	}
+
+	slices.SortStableFunc(rows, func(a, b *memRow) int {
+		for _, order := range orders {
+			if c := order(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	if query.Continue != "" {
+		cursor, err := decodeCursor(cfg, query)
+		if err != nil {
+			return nil, total, err
+		}
+
+		after := make([]*memRow, 0, len(rows))
+		for _, row := range rows {
+			values, _ := ms.sortValues(sch, cfg, row, query.Sort...)
+			uid, _ := columnOf(sch, row.value, cfg.IDColumnName)
+			values = append(values, uid)
+			if followsCursor(query.Sort, values, append(cursor.Values, cursor.UID)) {
+				after = append(after, row)
+			}
+		}
+		rows = after
+	}
+
+	return limitSlice(rows, query), total, nil
+}
+
+// queryFilter matches values of a model against filters of a search query: name, full-text search terms, time range and label selector.
+// Values are matched in the same way as [withQuery] filters rows in the DB. Sorting and pagination are not part of the filter.
+type queryFilter struct {
+	sch   *schema.Schema
+	cfg   SchemaConfig
+	query manifest.SearchQuery
+
+	timeField *schema.Field
+	words     []string
+}
+
+func newQueryFilter(sch *schema.Schema, cfg SchemaConfig, query manifest.SearchQuery) (queryFilter, error) {
+	filter := queryFilter{
+		sch:   sch,
+		cfg:   cfg,
+		query: query,
+		words: fullTextWords(query.Text),
+	}
+
+	if !query.FromTime.IsZero() || !query.TillTime.IsZero() {
+		column, err := cfg.TimeColumn(query.TimeField)
+		if err != nil {
+			return filter, err
+		}
+		if filter.timeField = sch.LookUpField(column); filter.timeField == nil {
+			return filter, fmt.Errorf("%w: %q", ErrUnknownColumn, column)
+		}
+	}
+
+	return filter, validateSelector(query.Selector)
+}
+
+// match returns true if the value matches the filter, and its full-text rank if the query has full-text search terms.
+func (f queryFilter) match(value reflect.Value) (rank int, ok bool) {
+	if f.query.Name != "" {
+		if name, ok := columnOf(f.sch, value, f.cfg.NameColumnName); !ok || !matchesName(fmt.Sprint(name), f.query.Name) {
+			return 0, false
+		}
+	}
+
+	if len(f.words) > 0 {
+		if rank = fullTextRank(f.sch, f.cfg, value, f.words); rank == 0 {
+			return 0, false
+		}
+	}
+
+	if f.timeField != nil {
+		v, ok := fieldByIndex(value, f.timeField.StructField.Index)
+		if !ok || !f.query.InTimeRange(timeOf(v)) {
+			return 0, false
+		}
+	}
+
+	if f.query.Selector != nil && !matchesSelector(f.query.Selector, labelsOf(f.sch, f.cfg, value)) {
+		return 0, false
+	}
+
+	return rank, true
+}
+
+// followsCursor returns true if values follow the cursor values in the order of the sort spec, followed by ascending UID.
+// It is the equivalent of [keysetCondition], thus NULL values go first in ascending order.
+func followsCursor(sort manifest.SortSpec, values, cursor []any) bool {
+	for i := range values {
+		c := orderValues(values[i], cursor[i], i < len(sort) && sort[i].Descending)
+		if c != 0 {
+			return c > 0
+		}
+	}
+
+	return false
+}
+
+// sortValues returns values of the sort fields of the row, after validating that fields can be sorted by.
+// If the row is nil, only validation is performed.
+func (ms *memSession) sortValues(sch *schema.Schema, cfg SchemaConfig, row *memRow, fields ...manifest.SortField) ([]any, error) {
+	result := make([]any, 0, len(fields))
+	for _, field := range fields {
+		column, ok := cfg.sortColumnName(field)
+		if !ok {
+			key, isLabel := field.LabelKey()
+			if !isLabel {
+				return nil, fmt.Errorf("%w: %q", manifest.ErrUnsortableField, field.Field)
+			}
+			if err := manifest.ValidateLabelKey(key); err != nil {
+				return nil, fmt.Errorf("%w: %w", manifest.ErrInvalidSortSpec, err)
+			}
+
+			var value any
+			if row != nil {
+				if labels := labelsOf(sch, ms.config(), row.value); labels.Has(key) {
+					value = labels.Get(key)
+				}
+			}
+			result = append(result, value)
+			continue
+		}
+
+		f := sch.LookUpField(column)
+		if f == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownColumn, column)
+		}
+
+		var value any
+		if row != nil {
+			v, _ := fieldByIndex(row.value, f.StructField.Index)
+			value = memValue(v)
+		}
+		result = append(result, value)
+	}
+
+	return result, nil
+}
+
+// nextContinueToken returns continue token pointing after the last of the rows, or empty string if rows are the last page.
+func (ms *memSession) nextContinueToken(sch *schema.Schema, rows []*memRow, query manifest.SearchQuery) (string, error) {
+	if query.Limit == 0 || len(rows) < int(query.Limit) {
+		return "", nil
+	}
+
+	cfg := ms.config()
+	last := rows[len(rows)-1]
+	values, err := ms.sortValues(sch, cfg, last, query.Sort...)
+	if err != nil {
+		return "", fmt.Errorf("failed to build continue token: %w", err)
+	}
+
+	uid, _ := columnOf(sch, last.value, cfg.IDColumnName)
+	return cfg.continueTokenCodec().Encode(manifest.Cursor{
+		Sort:   query.Sort.String(),
+		Values: values,
+		UID:    manifest.ResourceID(fmt.Sprint(uid)),
+	})
+}
+
+func fullTextRank(sch *schema.Schema, cfg SchemaConfig, value reflect.Value, words []string) int {
+	var name string
+	if v, ok := columnOf(sch, value, cfg.NameColumnName); ok {
+		name = fmt.Sprint(v)
+	}
+
+	// Rank is the number of occurrences of words matching the query
+	content := fullTextTokens(fullTextContent(name, labelsOf(sch, cfg, value), value.Interface()))
+	rank := 0
+	for _, w := range words {
+		matches := 0
+		for _, c := range content {
+			if strings.HasPrefix(c, w) {
+				matches++
+			}
+		}
+		if matches == 0 {
+			return 0
+		}
+		rank += matches
+	}
+
+	return rank
+}
+
+// column returns value of the column of a row, converting time fields to *time.Time.
+func columnOf(sch *schema.Schema, value reflect.Value, column string) (any, bool) {
+	field := sch.LookUpField(column)
+	if field == nil {
+		return nil, false
+	}
+
+	v, ok := fieldByIndex(value, field.StructField.Index)
+	if !ok {
+		return nil, false
+	}
+
+	return memValue(v), true
+}
+
+func labelsOf(sch *schema.Schema, cfg SchemaConfig, value reflect.Value) manifest.Labels {
+	v, _ := columnOf(sch, value, cfg.LabelsColumnName)
+	labels, _ := v.(manifest.Labels)
+	return labels
+}
+
+// matchesName returns true if value contains name, ignoring case, as `LIKE %name%` does in SQLite.
+func matchesName(value, name string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(name))
+}
+
+// matchesSelector returns true if labels match the selector.
+// As SQL conditions of [withSelector] do, `!=` and `notin` requirements only match labels that have the key.
+func matchesSelector(selector manifest.Selector, labels manifest.Labels) bool {
+	if !selector.Matches(labels) {
+		return false
+	}
+
+	reqs, _ := selector.Requirements()
+	for _, req := range reqs {
+		switch req.Operator() {
+		case manifest.NotEquals, manifest.NotIn:
+			if !labels.Has(req.Key()) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// validateSelector returns the same errors for a selector as [withSelector] does.
+func validateSelector(selector manifest.Selector) error {
+	if selector == nil {
+		return nil
+	}
+
+	reqs, ok := selector.Requirements()
+	if !ok {
+		return manifest.ErrNonSelectableRequirements
+	}
+
+	for _, req := range reqs {
+		switch req.Operator() {
+		case manifest.Equals, manifest.DoubleEquals, manifest.NotEquals:
+			if _, ok := req.Values().Any(); !ok {
+				return ErrNoRequirementsValueProvided
+			}
+		case manifest.GreaterThan, manifest.LessThan:
+			value, ok := req.Values().Any()
+			if !ok {
+				return ErrNoRequirementsValueProvided
+			}
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("%w: failed to parse value for key `%v` to compare with: %v", manifest.ErrNonSelectableRequirements, req.Key(), err)
+			}
+		case manifest.In, manifest.NotIn:
+			if req.Values() == nil {
+				return fmt.Errorf("%w: nil values for key `%v`", manifest.ErrNonSelectableRequirements, req.Key())
+			}
+		case manifest.Exists, manifest.DoesNotExist:
+		default:
+			return fmt.Errorf("%w: `%v`", ErrUnexpectedSelectorOperator, req.Operator())
+		}
+	}
+
+	return nil
+}
+
+// fieldByIndex returns a field of the struct, following index path of a GORM schema field.
+// Negative indexes refer to embedded pointers. It returns false if any of the pointers on the path is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if i < 0 {
+			i = -i - 1
+		}
+
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	return v, true
+}
+
+// memValue returns comparable value of a field: nil for NULL values and time.Time for timestamps.
+func memValue(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if t := timeOf(v); t != nil {
+		return *t
+	}
+	switch v.Interface().(type) {
+	case time.Time, *time.Time, gorm.DeletedAt, *gorm.DeletedAt, sql.NullTime, *sql.NullTime:
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	return v.Interface()
+}
+
+// timeOf returns the time held by a timestamp field, or nil if the field is not a timestamp or NULL.
+func timeOf(v reflect.Value) *time.Time {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+
+	switch t := v.Interface().(type) {
+	case time.Time:
+		if !t.IsZero() {
+			return &t
+		}
+	case *time.Time:
+		if t != nil && !t.IsZero() {
+			return t
+		}
+	case gorm.DeletedAt:
+		if t.Valid {
+			return &t.Time
+		}
+	case *gorm.DeletedAt:
+		if t != nil && t.Valid {
+			return &t.Time
+		}
+	case sql.NullTime:
+		if t.Valid {
+			return &t.Time
+		}
+	case *sql.NullTime:
+		if t != nil && t.Valid {
+			return &t.Time
+		}
+	}
+
+	return nil
+}
+
+// setTime sets a timestamp field to the given time, or NULL if the time is nil.
+func setTime(v reflect.Value, t *time.Time) {
+	var value any
+	switch v.Interface().(type) {
+	case time.Time:
+		value = time.Time{}
+		if t != nil {
+			value = *t
+		}
+	case *time.Time:
+		value = (*time.Time)(nil)
+		if t != nil {
+			tm := *t
+			value = &tm
+		}
+	case gorm.DeletedAt:
+		value = gorm.DeletedAt{}
+		if t != nil {
+			value = gorm.DeletedAt{Time: *t, Valid: true}
+		}
+	case *gorm.DeletedAt:
+		value = (*gorm.DeletedAt)(nil)
+		if t != nil {
+			value = &gorm.DeletedAt{Time: *t, Valid: true}
+		}
+	case sql.NullTime:
+		value = sql.NullTime{}
+		if t != nil {
+			value = sql.NullTime{Time: *t, Valid: true}
+		}
+	case *sql.NullTime:
+		value = (*sql.NullTime)(nil)
+		if t != nil {
+			value = &sql.NullTime{Time: *t, Valid: true}
+		}
+	default:
+		return
+	}
+
+	v.Set(reflect.ValueOf(value))
+}
+
+// orderValues compares values for ordering. NULL values go first in ascending order, as in SQLite.
+func orderValues(a, b any, desc bool) int {
+	var c int
+	switch {
+	case a == nil && b == nil:
+		c = 0
+	case a == nil:
+		c = -1
+	case b == nil:
+		c = 1
+	default:
+		c = compareValues(a, b)
+	}
+
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// compareValues compares non-NULL values of columns: strings, numbers, booleans and timestamps.
+// Values of other types are compared by their string representation.
+func compareValues(a, b any) int {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case va.Kind() == reflect.String && vb.Kind() == reflect.String:
+		return strings.Compare(va.String(), vb.String())
+	case isInt(va) && isInt(vb):
+		return compareInts(va, vb)
+	case isNumber(va) && isNumber(vb):
+		fa, fb := toFloat(va), toFloat(vb)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case va.Kind() == reflect.Bool && vb.Kind() == reflect.Bool:
+		return compareInts(reflect.ValueOf(boolInt(va.Bool())), reflect.ValueOf(boolInt(vb.Bool())))
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNumber(v reflect.Value) bool {
+	return isInt(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func compareInts(a, b reflect.Value) int {
+	// Compare signs first, so that large unsigned values are not overflown
+	aNeg, bNeg := a.CanInt() && a.Int() < 0, b.CanInt() && b.Int() < 0
+	switch {
+	case aNeg && !bNeg:
+		return -1
+	case !aNeg && bNeg:
+		return 1
+	case aNeg && bNeg:
+		return compareOrdered(a.Int(), b.Int())
+	}
+
+	toUint := func(v reflect.Value) uint64 {
+		if v.CanInt() {
+			return uint64(v.Int())
+		}
+		return v.Uint()
+	}
+	return compareOrdered(toUint(a), toUint(b))
+}
+
+func compareOrdered[T int64 | uint64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// deepCopy returns a copy of the value that shares no pointers, slices or maps with it.
+// Note unexported fields of structs are copied shallowly, such as location of time.Time.
+func deepCopy(v reflect.Value) reflect.Value {
+	result := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			result.Set(reflect.New(v.Type().Elem()))
+			result.Elem().Set(deepCopy(v.Elem()))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			result.Set(deepCopy(v.Elem()))
+		}
+	case reflect.Struct:
+		result.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				result.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			result.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				result.Index(i).Set(deepCopy(v.Index(i)))
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(deepCopy(v.Index(i)))
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			result.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			iter := v.MapRange()
+			for iter.Next() {
+				result.SetMapIndex(deepCopy(iter.Key()), deepCopy(iter.Value()))
+			}
+		}
+	default:
+		result.Set(v)
+	}
+
+	return result
+}
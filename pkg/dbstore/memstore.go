@@ -0,0 +1,1440 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrTransactionConflict error is returned by Commit of a [MemStore] transaction when an entry it modified was modified by another transaction since it begun,
+	// and by writes of [FSStore] when a file they would write was changed outside of the store since it was read.
+	ErrTransactionConflict = errors.New("transaction conflicts with a concurrent update")
+
+	// ErrUnknownColumn error is returned when an option refers to a column that is not a field of the model.
+	ErrUnknownColumn = errors.New("unknown column")
+)
+
+// MemStore is an in-memory implementation of [TransactionalStore], [LabelStore] and [AssociationStore].
+// It is intended for tests and embedded use, and behaves as [DBStore] for the features it supports.
+//
+// Models are mapped to tables and columns using the same GORM schema as DBStore, and columns are identified by the [SchemaConfig].
+// Stored values are copied, so models passed to and returned from the store can be modified freely.
+// Search queries are evaluated with [manifest.Selector.Matches], and full-text search is always enabled,
+// ranking results by the number of matching words.
+//
+// Transactions are snapshot-isolated: a transaction observes the store as it was when the transaction begun,
+// and its changes are only visible to others after a commit. Commit fails with [ErrTransactionConflict]
+// if any of the entries modified by the transaction has been modified by another one since.
+//
+// Note: model hooks BeforeSave, BeforeCreate, BeforeUpdate and BeforeDelete are called with nil *gorm.DB.
+// Note: name matching is case-insensitive, as LIKE operator of SQLite.
+type MemStore struct {
+	config SchemaConfig
+
+	schemas sync.Map
+	seq     atomic.Uint64
+
+	lock  sync.RWMutex
+	state *memState
+}
+
+// NewMemStore creates a new empty instance of MemStore.
+func NewMemStore(cfg SchemaConfig) *MemStore {
+	return &MemStore{
+		config: cfg,
+		state:  newMemState(),
+	}
+}
+
+// memRow is a stored copy of a model. Rows are never modified once stored, but replaced.
+type memRow struct {
+	// seq is the order of insertion of the row, used to order results by default.
+	seq   uint64
+	value reflect.Value
+}
+
+type memKey struct {
+	table string
+	id    any
+}
+
+type memLinkKey struct {
+	table string
+	owner any
+	link  string
+}
+
+// memLinks holds IDs of models associated with an owner. Like rows, links are never modified once stored.
+type memLinks struct {
+	ids []any
+}
+
+type memState struct {
+	tables map[string]map[any]*memRow
+	links  map[memLinkKey]*memLinks
+}
+
+func newMemState() *memState {
+	return &memState{
+		tables: map[string]map[any]*memRow{},
+		links:  map[memLinkKey]*memLinks{},
+	}
+}
+
+// clone returns a snapshot of the state. As rows are never modified, only maps are copied.
+func (st *memState) clone() *memState {
+	result := &memState{
+		tables: make(map[string]map[any]*memRow, len(st.tables)),
+		links:  make(map[memLinkKey]*memLinks, len(st.links)),
+	}
+	for table, rows := range st.tables {
+		result.tables[table] = make(map[any]*memRow, len(rows))
+		for id, row := range rows {
+			result.tables[table][id] = row
+		}
+	}
+	for key, links := range st.links {
+		result.links[key] = links
+	}
+
+	return result
+}
+
+func (st *memState) row(key memKey) *memRow {
+	return st.tables[key.table][key.id]
+}
+
+func (st *memState) setRow(key memKey, row *memRow) {
+	if row == nil {
+		delete(st.tables[key.table], key.id)
+		return
+	}
+
+	rows, ok := st.tables[key.table]
+	if !ok {
+		rows = map[any]*memRow{}
+		st.tables[key.table] = rows
+	}
+	rows[key.id] = row
+}
+
+func (st *memState) setLinks(key memLinkKey, links *memLinks) {
+	if links == nil || len(links.ids) == 0 {
+		delete(st.links, key)
+		return
+	}
+	st.links[key] = links
+}
+
+// memSession executes store operations against a state.
+// Sessions of transactions record original rows and links they modify to detect conflicts on commit.
+type memSession struct {
+	ctx   context.Context
+	store *MemStore
+	state *memState
+
+	written      map[memKey]*memRow
+	writtenLinks map[memLinkKey]*memLinks
+}
+
+func (s *MemStore) session(ctx context.Context) *memSession {
+	return &memSession{
+		ctx:   ctx,
+		store: s,
+		state: s.state,
+	}
+}
+
+func (s *MemStore) read(ctx context.Context, fn func(*memSession) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return fn(s.session(ctx))
+}
+
+func (s *MemStore) write(ctx context.Context, fn func(*memSession) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return fn(s.session(ctx))
+}
+
+func (s *MemStore) schema(value any) (*schema.Schema, error) {
+	if value == nil {
+		return nil, gorm.ErrInvalidValue
+	}
+
+	sch, err := schema.Parse(value, &s.schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("%w: %v", gorm.ErrPrimaryKeyRequired, sch.Name)
+	}
+
+	return sch, nil
+}
+
+// Ping implements [Pinger] interface. In-memory store is always available.
+func (s *MemStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Begin opens a snapshot-isolated transaction.
+// It is an implementation of Transactional interface.
+// Note: It's a caller responsibility to call Transaction.Commit() or Transaction.Rollback() to complete the transaction.
+func (s *MemStore) Begin(ctx context.Context) (StoreTransaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return &memStoreTransaction{
+		session: &memSession{
+			ctx:          ctx,
+			store:        s,
+			state:        s.state.clone(),
+			written:      map[memKey]*memRow{},
+			writtenLinks: map[memLinkKey]*memLinks{},
+		},
+	}, nil
+}
+
+// CreateOrUpdate inserts a new value into the store if the models.ID is nil, otherwise it replaces it.
+func (s *MemStore) CreateOrUpdate(ctx context.Context, value any, options ...Option) (exists bool, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		exists, err = ms.save(value, resolveOptions(s.config, value, options...))
+		return
+	})
+	return
+}
+
+// Create inserts a new value into the store, updating inserted models ID.
+func (s *MemStore) Create(ctx context.Context, value any, options ...Option) error {
+	return s.write(ctx, func(ms *memSession) error {
+		return ms.create(value, resolveOptions(s.config, value, options...))
+	})
+}
+
+// GetByUID finds at most one entry in the store identified by the UUID if there is one.
+// See [DBStore.GetByUID].
+func (s *MemStore) GetByUID(ctx context.Context, dest any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		exists, err = ms.get(dest, s.config.IDColumnName, id, resolveOptions(s.config, dest, options...))
+		return
+	})
+	return
+}
+
+// GetByName finds at most one entry in the store identified by the name if there is one.
+// See [DBStore.GetByName].
+func (s *MemStore) GetByName(ctx context.Context, dest any, name manifest.ResourceName, options ...Option) (exists bool, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		exists, err = ms.get(dest, s.config.NameColumnName, name, resolveOptions(s.config, dest, options...))
+		return
+	})
+	return
+}
+
+// Update updates non-zero fields of an entry identified by the ID of the value.
+// See [DBStore.Update].
+func (s *MemStore) Update(ctx context.Context, value any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		exists, err = ms.update(value, id, resolveOptions(s.config, value, options...))
+		return
+	})
+	return
+}
+
+// Delete deletes an entry identified by the ID from the store.
+// See [DBStore.Delete].
+func (s *MemStore) Delete(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		existed, err = ms.delete(model, id, version, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// Restore restores a previously deleted entry identified by the ID.
+// See [DBStore.Restore].
+func (s *MemStore) Restore(ctx context.Context, model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		existed, err = ms.restore(model, id, resolveOptions(s.config, nil, options...))
+		return
+	})
+	return
+}
+
+// CreateMany inserts values of a slice into the store, skipping values that fail to be inserted.
+// See [DBStore.CreateMany].
+func (s *MemStore) CreateMany(ctx context.Context, values any, options ...Option) (created int64, results []error, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		created, results, err = ms.createMany(values, resolveOptions(s.config, values, options...))
+		return
+	})
+	return
+}
+
+// DeleteMany deletes entries that match search query.
+// See [DBStore.DeleteMany].
+func (s *MemStore) DeleteMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		affected, err = ms.deleteMany(model, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// RestoreMany restores soft-deleted entries that match search query.
+// See [DBStore.RestoreMany].
+func (s *MemStore) RestoreMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		affected, err = ms.restoreMany(model, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// PatchLabels changes labels of entries that match search query, incrementing their version.
+// See [DBStore.PatchLabels].
+func (s *MemStore) PatchLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error) {
+	err = s.write(ctx, func(ms *memSession) (err error) {
+		affected, err = ms.patchLabels(model, searchQuery, patch, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// Find returns models from the store that matched search query parameters.
+// See [DBStore.Find].
+func (s *MemStore) Find(ctx context.Context, dest any, searchQuery manifest.SearchQuery, options ...Option) (total int64, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		total, err = ms.find(dest, searchQuery, resolveOptions(s.config, dest, options...))
+		return
+	})
+	return
+}
+
+// FindNames returns a set of names for a model type.
+// See [DBStore.FindNames].
+func (s *MemStore) FindNames(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (result manifest.StringSet, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		result, err = ms.findNames(model, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// FindLabels returns a set of label keys for a given model type.
+// See [DBStore.FindLabels].
+func (s *MemStore) FindLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (result manifest.StringSet, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		result, err = ms.findLabels(model, "", false, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// FindLabelValues returns a set of label values for a given model type and label key.
+// See [DBStore.FindLabelValues].
+func (s *MemStore) FindLabelValues(ctx context.Context, model any, key string, searchQuery manifest.SearchQuery, options ...Option) (result manifest.StringSet, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		result, err = ms.findLabels(model, key, true, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// CountLabelValues returns numbers of models per combination of values of the label keys, most common first.
+// See [DBStore.CountLabelValues].
+func (s *MemStore) CountLabelValues(ctx context.Context, model any, keys []string, searchQuery manifest.SearchQuery, options ...Option) (result []manifest.FacetCount, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		result, err = ms.countLabelValues(model, keys, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// CountByTime returns numbers of models per time bucket, by the time field of the search query, in order of time.
+// See [DBStore.CountByTime].
+func (s *MemStore) CountByTime(ctx context.Context, model any, bucket time.Duration, searchQuery manifest.SearchQuery, options ...Option) (result []manifest.TimeBucket, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		result, err = ms.countByTime(model, bucket, searchQuery, resolveOptions(s.config, model, options...))
+		return
+	})
+	return
+}
+
+// FindLinked returns models previously associated with the owner that match searchQuery.
+// This is an implementation of AssociationStore interface.
+func (s *MemStore) FindLinked(ctx context.Context, dest any, link string, owner any, searchQuery manifest.SearchQuery, options ...Option) (totalCount int64, err error) {
+	err = s.read(ctx, func(ms *memSession) (err error) {
+		totalCount, err = ms.findLinked(dest, link, owner, searchQuery, resolveOptions(s.config, dest, options...))
+		return
+	})
+	return
+}
+
+// AddLinked associates the value with the owner, creating the value if it is not in the store yet.
+func (s *MemStore) AddLinked(ctx context.Context, value any, link string, owner any, options ...Option) error {
+	return s.write(ctx, func(ms *memSession) error {
+		return ms.addLinked(value, link, owner, resolveOptions(s.config, value, options...))
+	})
+}
+
+// RemoveLinked removes a value associate from the owner. The value itself is not deleted.
+func (s *MemStore) RemoveLinked(ctx context.Context, value any, link string, owner any) error {
+	return s.write(ctx, func(ms *memSession) error {
+		return ms.removeLinked(value, link, owner)
+	})
+}
+
+// ClearLinked removes all associate from the owner. Values are not deleted from the store.
+func (s *MemStore) ClearLinked(ctx context.Context, link string, owner any) error {
+	return s.write(ctx, func(ms *memSession) error {
+		return ms.clearLinked(link, owner)
+	})
+}
+
+func (ms *memSession) config() SchemaConfig {
+	return ms.store.config
+}
+
+func (ms *memSession) rows(table string) map[any]*memRow {
+	return ms.state.tables[table]
+}
+
+func (ms *memSession) put(key memKey, row *memRow) {
+	if ms.written != nil {
+		if _, ok := ms.written[key]; !ok {
+			ms.written[key] = ms.state.row(key)
+		}
+	}
+	ms.state.setRow(key, row)
+}
+
+func (ms *memSession) putLinks(key memLinkKey, links *memLinks) {
+	if ms.writtenLinks != nil {
+		if _, ok := ms.writtenLinks[key]; !ok {
+			ms.writtenLinks[key] = ms.state.links[key]
+		}
+	}
+	ms.state.setLinks(key, links)
+}
+
+// eachModel calls fn with a pointer to each struct of the value, that can be a pointer to a struct or a slice of structs.
+func eachModel(value any, fn func(reflect.Value) error) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return gorm.ErrInvalidValue
+	}
+
+	switch elem := rv.Elem(); elem.Kind() {
+	case reflect.Struct:
+		return fn(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < elem.Len(); i++ {
+			item := elem.Index(i)
+			if item.Kind() != reflect.Pointer {
+				item = item.Addr()
+			}
+			if item.IsNil() {
+				continue
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return gorm.ErrInvalidValue
+}
+
+func callHook[T any](value reflect.Value, call func(T) error) error {
+	if hook, ok := value.Interface().(T); ok {
+		return call(hook)
+	}
+	return nil
+}
+
+// primaryKey returns the primary key of the model, or nil if it is not set.
+// Note associated models may not follow the schema config, thus primary key is taken from the model schema.
+func (ms *memSession) primaryKey(sch *schema.Schema, value reflect.Value) any {
+	field, ok := fieldByIndex(value, sch.PrioritizedPrimaryField.StructField.Index)
+	if !ok || field.IsZero() {
+		return nil
+	}
+
+	return field.Interface()
+}
+
+// idValue converts ID passed to a store method to the type of the ID field of the model.
+func (ms *memSession) idValue(sch *schema.Schema, id any) any {
+	t := sch.PrioritizedPrimaryField.FieldType
+	v := reflect.ValueOf(id)
+	if v.IsValid() && v.Type() != t && v.CanConvert(t) {
+		return v.Convert(t).Interface()
+	}
+
+	return id
+}
+
+// copyIn returns a row value holding copies of column fields of the model, except omitted ones.
+func (ms *memSession) copyIn(sch *schema.Schema, value reflect.Value, omit manifest.StringSet) reflect.Value {
+	result := reflect.New(sch.ModelType).Elem()
+	for _, name := range sch.DBNames {
+		field := sch.FieldsByDBName[name]
+		if omit.Has(field.Name) || omit.Has(field.DBName) {
+			continue
+		}
+
+		if src, ok := fieldByIndex(value, field.StructField.Index); ok {
+			field.ReflectValueOf(ms.ctx, result).Set(deepCopy(src))
+		}
+	}
+
+	return result
+}
+
+// copyOut writes a copy of the stored row into the value, and loads associations to expand.
+func (ms *memSession) copyOut(sch *schema.Schema, row *memRow, dest reflect.Value, tContext transactionContext) error {
+	value := deepCopy(row.value)
+	for name := range tContext.Omit {
+		if field := sch.LookUpField(name); field != nil {
+			field.ReflectValueOf(ms.ctx, value).SetZero()
+		}
+	}
+
+	for relation, expand := range tContext.Expand {
+		rel, ok := sch.Relationships.Relations[relation]
+		if !ok {
+			return fmt.Errorf("%w: %s", gorm.ErrUnsupportedRelation, relation)
+		}
+
+		linkContext := newTransactionContext(tContext.Config)
+		if expand.OrderBy.Column != "" {
+			linkContext.Order.OrderColumns = []orderByColumn{expand.OrderBy}
+		}
+
+		ids := ms.linkedIDs(sch, row.value, relation)
+		rows, _, err := ms.query(rel.FieldSchema, linkContext, expand.Query, ids)
+		if err != nil {
+			return err
+		}
+
+		field := rel.Field.ReflectValueOf(ms.ctx, value)
+		if err := ms.assignRows(rel.FieldSchema, rows, field, linkContext); err != nil {
+			return err
+		}
+	}
+
+	if dest.Type() != value.Type() {
+		return fmt.Errorf("%w: can not assign %v to %v", gorm.ErrInvalidValue, value.Type(), dest.Type())
+	}
+	dest.Set(value)
+	return nil
+}
+
+// assignRows writes copies of rows into the destination, which is a slice, a struct or a pointer to either.
+func (ms *memSession) assignRows(sch *schema.Schema, rows []*memRow, dest reflect.Value, tContext transactionContext) error {
+	if dest.Kind() == reflect.Pointer && dest.Type().Elem().Kind() != reflect.Struct {
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		dest = dest.Elem()
+	}
+
+	switch dest.Kind() {
+	case reflect.Slice:
+		elemType := dest.Type().Elem()
+		result := reflect.MakeSlice(dest.Type(), 0, len(rows))
+		for _, row := range rows {
+			item := reflect.New(elemType).Elem()
+			if elemType.Kind() == reflect.Pointer {
+				item.Set(reflect.New(elemType.Elem()))
+			}
+
+			if err := ms.copyOut(sch, row, reflect.Indirect(item), tContext); err != nil {
+				return err
+			}
+			result = reflect.Append(result, item)
+		}
+		dest.Set(result)
+	case reflect.Pointer:
+		if len(rows) == 0 {
+			return nil
+		}
+		item := reflect.New(dest.Type().Elem())
+		if err := ms.copyOut(sch, rows[0], item.Elem(), tContext); err != nil {
+			return err
+		}
+		dest.Set(item)
+	case reflect.Struct:
+		if len(rows) == 0 {
+			return nil
+		}
+		return ms.copyOut(sch, rows[0], dest, tContext)
+	default:
+		return gorm.ErrInvalidValue
+	}
+
+	return nil
+}
+
+func (ms *memSession) create(value any, tContext transactionContext) error {
+	sch, err := ms.store.schema(value)
+	if err != nil {
+		return err
+	}
+
+	return eachModel(value, func(v reflect.Value) error {
+		return ms.createOne(sch, v, tContext)
+	})
+}
+
+func (ms *memSession) createOne(sch *schema.Schema, ptr reflect.Value, tContext transactionContext) error {
+	if err := callHook(ptr, func(h callbacks.BeforeSaveInterface) error { return h.BeforeSave(nil) }); err != nil {
+		return err
+	}
+	if err := callHook(ptr, func(h callbacks.BeforeCreateInterface) error { return h.BeforeCreate(nil) }); err != nil {
+		return err
+	}
+
+	cfg := ms.config()
+	value := ptr.Elem()
+	idField := sch.PrioritizedPrimaryField
+	if ms.primaryKey(sch, value) == nil && (idField.DataType == schema.Int || idField.DataType == schema.Uint) {
+		// Auto-increment integer IDs
+		var last int64
+		for id := range ms.rows(sch.Table) {
+			if n := reflect.ValueOf(id).Convert(reflect.TypeOf(last)).Int(); n > last {
+				last = n
+			}
+		}
+		idField.ReflectValueOf(ms.ctx, value).Set(reflect.ValueOf(last + 1).Convert(idField.FieldType))
+	}
+
+	id := ms.primaryKey(sch, value)
+	if id == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	key := memKey{table: sch.Table, id: id}
+	if ms.state.row(key) != nil {
+		return fmt.Errorf("%w: %v", gorm.ErrDuplicatedKey, id)
+	}
+
+	now := time.Now()
+	for _, column := range []string{cfg.CreatedAtColumnName, cfg.UpdatedAtColumnName} {
+		if field := sch.LookUpField(column); field != nil {
+			if v := field.ReflectValueOf(ms.ctx, value); timeOf(v) == nil {
+				setTime(v, &now)
+			}
+		}
+	}
+
+	ms.put(key, &memRow{
+		seq:   ms.store.seq.Add(1),
+		value: ms.copyIn(sch, value, tContext.Omit),
+	})
+
+	// Associated values are created and linked, as GORM does
+	for name, rel := range sch.Relationships.Relations {
+		if tContext.Omit.Has(name) {
+			continue
+		}
+
+		field := rel.Field.ReflectValueOf(ms.ctx, value)
+		if field.IsZero() {
+			continue
+		}
+		if field.Kind() != reflect.Pointer {
+			field = field.Addr()
+		}
+		if err := ms.link(sch, id, rel, field.Interface(), newTransactionContext(cfg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ms *memSession) save(value any, tContext transactionContext) (bool, error) {
+	sch, err := ms.store.schema(value)
+	if err != nil {
+		return false, err
+	}
+
+	ptr := reflect.ValueOf(value)
+	if ptr.Kind() != reflect.Pointer || ptr.Elem().Kind() != reflect.Struct {
+		return false, gorm.ErrInvalidValue
+	}
+	if ms.primaryKey(sch, ptr.Elem()) == nil {
+		return true, ms.createOne(sch, ptr, tContext)
+	}
+	if err := ms.checkPrecondition(sch, ms.state.row(memKey{table: sch.Table, id: ms.primaryKey(sch, ptr.Elem())}), ptr.Elem(), tContext); err != nil {
+		return false, err
+	}
+
+	if err := callHook(ptr, func(h callbacks.BeforeSaveInterface) error { return h.BeforeSave(nil) }); err != nil {
+		return false, err
+	}
+	if err := callHook(ptr, func(h callbacks.BeforeUpdateInterface) error { return h.BeforeUpdate(nil) }); err != nil {
+		return false, err
+	}
+
+	cfg := ms.config()
+	model := ptr.Elem()
+	now := time.Now()
+	if field := sch.LookUpField(cfg.UpdatedAtColumnName); field != nil {
+		setTime(field.ReflectValueOf(ms.ctx, model), &now)
+	}
+
+	key := memKey{table: sch.Table, id: ms.primaryKey(sch, model)}
+	row := &memRow{value: ms.copyIn(sch, model, tContext.Omit)}
+	if existing := ms.state.row(key); existing != nil {
+		row.seq = existing.seq
+		if field := sch.LookUpField(cfg.CreatedAtColumnName); field != nil && timeOf(field.ReflectValueOf(ms.ctx, row.value)) == nil {
+			field.ReflectValueOf(ms.ctx, row.value).Set(field.ReflectValueOf(ms.ctx, deepCopy(existing.value)))
+		}
+	} else {
+		row.seq = ms.store.seq.Add(1)
+		if field := sch.LookUpField(cfg.CreatedAtColumnName); field != nil {
+			if v := field.ReflectValueOf(ms.ctx, row.value); timeOf(v) == nil {
+				setTime(v, &now)
+				setTime(field.ReflectValueOf(ms.ctx, model), &now)
+			}
+		}
+	}
+
+	ms.put(key, row)
+	return true, nil
+}
+
+// checkPrecondition returns [ErrVersionConflict] if the row is in scope of the operation, but its version is not the one the value expects.
+// The version is set by the [Precondition] option, in which case it is also written into the value, or is the value's own version if that is not zero.
+func (ms *memSession) checkPrecondition(sch *schema.Schema, row *memRow, value reflect.Value, tContext transactionContext) error {
+	cfg := ms.config()
+	field := sch.LookUpField(cfg.VersionColumnName)
+	if field == nil {
+		if tContext.precondition != nil {
+			return fmt.Errorf("%w: %q is not a field of %v", ErrUnknownColumn, cfg.VersionColumnName, sch.Name)
+		}
+		return nil
+	}
+
+	if tContext.precondition != nil {
+		if err := field.Set(ms.ctx, value, uint64(*tContext.precondition)); err != nil {
+			return err
+		}
+	}
+
+	expected, isZero := field.ValueOf(ms.ctx, value)
+	if isZero || row == nil || !ms.visible(sch, row, transactionContext{}, tContext.unScoped) {
+		return nil
+	}
+
+	if version, _ := columnOf(sch, row.value, cfg.VersionColumnName); compareValues(version, expected) != 0 {
+		return fmt.Errorf("%w: %v expected at version %v", ErrVersionConflict, ms.primaryKey(sch, value), expected)
+	}
+
+	return nil
+}
+
+// visible returns true if the row is in scope of the operation: it's not soft-deleted, unless unscoped, and has the required version.
+func (ms *memSession) visible(sch *schema.Schema, row *memRow, tContext transactionContext, unscoped bool) bool {
+	cfg := ms.config()
+	if !unscoped && ms.deleted(sch, row.value) {
+		return false
+	}
+
+	if tContext.withVersion != nil {
+		version, ok := columnOf(sch, row.value, cfg.VersionColumnName)
+		if !ok || compareValues(version, *tContext.withVersion) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ms *memSession) deleted(sch *schema.Schema, value reflect.Value) bool {
+	field := sch.LookUpField(ms.config().DeletedAtColumnName)
+	if field == nil {
+		return false
+	}
+
+	v, ok := fieldByIndex(value, field.StructField.Index)
+	return ok && timeOf(v) != nil
+}
+
+func (ms *memSession) get(dest any, column string, value any, tContext transactionContext) (bool, error) {
+	sch, err := ms.store.schema(dest)
+	if err != nil {
+		return false, err
+	}
+
+	var found *memRow
+	for _, row := range ms.rows(sch.Table) {
+		if !ms.visible(sch, row, tContext, tContext.unScoped) {
+			continue
+		}
+		if v, ok := columnOf(sch, row.value, column); !ok || compareValues(v, value) != 0 {
+			continue
+		}
+
+		// First entry by primary key, as GORM First does
+		if found == nil || compareValues(ms.primaryKey(sch, row.value), ms.primaryKey(sch, found.value)) < 0 {
+			found = row
+		}
+	}
+
+	if found == nil {
+		return false, nil
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return false, gorm.ErrInvalidValue
+	}
+	return true, ms.assignRows(sch, []*memRow{found}, dv.Elem(), tContext)
+}
+
+func (ms *memSession) update(value any, id manifest.ResourceID, tContext transactionContext) (bool, error) {
+	sch, err := ms.store.schema(value)
+	if err != nil {
+		return false, err
+	}
+
+	ptr := reflect.ValueOf(value)
+	if ptr.Kind() != reflect.Pointer || ptr.Elem().Kind() != reflect.Struct {
+		return false, gorm.ErrInvalidValue
+	}
+
+	key := memKey{table: sch.Table, id: ms.primaryKey(sch, ptr.Elem())}
+	if key.id == nil {
+		key.id = ms.idValue(sch, id)
+	}
+
+	row := ms.state.row(key)
+	if err := ms.checkPrecondition(sch, row, ptr.Elem(), tContext); err != nil {
+		return false, err
+	}
+	if row == nil || !ms.visible(sch, row, tContext, tContext.unScoped) {
+		return false, nil
+	}
+
+	if err := callHook(ptr, func(h callbacks.BeforeSaveInterface) error { return h.BeforeSave(nil) }); err != nil {
+		return false, err
+	}
+	if err := callHook(ptr, func(h callbacks.BeforeUpdateInterface) error { return h.BeforeUpdate(nil) }); err != nil {
+		return false, err
+	}
+
+	cfg := ms.config()
+	now := time.Now()
+	if field := sch.LookUpField(cfg.UpdatedAtColumnName); field != nil {
+		setTime(field.ReflectValueOf(ms.ctx, ptr.Elem()), &now)
+	}
+
+	// Only non-zero fields are updated, as GORM Updates does with a struct
+	updated := deepCopy(row.value)
+	for _, name := range sch.DBNames {
+		field := sch.FieldsByDBName[name]
+		if field.PrimaryKey || !field.Updatable || tContext.Omit.Has(field.Name) || tContext.Omit.Has(field.DBName) {
+			continue
+		}
+
+		if src, ok := fieldByIndex(ptr.Elem(), field.StructField.Index); ok && !src.IsZero() {
+			field.ReflectValueOf(ms.ctx, updated).Set(deepCopy(src))
+		}
+	}
+
+	ms.put(key, &memRow{seq: row.seq, value: updated})
+	return true, nil
+}
+
+func (ms *memSession) delete(value any, id manifest.ResourceID, version manifest.Version, tContext transactionContext) (bool, error) {
+	sch, err := ms.store.schema(value)
+	if err != nil {
+		return false, err
+	}
+
+	return ms.deleteKey(sch, memKey{table: sch.Table, id: ms.idValue(sch, id)}, value, version, tContext)
+}
+
+// deleteKey deletes the row with the key, if it is in scope of the operation and has the given version, unless version is zero.
+func (ms *memSession) deleteKey(sch *schema.Schema, key memKey, value any, version manifest.Version, tContext transactionContext) (bool, error) {
+	row := ms.state.row(key)
+	if row == nil || !ms.visible(sch, row, tContext, tContext.unScoped) {
+		return false, nil
+	}
+	if version > 0 {
+		if v, ok := columnOf(sch, row.value, ms.config().VersionColumnName); !ok || compareValues(v, version) != 0 {
+			return false, nil
+		}
+	}
+
+	if ptr := reflect.ValueOf(value); ptr.Kind() == reflect.Pointer && !ptr.IsNil() {
+		if err := callHook(ptr, func(h callbacks.BeforeDeleteInterface) error { return h.BeforeDelete(nil) }); err != nil {
+			return false, err
+		}
+	}
+
+	field := sch.LookUpField(ms.config().DeletedAtColumnName)
+	if tContext.unScoped || field == nil {
+		ms.put(key, nil)
+		return true, nil
+	}
+
+	now := time.Now()
+	deleted := deepCopy(row.value)
+	setTime(field.ReflectValueOf(ms.ctx, deleted), &now)
+	ms.put(key, &memRow{seq: row.seq, value: deleted})
+
+	return true, nil
+}
+
+func (ms *memSession) restore(model any, id manifest.ResourceID, tContext transactionContext) (bool, error) {
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return false, err
+	}
+
+	return ms.restoreKey(sch, memKey{table: sch.Table, id: ms.idValue(sch, id)}, tContext)
+}
+
+// restoreKey restores the soft-deleted row with the key, if it is in scope of the operation.
+func (ms *memSession) restoreKey(sch *schema.Schema, key memKey, tContext transactionContext) (bool, error) {
+	cfg := ms.config()
+	row := ms.state.row(key)
+	if row == nil || !ms.deleted(sch, row.value) || !ms.visible(sch, row, tContext, true) {
+		return false, nil
+	}
+
+	now := time.Now()
+	restored := deepCopy(row.value)
+	setTime(sch.LookUpField(cfg.DeletedAtColumnName).ReflectValueOf(ms.ctx, restored), nil)
+	if field := sch.LookUpField(cfg.UpdatedAtColumnName); field != nil {
+		setTime(field.ReflectValueOf(ms.ctx, restored), &now)
+	}
+
+	ms.put(key, &memRow{seq: row.seq, value: restored})
+	return true, nil
+}
+
+func (ms *memSession) createMany(values any, tContext transactionContext) (created int64, results []error, err error) {
+	sch, err := ms.store.schema(values)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := reflect.Indirect(reflect.ValueOf(values))
+	if items.Kind() != reflect.Slice {
+		return 0, nil, gorm.ErrInvalidValue
+	}
+
+	results = make([]error, items.Len())
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i)
+		if item.Kind() != reflect.Pointer {
+			item = item.Addr()
+		}
+		if results[i] = ms.createOne(sch, item, tContext); results[i] == nil {
+			created++
+		}
+	}
+
+	return created, results, nil
+}
+
+func (ms *memSession) deleteMany(model any, query manifest.SearchQuery, tContext transactionContext) (affected int64, err error) {
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _, err := ms.query(sch, tContext, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		existed, err := ms.deleteKey(sch, memKey{table: sch.Table, id: ms.primaryKey(sch, row.value)}, model, 0, tContext)
+		if err != nil {
+			return affected, err
+		}
+		if existed {
+			affected++
+		}
+	}
+
+	return affected, nil
+}
+
+func (ms *memSession) restoreMany(model any, query manifest.SearchQuery, tContext transactionContext) (affected int64, err error) {
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return 0, err
+	}
+
+	tContext.unScoped = true
+	rows, _, err := ms.query(sch, tContext, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		restored, err := ms.restoreKey(sch, memKey{table: sch.Table, id: ms.primaryKey(sch, row.value)}, tContext)
+		if err != nil {
+			return affected, err
+		}
+		if restored {
+			affected++
+		}
+	}
+
+	return affected, nil
+}
+
+func (ms *memSession) patchLabels(model any, query manifest.SearchQuery, patch LabelPatch, tContext transactionContext) (affected int64, err error) {
+	if patch.Empty() {
+		return 0, nil
+	}
+
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return 0, err
+	}
+
+	cfg := ms.config()
+	labelsField := sch.LookUpField(cfg.LabelsColumnName)
+	if labelsField == nil {
+		return 0, fmt.Errorf("%w: %q is not a field of %v", ErrUnknownColumn, cfg.LabelsColumnName, sch.Name)
+	}
+
+	rows, _, err := ms.query(sch, tContext, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		updated := deepCopy(row.value)
+		labels := manifest.Labels{}
+		for k, v := range labelsOf(sch, cfg, updated) {
+			labels[k] = v
+		}
+		for k, v := range patch.Add {
+			if !labels.Has(k) {
+				labels[k] = v
+			}
+		}
+		for k, v := range patch.Set {
+			labels[k] = v
+		}
+		for _, k := range patch.Remove {
+			delete(labels, k)
+		}
+		labelsField.ReflectValueOf(ms.ctx, updated).Set(reflect.ValueOf(labels))
+
+		if field := sch.LookUpField(cfg.VersionColumnName); field != nil {
+			if version := field.ReflectValueOf(ms.ctx, updated); version.CanInt() {
+				version.SetInt(version.Int() + 1)
+			} else {
+				version.SetUint(version.Uint() + 1)
+			}
+		}
+		if field := sch.LookUpField(cfg.UpdatedAtColumnName); field != nil {
+			setTime(field.ReflectValueOf(ms.ctx, updated), &now)
+		}
+
+		ms.put(memKey{table: sch.Table, id: ms.primaryKey(sch, row.value)}, &memRow{seq: row.seq, value: updated})
+		affected++
+	}
+
+	return affected, nil
+}
+
+func (ms *memSession) find(dest any, query manifest.SearchQuery, tContext transactionContext) (int64, error) {
+	sch, err := ms.store.schema(dest)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, total, err := ms.query(sch, tContext, query, nil)
+	if err != nil {
+		return total, err
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return total, gorm.ErrInvalidValue
+	}
+	if err := ms.assignRows(sch, rows, dv.Elem(), tContext); err != nil {
+		return total, err
+	}
+
+	if tContext.nextToken != nil {
+		*tContext.nextToken, err = ms.nextContinueToken(sch, rows, query)
+	}
+
+	return total, err
+}
+
+func (ms *memSession) findNames(model any, query manifest.SearchQuery, tContext transactionContext) (manifest.StringSet, error) {
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _, err := ms.query(sch, tContext, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(manifest.StringSet, len(rows))
+	for _, row := range rows {
+		if name, ok := columnOf(sch, row.value, ms.config().NameColumnName); ok {
+			result[fmt.Sprint(name)] = struct{}{}
+		}
+	}
+
+	return result, nil
+}
+
+// findLabels returns label keys of the model, or values of the label with given key.
+// Search query name is matched against the keys or the values, and limits apply to the distinct results.
+func (ms *memSession) findLabels(model any, key string, values bool, query manifest.SearchQuery, tContext transactionContext) (manifest.StringSet, error) {
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return nil, err
+	}
+
+	found := manifest.StringSet{}
+	for _, row := range ms.rows(sch.Table) {
+		if !ms.visible(sch, row, tContext, tContext.unScoped) {
+			continue
+		}
+
+		labels := labelsOf(sch, ms.config(), row.value)
+		for k, v := range labels {
+			if values && k != key {
+				continue
+			}
+
+			item := k
+			if values {
+				item = v
+			}
+			if matchesName(item, query.Name) {
+				found[item] = struct{}{}
+			}
+		}
+	}
+
+	items := found.Slice()
+	slices.Sort(items)
+	items = limitSlice(items, query)
+
+	return manifest.NewStringSet(items...), nil
+}
+
+// facetRows returns rows of the model that match search query, without sorting and pagination, as facets are counted over them.
+func (ms *memSession) facetRows(model any, query manifest.SearchQuery, tContext transactionContext) (*schema.Schema, []*memRow, error) {
+	sch, err := ms.store.schema(model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query.Sort = nil
+	query.Continue = ""
+	query.Offset = 0
+	query.Limit = 0
+	tContext.nextToken = nil
+	rows, _, err := ms.query(sch, tContext, query, nil)
+
+	return sch, rows, err
+}
+
+func (ms *memSession) countLabelValues(model any, keys []string, query manifest.SearchQuery, tContext transactionContext) ([]manifest.FacetCount, error) {
+	if err := validateFacetKeys(keys); err != nil {
+		return nil, err
+	}
+
+	sch, rows, err := ms.facetRows(model, query, tContext)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]*manifest.FacetCount{}
+	for _, row := range rows {
+		labels := labelsOf(sch, ms.config(), row.value)
+		facet := manifest.Labels{}
+		for _, key := range keys {
+			if value, ok := labels[key]; ok {
+				facet[key] = value
+			}
+		}
+		if len(facet) == 0 {
+			continue
+		}
+
+		var sb strings.Builder
+		facet.Format(&sb)
+		id := sb.String()
+		if _, ok := counts[id]; !ok {
+			counts[id] = &manifest.FacetCount{Labels: facet}
+		}
+		counts[id].Count++
+	}
+
+	result := make([]manifest.FacetCount, 0, len(counts))
+	for _, facet := range counts {
+		result = append(result, *facet)
+	}
+
+	// Most common first, ties ordered by values of the keys, with missing values last as NULLs are in the DB
+	slices.SortFunc(result, func(a, b manifest.FacetCount) int {
+		if a.Count != b.Count {
+			return compareValues(b.Count, a.Count)
+		}
+		for _, key := range keys {
+			av, aok := a.Labels[key]
+			bv, bok := b.Labels[key]
+			switch {
+			case aok && !bok:
+				return -1
+			case !aok && bok:
+				return 1
+			case av != bv:
+				return strings.Compare(av, bv)
+			}
+		}
+		return 0
+	})
+
+	return limitSlice(result, query), nil
+}
+
+func (ms *memSession) countByTime(model any, bucket time.Duration, query manifest.SearchQuery, tContext transactionContext) ([]manifest.TimeBucket, error) {
+	if bucket < time.Second {
+		return nil, fmt.Errorf("%w: time bucket %v is shorter than a second", ErrInvalidFacet, bucket)
+	}
+
+	column, err := ms.config().TimeColumn(query.TimeField)
+	if err != nil {
+		return nil, err
+	}
+
+	// Soft-deleted entries must be included to count them by the time of deletion
+	if query.TimeField == manifest.TimeFieldDeleted {
+		tContext.unScoped = true
+	}
+	sch, rows, err := ms.facetRows(model, query, tContext)
+	if err != nil {
+		return nil, err
+	}
+	field := sch.LookUpField(column)
+	if field == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownColumn, column)
+	}
+
+	seconds := int64(bucket / time.Second)
+	counts := map[int64]int64{}
+	for _, row := range rows {
+		v, _ := fieldByIndex(row.value, field.StructField.Index)
+		t := timeOf(v)
+		if t == nil {
+			continue
+		}
+
+		counts[t.Unix()/seconds*seconds]++
+	}
+
+	result := make([]manifest.TimeBucket, 0, len(counts))
+	for start, count := range counts {
+		result = append(result, manifest.TimeBucket{Start: time.Unix(start, 0).UTC(), Count: count})
+	}
+	slices.SortFunc(result, func(a, b manifest.TimeBucket) int { return a.Start.Compare(b.Start) })
+
+	return limitSlice(result, query), nil
+}
+
+func limitSlice[T any](items []T, query manifest.SearchQuery) []T {
+	if query.Offset > 0 {
+		items = items[min(int(query.Offset), len(items)):]
+	}
+	if query.Limit > 0 {
+		items = items[:min(int(query.Limit), len(items))]
+	}
+
+	return items
+}
+
+func (ms *memSession) relation(owner any, link string) (*schema.Schema, *schema.Relationship, any, error) {
+	sch, err := ms.store.schema(owner)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rel, ok := sch.Relationships.Relations[link]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %s", gorm.ErrUnsupportedRelation, link)
+	}
+
+	ov := reflect.Indirect(reflect.ValueOf(owner))
+	if ov.Kind() != reflect.Struct {
+		return nil, nil, nil, gorm.ErrInvalidValue
+	}
+	id := ms.primaryKey(sch, ov)
+	if id == nil {
+		return nil, nil, nil, gorm.ErrPrimaryKeyRequired
+	}
+
+	return sch, rel, id, nil
+}
+
+func (ms *memSession) linkedIDs(sch *schema.Schema, owner reflect.Value, link string) []any {
+	links := ms.state.links[memLinkKey{table: sch.Table, owner: ms.primaryKey(sch, owner), link: link}]
+	if links == nil {
+		return []any{}
+	}
+
+	return links.ids
+}
+
+func (ms *memSession) findLinked(dest any, link string, owner any, query manifest.SearchQuery, tContext transactionContext) (int64, error) {
+	sch, rel, _, err := ms.relation(owner, link)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := ms.linkedIDs(sch, reflect.Indirect(reflect.ValueOf(owner)), link)
+	rows, total, err := ms.query(rel.FieldSchema, tContext, query, ids)
+	if err != nil {
+		return total, err
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return total, gorm.ErrInvalidValue
+	}
+
+	return total, ms.assignRows(rel.FieldSchema, rows, dv.Elem(), tContext)
+}
+
+func (ms *memSession) addLinked(value any, link string, owner any, tContext transactionContext) error {
+	sch, rel, id, err := ms.relation(owner, link)
+	if err != nil {
+		return err
+	}
+
+	if err := ms.link(sch, id, rel, value, tContext); err != nil {
+		return err
+	}
+
+	// Associated values are appended to the owner, as GORM does
+	field := rel.Field.ReflectValueOf(ms.ctx, reflect.Indirect(reflect.ValueOf(owner)))
+	return eachModel(value, func(v reflect.Value) error {
+		switch {
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Pointer:
+			field.Set(reflect.Append(field, v))
+		case field.Kind() == reflect.Slice:
+			field.Set(reflect.Append(field, v.Elem()))
+		case field.Kind() == reflect.Pointer:
+			field.Set(v)
+		default:
+			field.Set(v.Elem())
+		}
+		return nil
+	})
+}
+
+// link associates values with the owner, creating values that are not in the store yet.
+func (ms *memSession) link(sch *schema.Schema, ownerID any, rel *schema.Relationship, value any, tContext transactionContext) error {
+	key := memLinkKey{table: sch.Table, owner: ownerID, link: rel.Name}
+	var ids []any
+	if links := ms.state.links[key]; links != nil {
+		ids = slices.Clone(links.ids)
+	}
+
+	err := eachModel(value, func(v reflect.Value) error {
+		id := ms.primaryKey(rel.FieldSchema, v.Elem())
+		if id == nil || ms.state.row(memKey{table: rel.FieldSchema.Table, id: id}) == nil {
+			if err := ms.createOne(rel.FieldSchema, v, tContext); err != nil {
+				return err
+			}
+			id = ms.primaryKey(rel.FieldSchema, v.Elem())
+		}
+
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ms.putLinks(key, &memLinks{ids: ids})
+	return nil
+}
+
+func (ms *memSession) removeLinked(value any, link string, owner any) error {
+	sch, rel, id, err := ms.relation(owner, link)
+	if err != nil {
+		return err
+	}
+
+	key := memLinkKey{table: sch.Table, owner: id, link: link}
+	links := ms.state.links[key]
+	if links == nil {
+		return nil
+	}
+
+	ids := slices.Clone(links.ids)
+	err = eachModel(value, func(v reflect.Value) error {
+		if id := ms.primaryKey(rel.FieldSchema, v.Elem()); id != nil {
+			ids = slices.DeleteFunc(ids, func(e any) bool { return e == id })
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ms.putLinks(key, &memLinks{ids: ids})
+	return nil
+}
+
+func (ms *memSession) clearLinked(link string, owner any) error {
+	sch, _, id, err := ms.relation(owner, link)
+	if err != nil {
+		return err
+	}
+
+	ms.putLinks(memLinkKey{table: sch.Table, owner: id, link: link}, nil)
+	return nil
+}
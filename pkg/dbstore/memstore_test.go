@@ -0,0 +1,469 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore interface {
+	dbstore.TransactionalStore
+	dbstore.LabelStore
+	dbstore.AssociationStore
+	dbstore.BulkStore
+	dbstore.FacetStore
+}
+
+// testStores are implementations of the store that are expected to behave identically
+var testStores = map[string]func(t *testing.T, given []Pet) (testStore, func()){
+	"db": func(t *testing.T, given []Pet) (testStore, func()) {
+		return makeTestStore(t, given)
+	},
+	"mem": func(t *testing.T, given []Pet) (testStore, func()) {
+		return makeTestMemStore(t, given), func() {}
+	},
+}
+
+func makeTestMemStore(t *testing.T, given []Pet) *dbstore.MemStore {
+	store := dbstore.NewMemStore(dbstore.ManifestModel)
+	for _, g := range given {
+		require.NoError(t, store.Create(context.TODO(), &g))
+	}
+
+	return store
+}
+
+func TestStore_Lifecycle(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, nil)
+			defer cleanup()
+			ctx := context.TODO()
+
+			pet := makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"}))
+			require.NoError(t, store.Create(ctx, &pet))
+			require.NotEmpty(t, pet.UID)
+			require.Equal(t, manifest.Version(1), pet.Version)
+			require.NotNil(t, pet.CreatedAt)
+
+			var got Pet
+			exists, err := store.GetByUID(ctx, &got, pet.UID)
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.Equal(t, pet.Name, got.Name)
+			require.Equal(t, pet.Labels, got.Labels)
+
+			// Only non-zero fields are updated
+			exists, err = store.Update(ctx, &Pet{ObjectMeta: manifest.ObjectMeta{UID: pet.UID, Version: got.Version}, Spec: PetSpec{CustomName: "Mr. Fluffy"}}, pet.UID)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			exists, err = store.GetByName(ctx, &got, "fluffy")
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.Equal(t, "Mr. Fluffy", got.Spec.CustomName)
+			require.Equal(t, manifest.Labels{"kind": "cat"}, got.Labels)
+			require.Equal(t, manifest.Version(2), got.Version)
+
+			// Version must match to delete
+			existed, err := store.Delete(ctx, &Pet{}, pet.UID, 1)
+			require.NoError(t, err)
+			require.False(t, existed)
+
+			existed, err = store.Delete(ctx, &Pet{}, pet.UID, 2)
+			require.NoError(t, err)
+			require.True(t, existed)
+
+			exists, err = store.GetByUID(ctx, &Pet{}, pet.UID)
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			var deleted Pet
+			exists, err = store.GetByUID(ctx, &deleted, pet.UID, dbstore.IncludeDeleted())
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.NotNil(t, deleted.DeletedAt)
+
+			existed, err = store.Restore(ctx, &Pet{}, pet.UID)
+			require.NoError(t, err)
+			require.True(t, existed)
+
+			// Restoring non-deleted entry is not an error
+			existed, err = store.Restore(ctx, &Pet{}, pet.UID)
+			require.NoError(t, err)
+			require.False(t, existed)
+
+			exists, err = store.GetByUID(ctx, &got, pet.UID)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			existed, err = store.Delete(ctx, &Pet{}, pet.UID, 0, dbstore.IncludeDeleted())
+			require.NoError(t, err)
+			require.True(t, existed)
+
+			exists, err = store.GetByUID(ctx, &Pet{}, pet.UID, dbstore.IncludeDeleted())
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			existed, err = store.Delete(ctx, &Pet{}, pet.UID, 0)
+			require.NoError(t, err)
+			require.False(t, existed)
+		})
+	}
+}
+
+func TestStore_CreateOrUpdate(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, nil)
+			defer cleanup()
+			ctx := context.TODO()
+
+			pet := makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"}))
+			exists, err := store.CreateOrUpdate(ctx, &pet)
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.NotEmpty(t, pet.UID)
+
+			// All fields are replaced
+			pet.Labels = nil
+			pet.Spec.CustomName = "Mr. Fluffy"
+			exists, err = store.CreateOrUpdate(ctx, &pet)
+			require.NoError(t, err)
+			require.True(t, exists)
+
+			var got Pet
+			exists, err = store.GetByUID(ctx, &got, pet.UID)
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.Equal(t, "Mr. Fluffy", got.Spec.CustomName)
+			require.Empty(t, got.Labels)
+			require.Equal(t, manifest.Version(2), got.Version)
+			require.NotNil(t, got.CreatedAt)
+		})
+	}
+}
+
+func TestStore_VersionConflict(t *testing.T) {
+	update := func(ctx context.Context, store testStore, pet *Pet, options ...dbstore.Option) (bool, error) {
+		return store.Update(ctx, pet, pet.UID, options...)
+	}
+	createOrUpdate := func(ctx context.Context, store testStore, pet *Pet, options ...dbstore.Option) (bool, error) {
+		return store.CreateOrUpdate(ctx, pet, options...)
+	}
+
+	testCases := map[string]struct {
+		write   func(context.Context, testStore, *Pet, ...dbstore.Option) (bool, error)
+		version manifest.Version
+		options []dbstore.Option
+
+		expectError   error
+		expectExists  bool
+		expectVersion manifest.Version
+	}{
+		"update-current": {
+			write:         update,
+			version:       2,
+			expectExists:  true,
+			expectVersion: 3,
+		},
+		"update-stale": {
+			write:         update,
+			version:       1,
+			expectError:   dbstore.ErrVersionConflict,
+			expectVersion: 2,
+		},
+		"update-any-version": {
+			write:        update,
+			version:      0,
+			expectExists: true,
+		},
+		"update-precondition": {
+			write:         update,
+			options:       []dbstore.Option{dbstore.Precondition(2)},
+			expectExists:  true,
+			expectVersion: 3,
+		},
+		"update-precondition-stale": {
+			write:         update,
+			version:       2,
+			options:       []dbstore.Option{dbstore.Precondition(1)},
+			expectError:   dbstore.ErrVersionConflict,
+			expectVersion: 2,
+		},
+		"save-current": {
+			write:         createOrUpdate,
+			version:       2,
+			expectExists:  true,
+			expectVersion: 3,
+		},
+		"save-stale": {
+			write:         createOrUpdate,
+			version:       1,
+			expectError:   dbstore.ErrVersionConflict,
+			expectVersion: 2,
+		},
+		"save-precondition-stale": {
+			write:         createOrUpdate,
+			version:       2,
+			options:       []dbstore.Option{dbstore.Precondition(3)},
+			expectError:   dbstore.ErrVersionConflict,
+			expectVersion: 2,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		for storeName, makeStore := range testStores {
+			t.Run(name+"/"+storeName, func(t *testing.T) {
+				store, cleanup := makeStore(t, nil)
+				defer cleanup()
+				ctx := context.TODO()
+
+				pet := makePet("fluffy", "Fluffy")
+				require.NoError(t, store.Create(ctx, &pet))
+				pet.Spec.CustomName = "Mr. Fluffy"
+				_, err := store.Update(ctx, &pet, pet.UID)
+				require.NoError(t, err)
+
+				value := makePet("fluffy", "Sir Fluffy", withVersion(test.version))
+				value.UID = pet.UID
+				exists, err := test.write(ctx, store, &value, test.options...)
+				if test.expectError != nil {
+					require.ErrorIs(t, err, test.expectError)
+
+					var got Pet
+					_, err = store.GetByUID(ctx, &got, pet.UID)
+					require.NoError(t, err)
+					require.Equal(t, "Mr. Fluffy", got.Spec.CustomName)
+					require.Equal(t, test.expectVersion, got.Version)
+					return
+				}
+
+				require.NoError(t, err)
+				require.Equal(t, test.expectExists, exists)
+				if test.expectVersion != 0 {
+					require.Equal(t, test.expectVersion, value.Version)
+				}
+			})
+		}
+	}
+}
+
+func TestStore_Linked(t *testing.T) {
+	for storeName, makeStore := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store, cleanup := makeStore(t, nil)
+			defer cleanup()
+			ctx := context.TODO()
+
+			pet := makePet("fluffy", "Fluffy")
+			require.NoError(t, store.Create(ctx, &pet))
+
+			toys := []Toy{{Spec: ToySpec{"ball"}}, {Spec: ToySpec{"mouse"}}, {Spec: ToySpec{"yarn"}}}
+			for i := range toys {
+				require.NoError(t, store.AddLinked(ctx, &toys[i], "Toys", &pet))
+				require.NotZero(t, toys[i].ID)
+			}
+
+			var got []Toy
+			total, err := store.FindLinked(ctx, &got, "Toys", &pet, manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Equal(t, int64(3), total)
+			require.ElementsMatch(t, toys, got)
+
+			var expanded Pet
+			exists, err := store.GetByUID(ctx, &expanded, pet.UID, dbstore.Expand("Toys", manifest.SearchQuery{}))
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.ElementsMatch(t, toys, expanded.Spec.Toys)
+
+			// Associations are not loaded unless expanded
+			var notExpanded Pet
+			exists, err = store.GetByUID(ctx, &notExpanded, pet.UID)
+			require.NoError(t, err)
+			require.True(t, exists)
+			require.Empty(t, notExpanded.Spec.Toys)
+
+			require.NoError(t, store.RemoveLinked(ctx, &toys[1], "Toys", &pet))
+			total, err = store.FindLinked(ctx, &got, "Toys", &pet, manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Equal(t, int64(2), total)
+			require.ElementsMatch(t, []Toy{toys[0], toys[2]}, got)
+
+			require.NoError(t, store.ClearLinked(ctx, "Toys", &pet))
+			total, err = store.FindLinked(ctx, &got, "Toys", &pet, manifest.SearchQuery{})
+			require.NoError(t, err)
+			require.Zero(t, total)
+			require.Empty(t, got)
+		})
+	}
+}
+
+func TestMemStore_CopiesValues(t *testing.T) {
+	store := makeTestMemStore(t, nil)
+	ctx := context.TODO()
+
+	pet := makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"}))
+	require.NoError(t, store.Create(ctx, &pet))
+
+	// Modifying created value does not affect the stored one
+	pet.Labels["kind"] = "dog"
+
+	var got Pet
+	_, err := store.GetByUID(ctx, &got, pet.UID)
+	require.NoError(t, err)
+	require.Equal(t, "cat", got.Labels["kind"])
+
+	// Nor does modifying a returned value
+	got.Labels["kind"] = "dog"
+
+	var again []Pet
+	_, err = store.Find(ctx, &again, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Len(t, again, 1)
+	require.Equal(t, "cat", again[0].Labels["kind"])
+}
+
+func TestMemStore_Transaction(t *testing.T) {
+	ctx := context.TODO()
+	store := makeTestMemStore(t, []Pet{makePet("pet-1", "a")})
+
+	var existing Pet
+	_, err := store.GetByName(ctx, &existing, "pet-1")
+	require.NoError(t, err)
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	created := makePet("pet-2", "b")
+	require.NoError(t, tx.Create(&created))
+
+	// Changes are visible within the transaction only
+	exists, err := tx.GetByUID(&Pet{}, created.UID)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = store.GetByUID(ctx, &Pet{}, created.UID)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Transaction observes a snapshot of the store
+	require.NoError(t, store.Create(ctx, &Pet{ObjectMeta: manifest.ObjectMeta{Name: "pet-3"}}))
+	exists, err = tx.GetByName(&Pet{}, "pet-3")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, tx.Commit())
+
+	var got []Pet
+	total, err := store.Find(ctx, &got, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), total)
+	require.Equal(t, []string{"pet-1", "pet-2", "pet-3"}, petNames(got))
+
+	// Committed transaction can not be committed again, and rollback does nothing
+	require.Error(t, tx.Commit())
+	tx.Rollback()
+	total, err = store.Find(ctx, &got, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), total)
+}
+
+func TestMemStore_TransactionRollback(t *testing.T) {
+	ctx := context.TODO()
+	store := makeTestMemStore(t, []Pet{makePet("pet-1", "a")})
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Create(&Pet{ObjectMeta: manifest.ObjectMeta{Name: "pet-2"}}))
+	var existing Pet
+	_, err = tx.GetByName(&existing, "pet-1")
+	require.NoError(t, err)
+	_, err = tx.Delete(&Pet{}, existing.UID, 0)
+	require.NoError(t, err)
+	tx.Rollback()
+
+	var got []Pet
+	_, err = store.Find(ctx, &got, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pet-1"}, petNames(got))
+}
+
+func TestMemStore_TransactionConflict(t *testing.T) {
+	ctx := context.TODO()
+	store := makeTestMemStore(t, []Pet{makePet("pet-1", "a")})
+
+	var pet Pet
+	_, err := store.GetByName(ctx, &pet, "pet-1")
+	require.NoError(t, err)
+
+	tx1, err := store.Begin(ctx)
+	require.NoError(t, err)
+	defer tx1.Rollback()
+	tx2, err := store.Begin(ctx)
+	require.NoError(t, err)
+	defer tx2.Rollback()
+
+	exists, err := tx1.Update(&Pet{ObjectMeta: manifest.ObjectMeta{UID: pet.UID}, Spec: PetSpec{CustomName: "first"}}, pet.UID)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = tx2.Update(&Pet{ObjectMeta: manifest.ObjectMeta{UID: pet.UID}, Spec: PetSpec{CustomName: "second"}}, pet.UID)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// First committer wins
+	require.NoError(t, tx1.Commit())
+	require.ErrorIs(t, tx2.Commit(), dbstore.ErrTransactionConflict)
+
+	var got Pet
+	_, err = store.GetByUID(ctx, &got, pet.UID)
+	require.NoError(t, err)
+	require.Equal(t, "first", got.Spec.CustomName)
+}
+
+func TestMemStore_FindFullText(t *testing.T) {
+	store := makeTestMemStore(t, []Pet{
+		makePet("fluffy", "cat", withLabels(manifest.Labels{"color": "white"})),
+		makePet("rex", "dog", withLabels(manifest.Labels{"color": "black"})),
+		makePet("white-fang", "wolf", withLabels(manifest.Labels{"color": "white"})),
+	})
+
+	testCases := map[string]struct {
+		givenQuery manifest.SearchQuery
+		expect     []string
+	}{
+		"name-prefix": {
+			givenQuery: manifest.SearchQuery{Text: "flu"},
+			expect:     []string{"fluffy"},
+		},
+		"label-value-ranked": {
+			givenQuery: manifest.SearchQuery{Text: "white"},
+			expect:     []string{"white-fang", "fluffy"},
+		},
+		"all-words": {
+			givenQuery: manifest.SearchQuery{Text: "white fang"},
+			expect:     []string{"white-fang"},
+		},
+		"no-match": {
+			givenQuery: manifest.SearchQuery{Text: "cat"},
+			expect:     []string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			var got []Pet
+			total, err := store.Find(context.TODO(), &got, test.givenQuery)
+			require.NoError(t, err)
+			require.Equal(t, test.expect, petNames(got))
+			require.Equal(t, int64(len(test.expect)), total)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package dbstore
+
+import (
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+)
+
+type memStoreTransaction struct {
+	session *memSession
+
+	done bool
+}
+
+func (tx *memStoreTransaction) Rollback() {
+	tx.done = true
+}
+
+// Commit applies changes of the transaction to the store, unless any of the modified entries has been modified by another transaction since it begun.
+func (tx *memStoreTransaction) Commit() error {
+	if tx.done {
+		return gorm.ErrInvalidTransaction
+	}
+	tx.done = true
+
+	store := tx.session.store
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for key, original := range tx.session.written {
+		if store.state.row(key) != original {
+			return ErrTransactionConflict
+		}
+	}
+	for key, original := range tx.session.writtenLinks {
+		if store.state.links[key] != original {
+			return ErrTransactionConflict
+		}
+	}
+
+	for key := range tx.session.written {
+		store.state.setRow(key, tx.session.state.row(key))
+	}
+	for key := range tx.session.writtenLinks {
+		store.state.setLinks(key, tx.session.state.links[key])
+	}
+
+	return nil
+}
+
+func (tx *memStoreTransaction) check() error {
+	if tx.done {
+		return gorm.ErrInvalidTransaction
+	}
+	return tx.session.ctx.Err()
+}
+
+func (tx *memStoreTransaction) options(value any, options ...Option) transactionContext {
+	return resolveOptions(tx.session.store.config, value, options...)
+}
+
+func (tx *memStoreTransaction) Create(value any, options ...Option) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	return tx.session.create(value, tx.options(value, options...))
+}
+
+func (tx *memStoreTransaction) Update(newValue any, id manifest.ResourceID, options ...Option) (exists bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.update(newValue, id, tx.options(newValue, options...))
+}
+
+func (tx *memStoreTransaction) CreateOrUpdate(newValue any, options ...Option) (exists bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.save(newValue, tx.options(newValue, options...))
+}
+
+func (tx *memStoreTransaction) GetByUID(dest any, id manifest.ResourceID, options ...Option) (bool, error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.get(dest, tx.session.config().IDColumnName, id, tx.options(dest, options...))
+}
+
+func (tx *memStoreTransaction) GetByName(dest any, name manifest.ResourceName, options ...Option) (bool, error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.get(dest, tx.session.config().NameColumnName, name, tx.options(dest, options...))
+}
+
+func (tx *memStoreTransaction) Delete(value any, id manifest.ResourceID, version manifest.Version, options ...Option) (existed bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.delete(value, id, version, tx.options(value, options...))
+}
+
+func (tx *memStoreTransaction) Restore(model any, id manifest.ResourceID, options ...Option) (existed bool, err error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	return tx.session.restore(model, id, tx.options(nil, options...))
+}
+
+func (tx *memStoreTransaction) CreateMany(values any, options ...Option) (created int64, results []error, err error) {
+	if err := tx.check(); err != nil {
+		return 0, nil, err
+	}
+	return tx.session.createMany(values, tx.options(values, options...))
+}
+
+func (tx *memStoreTransaction) DeleteMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.session.deleteMany(model, searchQuery, tx.options(model, options...))
+}
+
+func (tx *memStoreTransaction) RestoreMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.session.restoreMany(model, searchQuery, tx.options(model, options...))
+}
+
+func (tx *memStoreTransaction) PatchLabels(model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.session.patchLabels(model, searchQuery, patch, tx.options(model, options...))
+}
+
+func (tx *memStoreTransaction) AddLinked(value any, link string, owner any, options ...Option) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	return tx.session.addLinked(value, link, owner, tx.options(value, options...))
+}
+
+func (tx *memStoreTransaction) RemoveLinked(value any, link string, owner any) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	return tx.session.removeLinked(value, link, owner)
+}
+
+func (tx *memStoreTransaction) ClearLinked(link string, owner any) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	return tx.session.clearLinked(link, owner)
+}
@@ -0,0 +1,622 @@
+package dbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrInvalidMigration error is returned by [NewMigrationManager] when migrations have no version, duplicate versions or no Up function.
+	ErrInvalidMigration = errors.New("invalid migration")
+
+	// ErrUnknownMigration error is returned when migrating to a version that is not registered, or when the DB has migrations applied that are not registered.
+	ErrUnknownMigration = errors.New("unknown migration")
+
+	// ErrIrreversibleMigration error is returned when rolling back a migration that has no Down function.
+	ErrIrreversibleMigration = errors.New("migration can not be rolled back")
+
+	// ErrDryRunNotSupported error is returned by [MigrationManager.DryRun] for DBs that can not roll back schema changes, such as MySQL.
+	ErrDryRunNotSupported = errors.New("dry-run is not supported by the DB")
+
+	// ErrMigrationLockLost error is returned when the migration lock is taken over by another manager while migrating,
+	// as it has not been renewed in time by a migration transaction.
+	ErrMigrationLockLost = errors.New("migration lock is lost")
+)
+
+const (
+	// migrationLockID is the ID of the only row of the migration lock table.
+	migrationLockID = 1
+
+	// defaultMigrationLockTimeout is the time a lock is not renewed for after which it is considered abandoned, unless set by [MigrationManager.LockTimeout].
+	defaultMigrationLockTimeout = time.Minute
+	// defaultMigrationLockPollInterval is how often a locked migration is checked for release, unless set by [MigrationManager.LockPollInterval].
+	defaultMigrationLockPollInterval = time.Second
+
+	// migrationAdvisoryLockKey is the key of the Postgres advisory lock guarding migrations.
+	migrationAdvisoryLockKey int64 = 0x77797264 // "wyrd"
+	// migrationAdvisoryLockName is the name of the MySQL named lock guarding migrations.
+	migrationAdvisoryLockName = "wyrd_migrations"
+)
+
+// Migration is a versioned change of the DB schema.
+type Migration struct {
+	// Version orders migrations: they are applied in increasing order of versions, and rolled back in reverse.
+	Version uint64
+	// Name describes the migration.
+	Name string
+
+	// Up applies the migration within a transaction.
+	Up func(tx *gorm.DB) error
+	// Down reverts the migration within a transaction. Migrations without Down can not be rolled back.
+	Down func(tx *gorm.DB) error
+}
+
+// MigrationRecord is a row of the migrations table, recording a migration applied to the DB.
+type MigrationRecord struct {
+	Version   uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:256"`
+	AppliedAt time.Time
+}
+
+func (MigrationRecord) TableName() string {
+	return "wyrd_migrations"
+}
+
+// migrationLock is the row of the migration lock table, present while a migration manager holds the lock.
+// The holder renews LockedAt by each migration transaction, thus other managers can tell the lock is abandoned once it is not renewed.
+type migrationLock struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"size:256"`
+	LockedAt time.Time
+}
+
+func (migrationLock) TableName() string {
+	return "wyrd_migration_lock"
+}
+
+// ModelMigration returns a migration creating tables of the models, with GORM AutoMigrate, and recommended indexes of their columns.
+// Rolling it back drops the tables.
+// See [CreateRecommendedIndexes].
+func ModelMigration(version uint64, name string, config SchemaConfig, models ...any) Migration {
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(models...); err != nil {
+				return err
+			}
+
+			return CreateRecommendedIndexes(tx, config, models...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(models...)
+		},
+	}
+}
+
+// CreateRecommendedIndexes creates indexes of columns that search queries filter and sort models by:
+// name and time columns of the config, as well as its custom time and sort columns.
+// Columns that are missing in a model, or are first columns of an existing index, are skipped.
+// Indexes are named `idx_<table>_<column>`.
+func CreateRecommendedIndexes(db *gorm.DB, config SchemaConfig, models ...any) error {
+	columns := []string{config.NameColumnName, config.CreatedAtColumnName, config.UpdatedAtColumnName, config.DeletedAtColumnName}
+	for _, column := range config.TimeColumns {
+		columns = append(columns, column)
+	}
+	for _, column := range config.SortColumns {
+		columns = append(columns, column)
+	}
+	// Custom columns are sorted for indexes to be created in the same order every time
+	slices.Sort(columns[4:])
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		indexed := indexedColumns(stmt.Schema)
+		for _, column := range columns {
+			if column == "" || indexed[column] || stmt.Schema.LookUpField(column) == nil {
+				continue
+			}
+			indexed[column] = true
+
+			name := fmt.Sprintf("idx_%s_%s", stmt.Schema.Table, column)
+			if db.Migrator().HasIndex(model, name) {
+				continue
+			}
+
+			if err := db.Exec("CREATE INDEX ? ON ? (?)", clause.Column{Name: name}, clause.Table{Name: stmt.Schema.Table}, clause.Column{Name: column}).Error; err != nil {
+				return fmt.Errorf("failed to create index %q: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// indexedColumns returns columns that are first columns of indexes of the schema, including its primary key.
+func indexedColumns(s *schema.Schema) map[string]bool {
+	result := map[string]bool{}
+	if len(s.PrimaryFieldDBNames) > 0 {
+		result[s.PrimaryFieldDBNames[0]] = true
+	}
+
+	for _, index := range s.ParseIndexes() {
+		if len(index.Fields) > 0 && index.Fields[0].Field != nil {
+			result[index.Fields[0].DBName] = true
+		}
+	}
+
+	return result
+}
+
+// MigrationManager applies and rolls back versioned migrations, recording applied ones in the migrations table.
+//
+// Each migration is applied in its own transaction, together with its record.
+// A lock guards against concurrent migrations: a manager waits for the lock held by another one, for example by another replica of a service,
+// thus after the wait it finds migrations already applied. Postgres and MySQL advisory locks are used, which the DB releases
+// if the holding connection is lost. Other DBs use a lock table, where the holder renews the lock by each migration transaction,
+// thus other managers can not take the lock over until the transaction ends, as it locks the row of the lock.
+// A lock that other managers see not renewed for LockTimeout is considered abandoned and is taken over.
+// Waiting managers measure the time by their own clocks, thus clocks of replicas need not be in sync.
+type MigrationManager struct {
+	db         *gorm.DB
+	migrations []Migration
+
+	// Owner identifies the manager in the lock table. Defaults to the host name and a random ID.
+	Owner string
+	// LockTimeout is the time the lock table is not renewed for after which it is considered abandoned. Defaults to 1 minute.
+	LockTimeout time.Duration
+	// LockPollInterval is how often the lock held by another manager is checked for release. Defaults to 1 second.
+	LockPollInterval time.Duration
+}
+
+// NewMigrationManager creates a manager of given migrations, and the migrations and lock tables if they do not exist.
+// On Postgres and MySQL tables are created holding the advisory lock, as replicas may start at once,
+// thus it waits for migrations run by other managers meanwhile.
+func NewMigrationManager(db *gorm.DB, migrations ...Migration) (*MigrationManager, error) {
+	if db == nil {
+		return nil, ErrNoDBObject
+	}
+
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int {
+		switch {
+		case a.Version < b.Version:
+			return -1
+		case a.Version > b.Version:
+			return 1
+		}
+		return 0
+	})
+	for i, m := range sorted {
+		if m.Version == 0 {
+			return nil, fmt.Errorf("%w: migration %q has no version", ErrInvalidMigration, m.Name)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("%w: migration %d has no Up function", ErrInvalidMigration, m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("%w: duplicate version %d", ErrInvalidMigration, m.Version)
+		}
+	}
+
+	host, _ := os.Hostname()
+	result := &MigrationManager{
+		db:               db,
+		migrations:       sorted,
+		Owner:            fmt.Sprintf("%s/%s", host, uuid.NewString()),
+		LockTimeout:      defaultMigrationLockTimeout,
+		LockPollInterval: defaultMigrationLockPollInterval,
+	}
+
+	createTables := func(db *gorm.DB) error {
+		return db.AutoMigrate(&MigrationRecord{}, &migrationLock{})
+	}
+	var err error
+	switch db.Dialector.Name() {
+	case "postgres", "mysql":
+		err = result.withAdvisoryLock(context.Background(), createTables)
+	default:
+		err = createTables(db)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	return result, nil
+}
+
+// Migrations returns registered migrations in the order of their versions.
+func (m *MigrationManager) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// Applied returns records of migrations applied to the DB, in the order of their versions.
+func (m *MigrationManager) Applied(ctx context.Context) ([]MigrationRecord, error) {
+	var records []MigrationRecord
+	rtx := m.db.WithContext(ctx).Order(clause.OrderByColumn{Column: clause.Column{Name: "version"}}).Find(&records)
+	return records, rtx.Error
+}
+
+// Version returns the version of the latest migration applied to the DB, zero if none is.
+func (m *MigrationManager) Version(ctx context.Context) (uint64, error) {
+	records, err := m.Applied(ctx)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	return records[len(records)-1].Version, nil
+}
+
+// Pending returns migrations that are not applied to the DB yet, in the order they would be applied.
+func (m *MigrationManager) Pending(ctx context.Context) ([]Migration, error) {
+	records, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint64]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+
+	var result []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			result = append(result, migration)
+		}
+	}
+
+	return result, nil
+}
+
+// Migrate applies all pending migrations, returning the number of migrations applied.
+func (m *MigrationManager) Migrate(ctx context.Context) (int, error) {
+	if len(m.migrations) == 0 {
+		return 0, nil
+	}
+
+	return m.MigrateTo(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// MigrateTo applies pending migrations up to the version, and rolls back applied migrations above it, in reverse order.
+// Migrating to version zero rolls back all migrations. Returns the number of migrations applied or rolled back.
+func (m *MigrationManager) MigrateTo(ctx context.Context, version uint64) (count int, err error) {
+	err = m.withLock(ctx, func(transact migrationTransactor) (err error) {
+		count, err = m.migrateTo(transact, version)
+		return err
+	})
+
+	return count, err
+}
+
+// Rollback rolls back given number of the latest applied migrations, returning the number of migrations rolled back.
+func (m *MigrationManager) Rollback(ctx context.Context, steps int) (count int, err error) {
+	err = m.withLock(ctx, func(transact migrationTransactor) error {
+		records, err := m.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		if steps <= 0 || len(records) == 0 {
+			return nil
+		}
+
+		var version uint64
+		if steps < len(records) {
+			version = records[len(records)-steps-1].Version
+		}
+
+		count, err = m.migrateTo(transact, version)
+		return err
+	})
+
+	return count, err
+}
+
+// DryRun returns SQL statements that [MigrationManager.MigrateTo] the version would execute, without changing the DB.
+// Migrations are run in a transaction that is rolled back, thus it is not supported by DBs where schema changes commit implicitly, such as MySQL.
+// Queries that read the DB, such as schema introspection, are not included in the result.
+func (m *MigrationManager) DryRun(ctx context.Context, version uint64) ([]string, error) {
+	if m.db.Dialector.Name() == "mysql" {
+		return nil, ErrDryRunNotSupported
+	}
+
+	recorder := &sqlRecorder{Interface: m.db.Logger}
+	errRollback := errors.New("dry-run")
+
+	err := m.withLock(ctx, func(transact migrationTransactor) error {
+		err := transact(func(tx *gorm.DB) error {
+			if _, err := m.migrateWith(tx, tx.Session(&gorm.Session{Logger: recorder}), version); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if errors.Is(err, errRollback) {
+			return nil
+		}
+		return err
+	})
+
+	return recorder.statements, err
+}
+
+// migrateTo applies or rolls back migrations up to the version, each in its own transaction.
+func (m *MigrationManager) migrateTo(transact migrationTransactor, version uint64) (count int, err error) {
+	for {
+		applied, err := m.step(transact, version)
+		if err != nil || !applied {
+			return count, err
+		}
+		count++
+	}
+}
+
+// step applies or rolls back the next migration towards the version in a transaction, returning false if there are none left.
+func (m *MigrationManager) step(transact migrationTransactor, version uint64) (applied bool, err error) {
+	err = transact(func(tx *gorm.DB) (err error) {
+		migration, up, ok, err := m.next(tx, version)
+		if err != nil || !ok {
+			return err
+		}
+
+		applied = true
+		return m.apply(tx, tx, migration, up)
+	})
+
+	return applied, err
+}
+
+// migrateWith applies or rolls back all migrations up to the version in one transaction, running migration functions with the given session.
+func (m *MigrationManager) migrateWith(tx, session *gorm.DB, version uint64) (count int, err error) {
+	for {
+		migration, up, ok, err := m.next(tx, version)
+		if err != nil || !ok {
+			return count, err
+		}
+
+		if err := m.apply(tx, session, migration, up); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// next returns the next migration to apply towards the version, or to roll back if up is false.
+func (m *MigrationManager) next(tx *gorm.DB, version uint64) (migration Migration, up, ok bool, err error) {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(m Migration) bool { return m.Version == version }) {
+		return migration, false, false, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+	}
+
+	var records []MigrationRecord
+	if err := tx.Order(clause.OrderByColumn{Column: clause.Column{Name: "version"}}).Find(&records).Error; err != nil {
+		return migration, false, false, err
+	}
+
+	applied := make(map[uint64]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+
+	// Migrations above the version are rolled back first, latest first
+	for i := len(records) - 1; i >= 0 && records[i].Version > version; i-- {
+		for _, migration := range m.migrations {
+			if migration.Version == records[i].Version {
+				return migration, false, true, nil
+			}
+		}
+		return migration, false, false, fmt.Errorf("%w: applied version %d", ErrUnknownMigration, records[i].Version)
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if !applied[migration.Version] {
+			return migration, true, true, nil
+		}
+	}
+
+	return migration, false, false, nil
+}
+
+// apply runs the migration function with the session, and records the change with tx.
+func (m *MigrationManager) apply(tx, session *gorm.DB, migration Migration, up bool) error {
+	if !up {
+		if migration.Down == nil {
+			return fmt.Errorf("%w: version %d", ErrIrreversibleMigration, migration.Version)
+		}
+		if err := migration.Down(session); err != nil {
+			return fmt.Errorf("failed to roll back migration %d %q: %w", migration.Version, migration.Name, err)
+		}
+
+		return tx.Delete(&MigrationRecord{Version: migration.Version}).Error
+	}
+
+	if err := migration.Up(session); err != nil {
+		return fmt.Errorf("failed to apply migration %d %q: %w", migration.Version, migration.Name, err)
+	}
+
+	return tx.Create(&MigrationRecord{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+}
+
+// migrationTransactor runs the function in a transaction of the DB, holding the migration lock.
+type migrationTransactor func(fn func(tx *gorm.DB) error) error
+
+// withLock runs the function holding the migration lock, waiting for it to be released by other managers if needed.
+// The function runs its transactions with the given transactor. With the lock table, the transactor renews the lock
+// as the first statement of each transaction, thus the lock is renewed for as long as the transaction holds the row of the lock.
+func (m *MigrationManager) withLock(ctx context.Context, fn func(transact migrationTransactor) error) error {
+	switch m.db.Dialector.Name() {
+	case "postgres", "mysql":
+		return m.withAdvisoryLock(ctx, func(conn *gorm.DB) error {
+			return fn(func(f func(tx *gorm.DB) error) error {
+				return conn.Transaction(f)
+			})
+		})
+	}
+
+	db := m.db.WithContext(ctx)
+	if err := m.lock(ctx, db); err != nil {
+		return err
+	}
+	defer m.unlock(db)
+
+	return fn(func(f func(tx *gorm.DB) error) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := m.renew(tx); err != nil {
+				return err
+			}
+			return f(tx)
+		})
+	})
+}
+
+// withAdvisoryLock runs the function holding an advisory lock of the DB, on the connection holding the lock.
+func (m *MigrationManager) withAdvisoryLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		lock, unlock, key := "SELECT pg_try_advisory_lock(?)", "SELECT pg_advisory_unlock(?)", any(migrationAdvisoryLockKey)
+		if conn.Dialector.Name() == "mysql" {
+			lock, unlock, key = "SELECT GET_LOCK(?, 0)", "SELECT RELEASE_LOCK(?)", migrationAdvisoryLockName
+		}
+
+		for {
+			var locked bool
+			if err := conn.Raw(lock, key).Scan(&locked).Error; err != nil {
+				return fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			if locked {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(m.LockPollInterval):
+			}
+		}
+		// Lock is released even if the context is cancelled
+		defer conn.WithContext(context.Background()).Exec(unlock, key)
+
+		return fn(conn)
+	})
+}
+
+// lock acquires the lock table, taking over the lock that is not renewed by its holder for LockTimeout.
+// The lock table is considered held while SQLite reports it locked by a transaction of another connection, such as one migrating.
+func (m *MigrationManager) lock(ctx context.Context, db *gorm.DB) error {
+	var observed migrationLock
+	var observedAt time.Time
+	for {
+		acquired, err := m.tryLock(db, &observed, &observedAt)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !isSQLiteLocked(err) {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.LockPollInterval):
+		}
+	}
+}
+
+// tryLock inserts the lock table if it is not held, returning true if it acquired it. Otherwise it tracks renewals of the lock held by another manager,
+// and removes the lock if it has been observed not renewed for LockTimeout, so that the next attempt takes it over.
+// The lock held by another manager is only read, as writes of waiting managers would contend with the holder on SQLite.
+func (m *MigrationManager) tryLock(db *gorm.DB, observed *migrationLock, observedAt *time.Time) (bool, error) {
+	var held migrationLock
+	rtx := db.Limit(1).Find(&held, migrationLockID)
+	if rtx.Error != nil {
+		return false, rtx.Error
+	}
+	if rtx.RowsAffected == 0 {
+		// Lock taken by another manager meanwhile is not inserted
+		rtx = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&migrationLock{ID: migrationLockID, Owner: m.Owner, LockedAt: time.Now()})
+		return rtx.Error == nil && rtx.RowsAffected > 0, rtx.Error
+	}
+
+	// Renewals of the lock are tracked by the clock of this manager, as clocks of replicas may differ
+	if held.Owner != observed.Owner || !held.LockedAt.Equal(observed.LockedAt) {
+		*observed, *observedAt = held, time.Now()
+	} else if time.Since(*observedAt) >= m.LockTimeout {
+		// Abandoned lock is removed unless renewed meanwhile
+		return false, db.Where("owner = ? AND locked_at = ?", held.Owner, held.LockedAt).Delete(&migrationLock{ID: migrationLockID}).Error
+	}
+
+	return false, nil
+}
+
+// isSQLiteLocked returns true if the error is SQLite failing a statement as the DB or the table is locked by another connection.
+func isSQLiteLocked(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// renew refreshes the lock table by the transaction, so that other managers do not consider the lock abandoned.
+// It fails with [ErrMigrationLockLost] if the lock has been taken over.
+func (m *MigrationManager) renew(tx *gorm.DB) error {
+	rtx := tx.Model(&migrationLock{}).Where("id = ? AND owner = ?", migrationLockID, m.Owner).Update("locked_at", time.Now())
+	if rtx.Error != nil {
+		return fmt.Errorf("failed to renew migration lock: %w", rtx.Error)
+	}
+	if rtx.RowsAffected == 0 {
+		return ErrMigrationLockLost
+	}
+
+	return nil
+}
+
+func (m *MigrationManager) unlock(db *gorm.DB) {
+	// Lock is released even if the context is cancelled
+	db.WithContext(context.Background()).Where("owner = ?", m.Owner).Delete(&migrationLock{ID: migrationLockID})
+}
+
+// sqlRecorder is a logger recording SQL statements that change the DB.
+type sqlRecorder struct {
+	logger.Interface
+
+	lock       sync.Mutex
+	statements []string
+}
+
+// LogMode implements [logger.Interface], keeping the recorder as the logger.
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface {
+	return r
+}
+
+// Trace implements [logger.Interface] by recording statements other than queries.
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	sql, _ := fc()
+	statement := strings.ToUpper(strings.TrimSpace(sql))
+	for _, prefix := range []string{"SELECT", "PRAGMA", "SHOW", "WITH", "EXPLAIN"} {
+		if strings.HasPrefix(statement, prefix) {
+			return
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.statements = append(r.statements, sql)
+}
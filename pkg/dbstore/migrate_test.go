@@ -0,0 +1,309 @@
+package dbstore_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type Clinic struct {
+	ID        uint
+	Name      string
+	CreatedAt time.Time
+}
+
+// makeMigrationDB opens a DB file private to the test. Managers wait for locks of each other's connections, as they would with a file of a real DB.
+func makeMigrationDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=1000&_journal_mode=WAL", filepath.Join(t.TempDir(), "migrations.db"))), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		dbInstance, _ := db.DB()
+		_ = dbInstance.Close()
+	})
+
+	return db
+}
+
+func givenMigrations() []dbstore.Migration {
+	return []dbstore.Migration{
+		dbstore.ModelMigration(1, "pets", dbstore.ManifestModel, &Pet{}),
+		{
+			Version: 2,
+			Name:    "pet nicknames",
+			Up: func(tx *gorm.DB) error {
+				return tx.Exec("ALTER TABLE pets ADD COLUMN nickname TEXT").Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Exec("ALTER TABLE pets DROP COLUMN nickname").Error
+			},
+		},
+		dbstore.ModelMigration(3, "clinics", dbstore.ManifestModel, &Clinic{}),
+	}
+}
+
+func appliedVersions(t *testing.T, manager *dbstore.MigrationManager) []uint64 {
+	records, err := manager.Applied(context.TODO())
+	require.NoError(t, err)
+
+	result := make([]uint64, 0, len(records))
+	for _, r := range records {
+		result = append(result, r.Version)
+	}
+	return result
+}
+
+func TestMigrationManager(t *testing.T) {
+	db := makeMigrationDB(t)
+	ctx := context.TODO()
+
+	// Migrations are ordered by version regardless of the order given
+	migrations := givenMigrations()
+	manager, err := dbstore.NewMigrationManager(db, migrations[2], migrations[0], migrations[1])
+	require.NoError(t, err)
+
+	pending, err := manager.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	require.Equal(t, uint64(1), pending[0].Version)
+
+	count, err := manager.MigrateTo(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, []uint64{1, 2}, appliedVersions(t, manager))
+	require.True(t, db.Migrator().HasColumn(&Pet{}, "nickname"))
+	require.False(t, db.Migrator().HasTable(&Clinic{}))
+
+	count, err = manager.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.True(t, db.Migrator().HasTable(&Clinic{}))
+
+	// Applied migrations are not applied again
+	count, err = manager.Migrate(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	version, err := manager.Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), version)
+
+	count, err = manager.Rollback(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, []uint64{1}, appliedVersions(t, manager))
+	require.False(t, db.Migrator().HasColumn(&Pet{}, "nickname"))
+	require.False(t, db.Migrator().HasTable(&Clinic{}))
+
+	count, err = manager.MigrateTo(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.False(t, db.Migrator().HasTable(&Pet{}))
+}
+
+func TestMigrationManager_Errors(t *testing.T) {
+	up := func(tx *gorm.DB) error { return nil }
+	testCases := map[string]struct {
+		given []dbstore.Migration
+
+		expectNewError     error
+		expectMigrateError error
+		expectRollback     error
+	}{
+		"no version": {
+			given:          []dbstore.Migration{{Name: "nameless", Up: up}},
+			expectNewError: dbstore.ErrInvalidMigration,
+		},
+		"duplicate version": {
+			given:          []dbstore.Migration{{Version: 1, Up: up}, {Version: 1, Up: up}},
+			expectNewError: dbstore.ErrInvalidMigration,
+		},
+		"no up": {
+			given:          []dbstore.Migration{{Version: 1}},
+			expectNewError: dbstore.ErrInvalidMigration,
+		},
+		"irreversible": {
+			given:          []dbstore.Migration{{Version: 1, Up: up}},
+			expectRollback: dbstore.ErrIrreversibleMigration,
+		},
+		"failed migration is not recorded": {
+			given: []dbstore.Migration{
+				{Version: 1, Up: up},
+				{Version: 2, Up: func(tx *gorm.DB) error { return tx.Exec("ALTER TABLE missing ADD COLUMN x TEXT").Error }},
+			},
+			expectMigrateError: fmt.Errorf("failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+			manager, err := dbstore.NewMigrationManager(makeMigrationDB(t), test.given...)
+			if test.expectNewError != nil {
+				require.ErrorIs(t, err, test.expectNewError)
+				return
+			}
+			require.NoError(t, err)
+
+			count, err := manager.Migrate(ctx)
+			if test.expectMigrateError != nil {
+				require.Error(t, err)
+				require.Equal(t, 1, count)
+				require.Equal(t, []uint64{1}, appliedVersions(t, manager))
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = manager.Rollback(ctx, 1)
+			require.ErrorIs(t, err, test.expectRollback)
+			require.Equal(t, []uint64{1}, appliedVersions(t, manager))
+		})
+	}
+}
+
+func TestMigrationManager_UnknownVersion(t *testing.T) {
+	db := makeMigrationDB(t)
+	ctx := context.TODO()
+
+	manager, err := dbstore.NewMigrationManager(db, givenMigrations()...)
+	require.NoError(t, err)
+	_, err = manager.MigrateTo(ctx, 42)
+	require.ErrorIs(t, err, dbstore.ErrUnknownMigration)
+
+	_, err = manager.Migrate(ctx)
+	require.NoError(t, err)
+
+	// Migrations applied by a newer release can not be rolled back by an older one
+	older, err := dbstore.NewMigrationManager(db, givenMigrations()[:2]...)
+	require.NoError(t, err)
+	_, err = older.MigrateTo(ctx, 1)
+	require.ErrorIs(t, err, dbstore.ErrUnknownMigration)
+}
+
+func TestMigrationManager_DryRun(t *testing.T) {
+	db := makeMigrationDB(t)
+	ctx := context.TODO()
+
+	manager, err := dbstore.NewMigrationManager(db, givenMigrations()...)
+	require.NoError(t, err)
+
+	statements, err := manager.DryRun(ctx, 2)
+	require.NoError(t, err)
+	require.NotEmpty(t, statements)
+	require.True(t, strings.HasPrefix(statements[0], "CREATE TABLE `pets`"), statements[0])
+	require.Contains(t, statements, "CREATE INDEX `idx_pets_created_at` ON `pets` (`created_at`)")
+	require.Equal(t, "ALTER TABLE pets ADD COLUMN nickname TEXT", statements[len(statements)-1])
+
+	// DB is not changed
+	require.False(t, db.Migrator().HasTable(&Pet{}))
+	require.Empty(t, appliedVersions(t, manager))
+}
+
+func TestMigrationManager_Lock(t *testing.T) {
+	db := makeMigrationDB(t)
+
+	first, err := dbstore.NewMigrationManager(db, dbstore.Migration{
+		Version: 1,
+		Name:    "slow",
+		Up: func(tx *gorm.DB) error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	second, err := dbstore.NewMigrationManager(db, first.Migrations()...)
+	require.NoError(t, err)
+	second.LockPollInterval = 10 * time.Millisecond
+
+	// Lock is held by the first manager, and the second one gives up waiting for it
+	done := make(chan error)
+	go func() {
+		_, err := first.Migrate(context.TODO())
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Millisecond)
+	defer cancel()
+	_, err = second.Migrate(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, <-done)
+
+	// Once released, the second manager finds nothing to migrate
+	count, err := second.Migrate(context.TODO())
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	// Abandoned locks, that are not renewed for the timeout, are taken over regardless of the time they are locked at
+	require.NoError(t, db.Exec("INSERT INTO wyrd_migration_lock (id, owner, locked_at) VALUES (1, 'gone', ?)", time.Now().Add(time.Hour)).Error)
+	second.LockTimeout = 50 * time.Millisecond
+	_, err = second.Migrate(context.TODO())
+	require.NoError(t, err)
+}
+
+func TestMigrationManager_LockRenewed(t *testing.T) {
+	db := makeMigrationDB(t)
+
+	var running, overlapped atomic.Int32
+	first, err := dbstore.NewMigrationManager(db, dbstore.Migration{
+		Version: 1,
+		Name:    "slow",
+		Up: func(tx *gorm.DB) error {
+			if running.Add(1) > 1 {
+				overlapped.Add(1)
+			}
+			defer running.Add(-1)
+
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	first.LockTimeout = 60 * time.Millisecond
+	second, err := dbstore.NewMigrationManager(db, first.Migrations()...)
+	require.NoError(t, err)
+	second.LockTimeout = 60 * time.Millisecond
+	second.LockPollInterval = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		_, err := first.Migrate(context.TODO())
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Lock held longer than the timeout is not taken over while the holder renews it
+	ctx, cancel := context.WithTimeout(context.TODO(), 150*time.Millisecond)
+	defer cancel()
+	_, err = second.Migrate(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, <-done)
+	require.Zero(t, overlapped.Load())
+}
+
+func TestCreateRecommendedIndexes(t *testing.T) {
+	db := makeMigrationDB(t)
+	require.NoError(t, db.AutoMigrate(&Pet{}))
+
+	cfg := dbstore.ManifestModel
+	cfg.SortColumns = map[string]string{"spec.customName": "custom_name", "spec.missing": "missing"}
+	require.NoError(t, dbstore.CreateRecommendedIndexes(db, cfg, &Pet{}))
+	// Indexes are only created once
+	require.NoError(t, dbstore.CreateRecommendedIndexes(db, cfg, &Pet{}))
+
+	for _, name := range []string{"idx_pets_created_at", "idx_pets_updated_at", "idx_pets_deleted_at", "idx_pets_custom_name"} {
+		require.True(t, db.Migrator().HasIndex(&Pet{}, name), name)
+	}
+	// Name is indexed by the model already
+	require.False(t, db.Migrator().HasIndex(&Pet{}, "idx_pets_name"))
+	require.False(t, db.Migrator().HasIndex(&Pet{}, "idx_pets_missing"))
+}
@@ -0,0 +1,155 @@
+// Package otelstore adapts an OpenTelemetry tracer to trace operations of an [dbstore.InstrumentedStore],
+// and an OpenTelemetry meter to record metrics of stores and their background jobs.
+// It is a module of its own, so that users of dbstore that do not trace with OpenTelemetry do not depend on it.
+package otelstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer that spans of store operations are started with, and of the meter of their metrics.
+const InstrumentationName = "github.com/sre-norns/wyrd/pkg/dbstore"
+
+// Attributes of spans of store operations.
+const (
+	// OperationKey is the name of the store operation, such as "Find".
+	OperationKey = attribute.Key("db.operation.name")
+	// ModelKey is the name of the type of models of the operation.
+	ModelKey = attribute.Key("wyrd.model")
+	// RowsKey is the number of models returned or written by the operation.
+	RowsKey = attribute.Key("wyrd.rows")
+	// ErrorTypeKey is the type of error of a failed operation, see [dbstore.ErrorType].
+	ErrorTypeKey = attribute.Key("error.type")
+)
+
+// Tracer is a [dbstore.Tracer] that starts OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a tracer of store operations using the provider, or the global one if it is nil.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return &Tracer{tracer: provider.Tracer(InstrumentationName)}
+}
+
+// Start implements [dbstore.Tracer] interface, starting a client span named after the operation.
+func (t *Tracer) Start(ctx context.Context, operation, model string) (context.Context, dbstore.Span) {
+	attributes := []attribute.KeyValue{OperationKey.String(operation)}
+	if model != "" {
+		attributes = append(attributes, ModelKey.String(model))
+	}
+
+	ctx, span := t.tracer.Start(ctx, "dbstore."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	return ctx, &Span{span: span}
+}
+
+// Span is a [dbstore.Span] of an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+// End implements [dbstore.Span] interface, recording the error, if any, as the status of the span.
+func (s *Span) End(rows int64, err error) {
+	s.span.SetAttributes(RowsKey.Int64(rows))
+	if err != nil {
+		s.span.SetAttributes(ErrorTypeKey.String(dbstore.ErrorType(err)))
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// Meter is a [dbstore.Meter] that records metrics with OpenTelemetry instruments, created on first use of each metric.
+// Durations are recorded in seconds, in histograms with buckets of [dbstore.DefaultLatencyBuckets].
+type Meter struct {
+	meter   metric.Meter
+	buckets []float64
+
+	lock       sync.Mutex
+	counters   map[string]metric.Int64Counter
+	histograms map[string]metric.Float64Histogram
+	gauges     map[string]metric.Float64Gauge
+}
+
+// NewMeter creates a meter of store metrics using the provider, or the global one if it is nil.
+func NewMeter(provider metric.MeterProvider) *Meter {
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+
+	buckets := make([]float64, 0, len(dbstore.DefaultLatencyBuckets))
+	for _, bound := range dbstore.DefaultLatencyBuckets {
+		buckets = append(buckets, bound.Seconds())
+	}
+
+	return &Meter{
+		meter:      provider.Meter(InstrumentationName),
+		buckets:    buckets,
+		counters:   map[string]metric.Int64Counter{},
+		histograms: map[string]metric.Float64Histogram{},
+		gauges:     map[string]metric.Float64Gauge{},
+	}
+}
+
+// Add implements [dbstore.Meter] interface, adding the increment to the named counter.
+func (m *Meter) Add(name string, increment int64, labels manifest.Labels) {
+	counter := instrument(m, m.counters, name, func() (metric.Int64Counter, error) {
+		return m.meter.Int64Counter(name)
+	})
+	counter.Add(context.Background(), increment, attributes(labels))
+}
+
+// Record implements [dbstore.Meter] interface, recording the duration in seconds in the named histogram.
+func (m *Meter) Record(name string, d time.Duration, labels manifest.Labels) {
+	histogram := instrument(m, m.histograms, name, func() (metric.Float64Histogram, error) {
+		return m.meter.Float64Histogram(name, metric.WithUnit("s"), metric.WithExplicitBucketBoundaries(m.buckets...))
+	})
+	histogram.Record(context.Background(), d.Seconds(), attributes(labels))
+}
+
+// Set implements [dbstore.Meter] interface, setting the named gauge to the value.
+func (m *Meter) Set(name string, value float64, labels manifest.Labels) {
+	gauge := instrument(m, m.gauges, name, func() (metric.Float64Gauge, error) {
+		return m.meter.Float64Gauge(name)
+	})
+	gauge.Record(context.Background(), value, attributes(labels))
+}
+
+// instrument returns the named instrument, creating it on first use. Errors of creation are passed to the global error handler,
+// as OpenTelemetry returns a usable instrument along with them.
+func instrument[T any](m *Meter, instruments map[string]T, name string, create func() (T, error)) T {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result, ok := instruments[name]
+	if !ok {
+		var err error
+		if result, err = create(); err != nil {
+			otel.Handle(err)
+		}
+		instruments[name] = result
+	}
+	return result
+}
+
+func attributes(labels manifest.Labels) metric.MeasurementOption {
+	result := make([]attribute.KeyValue, 0, len(labels))
+	for key, value := range labels {
+		result = append(result, attribute.String(key, value))
+	}
+	return metric.WithAttributes(result...)
+}
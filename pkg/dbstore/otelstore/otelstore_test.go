@@ -0,0 +1,107 @@
+package otelstore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/dbstore/otelstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func makeTestTracer(t *testing.T) (*otelstore.Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+	})
+
+	return otelstore.NewTracer(provider), recorder
+}
+
+func TestTracer(t *testing.T) {
+	tracer, recorder := makeTestTracer(t)
+
+	ctx, txSpan := tracer.Start(context.TODO(), "Transaction", "")
+	_, span := tracer.Start(ctx, "Find", "Pet")
+	span.End(3, nil)
+	_, span = tracer.Start(ctx, "Update", "Pet")
+	span.End(0, fmt.Errorf("update: %w", dbstore.ErrVersionConflict))
+	txSpan.End(0, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	find, update, tx := spans[0], spans[1], spans[2]
+	require.Equal(t, "dbstore.Find", find.Name())
+	require.Equal(t, trace.SpanKindClient, find.SpanKind())
+	require.Equal(t, otelstore.InstrumentationName, find.InstrumentationScope().Name)
+	require.ElementsMatch(t, []attribute.KeyValue{
+		otelstore.OperationKey.String("Find"),
+		otelstore.ModelKey.String("Pet"),
+		otelstore.RowsKey.Int64(3),
+	}, find.Attributes())
+	require.Equal(t, codes.Unset, find.Status().Code)
+	require.Equal(t, tx.SpanContext().SpanID(), find.Parent().SpanID())
+
+	require.Equal(t, codes.Error, update.Status().Code)
+	require.Contains(t, update.Attributes(), otelstore.ErrorTypeKey.String(dbstore.ErrorTypeVersionConflict))
+	require.Len(t, update.Events(), 1)
+	require.Equal(t, tx.SpanContext().SpanID(), update.Parent().SpanID())
+
+	require.Equal(t, "dbstore.Transaction", tx.Name())
+	require.NotContains(t, tx.Attributes(), otelstore.ModelKey.String(""))
+	require.False(t, tx.Parent().IsValid())
+}
+
+func TestMeter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+	})
+
+	meter := otelstore.NewMeter(provider)
+	labels := manifest.Labels{dbstore.MetricLabelModel: "Pet"}
+	meter.Add(dbstore.MetricCacheHits, 2, labels)
+	meter.Add(dbstore.MetricCacheHits, 1, labels)
+	meter.Record(dbstore.MetricOperationDuration, 20*time.Millisecond, manifest.Labels{dbstore.MetricLabelOperation: "Find"})
+	meter.Set(dbstore.MetricCacheEntries, 5, nil)
+	meter.Set(dbstore.MetricCacheEntries, 3, nil)
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+	require.Len(t, data.ScopeMetrics, 1)
+	require.Equal(t, otelstore.InstrumentationName, data.ScopeMetrics[0].Scope.Name)
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, m := range data.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+	require.Len(t, metrics, 3)
+
+	hits := metrics[dbstore.MetricCacheHits].(metricdata.Sum[int64])
+	require.Len(t, hits.DataPoints, 1)
+	require.Equal(t, int64(3), hits.DataPoints[0].Value)
+	require.Equal(t, attribute.NewSet(attribute.String(dbstore.MetricLabelModel, "Pet")), hits.DataPoints[0].Attributes)
+
+	duration := metrics[dbstore.MetricOperationDuration].(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	require.Equal(t, uint64(1), duration.DataPoints[0].Count)
+	require.InDelta(t, 0.02, duration.DataPoints[0].Sum, 1e-9)
+	require.Len(t, duration.DataPoints[0].Bounds, len(dbstore.DefaultLatencyBuckets))
+
+	entries := metrics[dbstore.MetricCacheEntries].(metricdata.Gauge[float64])
+	require.Len(t, entries.DataPoints, 1)
+	require.Equal(t, float64(3), entries.DataPoints[0].Value)
+}
@@ -0,0 +1,294 @@
+package dbstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+)
+
+// ErrOutboxNotSupported error is returned by [Enqueue] when a transaction does not support enqueuing messages into an outbox.
+var ErrOutboxNotSupported = errors.New("transaction does not support outbox")
+
+const (
+	// defaultOutboxPollInterval is how often the outbox is checked for messages to deliver, unless set by [OutboxRelay.PollInterval].
+	defaultOutboxPollInterval = time.Second
+	// defaultOutboxBatchSize is the maximum number of messages read from the outbox at once, unless set by [OutboxRelay.BatchSize].
+	defaultOutboxBatchSize = 100
+	// defaultOutboxRetryBackoff is the delay before the first retry of a failed delivery, unless set by [OutboxRelay.RetryBackoff].
+	defaultOutboxRetryBackoff = time.Second
+	// defaultOutboxMaxBackoff is the maximum delay between retries of a failed delivery, unless set by [OutboxRelay.MaxBackoff].
+	defaultOutboxMaxBackoff = 5 * time.Minute
+	// defaultOutboxMaxAttempts is the number of failed deliveries after which a message is given up on, unless set by [OutboxRelay.MaxAttempts].
+	defaultOutboxMaxAttempts = 20
+)
+
+// OutboxMessage is a message enqueued into the outbox by a transaction, to be delivered by [OutboxRelay] after the transaction commits.
+type OutboxMessage struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+
+	// Key is an idempotency key of the message, the same for every delivery attempt, so that receivers can discard duplicates.
+	// A random key is generated if it is not set. Enqueuing a message with a key of another message in the outbox fails.
+	Key string `gorm:"size:64;not null;uniqueIndex:idx_wyrd_outbox_key"`
+	// Topic of the message, for sinks to route messages by.
+	Topic string `gorm:"size:128"`
+	// Resource the message is about. Messages about the same resource are delivered in the order of their IDs, see [Enqueue].
+	// Messages without a resource are not ordered.
+	Resource manifest.ResourceID `gorm:"size:64"`
+	// Payload is the body of the message.
+	Payload []byte
+
+	CreatedAt time.Time
+
+	// Attempts is the number of failed deliveries of the message.
+	Attempts int
+	// NextAttemptAt is the time before which the message is not delivered, after a failed delivery.
+	NextAttemptAt time.Time
+	// LastError is the error of the last failed delivery.
+	LastError string
+	// FailedAt is the time the message was given up on, after [OutboxRelay.MaxAttempts] failed deliveries.
+	// Failed messages are kept in the outbox as dead letters, and are not delivered.
+	FailedAt *time.Time `gorm:"index:idx_wyrd_outbox_failed_at"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "wyrd_outbox"
+}
+
+// NewOutboxMessage returns a message about the resource with JSON encoded payload.
+func NewOutboxMessage(topic string, resource manifest.ResourceID, payload any) (OutboxMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxMessage{}, fmt.Errorf("failed to encode outbox message payload: %w", err)
+	}
+
+	return OutboxMessage{
+		Topic:    topic,
+		Resource: resource,
+		Payload:  data,
+	}, nil
+}
+
+// Outbox interface is implemented by transactions that can enqueue messages, persisted together with the data written by the transaction.
+type Outbox interface {
+	// Enqueue adds messages to the outbox. Messages are only delivered if the transaction commits.
+	Enqueue(messages ...OutboxMessage) error
+}
+
+// Enqueue adds messages to the outbox within the transaction, see [Outbox].
+// Returns [ErrOutboxNotSupported] if the transaction does not implement [Outbox] interface.
+//
+// Note: IDs, which order messages about the same resource, are assigned when messages are enqueued rather than when transactions commit.
+// Enqueue messages after writing the resource they are about: the write locks the resource until the transaction commits,
+// so that concurrent transactions about the same resource enqueue their messages in the order they commit.
+// Messages enqueued before the write, or by transactions that do not write the resource, may be delivered out of commit order.
+func Enqueue(tx StoreTransaction, messages ...OutboxMessage) error {
+	outbox, ok := tx.(Outbox)
+	if !ok {
+		return ErrOutboxNotSupported
+	}
+
+	return outbox.Enqueue(messages...)
+}
+
+// EnableOutbox creates the outbox table, so that messages can be enqueued into it by transactions of a [DBStore].
+func EnableOutbox(db *gorm.DB) error {
+	if err := db.AutoMigrate(&OutboxMessage{}); err != nil {
+		return fmt.Errorf("failed to create outbox: %w", err)
+	}
+
+	return nil
+}
+
+func (tx *gormStoreTransaction) Enqueue(messages ...OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	rows := make([]OutboxMessage, 0, len(messages))
+	for _, m := range messages {
+		if m.Key == "" {
+			m.Key = uuid.NewString()
+		}
+		m.ID = 0
+		rows = append(rows, m)
+	}
+
+	return tx.db.Create(&rows).Error
+}
+
+// OutboxSink delivers messages from the outbox to their destination, such as a webhook or a message broker.
+type OutboxSink interface {
+	// Deliver delivers the message, returning an error if it should be retried.
+	Deliver(ctx context.Context, message OutboxMessage) error
+}
+
+// OutboxSinkFunc is an adapter to use a function as [OutboxSink].
+type OutboxSinkFunc func(ctx context.Context, message OutboxMessage) error
+
+// Deliver implements [OutboxSink] interface by calling the function.
+func (f OutboxSinkFunc) Deliver(ctx context.Context, message OutboxMessage) error {
+	return f(ctx, message)
+}
+
+// OutboxRelay delivers messages from the outbox to a sink, removing them once delivered.
+//
+// Messages are delivered at least once: a message can be delivered again if the relay stops before removing it,
+// thus sinks and receivers should use [OutboxMessage.Key] to discard duplicates.
+// Failed deliveries are retried with exponential backoff, and following messages about the same resource wait for them.
+// After MaxAttempts failed deliveries a message is given up on, see [OutboxMessage.FailedAt], so that following messages are delivered.
+// Note: only one relay should run for the outbox, as concurrent relays may deliver messages about the same resource out of order.
+type OutboxRelay struct {
+	db   *gorm.DB
+	sink OutboxSink
+
+	// PollInterval is how often the outbox is checked for messages to deliver. Defaults to 1 second.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of messages read from the outbox at once. Defaults to 100.
+	BatchSize int
+	// RetryBackoff is the delay before the first retry of a failed delivery, doubled for every following attempt. Defaults to 1 second.
+	RetryBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries of a failed delivery. Defaults to 5 minutes.
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of failed deliveries after which a message is given up on. Defaults to 20.
+	MaxAttempts int
+}
+
+// NewOutboxRelay returns a relay delivering messages from the outbox to the sink. See [EnableOutbox].
+func NewOutboxRelay(db *gorm.DB, sink OutboxSink) (*OutboxRelay, error) {
+	if db == nil {
+		return nil, ErrNoDBObject
+	}
+
+	return &OutboxRelay{
+		db:   db,
+		sink: sink,
+	}, nil
+}
+
+// Run delivers messages until the context is done, checking the outbox every [OutboxRelay.PollInterval].
+// Errors of reading the outbox are retried on the next check, and nil is returned once the context is done, as that is a clean shutdown.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = defaultOutboxPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Failed deliveries are recorded with messages, and reading the outbox is retried on the next check
+		_, _ = r.Relay(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Relay makes one pass over the outbox, delivering messages that are due, and returns the number of messages delivered.
+// Failed deliveries are recorded to be retried later, and are not returned as errors. Failed messages are skipped.
+func (r *OutboxRelay) Relay(ctx context.Context) (delivered int, err error) {
+	db := r.db.WithContext(ctx)
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultOutboxBatchSize
+	}
+
+	// Resources with a message waiting for retry, thus following messages about them must wait too
+	blocked := map[manifest.ResourceID]struct{}{}
+	now := time.Now()
+
+	var lastID uint64
+	for {
+		var messages []OutboxMessage
+		if err := db.Where("id > ? AND failed_at IS NULL", lastID).Order("id").Limit(batchSize).Find(&messages).Error; err != nil {
+			return delivered, fmt.Errorf("failed to read outbox: %w", err)
+		}
+
+		for _, m := range messages {
+			lastID = m.ID
+			if _, ok := blocked[m.Resource]; ok {
+				continue
+			}
+			if m.NextAttemptAt.After(now) {
+				r.block(blocked, m)
+				continue
+			}
+
+			if err := r.sink.Deliver(ctx, m); err != nil {
+				if ctx.Err() != nil {
+					return delivered, ctx.Err()
+				}
+
+				failed, err := r.retry(db, m, err)
+				if err != nil {
+					return delivered, err
+				}
+				if !failed {
+					r.block(blocked, m)
+				}
+				continue
+			}
+
+			if err := db.Delete(&OutboxMessage{}, m.ID).Error; err != nil {
+				return delivered, fmt.Errorf("failed to remove delivered message: %w", err)
+			}
+			delivered++
+		}
+
+		if len(messages) < batchSize {
+			return delivered, nil
+		}
+	}
+}
+
+func (r *OutboxRelay) block(blocked map[manifest.ResourceID]struct{}, m OutboxMessage) {
+	if m.Resource != "" {
+		blocked[m.Resource] = struct{}{}
+	}
+}
+
+// retry records a failed delivery of the message, scheduling the next attempt, or giving up on the message after too many attempts.
+func (r *OutboxRelay) retry(db *gorm.DB, m OutboxMessage, deliveryErr error) (failed bool, err error) {
+	backoff, maxBackoff := r.RetryBackoff, r.MaxBackoff
+	if backoff <= 0 {
+		backoff = defaultOutboxRetryBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultOutboxMaxBackoff
+	}
+	for i := 0; i < m.Attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultOutboxMaxAttempts
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"attempts":        m.Attempts + 1,
+		"next_attempt_at": now.Add(min(backoff, maxBackoff)),
+		"last_error":      deliveryErr.Error(),
+	}
+	failed = m.Attempts+1 >= maxAttempts
+	if failed {
+		updates["failed_at"] = now
+	}
+
+	if err := db.Model(&OutboxMessage{ID: m.ID}).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to record failed delivery: %w", err)
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,255 @@
+package dbstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func makeOutboxStore(t *testing.T) (*dbstore.DBStore, *gorm.DB) {
+	db, store := openTestDB(t)
+	require.NoError(t, dbstore.EnableOutbox(db))
+
+	return store, db
+}
+
+// recordingSink records topics of delivered messages, failing deliveries of topics given in fail.
+type recordingSink struct {
+	delivered []string
+	keys      []string
+	fail      map[string]bool
+}
+
+func (s *recordingSink) Deliver(_ context.Context, m dbstore.OutboxMessage) error {
+	if s.fail[m.Topic] {
+		return errors.New("delivery failed")
+	}
+
+	s.delivered = append(s.delivered, m.Topic)
+	s.keys = append(s.keys, m.Key)
+	return nil
+}
+
+func enqueue(t *testing.T, store *dbstore.DBStore, messages ...dbstore.OutboxMessage) {
+	tx, err := store.Begin(context.TODO())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	require.NoError(t, dbstore.Enqueue(tx, messages...))
+	require.NoError(t, tx.Commit())
+}
+
+func TestOutbox_Transaction(t *testing.T) {
+	store, db := makeOutboxStore(t)
+	ctx := context.TODO()
+
+	// Rolled back messages are never delivered
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	fluffy := makePet("fluffy", "Fluffy")
+	require.NoError(t, tx.Create(&fluffy))
+	message, err := dbstore.NewOutboxMessage("fluffy.created", fluffy.UID, map[string]string{"name": "fluffy"})
+	require.NoError(t, err)
+	require.NoError(t, dbstore.Enqueue(tx, message))
+	tx.Rollback()
+
+	// Committed messages are delivered
+	tx, err = store.Begin(ctx)
+	require.NoError(t, err)
+	rex := makePet("rex", "Rex")
+	require.NoError(t, tx.Create(&rex))
+	message, err = dbstore.NewOutboxMessage("rex.created", rex.UID, map[string]string{"name": "rex"})
+	require.NoError(t, err)
+	require.NoError(t, dbstore.Enqueue(tx, message))
+	require.NoError(t, tx.Commit())
+
+	sink := &recordingSink{}
+	relay, err := dbstore.NewOutboxRelay(db, sink)
+	require.NoError(t, err)
+
+	delivered, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	require.Equal(t, []string{"rex.created"}, sink.delivered)
+	require.NotEmpty(t, sink.keys[0])
+
+	// Delivered messages are removed from the outbox
+	delivered, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+}
+
+func TestOutbox_Relay(t *testing.T) {
+	testCases := map[string]struct {
+		given []dbstore.OutboxMessage
+		fail  map[string]bool
+
+		expect      []string
+		expectRetry []string
+	}{
+		"in order": {
+			given: []dbstore.OutboxMessage{
+				{Topic: "a1", Resource: "a"},
+				{Topic: "b1", Resource: "b"},
+				{Topic: "a2", Resource: "a"},
+			},
+			expect: []string{"a1", "b1", "a2"},
+		},
+		"failed resource waits": {
+			given: []dbstore.OutboxMessage{
+				{Topic: "a1", Resource: "a"},
+				{Topic: "b1", Resource: "b"},
+				{Topic: "a2", Resource: "a"},
+				{Topic: "b2", Resource: "b"},
+			},
+			fail:        map[string]bool{"a1": true},
+			expect:      []string{"b1", "b2"},
+			expectRetry: []string{"a1", "a2"},
+		},
+		"messages without resource are not ordered": {
+			given: []dbstore.OutboxMessage{
+				{Topic: "x"},
+				{Topic: "y"},
+			},
+			fail:        map[string]bool{"x": true},
+			expect:      []string{"y"},
+			expectRetry: []string{"x"},
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			store, db := makeOutboxStore(t)
+			enqueue(t, store, test.given...)
+
+			sink := &recordingSink{fail: test.fail}
+			relay, err := dbstore.NewOutboxRelay(db, sink)
+			require.NoError(t, err)
+			relay.BatchSize = 2
+
+			delivered, err := relay.Relay(context.TODO())
+			require.NoError(t, err)
+			require.Equal(t, len(test.expect), delivered)
+			require.Equal(t, test.expect, sink.delivered)
+
+			var pending []dbstore.OutboxMessage
+			require.NoError(t, db.Order("id").Find(&pending).Error)
+			got := make([]string, 0, len(pending))
+			for _, m := range pending {
+				got = append(got, m.Topic)
+			}
+			require.Equal(t, len(test.expectRetry), len(got))
+			if len(test.expectRetry) > 0 {
+				require.Equal(t, test.expectRetry, got)
+			}
+		})
+	}
+}
+
+func TestOutbox_Retry(t *testing.T) {
+	store, db := makeOutboxStore(t)
+	ctx := context.TODO()
+	enqueue(t, store, dbstore.OutboxMessage{Topic: "a1", Resource: "a", Key: "key-1"})
+
+	sink := &recordingSink{fail: map[string]bool{"a1": true}}
+	relay, err := dbstore.NewOutboxRelay(db, sink)
+	require.NoError(t, err)
+	relay.RetryBackoff = time.Hour
+	relay.MaxBackoff = 2 * time.Hour
+
+	_, err = relay.Relay(ctx)
+	require.NoError(t, err)
+
+	var pending dbstore.OutboxMessage
+	require.NoError(t, db.First(&pending).Error)
+	require.Equal(t, 1, pending.Attempts)
+	require.Equal(t, "delivery failed", pending.LastError)
+	require.True(t, pending.NextAttemptAt.After(time.Now().Add(30*time.Minute)))
+
+	// Not retried before the backoff passes
+	sink.fail = nil
+	delivered, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+
+	require.NoError(t, db.Model(&pending).Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+	delivered, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	// The same idempotency key is delivered on retry
+	require.Equal(t, []string{"key-1"}, sink.keys)
+}
+
+func TestOutbox_RunAfterFailedRead(t *testing.T) {
+	_, db := makeOutboxStore(t)
+	require.NoError(t, db.Migrator().DropTable(&dbstore.OutboxMessage{}))
+
+	relay, err := dbstore.NewOutboxRelay(db, &recordingSink{})
+	require.NoError(t, err)
+	relay.PollInterval = 10 * time.Millisecond
+
+	_, err = relay.Relay(context.TODO())
+	require.Error(t, err)
+
+	// Errors of reading the outbox are not returned once the context is done, as that is a clean shutdown
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, relay.Run(ctx))
+}
+
+func TestOutbox_DeadLetter(t *testing.T) {
+	store, db := makeOutboxStore(t)
+	ctx := context.TODO()
+	enqueue(t, store,
+		dbstore.OutboxMessage{Topic: "a1", Resource: "a"},
+		dbstore.OutboxMessage{Topic: "a2", Resource: "a"},
+	)
+
+	sink := &recordingSink{fail: map[string]bool{"a1": true}}
+	relay, err := dbstore.NewOutboxRelay(db, sink)
+	require.NoError(t, err)
+	relay.RetryBackoff = time.Nanosecond
+	relay.MaxAttempts = 3
+
+	// Following message about the resource waits for retries of the failing one, until it is given up on
+	for i := 0; i < relay.MaxAttempts-1; i++ {
+		delivered, err := relay.Relay(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 0, delivered)
+		time.Sleep(time.Millisecond)
+	}
+	delivered, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	require.Equal(t, []string{"a2"}, sink.delivered)
+
+	var failed []dbstore.OutboxMessage
+	require.NoError(t, db.Find(&failed).Error)
+	require.Len(t, failed, 1)
+	require.Equal(t, "a1", failed[0].Topic)
+	require.Equal(t, 3, failed[0].Attempts)
+	require.NotNil(t, failed[0].FailedAt)
+
+	// Failed messages are not delivered
+	sink.fail = nil
+	delivered, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+}
+
+func TestOutbox_DuplicateKey(t *testing.T) {
+	store, _ := makeOutboxStore(t)
+	enqueue(t, store, dbstore.OutboxMessage{Topic: "a", Resource: manifest.ResourceID("a"), Key: "key-1"})
+
+	tx, err := store.Begin(context.TODO())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.Error(t, dbstore.Enqueue(tx, dbstore.OutboxMessage{Topic: "b", Key: "key-1"}))
+}
@@ -0,0 +1,117 @@
+package dbstore
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	replicasPluginName        = "wyrd:read_replicas"
+	replicasCallbackName      = "wyrd:route_to_replica"
+	replicasResetCallbackName = "wyrd:route_to_primary"
+
+	// readReplicaKey is a key of GORM statement setting marking queries that can be served by a read replica, see [FromReplica].
+	readReplicaKey = "wyrd:read_replica"
+	// primaryPoolKey is a key of GORM statement instance setting holding the connection pool a query was routed away from.
+	primaryPoolKey = "wyrd:primary_pool"
+)
+
+// ReadReplicas is a [gorm.Plugin] that routes queries marked with [FromReplica] to read replicas, in round-robin order.
+//
+// [DBStore] marks Find, FindNames, FindLabels, FindLabelValues, GetByUID, GetByName and facet queries, unless
+// [ReadFromPrimary] option is given. Queries of transactions, locking queries and all writes are served by the primary DB,
+// as are reads that writes perform to check preconditions. Replicas may lag behind the primary, thus results of a write
+// may not be visible to reads that follow it.
+type ReadReplicas struct {
+	// Replicas are connection pools of read replicas, such as [sql.DB].
+	Replicas []gorm.ConnPool
+
+	next atomic.Uint64
+}
+
+// EnableReadReplicas registers [ReadReplicas] plugin with the DB, routing reads to given replicas.
+// See [Config.Open] to connect to replicas of the config.
+func EnableReadReplicas(db *gorm.DB, replicas ...gorm.ConnPool) error {
+	return db.Use(&ReadReplicas{Replicas: replicas})
+}
+
+// FromReplica returns a session of the DB whose queries can be served by a read replica, if [ReadReplicas] plugin is enabled.
+func FromReplica(db *gorm.DB) *gorm.DB {
+	return db.Set(readReplicaKey, true).Session(&gorm.Session{})
+}
+
+// Close closes connections of the DB and of its read replicas, if any.
+func Close(db *gorm.DB) error {
+	var errs []error
+	if plugin, ok := db.Config.Plugins[replicasPluginName].(*ReadReplicas); ok {
+		errs = append(errs, closePools(plugin.Replicas))
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	return errors.Join(append(errs, sqlDB.Close())...)
+}
+
+func closePools(pools []gorm.ConnPool) error {
+	var errs []error
+	for _, pool := range pools {
+		if closer, ok := pool.(interface{ Close() error }); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Name implements [gorm.Plugin] interface.
+func (p *ReadReplicas) Name() string {
+	return replicasPluginName
+}
+
+// Initialize implements [gorm.Plugin] interface. It registers callbacks routing queries to replicas.
+func (p *ReadReplicas) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().Before("gorm:query").Register(replicasCallbackName, p.routeCallback),
+		callbacks.Query().After("gorm:after_query").Register(replicasResetCallbackName, p.resetCallback),
+		callbacks.Row().Before("gorm:row").Register(replicasCallbackName, p.routeCallback),
+		callbacks.Row().After("gorm:row").Register(replicasResetCallbackName, p.resetCallback),
+	)
+}
+
+func (p *ReadReplicas) routeCallback(db *gorm.DB) {
+	if db.Error != nil || len(p.Replicas) == 0 || !p.routed(db) {
+		return
+	}
+
+	db.InstanceSet(primaryPoolKey, db.Statement.ConnPool)
+	db.Statement.ConnPool = p.Replicas[(p.next.Add(1)-1)%uint64(len(p.Replicas))]
+}
+
+// resetCallback restores the connection pool, so that following statements of the same session are not served by the replica.
+func (p *ReadReplicas) resetCallback(db *gorm.DB) {
+	if pool, ok := db.InstanceGet(primaryPoolKey); ok {
+		db.Statement.ConnPool = pool.(gorm.ConnPool)
+	}
+}
+
+// routed returns true if the query is marked to be served by a replica, and is neither part of a transaction nor a locking read.
+func (p *ReadReplicas) routed(db *gorm.DB) bool {
+	if marked, ok := db.Get(readReplicaKey); !ok || marked != true {
+		return false
+	}
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return false
+	}
+	if _, ok := db.Statement.Clauses[clause.Locking{}.Name()]; ok {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+package dbstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// makeReplicatedStore returns a store whose replica holds different data than the primary, to tell which one served a read.
+func makeReplicatedStore(t *testing.T, primary, replica []Pet) *dbstore.DBStore {
+	dir := t.TempDir()
+	replicaURL := "sqlite:" + filepath.Join(dir, "replica.sqlite")
+
+	replicaDB, err := dbstore.Config{URL: replicaURL}.Open(&gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, replicaDB.AutoMigrate(&Pet{}, &Toy{}))
+	for _, pet := range replica {
+		require.NoError(t, replicaDB.Create(&pet).Error)
+	}
+	require.NoError(t, dbstore.Close(replicaDB))
+
+	db, err := dbstore.Config{
+		URL:      "sqlite:" + filepath.Join(dir, "primary.sqlite"),
+		Replicas: []string{replicaURL},
+	}.Open(&gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, dbstore.Close(db)) })
+	require.NoError(t, db.AutoMigrate(&Pet{}, &Toy{}))
+
+	store, err := dbstore.NewDBStore(db, dbstore.ManifestModel)
+	require.NoError(t, err)
+	for _, pet := range primary {
+		require.NoError(t, store.Create(context.TODO(), &pet))
+	}
+
+	return store
+}
+
+func TestReadReplicas(t *testing.T) {
+	store := makeReplicatedStore(t,
+		[]Pet{makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"}))},
+		[]Pet{makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog"}))},
+	)
+	ctx := context.TODO()
+
+	names := func(pets []Pet) []manifest.ResourceName {
+		result := make([]manifest.ResourceName, 0, len(pets))
+		for _, pet := range pets {
+			result = append(result, pet.Name)
+		}
+		return result
+	}
+
+	t.Run("reads are served by replica", func(t *testing.T) {
+		var pets []Pet
+		total, err := store.Find(ctx, &pets, manifest.SearchQuery{})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), total)
+		require.Equal(t, []manifest.ResourceName{"rex"}, names(pets))
+
+		var pet Pet
+		found, err := store.GetByName(ctx, &pet, "rex")
+		require.NoError(t, err)
+		require.True(t, found)
+
+		labels, err := store.FindLabelValues(ctx, &Pet{}, "kind", manifest.SearchQuery{})
+		require.NoError(t, err)
+		require.Equal(t, manifest.NewStringSet("dog"), labels)
+	})
+
+	t.Run("ReadFromPrimary", func(t *testing.T) {
+		var pets []Pet
+		_, err := store.Find(ctx, &pets, manifest.SearchQuery{}, dbstore.ReadFromPrimary())
+		require.NoError(t, err)
+		require.Equal(t, []manifest.ResourceName{"fluffy"}, names(pets))
+
+		var pet Pet
+		found, err := store.GetByName(ctx, &pet, "fluffy", dbstore.ReadFromPrimary())
+		require.NoError(t, err)
+		require.True(t, found)
+	})
+
+	t.Run("writes go to primary", func(t *testing.T) {
+		pet := makePet("tom", "Tom")
+		require.NoError(t, store.Create(ctx, &pet))
+
+		var pets []Pet
+		_, err := store.Find(ctx, &pets, manifest.SearchQuery{}, dbstore.ReadFromPrimary())
+		require.NoError(t, err)
+		require.ElementsMatch(t, []manifest.ResourceName{"fluffy", "tom"}, names(pets))
+
+		// Precondition is checked against the primary
+		pet.Spec.CustomName = "Thomas"
+		updated, err := store.Update(ctx, &pet, pet.UID, dbstore.Precondition(pet.Version))
+		require.NoError(t, err)
+		require.True(t, updated)
+	})
+
+	t.Run("transactions are served by primary", func(t *testing.T) {
+		tx, err := store.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		var pet Pet
+		found, err := tx.GetByName(&pet, "fluffy")
+		require.NoError(t, err)
+		require.True(t, found)
+	})
+}
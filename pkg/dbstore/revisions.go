@@ -0,0 +1,373 @@
+package dbstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrRevisionsNotEnabled error is returned when revision history is requested for a model that it is not enabled for.
+var ErrRevisionsNotEnabled = errors.New("revision history is not enabled for the model")
+
+const (
+	revisionsPluginName   = "wyrd:revision_history"
+	revisionsCallbackName = "wyrd:record_revision"
+
+	// revisionAuthorKey is a key of GORM statement setting holding an author of the change, see [Author] option.
+	revisionAuthorKey = "wyrd:revision_author"
+
+	// revisionsTableSuffix is appended to a model table name to name its revision history table.
+	revisionsTableSuffix = "_revisions"
+)
+
+// revisionRow is a row of revision history table, holding a model as it was saved at a version.
+type revisionRow struct {
+	ID        uint             `gorm:"primaryKey"`
+	UID       string           `gorm:"size:64;not null"`
+	Version   manifest.Version `gorm:"not null"`
+	Author    string
+	CreatedAt time.Time
+	Value     []byte
+}
+
+func (r revisionRow) revision() manifest.Revision {
+	return manifest.Revision{
+		VersionedResourceID: manifest.NewVersionedID(manifest.ResourceID(r.UID), r.Version),
+		Author:              r.Author,
+		Timestamp:           r.CreatedAt,
+	}
+}
+
+// RevisionHistory is a [gorm.Plugin] that records every saved version of models, so that they can be retrieved
+// with [DBStore.GetRevision] and [DBStore.ListRevisions], and restored with [DBStore.Rollback].
+//
+// History is kept in a separate table per model, named after the model table with `_revisions` suffix.
+// A revision is recorded by callbacks when a model is created or updated, holding JSON encoding of the model,
+// and an author of the change if one is given with [Author] option. Thus fields that are not JSON encoded are not recorded.
+// History of a model is kept after it is deleted.
+type RevisionHistory struct {
+	// Config is the schema config of the models.
+	Config SchemaConfig
+	// Models to record history of.
+	Models []any
+
+	// Limit is the maximum number of revisions kept per model. Older revisions are removed when a new one is recorded.
+	// Zero means no limit.
+	Limit int
+	// MaxAge is the maximum age of revisions kept. Older revisions, except the latest one, are removed when a new one is recorded.
+	// Zero means no limit.
+	MaxAge time.Duration
+
+	tables map[string]struct{}
+}
+
+// EnableRevisionHistory creates revision history tables for given models and registers callbacks recording every saved version of them.
+// History is kept without retention limits, use [RevisionHistory] plugin directly to set them.
+func EnableRevisionHistory(db *gorm.DB, config SchemaConfig, models ...any) error {
+	return db.Use(&RevisionHistory{Config: config, Models: models})
+}
+
+// Name implements [gorm.Plugin] interface.
+func (p *RevisionHistory) Name() string {
+	return revisionsPluginName
+}
+
+// Initialize implements [gorm.Plugin] interface. It creates history tables and registers callbacks.
+func (p *RevisionHistory) Initialize(db *gorm.DB) error {
+	p.tables = make(map[string]struct{}, len(p.Models))
+	for _, model := range p.Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		if err := createRevisionsTable(db, stmt.Schema.Table); err != nil {
+			return fmt.Errorf("failed to create revision history for %q: %w", stmt.Schema.Table, err)
+		}
+		p.tables[stmt.Schema.Table] = struct{}{}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().After("gorm:create").Register(revisionsCallbackName, p.recordCallback),
+		callbacks.Update().After("gorm:update").Register(revisionsCallbackName, p.recordCallback),
+	)
+}
+
+func (p *RevisionHistory) recorded(db *gorm.DB) (*schema.Schema, bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.RowsAffected == 0 {
+		return nil, false
+	}
+
+	_, ok := p.tables[db.Statement.Schema.Table]
+	return db.Statement.Schema, ok
+}
+
+// recordCallback records revisions of models written by a statement.
+func (p *RevisionHistory) recordCallback(db *gorm.DB) {
+	s, ok := p.recorded(db)
+	if !ok {
+		return
+	}
+
+	rows, err := reloadAffected(db, p.Config.IDColumnName)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to record revisions: %w", err))
+		return
+	}
+
+	author, _ := db.Get(revisionAuthorKey)
+	name, _ := author.(string)
+	if err := p.record(db.Session(&gorm.Session{NewDB: true, SkipHooks: true}), s, rows, name); err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+// recordIDs records revisions of models with given IDs, as they are stored.
+func (p *RevisionHistory) recordIDs(tx *gorm.DB, s *schema.Schema, ids []any, author string) error {
+	rows, err := loadByIDs(tx, s, p.Config.IDColumnName, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load models to record revisions: %w", err)
+	}
+
+	return p.record(tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}), s, rows, author)
+}
+
+func (p *RevisionHistory) record(tx *gorm.DB, s *schema.Schema, rows reflect.Value, author string) error {
+	table := s.Table + revisionsTableSuffix
+	versionField := s.LookUpField(p.Config.VersionColumnName)
+	if versionField == nil {
+		return fmt.Errorf("%w: %q is not a field of %v", ErrUnknownColumn, p.Config.VersionColumnName, s.Name)
+	}
+
+	now := time.Now()
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+
+		id, _ := s.LookUpField(p.Config.IDColumnName).ValueOf(tx.Statement.Context, row)
+		version, _ := versionField.ValueOf(tx.Statement.Context, row)
+		value, err := json.Marshal(row.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("failed to encode revision: %w", err)
+		}
+
+		revision := revisionRow{
+			UID:       fmt.Sprint(id),
+			Version:   manifest.Version(reflect.ValueOf(version).Convert(reflect.TypeFor[manifest.Version]()).Uint()),
+			Author:    author,
+			CreatedAt: now,
+			Value:     value,
+		}
+
+		// The same version is saved again by updates of models with zero version, and the latest value is kept.
+		if err := tx.Table(table).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "uid"}, {Name: "version"}},
+			DoUpdates: clause.AssignmentColumns([]string{"author", "created_at", "value"}),
+		}).Create(&revision).Error; err != nil {
+			return fmt.Errorf("failed to record revision: %w", err)
+		}
+
+		if err := p.prune(tx, table, revision); err != nil {
+			return fmt.Errorf("failed to remove old revisions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// prune removes revisions of a model beyond retention limits. The latest revision is always kept.
+func (p *RevisionHistory) prune(tx *gorm.DB, table string, latest revisionRow) error {
+	if p.Limit > 0 {
+		var versions []manifest.Version
+		if err := tx.Table(table).Where("uid = ?", latest.UID).Order("version DESC").Offset(p.Limit).Limit(1).Pluck("version", &versions).Error; err != nil {
+			return err
+		}
+		if len(versions) > 0 {
+			if err := tx.Table(table).Where("uid = ? AND version <= ?", latest.UID, versions[0]).Delete(&revisionRow{}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.MaxAge > 0 {
+		if err := tx.Table(table).Where("uid = ? AND version < ? AND created_at < ?", latest.UID, latest.Version, latest.CreatedAt.Add(-p.MaxAge)).Delete(&revisionRow{}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func revisionsPlugin(db *gorm.DB) (*RevisionHistory, bool) {
+	p, ok := db.Config.Plugins[revisionsPluginName].(*RevisionHistory)
+	return p, ok
+}
+
+// revisionsRecorded returns revision history plugin and schema of the model, if revisions of the model are recorded.
+func revisionsRecorded(db *gorm.DB, model any) (*RevisionHistory, *schema.Schema, bool) {
+	p, ok := revisionsPlugin(db)
+	if !ok {
+		return nil, nil, false
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, nil, false
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return nil, nil, false
+	}
+
+	return p, stmt.Schema, true
+}
+
+// revisionsTable returns the name of revision history table of the model.
+func revisionsTable(db *gorm.DB, model any) (string, error) {
+	p, ok := revisionsPlugin(db)
+	if !ok {
+		return "", ErrRevisionsNotEnabled
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	if _, ok := p.tables[stmt.Schema.Table]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrRevisionsNotEnabled, stmt.Schema.Table)
+	}
+
+	return stmt.Schema.Table + revisionsTableSuffix, nil
+}
+
+func createRevisionsTable(db *gorm.DB, table string) error {
+	revisionsTable := table + revisionsTableSuffix
+	if err := db.Table(revisionsTable).AutoMigrate(&revisionRow{}); err != nil {
+		return err
+	}
+
+	// Note index names are global in some DBs, and thus are named after the table
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS ? ON ? (uid, version)",
+		clause.Column{Name: "idx_" + revisionsTable + "_uid_version"},
+		clause.Table{Name: revisionsTable},
+	).Error
+}
+
+// GetRevision finds a model identified by the ID as it was saved at the given version, if its revision history has it.
+// The revision is written into dest variable, thus dest must be a pointer to a variable of the model type.
+// Return values indicate if the revision was found, and if there was an error while fetching it.
+// Returns [ErrRevisionsNotEnabled] if revision history is not enabled for the model, see [EnableRevisionHistory].
+func (s *DBStore) GetRevision(ctx context.Context, dest any, id manifest.ResourceID, version manifest.Version) (exists bool, err error) {
+	return s.singleTransaction(ctx).getRevision(dest, id, version)
+}
+
+// ListRevisions returns revisions of a model identified by the ID recorded in its revision history, latest first.
+// Type of the model determines which model revisions to list. No field of the value is used, thus a pointer to an default value can be safely passed.
+// Search query limits and offset paginate results, and its time range applies to the time revisions were recorded. Other query fields are ignored.
+// Returns [ErrRevisionsNotEnabled] if revision history is not enabled for the model, see [EnableRevisionHistory].
+func (s *DBStore) ListRevisions(ctx context.Context, model any, id manifest.ResourceID, searchQuery manifest.SearchQuery) (revisions []manifest.Revision, total int64, err error) {
+	table, err := revisionsTable(s.db, model)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tx := s.db.WithContext(ctx).Table(table).Where("uid = ?", string(id))
+	tx = limitTimeRange(tx, "created_at", searchQuery.FromTime, searchQuery.TillTime)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, total, err
+	}
+
+	var rows []revisionRow
+	if err := limitedQuery(tx.Order("version DESC"), searchQuery).Omit("value").Find(&rows).Error; err != nil {
+		return nil, total, err
+	}
+
+	revisions = make([]manifest.Revision, 0, len(rows))
+	for _, r := range rows {
+		revisions = append(revisions, r.revision())
+	}
+
+	return revisions, total, nil
+}
+
+// Rollback restores a model identified by the ID to the given version from its revision history.
+// The restored value is saved as a new version of the model, so the history is preserved, and written into the model variable.
+// Return values indicate if both the model and its revision exist, and if there was an error while restoring it.
+// Returns [ErrVersionConflict] if the model is modified concurrently, and [ErrRevisionsNotEnabled] if revision history is not enabled for the model.
+func (s *DBStore) Rollback(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (exists bool, err error) {
+	err = s.db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		exists, err = (&gormStoreTransaction{db: db, config: s.config}).rollbackTo(model, id, version, options...)
+		return err
+	})
+
+	return
+}
+
+func (tx *gormStoreTransaction) getRevision(dest any, id manifest.ResourceID, version manifest.Version) (bool, error) {
+	table, err := revisionsTable(tx.db, dest)
+	if err != nil {
+		return false, err
+	}
+
+	var row revisionRow
+	rx := tx.db.Table(table).Where("uid = ? AND version = ?", string(id), version).Take(&row)
+	if errors.Is(rx.Error, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if rx.Error != nil {
+		return false, rx.Error
+	}
+
+	if err := json.Unmarshal(row.Value, dest); err != nil {
+		return false, fmt.Errorf("failed to decode revision: %w", err)
+	}
+
+	return true, nil
+}
+
+// rollbackTo saves the revision of the model as its next version.
+func (tx *gormStoreTransaction) rollbackTo(model any, id manifest.ResourceID, version manifest.Version, options ...Option) (bool, error) {
+	ptr := reflect.ValueOf(model)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return false, gorm.ErrInvalidValue
+	}
+	if _, err := revisionsTable(tx.db, model); err != nil {
+		return false, err
+	}
+
+	current := reflect.New(ptr.Elem().Type())
+	if exists, err := tx.GetByUID(current.Interface(), id, options...); err != nil || !exists {
+		return false, err
+	}
+
+	restored := reflect.New(ptr.Elem().Type())
+	if exists, err := tx.getRevision(restored.Interface(), id, version); err != nil || !exists {
+		return false, err
+	}
+
+	// The restored value becomes the version following the current one, unless the model is modified concurrently
+	stmt := &gorm.Statement{DB: tx.db}
+	if err := stmt.Parse(model); err != nil {
+		return false, err
+	}
+	if field := stmt.Schema.LookUpField(tx.config.VersionColumnName); field != nil {
+		currentVersion, _ := field.ValueOf(tx.db.Statement.Context, current)
+		if err := field.Set(tx.db.Statement.Context, restored, currentVersion); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.CreateOrUpdate(restored.Interface(), options...); err != nil {
+		return false, err
+	}
+
+	ptr.Elem().Set(restored.Elem())
+	return true, nil
+}
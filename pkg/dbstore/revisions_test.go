@@ -0,0 +1,185 @@
+package dbstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func makeRevisionsStore(t *testing.T, plugin *dbstore.RevisionHistory) *dbstore.DBStore {
+	var plugins []gorm.Plugin
+	if plugin != nil {
+		plugins = append(plugins, plugin)
+	}
+
+	_, store := openTestDB(t, plugins...)
+	return store
+}
+
+// givenPetHistory creates a pet and updates it twice, so it has 3 versions: "Fluffy", "Mr. Fluffy" and "Sir Fluffy".
+func givenPetHistory(t *testing.T, store *dbstore.DBStore) Pet {
+	ctx := context.TODO()
+
+	pet := makePet("fluffy", "Fluffy")
+	require.NoError(t, store.Create(ctx, &pet, dbstore.Author("alice")))
+	for _, name := range []string{"Mr. Fluffy", "Sir Fluffy"} {
+		pet.Spec.CustomName = name
+		_, err := store.Update(ctx, &pet, pet.UID, dbstore.Author("bob"))
+		require.NoError(t, err)
+	}
+
+	return pet
+}
+
+func revisionVersions(revisions []manifest.Revision) []manifest.Version {
+	result := make([]manifest.Version, 0, len(revisions))
+	for _, r := range revisions {
+		result = append(result, r.Version)
+	}
+	return result
+}
+
+func TestDBStore_ListRevisions(t *testing.T) {
+	testCases := map[string]struct {
+		givenQuery manifest.SearchQuery
+
+		expect      []manifest.Version
+		expectTotal int64
+	}{
+		"all": {
+			expect:      []manifest.Version{3, 2, 1},
+			expectTotal: 3,
+		},
+		"limit": {
+			givenQuery:  manifest.SearchQuery{Limit: 2},
+			expect:      []manifest.Version{3, 2},
+			expectTotal: 3,
+		},
+		"offset": {
+			givenQuery:  manifest.SearchQuery{Offset: 2, Limit: 2},
+			expect:      []manifest.Version{1},
+			expectTotal: 3,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			store := makeRevisionsStore(t, &dbstore.RevisionHistory{Config: dbstore.ManifestModel, Models: []any{&Pet{}}})
+			pet := givenPetHistory(t, store)
+
+			got, total, err := store.ListRevisions(context.TODO(), &Pet{}, pet.UID, test.givenQuery)
+			require.NoError(t, err)
+			require.Equal(t, test.expectTotal, total)
+			require.Equal(t, test.expect, revisionVersions(got))
+		})
+	}
+}
+
+func TestDBStore_GetRevision(t *testing.T) {
+	store := makeRevisionsStore(t, &dbstore.RevisionHistory{Config: dbstore.ManifestModel, Models: []any{&Pet{}}})
+	pet := givenPetHistory(t, store)
+	ctx := context.TODO()
+
+	var got Pet
+	exists, err := store.GetRevision(ctx, &got, pet.UID, 1)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, "Fluffy", got.Spec.CustomName)
+	require.Equal(t, manifest.Version(1), got.Version)
+
+	exists, err = store.GetRevision(ctx, &got, pet.UID, 7)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	revisions, _, err := store.ListRevisions(ctx, &Pet{}, pet.UID, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, "bob", revisions[0].Author)
+	require.Equal(t, "alice", revisions[2].Author)
+	require.False(t, revisions[0].Timestamp.IsZero())
+}
+
+func TestDBStore_Rollback(t *testing.T) {
+	store := makeRevisionsStore(t, &dbstore.RevisionHistory{Config: dbstore.ManifestModel, Models: []any{&Pet{}}})
+	pet := givenPetHistory(t, store)
+	ctx := context.TODO()
+
+	var got Pet
+	exists, err := store.Rollback(ctx, &got, pet.UID, 1, dbstore.Author("carol"))
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, "Fluffy", got.Spec.CustomName)
+	require.Equal(t, manifest.Version(4), got.Version)
+
+	// Rollback is recorded as a new version
+	exists, err = store.GetByUID(ctx, &got, pet.UID)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, "Fluffy", got.Spec.CustomName)
+	require.Equal(t, manifest.Version(4), got.Version)
+
+	revisions, total, err := store.ListRevisions(ctx, &Pet{}, pet.UID, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), total)
+	require.Equal(t, "carol", revisions[0].Author)
+
+	// Unknown version or resource
+	exists, err = store.Rollback(ctx, &Pet{}, pet.UID, 7)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	exists, err = store.Rollback(ctx, &Pet{}, "unknown", 1)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestDBStore_PatchLabelsRevisions(t *testing.T) {
+	store := makeRevisionsStore(t, &dbstore.RevisionHistory{Config: dbstore.ManifestModel, Models: []any{&Pet{}}})
+	pet := givenPetHistory(t, store)
+	ctx := context.TODO()
+
+	affected, err := store.PatchLabels(ctx, &Pet{}, manifest.SearchQuery{}, dbstore.LabelPatch{Set: manifest.Labels{"owner": "carol"}}, dbstore.Author("carol"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), affected)
+
+	revisions, total, err := store.ListRevisions(ctx, &Pet{}, pet.UID, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), total)
+	require.Equal(t, manifest.Version(4), revisions[0].Version)
+	require.Equal(t, "carol", revisions[0].Author)
+
+	var got Pet
+	exists, err := store.GetRevision(ctx, &got, pet.UID, 4)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, manifest.Labels{"owner": "carol"}, got.Labels)
+	require.Equal(t, "Sir Fluffy", got.Spec.CustomName)
+}
+
+func TestDBStore_RevisionsRetention(t *testing.T) {
+	store := makeRevisionsStore(t, &dbstore.RevisionHistory{Config: dbstore.ManifestModel, Models: []any{&Pet{}}, Limit: 2})
+	pet := givenPetHistory(t, store)
+
+	got, total, err := store.ListRevisions(context.TODO(), &Pet{}, pet.UID, manifest.SearchQuery{})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	require.Equal(t, []manifest.Version{3, 2}, revisionVersions(got))
+}
+
+func TestDBStore_RevisionsNotEnabled(t *testing.T) {
+	store := makeRevisionsStore(t, nil)
+	ctx := context.TODO()
+
+	_, err := store.GetRevision(ctx, &Pet{}, "some-id", 1)
+	require.ErrorIs(t, err, dbstore.ErrRevisionsNotEnabled)
+
+	_, _, err = store.ListRevisions(ctx, &Pet{}, "some-id", manifest.SearchQuery{})
+	require.ErrorIs(t, err, dbstore.ErrRevisionsNotEnabled)
+
+	_, err = store.Rollback(ctx, &Pet{}, "some-id", 1)
+	require.ErrorIs(t, err, dbstore.ErrRevisionsNotEnabled)
+}
@@ -0,0 +1,95 @@
+package dbstore
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	slowQueryPluginName        = "wyrd:slow_query_log"
+	slowQueryStartCallbackName = "wyrd:slow_query_start"
+	slowQueryLogCallbackName   = "wyrd:slow_query_log"
+
+	// slowQueryStartKey is a key of GORM statement instance setting holding the time the statement started at.
+	slowQueryStartKey = "wyrd:slow_query_start"
+)
+
+// SlowQueryLog is a [gorm.Plugin] that logs SQL statements that take at least Threshold to execute,
+// along with their duration, number of rows affected and error, if any.
+// Statements are logged with placeholders of their parameters, unless LogValues is set.
+type SlowQueryLog struct {
+	// Threshold is the minimum duration of statements that are logged. Zero logs all statements.
+	Threshold time.Duration
+	// Logger that slow statements are logged to, at warning level. Defaults to [slog.Default].
+	Logger *slog.Logger
+	// LogValues renders statements with values of their parameters.
+	// Note: values include data written and compared to, which may be sensitive.
+	LogValues bool
+}
+
+// EnableSlowQueryLog registers [SlowQueryLog] plugin with the DB, logging statements that take at least the threshold to the logger.
+func EnableSlowQueryLog(db *gorm.DB, threshold time.Duration, logger *slog.Logger) error {
+	return db.Use(&SlowQueryLog{Threshold: threshold, Logger: logger})
+}
+
+// Name implements [gorm.Plugin] interface.
+func (p *SlowQueryLog) Name() string {
+	return slowQueryPluginName
+}
+
+// Initialize implements [gorm.Plugin] interface. It registers callbacks that time statements of all kinds.
+func (p *SlowQueryLog) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register(slowQueryStartCallbackName, p.startCallback),
+		callbacks.Create().After("*").Register(slowQueryLogCallbackName, p.logCallback),
+		callbacks.Query().Before("*").Register(slowQueryStartCallbackName, p.startCallback),
+		callbacks.Query().After("*").Register(slowQueryLogCallbackName, p.logCallback),
+		callbacks.Update().Before("*").Register(slowQueryStartCallbackName, p.startCallback),
+		callbacks.Update().After("*").Register(slowQueryLogCallbackName, p.logCallback),
+		callbacks.Delete().Before("*").Register(slowQueryStartCallbackName, p.startCallback),
+		callbacks.Delete().After("*").Register(slowQueryLogCallbackName, p.logCallback),
+		callbacks.Row().Before("*").Register(slowQueryStartCallbackName, p.startCallback),
+		callbacks.Row().After("*").Register(slowQueryLogCallbackName, p.logCallback),
+		callbacks.Raw().Before("*").Register(slowQueryStartCallbackName, p.startCallback),
+		callbacks.Raw().After("*").Register(slowQueryLogCallbackName, p.logCallback),
+	)
+}
+
+func (p *SlowQueryLog) startCallback(db *gorm.DB) {
+	db.InstanceSet(slowQueryStartKey, time.Now())
+}
+
+func (p *SlowQueryLog) logCallback(db *gorm.DB) {
+	value, ok := db.InstanceGet(slowQueryStartKey)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(value.(time.Time))
+	if elapsed < p.Threshold || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	sql := db.Statement.SQL.String()
+	if p.LogValues {
+		sql = db.Dialector.Explain(sql, db.Statement.Vars...)
+	}
+
+	attrs := []slog.Attr{
+		slog.Duration("duration", elapsed),
+		slog.String("sql", sql),
+		slog.Int64("rows", db.Statement.RowsAffected),
+	}
+	if db.Error != nil {
+		attrs = append(attrs, slog.String("error", db.Error.Error()))
+	}
+	logger.LogAttrs(db.Statement.Context, slog.LevelWarn, "slow query", attrs...)
+}
@@ -2,6 +2,7 @@ package dbstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/sre-norns/wyrd/pkg/manifest"
 )
@@ -27,8 +28,21 @@ type transactionContext struct {
 	Omit            manifest.StringSet
 	Expand          map[string]expandDetails
 	Order           orderDetails
+	Sortable        []string
 
-	withVersion *manifest.Version
+	withVersion  *manifest.Version
+	precondition *manifest.Version
+	nextToken    *string
+	author       string
+	readPrimary  bool
+
+	// model is the value that the operation applies to, as passed to options.
+	model any
+}
+
+// keyset returns true if results are paginated by continue tokens rather than offset.
+func (tc transactionContext) keyset(query manifest.SearchQuery) bool {
+	return query.Continue != "" || tc.nextToken != nil
 }
 
 func newTransactionContext(config SchemaConfig) transactionContext {
@@ -109,6 +123,34 @@ func WithVersion(v manifest.Version) Option {
 	}
 }
 
+// Precondition option makes Update and CreateOrUpdate apply only if the stored entry has the given version,
+// otherwise they fail with [ErrVersionConflict]. The version of the value being written is set to the given one,
+// so that the stored version advances past it.
+// Without the option, the version of the value is the precondition, unless it is zero.
+func Precondition(v manifest.Version) Option {
+	return func(a any, tc transactionContext) transactionContext {
+		tc.precondition = &v
+		return tc
+	}
+}
+
+// Author option sets an author of the change, recorded in revision history of the model, see [EnableRevisionHistory].
+func Author(name string) Option {
+	return func(a any, tc transactionContext) transactionContext {
+		tc.author = name
+		return tc
+	}
+}
+
+// ReadFromPrimary option makes a read served by the primary DB rather than a read replica, see [ReadReplicas].
+// Use it to read results of a write that replicas may not have caught up with yet.
+func ReadFromPrimary() Option {
+	return func(a any, tc transactionContext) transactionContext {
+		tc.readPrimary = true
+		return tc
+	}
+}
+
 func OrderByCreatedAt(order Order) Option {
 	return func(a any, tc transactionContext) transactionContext {
 		tc.Order.OrderColumns = append(tc.Order.OrderColumns, orderByColumn{
@@ -120,6 +162,26 @@ func OrderByCreatedAt(order Order) Option {
 	}
 }
 
+// SortableFields option restricts fields that a sort spec of a search query can refer to, see [manifest.SortSpec.Validate] for the syntax.
+// By default results can be sorted by [manifest.DefaultSortableFields] and custom [SchemaConfig.SortColumns].
+func SortableFields(fields ...string) Option {
+	return func(a any, tc transactionContext) transactionContext {
+		tc.Sortable = append(tc.Sortable, fields...)
+		return tc
+	}
+}
+
+// NextContinueToken option requests a continue token for the page of results following the one returned by Find.
+// The token is written into the given variable, and is empty if there are no more results.
+// Results are then ordered by the sort spec of the search query followed by resource UID, replacing any order set by other options.
+// See [manifest.SearchQuery.Continue].
+func NextContinueToken(token *string) Option {
+	return func(a any, tc transactionContext) transactionContext {
+		tc.nextToken = token
+		return tc
+	}
+}
+
 func OrderBy(column string, order Order) Option {
 	return func(a any, tc transactionContext) transactionContext {
 		tc.Order.OrderColumns = append(tc.Order.OrderColumns, orderByColumn{
@@ -203,6 +265,77 @@ type AssociationStore interface {
 	ClearLinked(ctx context.Context, link string, owner any) error
 }
 
+// RevisionStore interface defines methods of a store that keeps revision history of models: every version of a model saved.
+type RevisionStore interface {
+	// GetRevision returns a model identified by the ID as it was saved at the given version.
+	GetRevision(ctx context.Context, dest any, id manifest.ResourceID, version manifest.Version) (exists bool, err error)
+
+	// ListRevisions returns revisions of a model identified by the ID, latest first.
+	ListRevisions(ctx context.Context, model any, id manifest.ResourceID, searchQuery manifest.SearchQuery) (revisions []manifest.Revision, total int64, err error)
+
+	// Rollback restores a model identified by the ID to the given version, saving it as a new version.
+	Rollback(ctx context.Context, model any, id manifest.ResourceID, version manifest.Version, options ...Option) (exists bool, err error)
+}
+
+// WatchStore interface defines a store that reports changes of models as they happen.
+type WatchStore interface {
+	// Watch returns a channel of events reporting changes of models that match search query, following the given version.
+	Watch(ctx context.Context, model any, searchQuery manifest.SearchQuery, fromVersion manifest.Version) (<-chan WatchEvent, error)
+}
+
+// LabelPatch describes changes to labels of resources. Changes are applied in order: Add, Set and then Remove.
+type LabelPatch struct {
+	// Add labels that resources don't have yet, keeping values of existing ones.
+	Add manifest.Labels
+	// Set labels, overwriting values of existing ones.
+	Set manifest.Labels
+	// Remove labels with these keys.
+	Remove []string
+}
+
+// Empty returns true if the patch does not change any labels.
+func (p LabelPatch) Empty() bool {
+	return len(p.Add) == 0 && len(p.Set) == 0 && len(p.Remove) == 0
+}
+
+// BulkStore interface defines methods of a store that change many entries at once, without reading them first.
+// Entries are selected by a search query, in the same way as Find selects them, thus an empty query selects all entries.
+type BulkStore interface {
+	// CreateMany inserts values of a slice into the store. Values that fail to be inserted are skipped, and their errors are returned in results,
+	// which has an entry for each value: nil if the value was created.
+	CreateMany(ctx context.Context, values any, options ...Option) (created int64, results []error, err error)
+
+	// DeleteMany deletes entries that match search query, returning number of entries deleted.
+	DeleteMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error)
+
+	// RestoreMany restores soft-deleted entries that match search query, returning number of entries restored.
+	RestoreMany(ctx context.Context, model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error)
+
+	// PatchLabels changes labels of entries that match search query, returning number of entries changed.
+	PatchLabels(ctx context.Context, model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error)
+}
+
+// BulkTransaction interface is implemented by transactions that support [BulkStore] operations.
+type BulkTransaction interface {
+	CreateMany(values any, options ...Option) (created int64, results []error, err error)
+	DeleteMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error)
+	RestoreMany(model any, searchQuery manifest.SearchQuery, options ...Option) (affected int64, err error)
+	PatchLabels(model any, searchQuery manifest.SearchQuery, patch LabelPatch, options ...Option) (affected int64, err error)
+}
+
+// FacetStore interface defines methods of a store that count models matching a search query, grouped by labels or by time,
+// for example to show number of resources next to filter options of a dashboard.
+// Sort and continue token of the search query are ignored, while offset and limit apply to the returned groups.
+type FacetStore interface {
+	// CountLabelValues returns numbers of models per combination of values of the label keys, most common first.
+	// Models that have none of the keys are not counted.
+	CountLabelValues(ctx context.Context, model any, keys []string, searchQuery manifest.SearchQuery, options ...Option) ([]manifest.FacetCount, error)
+
+	// CountByTime returns numbers of models per time bucket of the given width, by the time field of the search query, in order of time.
+	// Buckets without models are omitted.
+	CountByTime(ctx context.Context, model any, bucket time.Duration, searchQuery manifest.SearchQuery, options ...Option) ([]manifest.TimeBucket, error)
+}
+
 // Transaction interface defines a transaction that has been initiated and can be either Committed or Rollback'd.
 type Transaction interface {
 	// Rollback signals that transaction should be aborted and all not-yet-committed changed rollback'd.
@@ -0,0 +1,592 @@
+package dbstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrWatchNotEnabled error is returned when watching a model that change log is not enabled for.
+	ErrWatchNotEnabled = errors.New("watch is not enabled for the model")
+
+	// ErrEventsCompacted error is returned, or reported by [EventError], when events to watch from have been removed from the change log.
+	// Watching can be restarted from the current state of models, returned by Find.
+	ErrEventsCompacted = errors.New("events have been compacted")
+)
+
+// EventType is a type of a change of a model reported by [DBStore.Watch].
+type EventType string
+
+const (
+	// EventAdded reports a model that has been created or restored.
+	EventAdded EventType = "Added"
+	// EventModified reports a model that has been updated.
+	EventModified EventType = "Modified"
+	// EventDeleted reports a model that has been deleted.
+	EventDeleted EventType = "Deleted"
+	// EventError reports an error that stopped watching, such as [ErrEventsCompacted]. It is the last event sent.
+	EventError EventType = "Error"
+)
+
+// WatchEvent is a change of a model reported by [DBStore.Watch].
+type WatchEvent struct {
+	Type EventType
+	// Version is a position of the event in the change log. Watching can be resumed from it.
+	Version manifest.Version
+	// Object is a pointer to the model as it was after the change, or before it was deleted.
+	Object any
+	// Err is the error that stopped watching, if Type is [EventError].
+	Err error
+}
+
+const (
+	changeLogPluginName   = "wyrd:change_log"
+	changeLogCallbackName = "wyrd:log_change"
+
+	// changeLogMatchedKey is a key of GORM statement instance setting holding rows matched by an update or delete statement.
+	changeLogMatchedKey = "wyrd:change_log_matched"
+
+	// defaultWatchPollInterval is how often the change log is polled for new events, unless set by [ChangeLog.PollInterval].
+	defaultWatchPollInterval = time.Second
+	// defaultWatchGapTimeout is how long watchers wait for skipped events to be committed, unless set by [ChangeLog.GapTimeout].
+	defaultWatchGapTimeout = time.Minute
+	// watchBatchSize is the maximum number of events read from the change log at once.
+	watchBatchSize = 100
+	// maxWatchGaps is the maximum number of ranges of skipped events a watcher waits for. Oldest ones are given up first.
+	maxWatchGaps = 100
+)
+
+// changeRow is a row of the change log, holding a model as it was after a change.
+type changeRow struct {
+	Seq       uint64    `gorm:"primaryKey;autoIncrement"`
+	Model     string    `gorm:"size:64;not null;index:idx_wyrd_change_log_model"`
+	Type      EventType `gorm:"size:16;not null"`
+	CreatedAt time.Time
+	Value     []byte
+}
+
+func (changeRow) TableName() string {
+	return "wyrd_change_log"
+}
+
+// changeLogState is a single row holding the sequence number of the last event removed from the change log.
+type changeLogState struct {
+	ID        uint `gorm:"primaryKey"`
+	Compacted uint64
+}
+
+func (changeLogState) TableName() string {
+	return "wyrd_change_log_state"
+}
+
+// ChangeLog is a [gorm.Plugin] that records changes of models into a change log table, so that they can be watched with [DBStore.Watch].
+//
+// Changes are recorded by callbacks in the same transaction as the statement that makes them, holding JSON encoding of the changed model.
+// Thus the change log works with any DB, and no change is recorded if the transaction is rolled back.
+// Changes made with raw SQL are not recorded.
+//
+// Sequence numbers of changes are allocated when a transaction records them, not when it commits.
+// Thus, on DBs that run transactions concurrently, changes can be committed out of order of their sequence numbers,
+// and sequence numbers of rolled back changes are skipped. Watchers wait up to GapTimeout for skipped changes to be committed.
+type ChangeLog struct {
+	// Config is the schema config of the models.
+	Config SchemaConfig
+	// Models to record changes of.
+	Models []any
+
+	// Limit is the maximum number of events kept in the change log. Older events are removed when new ones are recorded.
+	// Zero means no limit.
+	Limit int
+	// MaxAge is the maximum age of events kept in the change log. Older events are removed when new ones are recorded.
+	// Zero means no limit.
+	MaxAge time.Duration
+	// PollInterval is how often watchers check the change log for new events. Defaults to 1 second.
+	PollInterval time.Duration
+	// GapTimeout is how long watchers wait for events skipped over to be committed, see [DBStore.Watch]. Defaults to 1 minute.
+	// It should be longer than the longest transaction that changes watched models.
+	GapTimeout time.Duration
+
+	tables map[string]*schema.Schema
+}
+
+// EnableWatch creates the change log table and registers callbacks recording changes of given models into it.
+// Events are kept without retention limits, use [ChangeLog] plugin directly to set them.
+func EnableWatch(db *gorm.DB, config SchemaConfig, models ...any) error {
+	return db.Use(&ChangeLog{Config: config, Models: models})
+}
+
+// Name implements [gorm.Plugin] interface.
+func (p *ChangeLog) Name() string {
+	return changeLogPluginName
+}
+
+// Initialize implements [gorm.Plugin] interface. It creates the change log table and registers callbacks.
+func (p *ChangeLog) Initialize(db *gorm.DB) error {
+	if err := db.AutoMigrate(&changeRow{}, &changeLogState{}); err != nil {
+		return fmt.Errorf("failed to create change log: %w", err)
+	}
+
+	p.tables = make(map[string]*schema.Schema, len(p.Models))
+	for _, model := range p.Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		p.tables[stmt.Schema.Table] = stmt.Schema
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().After("gorm:create").Register(changeLogCallbackName, p.createCallback),
+		callbacks.Update().Before("gorm:update").Register(changeLogCallbackName+"_match", p.matchCallback),
+		callbacks.Update().After("gorm:update").Register(changeLogCallbackName, p.updateCallback),
+		callbacks.Delete().Before("gorm:delete").Register(changeLogCallbackName+"_match", p.matchCallback),
+		callbacks.Delete().After("gorm:delete").Register(changeLogCallbackName, p.deleteCallback),
+	)
+}
+
+func (p *ChangeLog) logged(db *gorm.DB) (*schema.Schema, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, false
+	}
+
+	_, ok := p.tables[db.Statement.Schema.Table]
+	return db.Statement.Schema, ok
+}
+
+func (p *ChangeLog) session(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+}
+
+// createCallback records models created by a statement as added.
+// Note models are re-loaded from the DB to record values of fields set by the DB.
+func (p *ChangeLog) createCallback(db *gorm.DB) {
+	s, ok := p.logged(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+
+	rows, err := reloadAffected(db, p.Config.IDColumnName)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to record changes: %w", err))
+		return
+	}
+
+	if err := p.log(p.session(db), s, rows, func(reflect.Value) EventType { return EventAdded }); err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+// matchCallback loads models that an update or delete statement is about to change,
+// as deleted models can't be loaded after, and updated models may no longer match conditions of the statement.
+func (p *ChangeLog) matchCallback(db *gorm.DB) {
+	s, ok := p.logged(db)
+	if !ok {
+		return
+	}
+
+	exprs := matchConditions(db, s)
+	if len(exprs) == 0 {
+		return
+	}
+
+	tx := p.session(db)
+	if db.Statement.Unscoped {
+		tx = tx.Unscoped()
+	}
+
+	rows := reflect.New(reflect.SliceOf(s.ModelType))
+	if err := tx.Clauses(clause.Where{Exprs: exprs}).Find(rows.Interface()).Error; err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to record changes: %w", err))
+		return
+	}
+
+	db.InstanceSet(changeLogMatchedKey, rows.Elem())
+}
+
+func (p *ChangeLog) matched(db *gorm.DB) (reflect.Value, bool) {
+	v, ok := db.InstanceGet(changeLogMatchedKey)
+	if !ok || db.RowsAffected == 0 {
+		return reflect.Value{}, false
+	}
+
+	rows, ok := v.(reflect.Value)
+	return rows, ok && rows.Len() > 0
+}
+
+// updateCallback records models changed by an update statement as modified, or added if the update restored them.
+func (p *ChangeLog) updateCallback(db *gorm.DB) {
+	s, ok := p.logged(db)
+	if !ok {
+		return
+	}
+	before, ok := p.matched(db)
+	if !ok {
+		return
+	}
+
+	idField := s.LookUpField(p.Config.IDColumnName)
+	if idField == nil {
+		return
+	}
+
+	wasDeleted := map[any]bool{}
+	ids := make([]any, 0, before.Len())
+	for i := 0; i < before.Len(); i++ {
+		id, _ := idField.ValueOf(db.Statement.Context, before.Index(i))
+		ids = append(ids, id)
+		wasDeleted[id] = p.deleted(db.Statement.Context, s, before.Index(i))
+	}
+
+	rows, err := loadByIDs(db, s, p.Config.IDColumnName, ids)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("failed to load models to record changes: %w", err))
+		return
+	}
+
+	err = p.log(p.session(db), s, rows, func(row reflect.Value) EventType {
+		id, _ := idField.ValueOf(db.Statement.Context, row)
+		switch isDeleted := p.deleted(db.Statement.Context, s, row); {
+		case wasDeleted[id] && !isDeleted:
+			return EventAdded
+		case !wasDeleted[id] && isDeleted:
+			return EventDeleted
+		case isDeleted:
+			// Changes of deleted models are not visible to watchers
+			return ""
+		}
+		return EventModified
+	})
+	if err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+// deleteCallback records models deleted by a statement, as they were before deletion.
+// Permanently deleting previously soft-deleted models is not recorded, as they have been reported deleted already.
+func (p *ChangeLog) deleteCallback(db *gorm.DB) {
+	s, ok := p.logged(db)
+	if !ok {
+		return
+	}
+	before, ok := p.matched(db)
+	if !ok {
+		return
+	}
+
+	err := p.log(p.session(db), s, before, func(row reflect.Value) EventType {
+		if p.deleted(db.Statement.Context, s, row) {
+			return ""
+		}
+		return EventDeleted
+	})
+	if err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+func (p *ChangeLog) deleted(ctx context.Context, s *schema.Schema, row reflect.Value) bool {
+	field := s.LookUpField(p.Config.DeletedAtColumnName)
+	if field == nil {
+		return false
+	}
+
+	return timeOf(field.ReflectValueOf(ctx, reflect.Indirect(row))) != nil
+}
+
+// log records changes of the models, of the type returned by eventType function. Models with empty event type are skipped.
+func (p *ChangeLog) log(tx *gorm.DB, s *schema.Schema, rows reflect.Value, eventType func(reflect.Value) EventType) error {
+	now := time.Now()
+	changes := make([]changeRow, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		t := eventType(row)
+		if t == "" {
+			continue
+		}
+
+		value, err := json.Marshal(row.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("failed to encode change: %w", err)
+		}
+
+		changes = append(changes, changeRow{
+			Model:     s.Table,
+			Type:      t,
+			CreatedAt: now,
+			Value:     value,
+		})
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := tx.Create(&changes).Error; err != nil {
+		return fmt.Errorf("failed to record changes: %w", err)
+	}
+
+	if err := p.compact(tx, changes[len(changes)-1]); err != nil {
+		return fmt.Errorf("failed to remove old changes: %w", err)
+	}
+
+	return nil
+}
+
+// compact removes events beyond retention limits from the change log, and remembers the last one removed.
+func (p *ChangeLog) compact(tx *gorm.DB, latest changeRow) error {
+	var compacted uint64
+	if p.Limit > 0 && latest.Seq > uint64(p.Limit) {
+		compacted = latest.Seq - uint64(p.Limit)
+	}
+	if p.MaxAge > 0 {
+		var seqs []uint64
+		if err := tx.Model(&changeRow{}).Where("created_at < ?", latest.CreatedAt.Add(-p.MaxAge)).Order("seq DESC").Limit(1).Pluck("seq", &seqs).Error; err != nil {
+			return err
+		}
+		if len(seqs) > 0 {
+			compacted = max(compacted, seqs[0])
+		}
+	}
+
+	if compacted == 0 {
+		return nil
+	}
+
+	var state changeLogState
+	if err := tx.Limit(1).Find(&state).Error; err != nil {
+		return err
+	}
+	if compacted <= state.Compacted {
+		return nil
+	}
+
+	if err := tx.Where("seq <= ?", compacted).Delete(&changeRow{}).Error; err != nil {
+		return err
+	}
+
+	state.Compacted = compacted
+	if state.ID == 0 {
+		state.ID = 1
+		return tx.Create(&state).Error
+	}
+	return tx.Model(&state).Update("compacted", compacted).Error
+}
+
+func changeLogPlugin(db *gorm.DB) (*ChangeLog, bool) {
+	p, ok := db.Config.Plugins[changeLogPluginName].(*ChangeLog)
+	return p, ok
+}
+
+// Watch returns a channel of events reporting changes of models of the given type that match the search query.
+// Type of the model determines which model to watch. No field of the value is used, thus a pointer to an default value can be safely passed.
+// Search query selector, name, full-text search terms and time range filter events, the rest of it is ignored.
+//
+// Events following the given version are sent, or events following the call if the version is zero.
+// [ErrEventsCompacted] is returned if events following the version have been removed from the change log,
+// and reported by [EventError] event if that happens while watching, as events are not read in time.
+// The channel is closed when the context is done, or after an [EventError] event.
+//
+// Events committed by concurrent transactions out of order of their versions are sent as they are committed,
+// if that happens within [ChangeLog.GapTimeout] after a later event has been sent. Thus versions of events are not always increasing,
+// and resuming from the version of such an event may send some events again.
+//
+// Returns [ErrWatchNotEnabled] if change log is not enabled for the model, see [EnableWatch].
+// Note: the change log is polled for new events, see [ChangeLog.PollInterval].
+func (s *DBStore) Watch(ctx context.Context, model any, searchQuery manifest.SearchQuery, fromVersion manifest.Version) (<-chan WatchEvent, error) {
+	p, ok := changeLogPlugin(s.db)
+	if !ok {
+		return nil, ErrWatchNotEnabled
+	}
+
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	sch, ok := p.tables[stmt.Schema.Table]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrWatchNotEnabled, stmt.Schema.Table)
+	}
+
+	filter, err := newQueryFilter(sch, s.config, searchQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.db.WithContext(ctx)
+	last := uint64(fromVersion)
+	if fromVersion == 0 {
+		if err := db.Model(&changeRow{}).Select("COALESCE(MAX(seq), 0)").Scan(&last).Error; err != nil {
+			return nil, err
+		}
+	} else if err := checkCompacted(db, last); err != nil {
+		return nil, err
+	}
+
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = defaultWatchPollInterval
+	}
+	watcher := &changeWatcher{
+		db:         db,
+		schema:     sch,
+		filter:     filter,
+		gapTimeout: p.GapTimeout,
+		last:       last,
+	}
+	if watcher.gapTimeout <= 0 {
+		watcher.gapTimeout = defaultWatchGapTimeout
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		send := func(event WatchEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			if err := watcher.poll(send); err != nil {
+				if ctx.Err() == nil {
+					send(WatchEvent{Type: EventError, Err: err})
+				}
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func checkCompacted(db *gorm.DB, last uint64) error {
+	var state changeLogState
+	if err := db.Limit(1).Find(&state).Error; err != nil {
+		return err
+	}
+	if state.Compacted > last {
+		return fmt.Errorf("%w: events after %d are not available", ErrEventsCompacted, last)
+	}
+
+	return nil
+}
+
+// changeWatcher reads events of a model from the change log following the last one seen,
+// and events skipped over, as they may have been committed after later ones.
+type changeWatcher struct {
+	db         *gorm.DB
+	schema     *schema.Schema
+	filter     queryFilter
+	gapTimeout time.Duration
+
+	last uint64
+	gaps []changeGap
+}
+
+// changeGap is a range of sequence numbers skipped by a watcher, that events may yet be committed with.
+type changeGap struct {
+	from, to uint64
+	// seen is the time the gap was noticed.
+	seen time.Time
+}
+
+// poll sends new events of the model, and events that have filled gaps. Events of other models, or not matching the filter, are seen but not sent.
+func (w *changeWatcher) poll(send func(WatchEvent) bool) error {
+	now := time.Now()
+	w.gaps = slices.DeleteFunc(w.gaps, func(gap changeGap) bool {
+		return now.Sub(gap.seen) > w.gapTimeout
+	})
+
+	for {
+		tx := w.db.Where("seq > ?", w.last)
+		for _, gap := range w.gaps {
+			tx = tx.Or("seq BETWEEN ? AND ?", gap.from, gap.to)
+		}
+
+		var changes []changeRow
+		if err := tx.Order("seq").Limit(watchBatchSize).Find(&changes).Error; err != nil {
+			return err
+		}
+		// Events could be removed after they were read, if they have been compacted while not read in time
+		if err := checkCompacted(w.db, w.last); err != nil {
+			return err
+		}
+
+		for _, change := range changes {
+			w.seen(change.Seq, now)
+			if change.Model != w.schema.Table {
+				continue
+			}
+
+			object := reflect.New(w.schema.ModelType)
+			if err := json.Unmarshal(change.Value, object.Interface()); err != nil {
+				return fmt.Errorf("failed to decode change: %w", err)
+			}
+			if _, ok := w.filter.match(object.Elem()); !ok {
+				continue
+			}
+
+			if !send(WatchEvent{Type: change.Type, Version: manifest.Version(change.Seq), Object: object.Interface()}) {
+				return w.db.Statement.Context.Err()
+			}
+		}
+
+		if len(changes) < watchBatchSize {
+			return nil
+		}
+	}
+}
+
+// seen marks the event with the sequence number as seen, either following the last one, or filling a gap.
+func (w *changeWatcher) seen(seq uint64, now time.Time) {
+	if seq > w.last {
+		if seq > w.last+1 {
+			w.gaps = append(w.gaps, changeGap{from: w.last + 1, to: seq - 1, seen: now})
+			if len(w.gaps) > maxWatchGaps {
+				w.gaps = w.gaps[len(w.gaps)-maxWatchGaps:]
+			}
+		}
+		w.last = seq
+		return
+	}
+
+	for i, gap := range w.gaps {
+		if seq < gap.from || seq > gap.to {
+			continue
+		}
+
+		var rest []changeGap
+		if seq > gap.from {
+			rest = append(rest, changeGap{from: gap.from, to: seq - 1, seen: gap.seen})
+		}
+		if seq < gap.to {
+			rest = append(rest, changeGap{from: seq + 1, to: gap.to, seen: gap.seen})
+		}
+		w.gaps = slices.Replace(w.gaps, i, i+1, rest...)
+		return
+	}
+}
@@ -0,0 +1,184 @@
+package dbstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func makeWatchStore(t *testing.T, plugin *dbstore.ChangeLog) *dbstore.DBStore {
+	var plugins []gorm.Plugin
+	if plugin != nil {
+		plugin.PollInterval = 5 * time.Millisecond
+		plugins = append(plugins, plugin)
+	}
+
+	db, store := openTestDB(t, plugins...)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Watchers poll the DB concurrently with writes
+	sqlDB.SetMaxOpenConns(1)
+
+	return store
+}
+
+type watchedEvent struct {
+	Type dbstore.EventType
+	Name manifest.ResourceName
+}
+
+// receiveEvents reads given number of events from the channel, failing the test if they are not received in time.
+func receiveEvents(t *testing.T, events <-chan dbstore.WatchEvent, count int) (result []dbstore.WatchEvent) {
+	timeout := time.After(5 * time.Second)
+	for len(result) < count {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "events channel closed after %v", result)
+			result = append(result, event)
+		case <-timeout:
+			require.FailNow(t, "timed out waiting for events", "received %v", result)
+		}
+	}
+
+	return result
+}
+
+func watchedEvents(events []dbstore.WatchEvent) []watchedEvent {
+	result := make([]watchedEvent, 0, len(events))
+	for _, e := range events {
+		result = append(result, watchedEvent{Type: e.Type, Name: e.Object.(*Pet).Name})
+	}
+	return result
+}
+
+func TestDBStore_Watch(t *testing.T) {
+	store := makeWatchStore(t, &dbstore.ChangeLog{Config: dbstore.ManifestModel, Models: []any{&Pet{}}})
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	fluffy := makePet("fluffy", "Fluffy", withLabels(manifest.Labels{"kind": "cat"}))
+	rex := makePet("rex", "Rex", withLabels(manifest.Labels{"kind": "dog"}))
+	require.NoError(t, store.Create(ctx, &fluffy))
+	require.NoError(t, store.Create(ctx, &rex))
+
+	selector, err := manifest.ParseSelector("kind=cat")
+	require.NoError(t, err)
+	events, err := store.Watch(ctx, &Pet{}, manifest.SearchQuery{Selector: selector}, 0)
+	require.NoError(t, err)
+
+	fluffy.Spec.CustomName = "Mr. Fluffy"
+	_, err = store.Update(ctx, &fluffy, fluffy.UID)
+	require.NoError(t, err)
+	rex.Spec.CustomName = "Sir Rex"
+	_, err = store.Update(ctx, &rex, rex.UID)
+	require.NoError(t, err)
+	_, err = store.Delete(ctx, &Pet{}, fluffy.UID, 0)
+	require.NoError(t, err)
+	_, err = store.Restore(ctx, &Pet{}, fluffy.UID)
+	require.NoError(t, err)
+	tom := makePet("tom", "Tom", withLabels(manifest.Labels{"kind": "cat"}))
+	require.NoError(t, store.Create(ctx, &tom))
+
+	got := receiveEvents(t, events, 4)
+	require.Equal(t, []watchedEvent{
+		{Type: dbstore.EventModified, Name: "fluffy"},
+		{Type: dbstore.EventDeleted, Name: "fluffy"},
+		{Type: dbstore.EventAdded, Name: "fluffy"},
+		{Type: dbstore.EventAdded, Name: "tom"},
+	}, watchedEvents(got))
+	require.Equal(t, "Mr. Fluffy", got[0].Object.(*Pet).Spec.CustomName)
+
+	// Resume after the first event
+	resumed, err := store.Watch(ctx, &Pet{}, manifest.SearchQuery{Selector: selector}, got[0].Version)
+	require.NoError(t, err)
+	require.Equal(t, watchedEvents(got[1:]), watchedEvents(receiveEvents(t, resumed, 3)))
+
+	// The channel is closed when the context is done
+	cancel()
+	for range events {
+	}
+}
+
+func TestDBStore_WatchRollback(t *testing.T) {
+	store := makeWatchStore(t, &dbstore.ChangeLog{Config: dbstore.ManifestModel, Models: []any{&Pet{}}})
+	ctx := context.TODO()
+
+	events, err := store.Watch(ctx, &Pet{}, manifest.SearchQuery{}, 0)
+	require.NoError(t, err)
+
+	tx, err := store.Begin(ctx)
+	require.NoError(t, err)
+	fluffy := makePet("fluffy", "Fluffy")
+	require.NoError(t, tx.Create(&fluffy))
+	tx.Rollback()
+
+	rex := makePet("rex", "Rex")
+	require.NoError(t, store.Create(ctx, &rex))
+
+	require.Equal(t, []watchedEvent{{Type: dbstore.EventAdded, Name: "rex"}}, watchedEvents(receiveEvents(t, events, 1)))
+}
+
+func TestDBStore_WatchLateCommit(t *testing.T) {
+	db, store := openTestDB(t, &dbstore.ChangeLog{Config: dbstore.ManifestModel, Models: []any{&Pet{}}, PollInterval: 5 * time.Millisecond})
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	events, err := store.Watch(ctx, &Pet{}, manifest.SearchQuery{}, 0)
+	require.NoError(t, err)
+
+	// Change of fluffy is recorded first, but committed after the change of rex, as concurrent transactions can be
+	fluffy := makePet("fluffy", "Fluffy")
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return errors.Join(
+			tx.Create(&fluffy).Error,
+			tx.Exec("CREATE TABLE held_changes AS SELECT * FROM wyrd_change_log").Error,
+			tx.Exec("DELETE FROM wyrd_change_log").Error,
+		)
+	}))
+	rex := makePet("rex", "Rex")
+	require.NoError(t, store.Create(ctx, &rex))
+
+	got := receiveEvents(t, events, 1)
+	require.Equal(t, []watchedEvent{{Type: dbstore.EventAdded, Name: "rex"}}, watchedEvents(got))
+	require.NoError(t, db.Exec("INSERT INTO wyrd_change_log SELECT * FROM held_changes").Error)
+
+	late := receiveEvents(t, events, 1)
+	require.Equal(t, []watchedEvent{{Type: dbstore.EventAdded, Name: "fluffy"}}, watchedEvents(late))
+	require.Less(t, late[0].Version, got[0].Version)
+}
+
+func TestDBStore_WatchCompacted(t *testing.T) {
+	store := makeWatchStore(t, &dbstore.ChangeLog{Config: dbstore.ManifestModel, Models: []any{&Pet{}}, Limit: 2})
+	ctx := context.TODO()
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		pet := makePet(name, name)
+		require.NoError(t, store.Create(ctx, &pet))
+	}
+
+	_, err := store.Watch(ctx, &Pet{}, manifest.SearchQuery{}, 1)
+	require.ErrorIs(t, err, dbstore.ErrEventsCompacted)
+
+	events, err := store.Watch(ctx, &Pet{}, manifest.SearchQuery{}, 2)
+	require.NoError(t, err)
+	require.Equal(t, []watchedEvent{
+		{Type: dbstore.EventAdded, Name: "c"},
+		{Type: dbstore.EventAdded, Name: "d"},
+	}, watchedEvents(receiveEvents(t, events, 2)))
+}
+
+func TestDBStore_WatchNotEnabled(t *testing.T) {
+	store := makeWatchStore(t, nil)
+
+	_, err := store.Watch(context.TODO(), &Pet{}, manifest.SearchQuery{}, 0)
+	require.ErrorIs(t, err, dbstore.ErrWatchNotEnabled)
+}
@@ -0,0 +1,33 @@
+// Package webhookoutbox delivers messages of a [dbstore.OutboxRelay] to webhooks,
+// so that the webhooks package does not depend on drivers of the store.
+package webhookoutbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/webhooks"
+)
+
+// NewSink returns a sink that delivers messages of an outbox, with JSON encoded [webhooks.EventPayload], to the webhooks with the caller.
+// Messages are posted with their key as the idempotency key, see [webhooks.WithIdempotencyKey], so that receivers can discard repeated deliveries.
+// Note: a message is delivered again to every webhook if posting it to any of them fails.
+func NewSink(caller webhooks.Caller, hooks ...webhooks.Webhook) dbstore.OutboxSink {
+	return dbstore.OutboxSinkFunc(func(ctx context.Context, message dbstore.OutboxMessage) error {
+		var event webhooks.EventPayload
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			return fmt.Errorf("failed to decode webhook payload of outbox message %q: %w", message.Key, err)
+		}
+
+		ctx = webhooks.WithIdempotencyKey(ctx, message.Key)
+		for _, hook := range hooks {
+			if err := caller.Post(ctx, hook, event); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+package webhookoutbox_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/bark"
+	"github.com/sre-norns/wyrd/pkg/dbstore"
+	"github.com/sre-norns/wyrd/pkg/dbstore/webhookoutbox"
+	"github.com/sre-norns/wyrd/pkg/webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSink(t *testing.T) {
+	var keys []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(bark.HTTPHeaderIdempotencyKey))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	caller, err := webhooks.NewHTTPCaller(server.Client())
+	require.NoError(t, err)
+	hook := webhooks.Webhook{Spec: webhooks.WebhookSpec{Schema: target.Scheme, Host: target.Host, Path: "/events"}}
+
+	message, err := dbstore.NewOutboxMessage("pet.deleted", "fluffy", webhooks.EventPayload{Principle: "alice"})
+	require.NoError(t, err)
+	message.Key = "key-1"
+
+	sink := webhookoutbox.NewSink(caller, hook, hook)
+	require.NoError(t, sink.Deliver(context.TODO(), message))
+	require.Equal(t, []string{"key-1", "key-1"}, keys)
+
+	status = http.StatusInternalServerError
+	require.Error(t, sink.Deliver(context.TODO(), message))
+
+	message.Payload = []byte("not json")
+	require.Error(t, sink.Deliver(context.TODO(), message))
+}
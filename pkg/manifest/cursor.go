@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidContinueToken is returned when a continue token can not be decoded, its signature doesn't match or it was issued for a different query.
+var ErrInvalidContinueToken = errors.New("invalid continue token")
+
+// Cursor identifies a position in an ordered list of resources for keyset pagination.
+// It holds values of the sort keys of the last seen resource and its UID, used to break ties.
+type Cursor struct {
+	// Sort is a string representation of the [SortSpec] the cursor was issued for.
+	Sort string `json:"s,omitempty"`
+	// Values of the sort keys of the last seen resource, in the order of the sort spec.
+	Values []any `json:"v,omitempty"`
+	// UID of the last seen resource.
+	UID ResourceID `json:"u"`
+}
+
+// ContinueTokenCodec encodes [Cursor] into an opaque continue token and back.
+// If Key is set, tokens are signed with HMAC-SHA256 and tokens with missing or invalid signature are rejected.
+type ContinueTokenCodec struct {
+	Key []byte
+}
+
+// Encode returns opaque continue token representing the cursor.
+func (c ContinueTokenCodec) Encode(cursor Cursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(data)
+	if len(c.Key) == 0 {
+		return token, nil
+	}
+
+	return token + "." + base64.RawURLEncoding.EncodeToString(c.sign(data)), nil
+}
+
+// Decode returns [Cursor] represented by the continue token. Returned error, if any, wraps [ErrInvalidContinueToken].
+func (c ContinueTokenCodec) Decode(token string) (Cursor, error) {
+	var cursor Cursor
+
+	payload, signature, signed := strings.Cut(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return cursor, fmt.Errorf("%w: %w", ErrInvalidContinueToken, err)
+	}
+
+	if len(c.Key) == 0 && signed {
+		return cursor, fmt.Errorf("%w: unexpected signature", ErrInvalidContinueToken)
+	} else if len(c.Key) > 0 {
+		if !signed {
+			return cursor, fmt.Errorf("%w: token is not signed", ErrInvalidContinueToken)
+		}
+
+		sig, err := base64.RawURLEncoding.DecodeString(signature)
+		if err != nil || !hmac.Equal(sig, c.sign(data)) {
+			return cursor, fmt.Errorf("%w: signature mismatch", ErrInvalidContinueToken)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return cursor, fmt.Errorf("%w: %w", ErrInvalidContinueToken, err)
+	}
+
+	return cursor, nil
+}
+
+func (c ContinueTokenCodec) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,83 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinueTokenCodec(t *testing.T) {
+	cursor := manifest.Cursor{
+		Sort:   "-metadata.updateTimestamp,metadata.name",
+		Values: []any{"2024-02-27T00:00:00Z", "name", 42},
+		UID:    "00000000-0000-0000-0000-000000000001",
+	}
+	expect := manifest.Cursor{
+		Sort:   cursor.Sort,
+		Values: []any{"2024-02-27T00:00:00Z", "name", json.Number("42")},
+		UID:    cursor.UID,
+	}
+
+	testCases := map[string]struct {
+		encoder manifest.ContinueTokenCodec
+		decoder manifest.ContinueTokenCodec
+		tamper  func(string) string
+
+		expectError bool
+	}{
+		"unsigned": {},
+		"signed": {
+			encoder: manifest.ContinueTokenCodec{Key: []byte("secret")},
+			decoder: manifest.ContinueTokenCodec{Key: []byte("secret")},
+		},
+		"wrong-key": {
+			encoder:     manifest.ContinueTokenCodec{Key: []byte("secret")},
+			decoder:     manifest.ContinueTokenCodec{Key: []byte("other")},
+			expectError: true,
+		},
+		"missing-signature": {
+			decoder:     manifest.ContinueTokenCodec{Key: []byte("secret")},
+			expectError: true,
+		},
+		"unexpected-signature": {
+			encoder:     manifest.ContinueTokenCodec{Key: []byte("secret")},
+			expectError: true,
+		},
+		"tampered-payload": {
+			encoder: manifest.ContinueTokenCodec{Key: []byte("secret")},
+			decoder: manifest.ContinueTokenCodec{Key: []byte("secret")},
+			tamper: func(token string) string {
+				payload, signature, _ := strings.Cut(token, ".")
+				return "x" + payload[1:] + "." + signature
+			},
+			expectError: true,
+		},
+		"garbage": {
+			tamper:      func(string) string { return "!!!" },
+			expectError: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			token, err := test.encoder.Encode(cursor)
+			require.NoError(t, err)
+			if test.tamper != nil {
+				token = test.tamper(token)
+			}
+
+			got, err := test.decoder.Decode(token)
+			if test.expectError {
+				require.ErrorIs(t, err, manifest.ErrInvalidContinueToken)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, expect, got)
+		})
+	}
+}
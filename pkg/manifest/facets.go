@@ -0,0 +1,34 @@
+package manifest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FacetCount is a number of resources that have the same values of faceted label keys, such as `env=prod (412)`.
+type FacetCount struct {
+	// Labels are values of the faceted label keys. Keys that resources don't have are omitted.
+	Labels Labels `form:"labels" json:"labels,omitempty" yaml:"labels,omitempty" xml:"labels"`
+	// Count is the number of resources with these label values.
+	Count int64 `form:"count" json:"count" yaml:"count" xml:"count"`
+}
+
+// String returns facet in a form suitable for display, such as `env=prod (412)`.
+func (f FacetCount) String() string {
+	var sb strings.Builder
+	f.Labels.Format(&sb)
+	sb.WriteString(" (")
+	sb.WriteString(strconv.FormatInt(f.Count, 10))
+	sb.WriteString(")")
+
+	return sb.String()
+}
+
+// TimeBucket is a number of resources with a timestamp within a bucket of a histogram.
+type TimeBucket struct {
+	// Start is the time the bucket starts at, included in the bucket. Buckets are aligned to Unix epoch.
+	Start time.Time `form:"start" json:"start" yaml:"start" xml:"start"`
+	// Count is the number of resources with a timestamp in the bucket.
+	Count int64 `form:"count" json:"count" yaml:"count" xml:"count"`
+}
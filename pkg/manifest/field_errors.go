@@ -0,0 +1,267 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldErrorType defines a category of a validation error of a field.
+type FieldErrorType string
+
+const (
+	// FieldErrorRequired is used to report required values that are not provided.
+	FieldErrorRequired FieldErrorType = "Required"
+	// FieldErrorInvalid is used to report malformed values, such as a string that does not match a pattern.
+	FieldErrorInvalid FieldErrorType = "Invalid"
+	// FieldErrorDuplicate is used to report collisions of values that must be unique.
+	FieldErrorDuplicate FieldErrorType = "Duplicate"
+	// FieldErrorNotSupported is used to report unknown fields or values that are not one of the supported values.
+	FieldErrorNotSupported FieldErrorType = "NotSupported"
+	// FieldErrorTooLong is used to report values that exceed maximum allowed length.
+	FieldErrorTooLong FieldErrorType = "TooLong"
+)
+
+// String returns human readable description of the error type.
+func (t FieldErrorType) String() string {
+	switch t {
+	case FieldErrorRequired:
+		return "Required value"
+	case FieldErrorInvalid:
+		return "Invalid value"
+	case FieldErrorDuplicate:
+		return "Duplicate value"
+	case FieldErrorNotSupported:
+		return "Unsupported value"
+	case FieldErrorTooLong:
+		return "Too long"
+	default:
+		return string(t)
+	}
+}
+
+// FieldPath represents a path from the root of an object to a field in it, for example: `metadata.labels[env]`.
+// Nil value represents the root of an object.
+type FieldPath struct {
+	name   string
+	index  string
+	parent *FieldPath
+}
+
+// NewPath returns a [FieldPath] to a root level field name, followed by optional child field names.
+func NewPath(name string, moreNames ...string) *FieldPath {
+	return (*FieldPath)(nil).Child(name, moreNames...)
+}
+
+// Child returns a new [FieldPath] to a child field of the current path.
+func (p *FieldPath) Child(name string, moreNames ...string) *FieldPath {
+	result := &FieldPath{name: name, parent: p}
+	for _, n := range moreNames {
+		result = &FieldPath{name: n, parent: result}
+	}
+
+	return result
+}
+
+// Index returns a new [FieldPath] to an element of a list identified by the current path.
+func (p *FieldPath) Index(index int) *FieldPath {
+	return &FieldPath{index: strconv.Itoa(index), parent: p}
+}
+
+// Key returns a new [FieldPath] to an element of a map identified by the current path.
+func (p *FieldPath) Key(key string) *FieldPath {
+	return &FieldPath{index: key, parent: p}
+}
+
+// String returns string representation of the path.
+func (p *FieldPath) String() string {
+	if p == nil {
+		return ""
+	}
+
+	elements := []*FieldPath{}
+	for e := p; e != nil; e = e.parent {
+		elements = append(elements, e)
+	}
+
+	var sb strings.Builder
+	for i := len(elements) - 1; i >= 0; i-- {
+		e := elements[i]
+		if e.name != "" {
+			if sb.Len() > 0 {
+				sb.WriteRune('.')
+			}
+			sb.WriteString(e.name)
+		} else {
+			sb.WriteRune('[')
+			sb.WriteString(e.index)
+			sb.WriteRune(']')
+		}
+	}
+
+	return sb.String()
+}
+
+// FieldError represents a validation error of a single field of an object.
+type FieldError struct {
+	// Type is the category of the error
+	Type FieldErrorType `form:"type" json:"type" yaml:"type" xml:"type"`
+	// Field is the path to the field that failed validation, for example `metadata.labels[env]`.
+	Field string `form:"field" json:"field" yaml:"field" xml:"field"`
+	// BadValue is the value of the field that failed validation, if any.
+	BadValue any `form:"value" json:"value,omitempty" yaml:"value,omitempty" xml:"value,omitempty"`
+	// Detail is human readable explanation of the error, suitable for display
+	Detail string `form:"detail" json:"detail,omitempty" yaml:"detail,omitempty" xml:"detail,omitempty"`
+
+	cause error
+}
+
+// NewFieldError returns a new [FieldError] caused by the given error.
+func NewFieldError(errType FieldErrorType, path *FieldPath, value any, err error) *FieldError {
+	result := &FieldError{
+		Type:     errType,
+		Field:    path.String(),
+		BadValue: value,
+		cause:    err,
+	}
+	if err != nil {
+		result.Detail = err.Error()
+	}
+
+	return result
+}
+
+// Required returns a [FieldError] reporting a missing required value.
+func Required(path *FieldPath, detail string) *FieldError {
+	return &FieldError{Type: FieldErrorRequired, Field: path.String(), Detail: detail}
+}
+
+// Invalid returns a [FieldError] reporting a malformed value.
+func Invalid(path *FieldPath, value any, detail string) *FieldError {
+	return &FieldError{Type: FieldErrorInvalid, Field: path.String(), BadValue: value, Detail: detail}
+}
+
+// Duplicate returns a [FieldError] reporting a value that is not unique.
+func Duplicate(path *FieldPath, value any) *FieldError {
+	return &FieldError{Type: FieldErrorDuplicate, Field: path.String(), BadValue: value}
+}
+
+// NotSupported returns a [FieldError] reporting a value that is not one of the supported values.
+func NotSupported(path *FieldPath, value any, validValues []string) *FieldError {
+	detail := ""
+	if len(validValues) > 0 {
+		quoted := make([]string, 0, len(validValues))
+		for _, v := range validValues {
+			quoted = append(quoted, strconv.Quote(v))
+		}
+		detail = "supported values: " + strings.Join(quoted, ", ")
+	}
+
+	return &FieldError{Type: FieldErrorNotSupported, Field: path.String(), BadValue: value, Detail: detail}
+}
+
+// TooLong returns a [FieldError] reporting a value that exceeds maxLength.
+func TooLong(path *FieldPath, value any, maxLength int) *FieldError {
+	return &FieldError{Type: FieldErrorTooLong, Field: path.String(), BadValue: value, Detail: fmt.Sprintf("must have at most %d characters", maxLength)}
+}
+
+// Error returns string representation of the error to implement error interface for [FieldError] type.
+func (e *FieldError) Error() string {
+	var sb strings.Builder
+	if e.Field != "" {
+		sb.WriteString(e.Field)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Type.String())
+	if e.BadValue != nil {
+		sb.WriteString(fmt.Sprintf(": %#v", e.BadValue))
+	}
+	if e.Detail != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Detail)
+	}
+
+	return sb.String()
+}
+
+// Unwrap returns underlying error that caused this field error, if any.
+func (e *FieldError) Unwrap() error {
+	return e.cause
+}
+
+// FieldErrors is a collection of [FieldError]s that is itself an error.
+type FieldErrors []*FieldError
+
+// Error returns string representation of the error to implement error interface for [FieldErrors] type.
+func (e FieldErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	s := make([]string, 0, len(e))
+	for _, er := range e {
+		s = append(s, er.Error())
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(s, ", "))
+}
+
+// Unwrap returns all errors in the collection, so that [errors.Is] and [errors.As] can inspect them.
+func (e FieldErrors) Unwrap() []error {
+	result := make([]error, 0, len(e))
+	for _, er := range e {
+		result = append(result, er)
+	}
+
+	return result
+}
+
+// ErrorOrNil returns nil if the collection is empty or the collection itself as an error.
+func (e FieldErrors) ErrorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// AsFieldErrors extracts [FieldErrors] from the error chain if there are any.
+// A single [FieldError] is returned as a collection of one.
+func AsFieldErrors(err error) (FieldErrors, bool) {
+	var errs FieldErrors
+	if errors.As(err, &errs) {
+		return errs, true
+	}
+
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return FieldErrors{fieldErr}, true
+	}
+
+	return nil, false
+}
+
+const jsonUnknownFieldPrefix = "json: unknown field "
+
+// decodingError converts an error returned by a JSON or YAML decoder into a [FieldError] of a field at the given path.
+func decodingError(path *FieldPath, err error) *FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		fieldPath := path
+		if typeErr.Field != "" {
+			fieldPath = fieldPath.Child(typeErr.Field)
+		}
+		return NewFieldError(FieldErrorInvalid, fieldPath, typeErr.Value, err)
+	}
+
+	if name, ok := strings.CutPrefix(err.Error(), jsonUnknownFieldPrefix); ok {
+		if unquoted, uerr := strconv.Unquote(name); uerr == nil {
+			name = unquoted
+		}
+		return NewFieldError(FieldErrorNotSupported, path.Child(name), nil, err)
+	}
+
+	return NewFieldError(FieldErrorInvalid, path, nil, err)
+}
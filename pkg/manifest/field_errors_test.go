@@ -0,0 +1,140 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldPath_String(t *testing.T) {
+	testCases := map[string]struct {
+		given  *manifest.FieldPath
+		expect string
+	}{
+		"nil":    {given: nil, expect: ""},
+		"root":   {given: manifest.NewPath("spec"), expect: "spec"},
+		"nested": {given: manifest.NewPath("metadata", "name"), expect: "metadata.name"},
+		"child":  {given: manifest.NewPath("spec").Child("targets", "host"), expect: "spec.targets.host"},
+		"key":    {given: manifest.NewPath("metadata", "labels").Key("env"), expect: "metadata.labels[env]"},
+		"index":  {given: manifest.NewPath("spec", "targets").Index(2).Child("host"), expect: "spec.targets[2].host"},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expect, test.given.String())
+		})
+	}
+}
+
+func TestFieldErrors_JSON(t *testing.T) {
+	errs := manifest.FieldErrors{
+		manifest.Required(manifest.NewPath("spec", "host"), ""),
+		manifest.TooLong(manifest.NewPath("metadata", "name"), "xyz", 2),
+	}
+
+	got, err := json.Marshal(errs)
+	require.NoError(t, err)
+	require.Equal(t, `[{"type":"Required","field":"spec.host"},{"type":"TooLong","field":"metadata.name","value":"xyz","detail":"must have at most 2 characters"}]`, string(got))
+	require.Equal(t, `[spec.host: Required value, metadata.name: Too long: "xyz": must have at most 2 characters]`, errs.Error())
+}
+
+func TestMetadataValidation_FieldErrors(t *testing.T) {
+	given := manifest.ObjectMeta{
+		Name: "Name",
+		Labels: manifest.Labels{
+			"key":  "+invalid value",
+			"key1": "valid",
+		},
+	}
+
+	err := given.Validate()
+	require.ErrorIs(t, err, manifest.ErrNameNotDNSname)
+
+	errs, ok := manifest.AsFieldErrors(err)
+	require.True(t, ok)
+	require.Len(t, errs, 2)
+
+	require.Equal(t, manifest.FieldErrorInvalid, errs[0].Type)
+	require.Equal(t, "metadata.name", errs[0].Field)
+	require.Equal(t, "Name", errs[0].BadValue)
+
+	require.Equal(t, manifest.FieldErrorInvalid, errs[1].Type)
+	require.Equal(t, "metadata.labels[key]", errs[1].Field)
+	require.Equal(t, "+invalid value", errs[1].BadValue)
+}
+
+func TestManifestUnmarshaling_FieldErrors(t *testing.T) {
+	type TestSpec struct {
+		Value int    `json:"value"`
+		Name  string `json:"name"`
+	}
+
+	testKind := manifest.Kind("testSpec")
+	require.NoError(t, manifest.RegisterKind(testKind, &TestSpec{}))
+	defer manifest.UnregisterKind(testKind)
+
+	testCases := map[string]struct {
+		given       string
+		expectType  manifest.FieldErrorType
+		expectField string
+	}{
+		"wrong-type": {
+			given:       `{"kind":"testSpec","metadata":{"name":"x"},"spec":{"value":"one"}}`,
+			expectType:  manifest.FieldErrorInvalid,
+			expectField: "spec.value",
+		},
+		"unknown-field": {
+			given:       `{"kind":"testSpec","metadata":{"name":"x"},"spec":{"other":"one"}}`,
+			expectType:  manifest.FieldErrorNotSupported,
+			expectField: "spec.other",
+		},
+		"no-status-type": {
+			given:       `{"kind":"testSpec","metadata":{"name":"x"},"status":{"value":1}}`,
+			expectType:  manifest.FieldErrorNotSupported,
+			expectField: "status",
+		},
+		"metadata-type": {
+			given:       `{"kind":"testSpec","metadata":{"name":1}}`,
+			expectType:  manifest.FieldErrorInvalid,
+			expectField: "metadata.name",
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			var got manifest.ResourceManifest
+			err := json.Unmarshal([]byte(test.given), &got)
+			require.Error(t, err)
+
+			errs, ok := manifest.AsFieldErrors(err)
+			require.True(t, ok, "expected field errors, got: %v", err)
+			require.Len(t, errs, 1)
+			require.Equal(t, test.expectType, errs[0].Type)
+			require.Equal(t, test.expectField, errs[0].Field)
+		})
+	}
+}
+
+func TestManifestUnmarshaling_SyntaxError(t *testing.T) {
+	testCases := map[string]string{
+		"malformed": `{"kind":}`,
+		"truncated": `{"kind":"testSpec"`,
+	}
+
+	for name, tc := range testCases {
+		given := tc
+		t.Run(name, func(t *testing.T) {
+			var got manifest.ResourceManifest
+			err := got.UnmarshalJSON([]byte(given))
+
+			var syntaxErr *json.SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			_, ok := manifest.AsFieldErrors(err)
+			require.False(t, ok, "expected no field errors, got: %v", err)
+		})
+	}
+}
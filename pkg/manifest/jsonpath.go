@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidJSONPath is returned when a JSONPath expression can not be parsed.
+var ErrInvalidJSONPath = errors.New("invalid JSONPath")
+
+// jsonPath is a parsed simple JSONPath expression, such as `.spec.targets[0].host` or `.metadata.labels['app.k8s.io/name']`.
+// Each element is either a string key of an object or an int index of an array.
+type jsonPath []any
+
+// parseJSONPath parses a subset of JSONPath syntax used by printer columns.
+// Supported are: field access `.name`, escaped dots in names `.app\.k8s\.io`, array index `[0]` and quoted keys `['key']`.
+// Expression may optionally be wrapped in curly braces: `{.spec.name}`.
+func parseJSONPath(expr string) (jsonPath, error) {
+	expr = strings.TrimSpace(expr)
+	expr = strings.TrimSuffix(strings.TrimPrefix(expr, "{"), "}")
+	expr = strings.TrimPrefix(expr, "$")
+	if expr == "" || expr == "." {
+		return jsonPath{}, nil
+	}
+
+	var result jsonPath
+	for i := 0; i < len(expr); {
+		switch expr[i] {
+		case '.':
+			var sb strings.Builder
+			i++
+			for ; i < len(expr) && expr[i] != '.' && expr[i] != '['; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				sb.WriteByte(expr[i])
+			}
+			if sb.Len() == 0 {
+				return nil, fmt.Errorf("%w %q: empty field name", ErrInvalidJSONPath, expr)
+			}
+			result = append(result, sb.String())
+		case '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w %q: unterminated '['", ErrInvalidJSONPath, expr)
+			}
+			element := expr[i+1 : i+end]
+			i += end + 1
+
+			if len(element) >= 2 && (element[0] == '\'' || element[0] == '"') && element[len(element)-1] == element[0] {
+				result = append(result, element[1:len(element)-1])
+			} else if index, err := strconv.Atoi(element); err == nil {
+				result = append(result, index)
+			} else {
+				return nil, fmt.Errorf("%w %q: unexpected element %q", ErrInvalidJSONPath, expr, element)
+			}
+		default:
+			return nil, fmt.Errorf("%w %q: unexpected character %q", ErrInvalidJSONPath, expr, expr[i])
+		}
+	}
+
+	return result, nil
+}
+
+// Lookup returns a value found at the path in a generic value, as produced by decoding JSON into `any`.
+func (p jsonPath) Lookup(value any) (any, bool) {
+	for _, element := range p {
+		switch e := element.(type) {
+		case string:
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = obj[e]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := value.([]any)
+			if !ok || e < 0 || e >= len(arr) {
+				return nil, false
+			}
+			value = arr[e]
+		}
+	}
+
+	return value, true
+}
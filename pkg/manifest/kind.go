@@ -12,6 +12,9 @@ type Kind string
 type KindSpec struct {
 	SpecType   reflect.Type
 	StatusType reflect.Type
+
+	// PrinterColumns are additional columns used to display resources of the kind as a table, see [RegisterPrinterColumns].
+	PrinterColumns []PrinterColumn
 }
 
 var (
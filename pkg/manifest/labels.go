@@ -115,18 +115,39 @@ func ValidateLabelValue(key, value string) error {
 	return nil
 }
 
+// Validate checks that all keys and values in the labels set are valid.
+// Returned error, if any, is [FieldErrors] with paths relative to `labels`.
 func (l Labels) Validate() error {
-	errs := ErrorSet{}
-	for key, value := range l {
+	return l.ValidateWithPath(NewPath("labels")).ErrorOrNil()
+}
+
+// ValidateWithPath checks that all keys and values in the labels set are valid, reporting errors for fields relative to the given path.
+func (l Labels) ValidateWithPath(path *FieldPath) FieldErrors {
+	keys := l.Slice()
+	keys.Sort()
+
+	errs := FieldErrors{}
+	for _, key := range keys {
 		if err := ValidateLabelKey(key); err != nil {
-			errs = append(errs, err)
+			errs = append(errs, NewFieldError(validationErrorType(err), path.Key(key), key, err))
 		}
-		if err := ValidateLabelValue(key, value); err != nil {
-			errs = append(errs, err)
+		if err := ValidateLabelValue(key, l[key]); err != nil {
+			errs = append(errs, NewFieldError(validationErrorType(err), path.Key(key), l[key], err))
 		}
 	}
 
-	return errs.ErrorOrNil()
+	return errs
+}
+
+func validationErrorType(err error) FieldErrorType {
+	if errors.Is(err, ErrNameTooLong) || errors.Is(err, ErrLabelValueTooLong) {
+		return FieldErrorTooLong
+	}
+	if errors.Is(err, ErrNameIsEmpty) {
+		return FieldErrorRequired
+	}
+
+	return FieldErrorInvalid
 }
 
 // Format writes string representation of the [SelectorRule] into the provided sb.
@@ -3,8 +3,10 @@ package manifest
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,7 +15,11 @@ import (
 )
 
 // Registry of types that can be used in a manifest spec
-var metaKindRegistry = map[Kind]KindSpec{}
+var (
+	metaKindRegistry = map[Kind]KindSpec{}
+	// Guards metaKindRegistry, as kinds can be registered by plugins concurrently with manifests being decoded
+	metaKindRegistryLock sync.RWMutex
+)
 
 func ExemplarType(spec any) (reflect.Type, error) {
 	if spec == nil {
@@ -45,6 +51,9 @@ func RegisterKind(kind Kind, spec any) error {
 }
 
 func RegisterManifest(kind Kind, spec, status any) error {
+	metaKindRegistryLock.Lock()
+	defer metaKindRegistryLock.Unlock()
+
 	if _, know := metaKindRegistry[kind]; know {
 		return fmt.Errorf("kind %q already registered", kind)
 	}
@@ -86,10 +95,16 @@ func MustRegisterManifest(kind Kind, specType, statusType any) {
 
 // UnregisterKind unregisters previously registered 'kind' value
 func UnregisterKind(kind Kind) {
+	metaKindRegistryLock.Lock()
+	defer metaKindRegistryLock.Unlock()
+
 	delete(metaKindRegistry, kind)
 }
 
 func LookupKind(kind Kind) (result KindSpec, known bool) {
+	metaKindRegistryLock.RLock()
+	defer metaKindRegistryLock.RUnlock()
+
 	result, known = metaKindRegistry[kind]
 	return
 }
@@ -99,7 +114,7 @@ type KindFactory func(kind Kind) (ResourceManifest, error)
 
 // InstanceOf is a default `KindFactory` to create instances of previously registered kinds
 func InstanceOf(kind Kind) (ResourceManifest, error) {
-	kindSpec, known := metaKindRegistry[kind]
+	kindSpec, known := LookupKind(kind)
 	if !known {
 		return ResourceManifest{}, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
 	}
@@ -131,6 +146,9 @@ func KindOf(maybeSpec any) (result Kind, known bool) {
 		t = val.Elem().Type()
 	}
 
+	metaKindRegistryLock.RLock()
+	defer metaKindRegistryLock.RUnlock()
+
 	// Linear scan over map to find key with value equals give: not that terrible when the map is small
 	for kind, kindSpec := range metaKindRegistry {
 		if kindSpec.SpecType == t {
@@ -209,24 +227,23 @@ func (m ObjectMeta) GetVersionedID() VersionedResourceID {
 	}
 }
 
+// Validate checks that object metadata is valid.
+// Returned error, if any, is [FieldErrors] with paths relative to `metadata`.
 func (m ObjectMeta) Validate() error {
-	errs := ErrorSet{}
+	return m.ValidateWithPath(NewPath("metadata")).ErrorOrNil()
+}
+
+// ValidateWithPath checks that object metadata is valid, reporting errors for fields relative to the given path.
+func (m ObjectMeta) ValidateWithPath(path *FieldPath) FieldErrors {
+	errs := FieldErrors{}
 
 	if m.Name != "" {
 		if err := m.Name.ValidateSubdomainName(); err != nil {
-			errs = append(errs, err)
+			errs = append(errs, NewFieldError(validationErrorType(err), path.Child("name"), string(m.Name), err))
 		}
 	} // TODO: Should we allow empty names?
 
-	if err := m.Labels.Validate(); err != nil {
-		if errSet, ok := err.(ErrorSet); ok {
-			errs = append(errs, errSet...)
-		} else {
-			errs = append(errs, err)
-		}
-	}
-
-	return errs.ErrorOrNil()
+	return append(errs, m.Labels.ValidateWithPath(path.Child("labels"))...)
 }
 
 // ResourceManifest is a Custom Resource Definition.
@@ -240,8 +257,24 @@ type ResourceManifest struct {
 	HResponse `json:",inline" yaml:",inline"`
 }
 
-// MarshalJSON implements golang [encoding/json.Marshaler] interface for ResourceManifest
-func (s ResourceManifest) MarshalJSON() ([]byte, error) {
+// UnredactedManifest is a [ResourceManifest] that is marshaled as is, without redacting sensitive fields.
+// It is meant to be used for storage, where the complete value of a resource must be preserved.
+// Never use it to produce API responses or log records.
+type UnredactedManifest ResourceManifest
+
+// Unredacted returns a representation of the manifest that preserves fields marked as sensitive when marshaled.
+func (s ResourceManifest) Unredacted() UnredactedManifest {
+	return UnredactedManifest(s)
+}
+
+// Redacted returns a copy of the manifest with all fields marked as `wyrd:"sensitive"` redacted.
+func (s ResourceManifest) Redacted() ResourceManifest {
+	s.Spec = Redact(s.Spec)
+	s.Status = Redact(s.Status)
+	return s
+}
+
+func (s ResourceManifest) marshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		TypeMeta `json:",inline"`
 		Metadata ObjectMeta `json:"metadata"`
@@ -255,6 +288,37 @@ func (s ResourceManifest) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// MarshalJSON implements golang [encoding/json.Marshaler] interface for ResourceManifest.
+// Fields of spec and status marked as `wyrd:"sensitive"` are redacted, see [ResourceManifest.Unredacted] to preserve them.
+func (s ResourceManifest) MarshalJSON() ([]byte, error) {
+	return s.Redacted().marshalJSON()
+}
+
+// MarshalJSON implements golang [encoding/json.Marshaler] interface, preserving sensitive fields.
+func (s UnredactedManifest) MarshalJSON() ([]byte, error) {
+	return ResourceManifest(s).marshalJSON()
+}
+
+// UnmarshalJSON implements golang [encoding/json.Unmarshaler] interface.
+func (s *UnredactedManifest) UnmarshalJSON(data []byte) error {
+	return (*ResourceManifest)(s).UnmarshalJSON(data)
+}
+
+// String returns a representation of the manifest that is safe to log: sensitive fields are redacted.
+func (s ResourceManifest) String() string {
+	data, err := s.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%v/%v", s.Kind, s.Metadata.Name)
+	}
+
+	return string(data)
+}
+
+// GoString implements [fmt.GoStringer] so that `%#v` formatting does not reveal sensitive fields.
+func (s ResourceManifest) GoString() string {
+	return s.String()
+}
+
 func tryPreserveJSON(data json.RawMessage) any {
 	if len(data) != 0 { // Is there a spec to parse
 		t := make(map[string]any)
@@ -279,12 +343,12 @@ func UnmarshalJSONWithRegister(kind Kind, factory KindFactory, specData json.Raw
 
 	if len(specData) != 0 {
 		if resource.Spec == nil {
-			return resource, fmt.Errorf("manifest has no spec type associated")
+			return resource, FieldErrors{NewFieldError(FieldErrorNotSupported, NewPath("spec"), nil, ErrNoSpecType)}
 		}
 		decoder := json.NewDecoder(bytes.NewReader(specData))
 		decoder.DisallowUnknownFields()
 		if err := decoder.Decode(resource.Spec); err != nil {
-			return resource, fmt.Errorf("failed to decode spec: %w", err)
+			return resource, fmt.Errorf("failed to decode spec: %w", FieldErrors{decodingError(NewPath("spec"), err)})
 		}
 	} else { // No spec to parse
 		resource.Spec = nil
@@ -292,13 +356,13 @@ func UnmarshalJSONWithRegister(kind Kind, factory KindFactory, specData json.Raw
 
 	if len(statusData) != 0 {
 		if resource.Status == nil {
-			return resource, fmt.Errorf("manifest has no status type associated")
+			return resource, FieldErrors{NewFieldError(FieldErrorNotSupported, NewPath("status"), nil, ErrNoStatusType)}
 		}
 
 		decoder := json.NewDecoder(bytes.NewReader(statusData))
 		decoder.DisallowUnknownFields()
 		if err := decoder.Decode(resource.Status); err != nil {
-			return resource, fmt.Errorf("failed to decode status: %w", err)
+			return resource, fmt.Errorf("failed to decode status: %w", FieldErrors{decodingError(NewPath("status"), err)})
 		}
 	} else { // No spec to parse
 		resource.Status = nil
@@ -320,7 +384,12 @@ func (s *ResourceManifest) UnmarshalJSON(data []byte) (err error) {
 	}
 
 	if err := json.Unmarshal(data, &aux); err != nil {
-		return err
+		// Malformed JSON is not an error of a field, so that it is reported as a bad request rather than an invalid manifest
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return err
+		}
+		return FieldErrors{decodingError(nil, err)}
 	}
 
 	*s, err = UnmarshalJSONWithRegister(aux.Kind, InstanceOf, aux.Spec, aux.Status)
@@ -329,8 +398,7 @@ func (s *ResourceManifest) UnmarshalJSON(data []byte) (err error) {
 	return
 }
 
-// MarshalYAML returns a value that can be easily marshaled to yaml representation.
-func (s ResourceManifest) MarshalYAML() (interface{}, error) {
+func (s ResourceManifest) marshalYAML() (interface{}, error) {
 	return struct {
 		TypeMeta `json:",inline" yaml:",inline"`
 		Metadata ObjectMeta `json:"metadata" yaml:"metadata"`
@@ -344,6 +412,17 @@ func (s ResourceManifest) MarshalYAML() (interface{}, error) {
 	}, nil
 }
 
+// MarshalYAML returns a value that can be easily marshaled to yaml representation.
+// Fields of spec and status marked as `wyrd:"sensitive"` are redacted, see [ResourceManifest.Unredacted] to preserve them.
+func (s ResourceManifest) MarshalYAML() (interface{}, error) {
+	return s.Redacted().marshalYAML()
+}
+
+// MarshalYAML returns a value that can be marshaled to yaml representation, preserving sensitive fields.
+func (s UnredactedManifest) MarshalYAML() (interface{}, error) {
+	return ResourceManifest(s).marshalYAML()
+}
+
 // UnmarshalYAML decodes manifest object from YAML representation.
 func (s *ResourceManifest) UnmarshalYAML(n *yaml.Node) (err error) {
 	type S ResourceManifest
@@ -390,12 +469,12 @@ func (s *ResourceManifest) UnmarshalYAML(n *yaml.Node) (err error) {
 
 	if result.Spec != nil {
 		if err := obj.Spec.Decode(result.Spec); err != nil {
-			return fmt.Errorf("failed to decode spec from YML: %w", err)
+			return fmt.Errorf("failed to decode spec from YML: %w", FieldErrors{decodingError(NewPath("spec"), err)})
 		}
 	}
 	if result.Status != nil {
 		if err := obj.Status.Decode(result.Status); err != nil {
-			return fmt.Errorf("failed to decode status from YML: %w", err)
+			return fmt.Errorf("failed to decode status from YML: %w", FieldErrors{decodingError(NewPath("status"), err)})
 		}
 	}
 
@@ -404,3 +483,8 @@ func (s *ResourceManifest) UnmarshalYAML(n *yaml.Node) (err error) {
 
 	return nil
 }
+
+// UnmarshalYAML decodes manifest object from YAML representation.
+func (s *UnredactedManifest) UnmarshalYAML(n *yaml.Node) error {
+	return (*ResourceManifest)(s).UnmarshalYAML(n)
+}
@@ -3,6 +3,7 @@ package manifest
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -13,6 +14,11 @@ var (
 	ErrNilStatus         = fmt.Errorf(".status is nil")
 	ErrSpecTypeInvalid   = fmt.Errorf("invalid manifest .spec type")
 	ErrStatusTypeInvalid = fmt.Errorf("invalid manifest .status type")
+	ErrNoSpecType        = fmt.Errorf("manifest has no spec type associated")
+	ErrNoStatusType      = fmt.Errorf("manifest has no status type associated")
+
+	// ErrVersionConflict is returned when a resource can not be written because its stored version is not the one the writer expected.
+	ErrVersionConflict = fmt.Errorf("resource version conflict")
 )
 
 // VersionedResourceID represents some versioned resources when its required to know not only UUID but exact version of it.
@@ -35,6 +41,16 @@ func (r VersionedResourceID) String() string {
 	return fmt.Sprintf("%v@%d", r.ID, r.Version)
 }
 
+// Revision describes a version of a resource recorded in its revision history.
+type Revision struct {
+	VersionedResourceID `json:",inline" yaml:",inline"`
+
+	// Author of the change that produced the version, if known.
+	Author string `form:"author" json:"author,omitempty" yaml:"author,omitempty" xml:"author,omitempty"`
+	// Timestamp is the time the version was saved.
+	Timestamp time.Time `form:"timestamp" json:"timestamp" yaml:"timestamp" xml:"timestamp"`
+}
+
 type Model interface {
 	GetTypeMetadata() TypeMeta
 	GetMetadata() ObjectMeta
@@ -89,6 +105,12 @@ func ManifestAsResource[SpecType any](newEntry ResourceManifest) (ResourceModel[
 		ObjectMeta: newEntry.Metadata,
 	}
 
+	// Manifests decoded before the kind was registered hold generic spec values
+	newEntry, err := newEntry.Bind()
+	if err != nil {
+		return result, err
+	}
+
 	manifestSpec, exist := LookupKind(newEntry.Kind)
 	if !exist {
 		return result, fmt.Errorf("%w: %q", ErrUnknownKind, newEntry.Kind)
@@ -115,6 +137,12 @@ func ManifestAsStatefulResource[SpecType, StatusType any](newEntry ResourceManif
 		ObjectMeta: newEntry.Metadata,
 	}
 
+	// Manifests decoded before the kind was registered hold generic spec values
+	newEntry, err := newEntry.Bind()
+	if err != nil {
+		return result, err
+	}
+
 	manifestSpec, exist := LookupKind(newEntry.Kind)
 	if !exist {
 		return result, fmt.Errorf("%w: %q", ErrUnknownKind, newEntry.Kind)
@@ -0,0 +1,180 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	// StructTagKey is the name of the struct tag used to annotate fields of a spec with wyrd-specific options.
+	// Multiple options can be specified as a comma separated list, for example: `wyrd:"sensitive"`.
+	StructTagKey = "wyrd"
+
+	// TagOptionSensitive marks a field as sensitive. Values of such fields are redacted when a manifest is marshaled for display.
+	TagOptionSensitive = "sensitive"
+
+	// RedactedPlaceholder is a value used in place of a non-empty string field marked as sensitive.
+	RedactedPlaceholder = "[redacted]"
+)
+
+// HasTagOption returns true if the struct field has given option set in its [StructTagKey] tag.
+func HasTagOption(field reflect.StructField, option string) bool {
+	tag, ok := field.Tag.Lookup(StructTagKey)
+	if !ok {
+		return false
+	}
+
+	for _, o := range strings.Split(tag, ",") {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cache of types known to contain sensitive fields, maps reflect.Type to bool
+var sensitiveTypes sync.Map
+
+func mayHoldSensitive(t reflect.Type) bool {
+	if known, ok := sensitiveTypes.Load(t); ok {
+		return known.(bool)
+	}
+
+	result := scanSensitive(t, map[reflect.Type]bool{})
+	sensitiveTypes.Store(t, result)
+	return result
+}
+
+func scanSensitive(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		// Dynamic type is only known at runtime
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return scanSensitive(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if HasTagOption(field, TagOptionSensitive) || scanSensitive(field.Type, visiting) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Redact returns a copy of the value with all fields tagged as `wyrd:"sensitive"` redacted.
+// Non-empty string fields are replaced with [RedactedPlaceholder], fields of any other type are reset to their zero value.
+// The original value is never modified. Values that contain no sensitive fields are returned as is.
+func Redact(value any) any {
+	if value == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if !mayHoldSensitive(v.Type()) {
+		return value
+	}
+
+	return redactValue(v).Interface()
+}
+
+func redactValue(v reflect.Value) reflect.Value {
+	if !mayHoldSensitive(v.Type()) {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		result := reflect.New(v.Type()).Elem()
+		result.Set(redactValue(v.Elem()))
+		return result
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		result := reflect.New(v.Type().Elem())
+		result.Elem().Set(redactValue(v.Elem()))
+		return result
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		result := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(redactValue(v.Index(i)))
+		}
+		return result
+	case reflect.Array:
+		result := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(redactValue(v.Index(i)))
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		result := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(iter.Key(), redactValue(iter.Value()))
+		}
+		return result
+	case reflect.Struct:
+		t := v.Type()
+		result := reflect.New(t).Elem()
+		result.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			if HasTagOption(field, TagOptionSensitive) {
+				result.Field(i).Set(redactedField(v.Field(i)))
+			} else {
+				result.Field(i).Set(redactValue(v.Field(i)))
+			}
+		}
+		return result
+	}
+
+	return v
+}
+
+func redactedField(v reflect.Value) reflect.Value {
+	if v.IsZero() {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		result := reflect.New(v.Type()).Elem()
+		result.SetString(RedactedPlaceholder)
+		return result
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() == reflect.String {
+			result := reflect.New(v.Type().Elem())
+			result.Elem().SetString(RedactedPlaceholder)
+			return result
+		}
+	}
+
+	return reflect.Zero(v.Type())
+}
@@ -0,0 +1,129 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type credentials struct {
+	User     string `json:"user,omitempty" yaml:"user,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty" wyrd:"sensitive"`
+}
+
+type secretSpec struct {
+	Host   string            `json:"host,omitempty" yaml:"host,omitempty"`
+	Token  string            `json:"token,omitempty" yaml:"token,omitempty" wyrd:"sensitive"`
+	Key    []byte            `json:"key,omitempty" yaml:"key,omitempty" wyrd:"sensitive"`
+	Port   int               `json:"port,omitempty" yaml:"port,omitempty" wyrd:"other,sensitive"`
+	Auth   *credentials      `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Extra  []credentials     `json:"extra,omitempty" yaml:"extra,omitempty"`
+	ByName map[string]any    `json:"byName,omitempty" yaml:"byName,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty" yaml:"meta,omitempty"`
+}
+
+func TestRedact(t *testing.T) {
+	testCases := map[string]struct {
+		given  any
+		expect any
+	}{
+		"nil": {
+			given:  nil,
+			expect: nil,
+		},
+		"no-sensitive-fields": {
+			given:  manifest.Labels{"key": "value"},
+			expect: manifest.Labels{"key": "value"},
+		},
+		"empty-values-preserved": {
+			given:  &secretSpec{Host: "localhost"},
+			expect: &secretSpec{Host: "localhost"},
+		},
+		"flat": {
+			given:  secretSpec{Host: "localhost", Token: "xyz", Key: []byte("key"), Port: 42},
+			expect: secretSpec{Host: "localhost", Token: manifest.RedactedPlaceholder},
+		},
+		"nested": {
+			given: &secretSpec{
+				Auth:   &credentials{User: "root", Password: "pass"},
+				Extra:  []credentials{{User: "1", Password: "2"}},
+				ByName: map[string]any{"admin": credentials{User: "admin", Password: "admin"}},
+			},
+			expect: &secretSpec{
+				Auth:   &credentials{User: "root", Password: manifest.RedactedPlaceholder},
+				Extra:  []credentials{{User: "1", Password: manifest.RedactedPlaceholder}},
+				ByName: map[string]any{"admin": credentials{User: "admin", Password: manifest.RedactedPlaceholder}},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			got := manifest.Redact(test.given)
+			require.Equal(t, test.expect, got)
+		})
+	}
+}
+
+func TestRedact_OriginalUnchanged(t *testing.T) {
+	given := &secretSpec{
+		Token: "xyz",
+		Auth:  &credentials{User: "root", Password: "pass"},
+	}
+
+	_ = manifest.Redact(given)
+	require.Equal(t, "xyz", given.Token)
+	require.Equal(t, "pass", given.Auth.Password)
+}
+
+func TestManifestMarshaling_Redacted(t *testing.T) {
+	testKind := manifest.Kind("secretSpec")
+	require.NoError(t, manifest.RegisterKind(testKind, &secretSpec{}))
+	defer manifest.UnregisterKind(testKind)
+
+	given := manifest.ResourceManifest{
+		TypeMeta: manifest.TypeMeta{Kind: testKind},
+		Metadata: manifest.ObjectMeta{Name: "test"},
+		Spec:     &secretSpec{Host: "localhost", Token: "xyz"},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		got, err := json.Marshal(given)
+		require.NoError(t, err)
+		require.Equal(t, `{"kind":"secretSpec","metadata":{"name":"test"},"spec":{"host":"localhost","token":"[redacted]"}}`, string(got))
+
+		raw, err := json.Marshal(given.Unredacted())
+		require.NoError(t, err)
+		require.Equal(t, `{"kind":"secretSpec","metadata":{"name":"test"},"spec":{"host":"localhost","token":"xyz"}}`, string(raw))
+
+		var restored manifest.UnredactedManifest
+		require.NoError(t, json.Unmarshal(raw, &restored))
+		require.Equal(t, given, manifest.ResourceManifest(restored))
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		got, err := yaml.Marshal(given)
+		require.NoError(t, err)
+		require.NotContains(t, string(got), "xyz")
+		require.Contains(t, string(got), manifest.RedactedPlaceholder)
+
+		raw, err := yaml.Marshal(given.Unredacted())
+		require.NoError(t, err)
+		require.Contains(t, string(raw), "xyz")
+
+		var restored manifest.UnredactedManifest
+		require.NoError(t, yaml.Unmarshal(raw, &restored))
+		require.Equal(t, given, manifest.ResourceManifest(restored))
+	})
+
+	t.Run("fmt", func(t *testing.T) {
+		for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+			require.NotContains(t, fmt.Sprintf(format, given), "xyz", format)
+		}
+	})
+}
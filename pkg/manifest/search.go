@@ -1,18 +1,73 @@
 package manifest
 
-import "time"
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrUnsupportedTimeField is returned when time range of a search query refers to a time field that is not in the allowed list.
+var ErrUnsupportedTimeField = errors.New("time field is not supported")
+
+// TimeField identifies a timestamp of a resource that time range of a [SearchQuery] applies to.
+// Besides well-known values, stores may support custom time fields, such as timestamps in a resource status.
+type TimeField string
+
+const (
+	// TimeFieldCreated refers to [ObjectMeta.CreatedAt] timestamp. This is the default.
+	TimeFieldCreated TimeField = "created"
+	// TimeFieldUpdated refers to [ObjectMeta.UpdatedAt] timestamp.
+	TimeFieldUpdated TimeField = "updated"
+	// TimeFieldDeleted refers to [ObjectMeta.DeletedAt] timestamp. Searching by it implies search of deleted resources.
+	TimeFieldDeleted TimeField = "deleted"
+)
+
+// DefaultTimeFields is a list of time fields that time range of a search query can refer to unless another list is provided.
+var DefaultTimeFields = []TimeField{
+	TimeFieldCreated,
+	TimeFieldUpdated,
+	TimeFieldDeleted,
+}
+
+// Validate checks that the time field is empty, meaning the default, or is in the allowed list. If allowed list is empty, [DefaultTimeFields] is used.
+// Returned error, if any, is [FieldErrors] with the path `timeField`.
+func (f TimeField) Validate(allowed ...TimeField) error {
+	if len(allowed) == 0 {
+		allowed = DefaultTimeFields
+	}
+	if f == "" || slices.Contains(allowed, f) {
+		return nil
+	}
+
+	return FieldErrors{NewFieldError(FieldErrorNotSupported, NewPath("timeField"), string(f), ErrUnsupportedTimeField)}
+}
 
 // SearchQuery represent query object accepted by APIs that implement pagination and label based object selection.
+//
+// Time range is half-open: it includes resources with the timestamp at or after FromTime and strictly before TillTime.
+// Either end of the range can be omitted, leaving the range open-ended.
 type SearchQuery struct {
 	// Selector represents label-based filter to narrow down results.
 	Selector Selector
 
 	// Name is a fuzzy matched name of the resource to search for.
 	Name string `uri:"name" form:"name" json:"name,omitempty" yaml:"name,omitempty" xml:"name"`
-	// FromTime represents start of a time-range when searching for resources with time aspect.
+	// Text is a full-text search query, matched against names, label values and searchable fields of resources.
+	// Every word of the text must match a prefix of a word in the resource. See [TagOptionSearchable].
+	Text string `uri:"q" form:"q" json:"q,omitempty" yaml:"q,omitempty" xml:"q"`
+	// FromTime represents start of a time-range when searching for resources with time aspect. The start is included in the range.
 	FromTime time.Time `uri:"from" form:"from" json:"from,omitempty" yaml:"from,omitempty" xml:"from"`
-	// TillTime represents end of a time-range when searching for resources with time aspect.
+	// TillTime represents end of a time-range when searching for resources with time aspect. The end is not included in the range.
 	TillTime time.Time `uri:"till" form:"till" json:"till,omitempty" yaml:"till,omitempty" xml:"till"`
+	// TimeField selects which timestamp of a resource the time-range applies to. Defaults to [TimeFieldCreated].
+	TimeField TimeField `uri:"timeField" form:"timeField" json:"timeField,omitempty" yaml:"timeField,omitempty" xml:"timeField"`
+
+	// Sort specifies order of results, see [ParseSortSpec] for the syntax.
+	Sort SortSpec `uri:"sort" form:"sort" json:"sort,omitempty" yaml:"sort,omitempty" xml:"sort"`
+
+	// Continue is an opaque token, returned by a store with a previous page of results, to continue keyset pagination from.
+	// When set, Offset is ignored and results follow the last resource of the previous page in the order of Sort.
+	Continue string `uri:"continue" form:"continue" json:"continue,omitempty" yaml:"continue,omitempty" xml:"continue"`
 
 	// Offset is a number of items to skip when paginating a list of results
 	Offset uint `uri:"offset" form:"offset" json:"offset,omitempty" yaml:"offset,omitempty" xml:"offset"`
@@ -24,6 +79,26 @@ type SearchQuery struct {
 func (s SearchQuery) Empty() bool {
 	return s.Limit == 0 && s.Offset == 0 &&
 		s.FromTime.IsZero() && s.TillTime.IsZero() &&
-		s.Name == "" &&
+		s.Name == "" && s.Text == "" && len(s.Sort) == 0 && s.Continue == "" &&
 		(s.Selector == nil || s.Selector.Empty())
 }
+
+// InTimeRange returns true if given time is within the half-open time range of the query: [FromTime, TillTime).
+// Nil time is only in range if the query has no time range.
+func (s SearchQuery) InTimeRange(t *time.Time) bool {
+	if s.FromTime.IsZero() && s.TillTime.IsZero() {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+
+	if !s.FromTime.IsZero() && t.Before(s.FromTime) {
+		return false
+	}
+	if !s.TillTime.IsZero() && !t.Before(s.TillTime) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,40 @@
+package manifest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchQuery_InTimeRange(t *testing.T) {
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	till := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	inside := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	before := from.Add(-time.Second)
+
+	testCases := map[string]struct {
+		query  manifest.SearchQuery
+		given  *time.Time
+		expect bool
+	}{
+		"no-range":           {query: manifest.SearchQuery{}, given: &before, expect: true},
+		"no-range-nil":       {query: manifest.SearchQuery{}, given: nil, expect: true},
+		"nil-with-range":     {query: manifest.SearchQuery{FromTime: from}, given: nil, expect: false},
+		"inside":             {query: manifest.SearchQuery{FromTime: from, TillTime: till}, given: &inside, expect: true},
+		"from-is-inclusive":  {query: manifest.SearchQuery{FromTime: from, TillTime: till}, given: &from, expect: true},
+		"till-is-exclusive":  {query: manifest.SearchQuery{FromTime: from, TillTime: till}, given: &till, expect: false},
+		"before-from":        {query: manifest.SearchQuery{FromTime: from, TillTime: till}, given: &before, expect: false},
+		"open-ended-from":    {query: manifest.SearchQuery{FromTime: from}, given: &till, expect: true},
+		"open-ended-till":    {query: manifest.SearchQuery{TillTime: till}, given: &before, expect: true},
+		"open-ended-till-at": {query: manifest.SearchQuery{TillTime: till}, given: &till, expect: false},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expect, test.query.InTimeRange(test.given))
+		})
+	}
+}
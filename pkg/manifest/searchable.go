@@ -0,0 +1,61 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TagOptionSearchable marks a field of a spec to be included into full-text search index, for example: `wyrd:"searchable"`.
+// Note fields marked as [TagOptionSensitive] are never indexed.
+const TagOptionSearchable = "searchable"
+
+// SearchableText returns text values of all fields of the value marked as [TagOptionSearchable].
+// Values of nested structs, slices and maps of a searchable field are all included.
+func SearchableText(value any) []string {
+	var result []string
+	collectSearchable(reflect.ValueOf(value), false, &result)
+	return result
+}
+
+func collectSearchable(v reflect.Value, searchable bool, result *[]string) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			collectSearchable(v.Elem(), searchable, result)
+		}
+	case reflect.Struct:
+		if searchable {
+			if s, ok := v.Interface().(fmt.Stringer); ok {
+				*result = append(*result, s.String())
+				return
+			}
+		}
+
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || HasTagOption(field, TagOptionSensitive) {
+				continue
+			}
+			collectSearchable(v.Field(i), searchable || HasTagOption(field, TagOptionSearchable), result)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectSearchable(v.Index(i), searchable, result)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			collectSearchable(iter.Value(), searchable, result)
+		}
+	case reflect.String:
+		if searchable && v.Len() > 0 {
+			*result = append(*result, v.String())
+		}
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if searchable {
+			*result = append(*result, fmt.Sprint(v.Interface()))
+		}
+	}
+}
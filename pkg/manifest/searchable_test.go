@@ -0,0 +1,71 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+type searchableAddress struct {
+	City string
+	Zip  int
+}
+
+type searchableSpec struct {
+	Title    string             `wyrd:"searchable"`
+	Count    int                `wyrd:"searchable"`
+	Tags     []string           `wyrd:"searchable"`
+	Address  *searchableAddress `wyrd:"searchable"`
+	Meta     map[string]string  `wyrd:"searchable"`
+	Password string             `wyrd:"searchable,sensitive"`
+	Internal string
+	Nested   struct {
+		Note  string `wyrd:"searchable"`
+		Other string
+	}
+}
+
+func TestSearchableText(t *testing.T) {
+	testCases := map[string]struct {
+		given  any
+		expect []string
+	}{
+		"nil": {
+			given:  nil,
+			expect: nil,
+		},
+		"no-searchable-fields": {
+			given:  credentials{User: "user", Password: "secret"},
+			expect: nil,
+		},
+		"searchable-fields": {
+			given: searchableSpec{
+				Title:    "title",
+				Count:    3,
+				Tags:     []string{"a", "b"},
+				Address:  &searchableAddress{City: "Sydney", Zip: 2000},
+				Meta:     map[string]string{"key": "value"},
+				Password: "secret",
+				Internal: "internal",
+			},
+			expect: []string{"title", "3", "a", "b", "Sydney", "2000", "value"},
+		},
+		"pointer-and-nested-field": {
+			given: func() *searchableSpec {
+				s := &searchableSpec{}
+				s.Nested.Note = "note"
+				s.Nested.Other = "other"
+				return s
+			}(),
+			expect: []string{"0", "note"},
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expect, manifest.SearchableText(test.given))
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidSortSpec is returned when a sort specification string can not be parsed.
+	ErrInvalidSortSpec = errors.New("invalid sort specification")
+
+	// ErrUnsortableField is returned when a sort specification refers to a field that results can not be sorted by.
+	ErrUnsortableField = errors.New("field is not sortable")
+)
+
+// Well-known fields of [ObjectMeta] that search results can be sorted by.
+const (
+	SortFieldUID       = "metadata.uid"
+	SortFieldName      = "metadata.name"
+	SortFieldVersion   = "metadata.version"
+	SortFieldCreatedAt = "metadata.creationTimestamp"
+	SortFieldUpdatedAt = "metadata.updateTimestamp"
+	SortFieldDeletedAt = "metadata.deletionTimestamp"
+
+	// SortFieldLabelsPrefix is the prefix of fields that refer to a label value, such as `metadata.labels.priority`.
+	SortFieldLabelsPrefix = "metadata.labels."
+)
+
+// DefaultSortableFields is a list of fields that results can be sorted by unless a narrower list is provided.
+// Entries ending with `*` allow any field with the given prefix.
+var DefaultSortableFields = []string{
+	SortFieldUID,
+	SortFieldName,
+	SortFieldVersion,
+	SortFieldCreatedAt,
+	SortFieldUpdatedAt,
+	SortFieldDeletedAt,
+	SortFieldLabelsPrefix + "*",
+}
+
+// sortFieldAliases maps short forms of field names, accepted by [ParseSortSpec], to their canonical form.
+var sortFieldAliases = map[string]string{
+	"uid":     SortFieldUID,
+	"name":    SortFieldName,
+	"version": SortFieldVersion,
+}
+
+// SortField is a single key of a [SortSpec].
+type SortField struct {
+	// Field is a dot-separated path of a field to sort by, such as `metadata.name` or `metadata.labels.priority`.
+	Field string `json:"field" yaml:"field"`
+	// Descending reverses the order from ascending to descending.
+	Descending bool `json:"descending,omitempty" yaml:"descending,omitempty"`
+}
+
+// LabelKey returns the label key if the field refers to a label value.
+func (f SortField) LabelKey() (string, bool) {
+	if !strings.HasPrefix(f.Field, SortFieldLabelsPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(f.Field, SortFieldLabelsPrefix), true
+}
+
+// String returns string representation of the sort field, prefixed by `-` if the order is descending.
+func (f SortField) String() string {
+	if f.Descending {
+		return "-" + f.Field
+	}
+	return f.Field
+}
+
+// SortSpec is an ordered list of fields to sort results by. Results are ordered by the first field, with ties broken by the following ones.
+type SortSpec []SortField
+
+// ParseSortSpec parses a comma-separated list of fields, each optionally prefixed by `-` for descending or `+` for ascending order.
+// For example: `-metadata.updateTimestamp,name,labels.priority`.
+// Short forms `uid`, `name`, `version` and `labels.<key>` are accepted and normalized to `metadata.` paths.
+func ParseSortSpec(value string) (SortSpec, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, ",")
+	result := make(SortSpec, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+
+		var field SortField
+		if strings.HasPrefix(part, "-") {
+			field.Descending = true
+			part = part[1:]
+		} else {
+			part = strings.TrimPrefix(part, "+")
+		}
+
+		if part == "" {
+			return nil, fmt.Errorf("%w %q: empty field name", ErrInvalidSortSpec, value)
+		}
+
+		if canonical, ok := sortFieldAliases[part]; ok {
+			part = canonical
+		} else if strings.HasPrefix(part, "labels.") {
+			part = "metadata." + part
+		}
+		field.Field = part
+
+		if key, ok := field.LabelKey(); ok {
+			if err := ValidateLabelKey(key); err != nil {
+				return nil, fmt.Errorf("%w %q: %w", ErrInvalidSortSpec, value, err)
+			}
+		}
+
+		result = append(result, field)
+	}
+
+	return result, nil
+}
+
+// String returns comma-separated representation of the sort spec that can be parsed by [ParseSortSpec].
+func (s SortSpec) String() string {
+	fields := make([]string, 0, len(s))
+	for _, f := range s {
+		fields = append(fields, f.String())
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// MarshalText implements [encoding.TextMarshaler] interface.
+func (s SortSpec) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler] interface.
+func (s *SortSpec) UnmarshalText(data []byte) error {
+	spec, err := ParseSortSpec(string(data))
+	if err != nil {
+		return err
+	}
+
+	*s = spec
+	return nil
+}
+
+// Validate checks that every field of the sort spec is in the allowed list. If allowed list is empty, [DefaultSortableFields] is used.
+// Entries of the allowed list ending with `*` allow any field with the given prefix.
+// Returned error, if any, is [FieldErrors] with paths relative to `sort`.
+func (s SortSpec) Validate(allowed ...string) error {
+	if len(allowed) == 0 {
+		allowed = DefaultSortableFields
+	}
+
+	path := NewPath("sort")
+	errs := FieldErrors{}
+	for i, f := range s {
+		if !sortFieldAllowed(f.Field, allowed) {
+			errs = append(errs, NewFieldError(FieldErrorNotSupported, path.Index(i), f.Field, ErrUnsortableField))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func sortFieldAllowed(field string, allowed []string) bool {
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(field, prefix) && len(field) > len(prefix) {
+				return true
+			}
+		} else if a == field {
+			return true
+		}
+	}
+
+	return false
+}
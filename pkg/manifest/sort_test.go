@@ -0,0 +1,116 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSortSpec(t *testing.T) {
+	testCases := map[string]struct {
+		given       string
+		expect      manifest.SortSpec
+		expectError error
+	}{
+		"empty": {
+			given:  "",
+			expect: nil,
+		},
+		"single": {
+			given:  "metadata.name",
+			expect: manifest.SortSpec{{Field: manifest.SortFieldName}},
+		},
+		"multi-key-with-aliases": {
+			given: "-metadata.updateTimestamp,name,labels.priority",
+			expect: manifest.SortSpec{
+				{Field: manifest.SortFieldUpdatedAt, Descending: true},
+				{Field: manifest.SortFieldName},
+				{Field: "metadata.labels.priority"},
+			},
+		},
+		"explicit-ascending": {
+			given:  "+version",
+			expect: manifest.SortSpec{{Field: manifest.SortFieldVersion}},
+		},
+		"label-with-prefix": {
+			given:  "-labels.app.k8s.io/name",
+			expect: manifest.SortSpec{{Field: "metadata.labels.app.k8s.io/name", Descending: true}},
+		},
+		"empty-field": {
+			given:       "name,,version",
+			expectError: manifest.ErrInvalidSortSpec,
+		},
+		"bare-minus": {
+			given:       "-",
+			expectError: manifest.ErrInvalidSortSpec,
+		},
+		"invalid-label-key": {
+			given:       "labels.bad'key",
+			expectError: manifest.ErrInvalidSortSpec,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := manifest.ParseSortSpec(test.given)
+			if test.expectError != nil {
+				require.ErrorIs(t, err, test.expectError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expect, got)
+
+			reparsed, err := manifest.ParseSortSpec(got.String())
+			require.NoError(t, err)
+			require.Equal(t, got, reparsed)
+		})
+	}
+}
+
+func TestSortSpec_Validate(t *testing.T) {
+	testCases := map[string]struct {
+		given       manifest.SortSpec
+		allowed     []string
+		expectError bool
+	}{
+		"default-allowlist": {
+			given: manifest.SortSpec{{Field: manifest.SortFieldCreatedAt}, {Field: "metadata.labels.priority"}},
+		},
+		"default-allowlist-rejects-spec": {
+			given:       manifest.SortSpec{{Field: "spec.value"}},
+			expectError: true,
+		},
+		"custom-allowlist": {
+			given:   manifest.SortSpec{{Field: "spec.value"}},
+			allowed: []string{"spec.value"},
+		},
+		"prefix-requires-key": {
+			given:       manifest.SortSpec{{Field: "metadata.labels."}},
+			expectError: true,
+		},
+		"narrow-allowlist": {
+			given:       manifest.SortSpec{{Field: manifest.SortFieldName}, {Field: manifest.SortFieldVersion}},
+			allowed:     []string{manifest.SortFieldName},
+			expectError: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			err := test.given.Validate(test.allowed...)
+			if !test.expectError {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, manifest.ErrUnsortableField)
+			fieldErrors, ok := manifest.AsFieldErrors(err)
+			require.True(t, ok)
+			require.Equal(t, manifest.FieldErrorNotSupported, fieldErrors[0].Type)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// KindTable is the [Kind] of the [Table] object.
+const KindTable Kind = "Table"
+
+// ColumnType defines how values of a printer column are interpreted and formatted.
+type ColumnType string
+
+const (
+	ColumnTypeString  ColumnType = "string"
+	ColumnTypeInteger ColumnType = "integer"
+	ColumnTypeNumber  ColumnType = "number"
+	ColumnTypeBoolean ColumnType = "boolean"
+	// ColumnTypeDate columns hold RFC3339 timestamps and are displayed as age relative to the current time.
+	ColumnTypeDate ColumnType = "date"
+)
+
+// PrinterColumn defines a column of a table representation of resources of a kind.
+// It is modeled after Kubernetes CRD `additionalPrinterColumns`.
+type PrinterColumn struct {
+	// Name is a human readable name of the column.
+	Name string `json:"name" yaml:"name"`
+	// Type of the column values, see [ColumnType].
+	Type ColumnType `json:"type" yaml:"type"`
+	// JSONPath is a simple JSONPath expression evaluated against the manifest to produce the value of the column, for example `.spec.host`.
+	JSONPath string `json:"jsonPath" yaml:"jsonPath"`
+	// Description is a human readable description of the column.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Priority of the column. Columns with priority greater than 0 are only shown in a wide view.
+	Priority int32 `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+var (
+	// NameColumn is a default printer column displaying name of a resource.
+	NameColumn = PrinterColumn{Name: "Name", Type: ColumnTypeString, JSONPath: ".metadata.name", Description: "Name of the resource"}
+	// AgeColumn is a default printer column displaying time since a resource was created.
+	AgeColumn = PrinterColumn{Name: "Age", Type: ColumnTypeDate, JSONPath: ".metadata.creationTimestamp", Description: "Time since the resource was created"}
+)
+
+// RegisterPrinterColumns associates printer columns with a previously registered kind.
+// Columns are displayed in between the default [NameColumn] and [AgeColumn]. Calling it again replaces previously registered columns.
+func RegisterPrinterColumns(kind Kind, columns ...PrinterColumn) error {
+	for _, c := range columns {
+		if _, err := parseJSONPath(c.JSONPath); err != nil {
+			return fmt.Errorf("printer column %q: %w", c.Name, err)
+		}
+	}
+
+	metaKindRegistryLock.Lock()
+	defer metaKindRegistryLock.Unlock()
+
+	kindSpec, known := metaKindRegistry[kind]
+	if !known {
+		return fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+
+	kindSpec.PrinterColumns = columns
+	metaKindRegistry[kind] = kindSpec
+	return nil
+}
+
+// MustRegisterPrinterColumns calls [RegisterPrinterColumns] and panics on error.
+func MustRegisterPrinterColumns(kind Kind, columns ...PrinterColumn) {
+	if err := RegisterPrinterColumns(kind, columns...); err != nil {
+		panic(err)
+	}
+}
+
+// PrinterColumnsOf returns a complete list of printer columns to display resources of the given kind.
+func PrinterColumnsOf(kind Kind) []PrinterColumn {
+	kindSpec, _ := LookupKind(kind)
+
+	result := make([]PrinterColumn, 0, len(kindSpec.PrinterColumns)+2)
+	result = append(result, NameColumn)
+	result = append(result, kindSpec.PrinterColumns...)
+	return append(result, AgeColumn)
+}
+
+// TableColumnDefinition describes a column of a [Table].
+type TableColumnDefinition struct {
+	Name        string     `json:"name" yaml:"name" xml:"name"`
+	Type        ColumnType `json:"type" yaml:"type" xml:"type"`
+	Description string     `json:"description,omitempty" yaml:"description,omitempty" xml:"description,omitempty"`
+	Priority    int32      `json:"priority,omitempty" yaml:"priority,omitempty" xml:"priority,omitempty"`
+}
+
+// TableRow is a single row of a [Table], one cell per column. Cells of missing values are nil.
+type TableRow struct {
+	Cells []any `json:"cells" yaml:"cells" xml:"cells"`
+}
+
+// Table is a tabular representation of a collection of resources.
+type Table struct {
+	TypeMeta          `json:",inline" yaml:",inline"`
+	ColumnDefinitions []TableColumnDefinition `json:"columnDefinitions" yaml:"columnDefinitions" xml:"columnDefinitions"`
+	Rows              []TableRow              `json:"rows" yaml:"rows" xml:"rows"`
+}
+
+// NewTable returns a [Table] of the given manifests using columns registered for their kind.
+// If manifests are of different kinds, only default columns are used.
+func NewTable(manifests ...ResourceManifest) (Table, error) {
+	var kind Kind
+	for i, m := range manifests {
+		if i == 0 {
+			kind = m.Kind
+		} else if kind != m.Kind {
+			kind = ""
+			break
+		}
+	}
+
+	columns := []PrinterColumn{NameColumn, AgeColumn}
+	if kind != "" {
+		columns = PrinterColumnsOf(kind)
+	}
+
+	return NewTableWithColumns(columns, manifests...)
+}
+
+// NewTableWithColumns returns a [Table] of the given manifests with given columns.
+// Note values are taken from manifests with sensitive fields redacted.
+func NewTableWithColumns(columns []PrinterColumn, manifests ...ResourceManifest) (Table, error) {
+	paths := make([]jsonPath, 0, len(columns))
+	result := Table{
+		TypeMeta:          TypeMeta{Kind: KindTable},
+		ColumnDefinitions: make([]TableColumnDefinition, 0, len(columns)),
+		Rows:              make([]TableRow, 0, len(manifests)),
+	}
+	for _, c := range columns {
+		path, err := parseJSONPath(c.JSONPath)
+		if err != nil {
+			return result, fmt.Errorf("printer column %q: %w", c.Name, err)
+		}
+
+		paths = append(paths, path)
+		result.ColumnDefinitions = append(result.ColumnDefinitions, TableColumnDefinition{
+			Name:        c.Name,
+			Type:        c.Type,
+			Description: c.Description,
+			Priority:    c.Priority,
+		})
+	}
+
+	for _, m := range manifests {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return result, fmt.Errorf("failed to marshal manifest %q: %w", m.Metadata.Name, err)
+		}
+		// Numbers are decoded as written, as float64 would format large ones in exponent notation, such as 1e+06
+		var obj any
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&obj); err != nil {
+			return result, fmt.Errorf("failed to unmarshal manifest %q: %w", m.Metadata.Name, err)
+		}
+
+		row := TableRow{Cells: make([]any, 0, len(paths))}
+		for _, path := range paths {
+			value, _ := path.Lookup(obj)
+			row.Cells = append(row.Cells, value)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result, nil
+}
+
+// WriteText renders the table as aligned text columns into w.
+// Columns with priority greater than 0 are only rendered if wide is true.
+func (t Table) WriteText(w io.Writer, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+
+	visible := make([]int, 0, len(t.ColumnDefinitions))
+	headers := make([]string, 0, len(t.ColumnDefinitions))
+	for i, c := range t.ColumnDefinitions {
+		if c.Priority > 0 && !wide {
+			continue
+		}
+		visible = append(visible, i)
+		headers = append(headers, strings.ToUpper(c.Name))
+	}
+
+	if _, err := fmt.Fprintln(tw, strings.Join(headers, "\t")); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, row := range t.Rows {
+		cells := make([]string, 0, len(visible))
+		for _, i := range visible {
+			var value any
+			if i < len(row.Cells) {
+				value = row.Cells[i]
+			}
+			cells = append(cells, formatCell(t.ColumnDefinitions[i].Type, value, now))
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(cells, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+// String returns text representation of the table with default columns.
+func (t Table) String() string {
+	var sb strings.Builder
+	if err := t.WriteText(&sb, false); err != nil {
+		return fmt.Sprintf("<table: %v>", err)
+	}
+
+	return sb.String()
+}
+
+func formatCell(columnType ColumnType, value any, now time.Time) string {
+	if value == nil {
+		return "<none>"
+	}
+
+	switch v := value.(type) {
+	case string:
+		if columnType == ColumnTypeDate {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return HumanDuration(now.Sub(t))
+			}
+		}
+		return v
+	case float64:
+		// Numbers of tables decoded from JSON
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// HumanDuration returns a short, human readable representation of a duration, such as `45s`, `5m`, `3h` or `12d`.
+func HumanDuration(d time.Duration) string {
+	if d < 0 {
+		return "<invalid>"
+	}
+
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	default:
+		return fmt.Sprintf("%dy", int(d.Hours()/24/365))
+	}
+}
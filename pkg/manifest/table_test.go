@@ -0,0 +1,123 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+type tableSpec struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port,omitempty"`
+	Password string   `json:"password,omitempty" wyrd:"sensitive"`
+	Targets  []string `json:"targets,omitempty"`
+}
+
+func TestRegisterPrinterColumns(t *testing.T) {
+	testKind := manifest.Kind("tableSpec")
+
+	require.ErrorIs(t, manifest.RegisterPrinterColumns(testKind), manifest.ErrUnknownKind)
+
+	require.NoError(t, manifest.RegisterKind(testKind, &tableSpec{}))
+	defer manifest.UnregisterKind(testKind)
+
+	require.ErrorIs(t, manifest.RegisterPrinterColumns(testKind, manifest.PrinterColumn{Name: "Bad", JSONPath: ".spec[x"}), manifest.ErrInvalidJSONPath)
+
+	host := manifest.PrinterColumn{Name: "Host", Type: manifest.ColumnTypeString, JSONPath: ".spec.host"}
+	require.NoError(t, manifest.RegisterPrinterColumns(testKind, host))
+	require.Equal(t, []manifest.PrinterColumn{manifest.NameColumn, host, manifest.AgeColumn}, manifest.PrinterColumnsOf(testKind))
+}
+
+func TestNewTable(t *testing.T) {
+	testKind := manifest.Kind("tableSpec")
+	require.NoError(t, manifest.RegisterKind(testKind, &tableSpec{}))
+	defer manifest.UnregisterKind(testKind)
+
+	require.NoError(t, manifest.RegisterPrinterColumns(testKind,
+		manifest.PrinterColumn{Name: "Host", Type: manifest.ColumnTypeString, JSONPath: ".spec.host"},
+		manifest.PrinterColumn{Name: "Port", Type: manifest.ColumnTypeInteger, JSONPath: "{.spec.port}", Priority: 1},
+		manifest.PrinterColumn{Name: "Password", Type: manifest.ColumnTypeString, JSONPath: ".spec.password", Priority: 1},
+		manifest.PrinterColumn{Name: "Primary", Type: manifest.ColumnTypeString, JSONPath: ".spec.targets[0]", Priority: 1},
+		manifest.PrinterColumn{Name: "App", Type: manifest.ColumnTypeString, JSONPath: ".metadata.labels['app.k8s.io/name']"},
+		manifest.PrinterColumn{Name: "Env", Type: manifest.ColumnTypeString, JSONPath: `.metadata.labels.env\.name`},
+	))
+
+	created := time.Now().Add(-5 * time.Minute)
+	given := []manifest.ResourceManifest{
+		{
+			TypeMeta: manifest.TypeMeta{Kind: testKind},
+			Metadata: manifest.ObjectMeta{
+				Name:      "first",
+				Labels:    manifest.Labels{"app.k8s.io/name": "web", "env.name": "prod"},
+				CreatedAt: &created,
+			},
+			Spec: &tableSpec{Host: "localhost", Port: 1000000, Password: "xyz", Targets: []string{"a", "b"}},
+		},
+		{
+			TypeMeta: manifest.TypeMeta{Kind: testKind},
+			Metadata: manifest.ObjectMeta{Name: "second"},
+			Spec:     &tableSpec{Host: "remote"},
+		},
+	}
+
+	got, err := manifest.NewTable(given...)
+	require.NoError(t, err)
+	require.Equal(t, manifest.KindTable, got.Kind)
+	require.Len(t, got.ColumnDefinitions, 8)
+	require.Len(t, got.Rows, 2)
+	require.Equal(t, []any{"first", "localhost", json.Number("1000000"), manifest.RedactedPlaceholder, "a", "web", "prod", created.Format(time.RFC3339Nano)}, got.Rows[0].Cells)
+	require.Equal(t, []any{"second", "remote", nil, nil, nil, nil, nil, nil}, got.Rows[1].Cells)
+
+	lines := strings.Split(strings.TrimSpace(got.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, []string{"NAME", "HOST", "APP", "ENV", "AGE"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{"first", "localhost", "web", "prod", "5m"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{"second", "remote", "<none>", "<none>", "<none>"}, strings.Fields(lines[2]))
+
+	var wide strings.Builder
+	require.NoError(t, got.WriteText(&wide, true))
+	require.Contains(t, wide.String(), "PASSWORD")
+	require.Contains(t, wide.String(), " 1000000 ")
+	require.NotContains(t, wide.String(), "xyz")
+}
+
+func TestNewTable_MixedKinds(t *testing.T) {
+	got, err := manifest.NewTable(
+		manifest.ResourceManifest{TypeMeta: manifest.TypeMeta{Kind: "a"}, Metadata: manifest.ObjectMeta{Name: "x"}},
+		manifest.ResourceManifest{TypeMeta: manifest.TypeMeta{Kind: "b"}, Metadata: manifest.ObjectMeta{Name: "y"}},
+	)
+	require.NoError(t, err)
+	require.Len(t, got.ColumnDefinitions, 2)
+	require.Equal(t, []any{"x", nil}, got.Rows[0].Cells)
+}
+
+func TestTable_WriteTextDecoded(t *testing.T) {
+	var got manifest.Table
+	require.NoError(t, json.Unmarshal([]byte(`{"kind":"Table","columnDefinitions":[{"name":"Name","type":"string"},{"name":"Port","type":"integer"}],"rows":[{"cells":["first",1000000]}]}`), &got))
+	require.Equal(t, []string{"first", "1000000"}, strings.Fields(strings.Split(strings.TrimSpace(got.String()), "\n")[1]))
+}
+
+func TestHumanDuration(t *testing.T) {
+	testCases := map[string]struct {
+		given  time.Duration
+		expect string
+	}{
+		"negative": {given: -time.Second, expect: "<invalid>"},
+		"seconds":  {given: 45 * time.Second, expect: "45s"},
+		"minutes":  {given: 5*time.Minute + 3*time.Second, expect: "5m"},
+		"hours":    {given: 30 * time.Hour, expect: "30h"},
+		"days":     {given: 72 * time.Hour, expect: "3d"},
+		"years":    {given: 800 * 24 * time.Hour, expect: "2y"},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expect, manifest.HumanDuration(test.given))
+		})
+	}
+}
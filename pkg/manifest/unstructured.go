@@ -0,0 +1,138 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Unstructured is a generic representation of a spec or status of a manifest which kind is not known.
+type Unstructured = map[string]any
+
+// isUnstructured returns true if the value is a generic representation of a spec that is produced when decoding manifests of unknown kinds.
+func isUnstructured(value any) bool {
+	switch value.(type) {
+	case Unstructured, json.RawMessage, []byte:
+		return true
+	}
+	return false
+}
+
+// ToUnstructured converts a typed value into its generic [Unstructured] representation.
+// Sensitive fields are preserved.
+func ToUnstructured(value any) (Unstructured, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if u, ok := value.(Unstructured); ok {
+		return u, nil
+	}
+
+	data, err := toJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Unstructured
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FromUnstructured decodes a generic representation of a value into a typed value pointed to by dest.
+// Unknown fields are not permitted and result in an error.
+func FromUnstructured(value any, dest any) error {
+	data, err := toJSON(value)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(dest)
+}
+
+func toJSON(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case json.RawMessage:
+		return v, nil
+	case []byte:
+		return v, nil
+	}
+
+	return json.Marshal(value)
+}
+
+// IsUnstructured returns true if spec or status of the manifest is held in a generic form, rather than typed value.
+// This is the case for manifests decoded before its kind has been registered.
+func (s ResourceManifest) IsUnstructured() bool {
+	return isUnstructured(s.Spec) || isUnstructured(s.Status)
+}
+
+// Bind returns a copy of the manifest where generic spec and status values are converted into typed values of its registered kind.
+// It is used to bind manifests decoded before its kind has been registered. Already typed manifests are returned as is.
+// An error wrapping [ErrUnknownKind] is returned if the kind of the manifest is still not registered.
+func (s ResourceManifest) Bind() (ResourceManifest, error) {
+	if !s.IsUnstructured() {
+		return s, nil
+	}
+
+	typed, err := InstanceOf(s.Kind)
+	if err != nil {
+		return s, err
+	}
+
+	result := s
+	if result.Spec, err = bindValue(NewPath("spec"), s.Spec, typed.Spec, ErrNoSpecType); err != nil {
+		return s, err
+	}
+	if result.Status, err = bindValue(NewPath("status"), s.Status, typed.Status, ErrNoStatusType); err != nil {
+		return s, err
+	}
+
+	return result, nil
+}
+
+func bindValue(path *FieldPath, value, typed any, errNoType error) (any, error) {
+	if !isUnstructured(value) {
+		return value, nil
+	}
+
+	if typed == nil {
+		return nil, FieldErrors{NewFieldError(FieldErrorNotSupported, path, nil, errNoType)}
+	}
+
+	if err := FromUnstructured(value, typed); err != nil {
+		return nil, fmt.Errorf("failed to bind %v: %w", path, FieldErrors{decodingError(path, err)})
+	}
+
+	return typed, nil
+}
+
+// Unstructured returns a copy of the manifest where spec and status are converted into generic [Unstructured] values.
+// This is the reverse of [ResourceManifest.Bind].
+func (s ResourceManifest) Unstructured() (ResourceManifest, error) {
+	spec, err := ToUnstructured(s.Spec)
+	if err != nil {
+		return s, fmt.Errorf("failed to convert spec: %w", err)
+	}
+	status, err := ToUnstructured(s.Status)
+	if err != nil {
+		return s, fmt.Errorf("failed to convert status: %w", err)
+	}
+
+	result := s
+	result.Spec = nil
+	result.Status = nil
+	// Note: assign only non-nil values to avoid typed nil in the interface
+	if spec != nil {
+		result.Spec = spec
+	}
+	if status != nil {
+		result.Status = status
+	}
+
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sre-norns/wyrd/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type lateSpec struct {
+	Value int    `json:"value" yaml:"value"`
+	Token string `json:"token,omitempty" yaml:"token,omitempty" wyrd:"sensitive"`
+}
+
+type lateStatus struct {
+	Ready bool `json:"ready" yaml:"ready"`
+}
+
+func TestManifest_LateBinding(t *testing.T) {
+	testKind := manifest.Kind("lateSpec")
+
+	var fromJSON, fromYAML manifest.ResourceManifest
+	require.NoError(t, json.Unmarshal([]byte(`{"kind":"lateSpec","metadata":{"name":"late"},"spec":{"value":42,"token":"xyz"},"status":{"ready":true}}`), &fromJSON))
+	require.NoError(t, yaml.Unmarshal([]byte("kind: lateSpec\nmetadata:\n  name: late\nspec:\n  value: 42\n  token: xyz\nstatus:\n  ready: true\n"), &fromYAML))
+
+	for name, given := range map[string]manifest.ResourceManifest{"json": fromJSON, "yaml": fromYAML} {
+		t.Run(name, func(t *testing.T) {
+			require.True(t, given.IsUnstructured())
+
+			_, err := given.Bind()
+			require.ErrorIs(t, err, manifest.ErrUnknownKind)
+			_, err = manifest.ManifestAsStatefulResource[lateSpec, lateStatus](given)
+			require.ErrorIs(t, err, manifest.ErrUnknownKind)
+
+			require.NoError(t, manifest.RegisterManifest(testKind, &lateSpec{}, &lateStatus{}))
+			defer manifest.UnregisterKind(testKind)
+
+			got, err := given.Bind()
+			require.NoError(t, err)
+			require.False(t, got.IsUnstructured())
+			require.Equal(t, &lateSpec{Value: 42, Token: "xyz"}, got.Spec)
+			require.Equal(t, &lateStatus{Ready: true}, got.Status)
+
+			resource, err := manifest.ManifestAsStatefulResource[lateSpec, lateStatus](given)
+			require.NoError(t, err)
+			require.Equal(t, lateSpec{Value: 42, Token: "xyz"}, resource.Spec)
+			require.Equal(t, lateStatus{Ready: true}, resource.Status)
+		})
+	}
+}
+
+func TestManifest_BindErrors(t *testing.T) {
+	testKind := manifest.Kind("lateSpec")
+	require.NoError(t, manifest.RegisterKind(testKind, &lateSpec{}))
+	defer manifest.UnregisterKind(testKind)
+
+	testCases := map[string]struct {
+		given       manifest.ResourceManifest
+		expectField string
+	}{
+		"unknown-field": {
+			given: manifest.ResourceManifest{
+				TypeMeta: manifest.TypeMeta{Kind: testKind},
+				Spec:     map[string]any{"other": 1},
+			},
+			expectField: "spec.other",
+		},
+		"no-status-type": {
+			given: manifest.ResourceManifest{
+				TypeMeta: manifest.TypeMeta{Kind: testKind},
+				Status:   map[string]any{"ready": true},
+			},
+			expectField: "status",
+		},
+	}
+
+	for name, tc := range testCases {
+		test := tc
+		t.Run(name, func(t *testing.T) {
+			_, err := test.given.Bind()
+			errs, ok := manifest.AsFieldErrors(err)
+			require.True(t, ok, "expected field errors, got %v", err)
+			require.Equal(t, test.expectField, errs[0].Field)
+		})
+	}
+}
+
+func TestManifest_Unstructured(t *testing.T) {
+	testKind := manifest.Kind("lateSpec")
+	require.NoError(t, manifest.RegisterKind(testKind, &lateSpec{}))
+	defer manifest.UnregisterKind(testKind)
+
+	given := manifest.ResourceManifest{
+		TypeMeta: manifest.TypeMeta{Kind: testKind},
+		Metadata: manifest.ObjectMeta{Name: "typed"},
+		Spec:     &lateSpec{Value: 7, Token: "secret"},
+	}
+
+	got, err := given.Unstructured()
+	require.NoError(t, err)
+	require.True(t, got.IsUnstructured())
+	require.Equal(t, manifest.Unstructured{"value": float64(7), "token": "secret"}, got.Spec)
+	require.Nil(t, got.Status)
+
+	back, err := got.Bind()
+	require.NoError(t, err)
+	require.Equal(t, given, back)
+}
@@ -10,6 +10,19 @@ import (
 	"github.com/sre-norns/wyrd/pkg/bark"
 )
 
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey returns a context with the key, sent by [HTTPCaller] with the webhook call, so that the receiver can discard duplicate calls.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+// IdempotencyKey returns the key set by [WithIdempotencyKey], if any.
+func IdempotencyKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key, ok && key != ""
+}
+
 type Caller interface {
 	Post(ctx context.Context, hook Webhook, event EventPayload) error
 }
@@ -41,6 +54,9 @@ func (h *HTTPCaller) Post(ctx context.Context, hook Webhook, event EventPayload)
 		return fmt.Errorf("failed to create a new POST request: %w", err)
 	}
 	req.Header.Set(bark.HTTPHeaderContentType, bark.MimeTypeJSON)
+	if key, ok := IdempotencyKey(ctx); ok {
+		req.Header.Set(bark.HTTPHeaderIdempotencyKey, key)
+	}
 
 	resp, err := h.client.Do(req)
 	if err != nil {
@@ -32,7 +32,7 @@ type ResourceDiff struct {
 }
 
 type EventPayload struct {
-	// TODO: Capture who changed the resources
+	// Principle is who changed the resources, such as the principal recorded in the audit log, see dbstore.WithPrincipal.
 	Principle any `json:"who,omitempty" yaml:"who,omitempty" xml:"who,omitempty"`
 
 	// List of newly created resources